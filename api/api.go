@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"sync"
 	"time"
@@ -92,6 +93,12 @@ type API struct {
 	onExit           func() error
 	onRebind         func() error
 	onPowerMode      func(PowerModeRequest) error
+	onDNSStale       func() (any, error)
+	onClientHistory  func(clientIP netip.Addr, n int) (any, error)
+	onStats          func() (any, error)
+	onStatsReset     func() error
+	onOverlapCheck   func() (any, error)
+	onQueryStream    http.HandlerFunc
 
 	statusMu     sync.RWMutex
 	peerStatuses map[int]*PeerStatus
@@ -153,6 +160,36 @@ func (s *API) SetHandlers(
 	s.onPowerMode = onPowerMode
 }
 
+// SetDNSStaleHandler sets the callback used by /dns/stale to report stale DNS state
+func (s *API) SetDNSStaleHandler(onDNSStale func() (any, error)) {
+	s.onDNSStale = onDNSStale
+}
+
+// SetClientHistoryHandler sets the callback used by /clients/{ip}/history to report
+// the recent DNS queries of a client
+func (s *API) SetClientHistoryHandler(onClientHistory func(clientIP netip.Addr, n int) (any, error)) {
+	s.onClientHistory = onClientHistory
+}
+
+// SetStatsHandlers sets the callbacks used by /stats to report the DNS proxy counters
+// and by /stats/reset to zero them
+func (s *API) SetStatsHandlers(onStats func() (any, error), onStatsReset func() error) {
+	s.onStats = onStats
+	s.onStatsReset = onStatsReset
+}
+
+// SetOverlapCheckHandler sets the callback used by /check/overlaps to report wildcard
+// patterns that match the same domains
+func (s *API) SetOverlapCheckHandler(onOverlapCheck func() (any, error)) {
+	s.onOverlapCheck = onOverlapCheck
+}
+
+// SetQueryStreamHandler sets the WebSocket handler used by /ws/queries to stream DNS
+// queries as they are resolved
+func (s *API) SetQueryStreamHandler(onQueryStream http.HandlerFunc) {
+	s.onQueryStream = onQueryStream
+}
+
 // Start starts the HTTP server
 func (s *API) Start() error {
 	if s.socketPath == "" && s.addr == "" {
@@ -169,6 +206,12 @@ func (s *API) Start() error {
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/rebind", s.handleRebind)
 	mux.HandleFunc("/power-mode", s.handlePowerMode)
+	mux.HandleFunc("/dns/stale", s.handleDNSStale)
+	mux.HandleFunc("/clients/{ip}/history", s.handleClientHistory)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/stats/reset", s.handleStatsReset)
+	mux.HandleFunc("/check/overlaps", s.handleOverlapCheck)
+	mux.HandleFunc("/ws/queries", s.handleQueryStream)
 
 	s.server = &http.Server{
 		Handler: mux,
@@ -673,3 +716,151 @@ func (s *API) handlePowerMode(w http.ResponseWriter, r *http.Request) {
 		"status": fmt.Sprintf("power mode changed to %s successfully", req.Mode),
 	})
 }
+
+// handleDNSStale handles the /dns/stale endpoint
+// This reports DNS configuration left by a previous session without removing it
+func (s *API) handleDNSStale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.onDNSStale == nil {
+		http.Error(w, "DNS stale state handler not configured", http.StatusNotImplemented)
+		return
+	}
+
+	entries, err := s.onDNSStale()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to inspect DNS state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// handleClientHistory handles the /clients/{ip}/history endpoint
+// The optional n query parameter limits the response to the last n queries
+func (s *API) handleClientHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.onClientHistory == nil {
+		http.Error(w, "Client history handler not configured", http.StatusNotImplemented)
+		return
+	}
+
+	clientIP, err := netip.ParseAddr(r.PathValue("ip"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid client IP: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	n := 0
+	if param := r.URL.Query().Get("n"); param != "" {
+		n, err = strconv.Atoi(param)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid n: must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.onClientHistory(clientIP, n)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get client history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// handleStats handles the /stats endpoint
+func (s *API) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.onStats == nil {
+		http.Error(w, "Stats handler not configured", http.StatusNotImplemented)
+		return
+	}
+
+	stats, err := s.onStats()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// handleStatsReset handles the /stats/reset endpoint
+func (s *API) handleStatsReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.onStatsReset == nil {
+		http.Error(w, "Stats handler not configured", http.StatusNotImplemented)
+		return
+	}
+
+	if err := s.onStatsReset(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reset stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status": "stats reset",
+	})
+}
+
+// handleOverlapCheck handles the /check/overlaps endpoint
+func (s *API) handleOverlapCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.onOverlapCheck == nil {
+		http.Error(w, "Overlap check handler not configured", http.StatusNotImplemented)
+		return
+	}
+
+	overlaps, err := s.onOverlapCheck()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check overlaps: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(overlaps)
+}
+
+// handleQueryStream handles the /ws/queries endpoint
+func (s *API) handleQueryStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.onQueryStream == nil {
+		http.Error(w, "Query stream handler not configured", http.StatusNotImplemented)
+		return
+	}
+
+	s.onQueryStream(w, r)
+}
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerThreshold is how many consecutive failures open a circuit breaker
+	defaultBreakerThreshold = 5
+
+	// defaultBreakerCooldown is how long an open circuit breaker skips its upstream
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every query through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen skips the upstream until the cooldown has passed
+	BreakerOpen
+	// BreakerHalfOpen lets one probe query through to test the upstream
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops queries to an upstream server that keeps failing. After threshold
+// consecutive failures it opens and refuses queries for cooldown. Then it lets a single
+// probe through: success closes it again, failure keeps it open for another cooldown.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int       // consecutive failures while closed
+	openUntil time.Time // end of the cooldown while open
+	probing   bool      // a half-open probe is in flight
+
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker
+// Non-positive arguments fall back to 5 failures and a 30 second cooldown
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a query may be sent. Once the cooldown of an open breaker has
+// passed it moves to half-open and allows exactly one probe until that probe is recorded.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Before(b.openUntil) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the breaker and resets its failure count
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// RecordFailure counts a failed query, opening the breaker at the threshold or
+// reopening it when a half-open probe fails
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.open()
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+// RecordCanceled ends a query the client gave up on before the upstream answered.
+// It is not counted as a failure, and a half-open breaker lets the next probe through.
+func (b *CircuitBreaker) RecordCanceled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// retryAt returns when an open breaker lets a probe through again
+func (b *CircuitBreaker) retryAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.openUntil
+}
+
+// open starts a cooldown, the caller must hold b.mu
+func (b *CircuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openUntil = b.now().Add(b.cooldown)
+	b.failures = 0
+	b.probing = false
+}
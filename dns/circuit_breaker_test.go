@@ -0,0 +1,203 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		breaker.RecordFailure()
+	}
+	breaker.RecordSuccess()
+	for i := 0; i < 2; i++ {
+		breaker.RecordFailure()
+	}
+	if state := breaker.State(); state != BreakerClosed || !breaker.Allow() {
+		t.Fatalf("Expected a success to reset the failure count, got %v", state)
+	}
+
+	breaker.RecordFailure()
+	if state := breaker.State(); state != BreakerOpen || breaker.Allow() {
+		t.Fatalf("Expected the breaker to open after 3 failures, got %v", state)
+	}
+
+	// After the cooldown exactly one probe goes through
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("Expected a probe after the cooldown")
+	}
+	if state := breaker.State(); state != BreakerHalfOpen || breaker.Allow() {
+		t.Fatalf("Expected a single half-open probe, got %v", state)
+	}
+
+	// A failed probe extends the open period
+	breaker.RecordFailure()
+	if state := breaker.State(); state != BreakerOpen || breaker.Allow() {
+		t.Fatalf("Expected a failed probe to reopen the breaker, got %v", state)
+	}
+	now = now.Add(59 * time.Second)
+	if breaker.Allow() {
+		t.Fatal("Expected the breaker to stay open for another cooldown")
+	}
+
+	now = now.Add(time.Second)
+	if !breaker.Allow() {
+		t.Fatal("Expected a probe after the second cooldown")
+	}
+	breaker.RecordSuccess()
+	if state := breaker.State(); state != BreakerClosed || !breaker.Allow() {
+		t.Fatalf("Expected a successful probe to close the breaker, got %v", state)
+	}
+}
+
+func TestNewCircuitBreakerDefaults(t *testing.T) {
+	breaker := NewCircuitBreaker(0, 0)
+	if breaker.threshold != defaultBreakerThreshold || breaker.cooldown != defaultBreakerCooldown {
+		t.Errorf("Expected defaults, got threshold %d and cooldown %v", breaker.threshold, breaker.cooldown)
+	}
+}
+
+func TestForwardToUpstreamSkipsOpenBreaker(t *testing.T) {
+	var queries atomic.Int32
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	// Nothing answers on the primary, a closed port on the loopback
+	dead := "127.0.0.1:1"
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithCircuitBreakerThreshold(2)(proxy)
+	WithCircuitBreakerCooldown(time.Minute)(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	upstreams := []string{dead, conn.LocalAddr().String()}
+
+	for i := 0; i < 4; i++ {
+		if response := proxy.forwardToUpstream(context.Background(), query, upstreams); response == nil {
+			t.Fatalf("Expected the secondary to answer query %d", i)
+		}
+	}
+
+	if state := proxy.upstreamBreaker(dead).State(); state != BreakerOpen {
+		t.Errorf("Expected the primary's breaker to be open, got %v", state)
+	}
+	if state := proxy.upstreamBreaker(conn.LocalAddr().String()).State(); state != BreakerClosed {
+		t.Errorf("Expected the secondary's breaker to be closed, got %v", state)
+	}
+	if n := queries.Load(); n != 4 {
+		t.Errorf("Expected 4 queries to the secondary, got %d", n)
+	}
+
+	// With every breaker open the one closing first still gets the query as a probe
+	proxy.upstreamBreaker(conn.LocalAddr().String()).open()
+	proxy.upstreamBreaker(dead).open()
+	if response := proxy.forwardToUpstream(context.Background(), query, upstreams); response == nil {
+		t.Error("Expected the secondary to be probed with all breakers open")
+	}
+	if n := queries.Load(); n != 5 {
+		t.Errorf("Expected the probe to reach the secondary, got %d queries", n)
+	}
+	if state := proxy.upstreamBreaker(conn.LocalAddr().String()).State(); state != BreakerClosed {
+		t.Errorf("Expected the successful probe to close the secondary's breaker, got %v", state)
+	}
+}
+
+func TestCircuitBreakerRecordCanceled(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.RecordFailure()
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("Expected a probe after the cooldown")
+	}
+
+	// A canceled probe neither closes nor reopens the breaker, and frees the probe slot
+	breaker.RecordCanceled()
+	if state := breaker.State(); state != BreakerHalfOpen || !breaker.Allow() {
+		t.Errorf("Expected another probe after a canceled one, got %v", state)
+	}
+}
+
+func TestForwardToUpstreamCanceled(t *testing.T) {
+	// Nothing answers, so the query waits until it is canceled
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	server := conn.LocalAddr().String()
+
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithCircuitBreakerThreshold(1)(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if response := proxy.forwardToUpstream(ctx, query, []string{server}); response != nil {
+		t.Fatalf("Expected no response to a canceled query, got %v", response)
+	}
+
+	if state := proxy.upstreamBreaker(server).State(); state != BreakerClosed {
+		t.Errorf("Expected a canceled query not to open the breaker, got %v", state)
+	}
+}
+
+func TestForwardToUpstreamBreakersDisabled(t *testing.T) {
+	var queries atomic.Int32
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	dead := "127.0.0.1:1"
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithCircuitBreakers(false)(proxy)
+	WithCircuitBreakerThreshold(1)(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	for i := 0; i < 3; i++ {
+		proxy.forwardToUpstream(context.Background(), query, []string{dead, conn.LocalAddr().String()})
+	}
+
+	// The failing primary is never skipped, so every query falls through to the secondary
+	if n := queries.Load(); n != 3 {
+		t.Errorf("Expected 3 queries to the secondary, got %d", n)
+	}
+	if _, ok := proxy.upstreamBreakers.Load(dead); ok {
+		t.Error("Expected no circuit breaker to be created")
+	}
+}
@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// WithAllowlist turns on allowlist mode: queries that no local record answers are only
+// forwarded upstream when the name matches one of domains, and are refused otherwise.
+// Entries are exact domains or patterns with the * and ? wildcards of DNSRecordStore.
+// Invalid entries are logged and skipped.
+func WithAllowlist(domains []string) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.allowlistEnabled = true
+		for _, domain := range domains {
+			if err := p.AddAllowlistEntry(domain); err != nil {
+				logger.Warn("Skipping allowlist entry: %v", err)
+			}
+		}
+	}
+}
+
+// AddAllowlistEntry allows names matching pattern to be forwarded upstream and turns on
+// allowlist mode if it was off
+func (p *DNSProxy) AddAllowlistEntry(pattern string) error {
+	// Normalize pattern to lowercase FQDN
+	pattern = strings.ToLower(dns.Fqdn(pattern))
+	if strings.ContainsAny(pattern, "*?") {
+		if err := validateWildcardPattern(pattern); err != nil {
+			return err
+		}
+	} else if _, ok := dns.IsDomainName(pattern); !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidDomain, pattern)
+	}
+
+	p.allowlistLock.Lock()
+	defer p.allowlistLock.Unlock()
+
+	if p.allowlist == nil {
+		p.allowlist = make(map[string]struct{})
+	}
+	p.allowlist[pattern] = struct{}{}
+	p.allowlistEnabled = true
+	return nil
+}
+
+// RemoveAllowlistEntry removes pattern from the allowlist
+// Allowlist mode stays on, so with no entries left every upstream query is refused
+func (p *DNSProxy) RemoveAllowlistEntry(pattern string) {
+	p.allowlistLock.Lock()
+	defer p.allowlistLock.Unlock()
+
+	delete(p.allowlist, strings.ToLower(dns.Fqdn(pattern)))
+}
+
+// isAllowed reports whether name may be forwarded upstream
+func (p *DNSProxy) isAllowed(name string) bool {
+	p.allowlistLock.RLock()
+	defer p.allowlistLock.RUnlock()
+
+	if !p.allowlistEnabled {
+		return true
+	}
+
+	name = strings.ToLower(dns.Fqdn(name))
+	if _, ok := p.allowlist[name]; ok {
+		return true
+	}
+	for pattern := range p.allowlist {
+		if strings.ContainsAny(pattern, "*?") && matchWildcard(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
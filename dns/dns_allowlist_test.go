@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestAllowlist(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 0)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithAllowlist([]string{"Allowed.example.com", "*.corp.example.com.", "api?.example.net."})(proxy)
+	proxy.recordStore.AddRecord("local.example.org.", net.ParseIP("10.0.0.1"))
+
+	resolve := func(name string) int {
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+		response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+		if response == nil {
+			t.Fatalf("Expected a response for %s", name)
+		}
+		return response.Rcode
+	}
+
+	tests := []struct {
+		name  string
+		rcode int
+	}{
+		{"allowed.example.com.", dns.RcodeSuccess},
+		{"host.corp.example.com.", dns.RcodeSuccess},
+		{"api1.example.net.", dns.RcodeSuccess},
+		{"local.example.org.", dns.RcodeSuccess},
+		{"blocked.example.com.", dns.RcodeRefused},
+		{"corp.example.com.", dns.RcodeRefused},
+		{"api10.example.net.", dns.RcodeRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rcode := resolve(tt.name); rcode != tt.rcode {
+				t.Errorf("Expected %s, got %s", dns.RcodeToString[tt.rcode], dns.RcodeToString[rcode])
+			}
+		})
+	}
+
+	// Refused and local names never reach the upstream
+	if n := queries.Load(); n != 3 {
+		t.Errorf("Expected 3 upstream queries, got %d", n)
+	}
+
+	proxy.RemoveAllowlistEntry("allowed.example.com.")
+	if rcode := resolve("allowed.example.com."); rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED after removing the entry, got %s", dns.RcodeToString[rcode])
+	}
+	if err := proxy.AddAllowlistEntry("blocked.example.com"); err != nil {
+		t.Fatalf("AddAllowlistEntry failed: %v", err)
+	}
+	if rcode := resolve("blocked.example.com."); rcode != dns.RcodeSuccess {
+		t.Errorf("Expected the added entry to be forwarded, got %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestAllowlistOffByDefault(t *testing.T) {
+	proxy := &DNSProxy{}
+	if !proxy.isAllowed("anything.example.com.") {
+		t.Error("Expected every name to be allowed without an allowlist")
+	}
+
+	if err := proxy.AddAllowlistEntry("*.example.com"); err != nil {
+		t.Fatalf("AddAllowlistEntry failed: %v", err)
+	}
+	if proxy.isAllowed("example.org.") {
+		t.Error("Expected adding an entry to turn on allowlist mode")
+	}
+}
+
+func TestAddAllowlistEntryInvalid(t *testing.T) {
+	proxy := &DNSProxy{}
+	for _, pattern := range []string{"*.", "bad..example.com", "*.-bad.example.com"} {
+		if err := proxy.AddAllowlistEntry(pattern); !errors.Is(err, ErrInvalidDomain) {
+			t.Errorf("Expected ErrInvalidDomain for %q, got %v", pattern, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"context"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// ANYQueryPolicy decides how the proxy answers QTYPE=ANY queries for names without local records
+type ANYQueryPolicy int
+
+const (
+	// PolicyMinimalRFC8482 answers with a synthesised HINFO record as RFC 8482 section 4.2
+	// allows, so ANY queries cannot be used to pull large responses through the proxy
+	PolicyMinimalRFC8482 ANYQueryPolicy = iota
+	// PolicyForwardUpstream passes ANY queries through to the upstream servers
+	PolicyForwardUpstream
+)
+
+// anyQueryTypes are the local record types an ANY query is answered from, most common first
+// The store holds no MX or CNAME records, so those are never part of a local answer.
+var anyQueryTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeSRV}
+
+// WithANYQueryPolicy sets how ANY queries are answered when no local record matches,
+// PolicyMinimalRFC8482 by default. Names with local records are always answered with a
+// single RRset of the most common type they have.
+func WithANYQueryPolicy(policy ANYQueryPolicy) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.anyQueryPolicy = policy
+	}
+}
+
+// checkANYQuery answers an ANY query locally with one RRset of the name's local records,
+// or with a synthesised HINFO record under PolicyMinimalRFC8482. It returns nil when the
+// query should be forwarded upstream.
+func (p *DNSProxy) checkANYQuery(ctx context.Context, query *dns.Msg, question dns.Question) *dns.Msg {
+	for _, qtype := range anyQueryTypes {
+		typed := question
+		typed.Qtype = qtype
+		if response := p.checkLocalRecords(ctx, query, typed); response != nil && len(response.Answer) > 0 {
+			logger.Debug("Answering ANY query for %s with its %s records", question.Name, dns.TypeToString[qtype])
+			return response
+		}
+	}
+
+	if p.anyQueryPolicy == PolicyForwardUpstream {
+		return nil
+	}
+
+	logger.Debug("Answering ANY query for %s with a minimal RFC 8482 response", question.Name)
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Answer = append(response.Answer, &dns.HINFO{
+		Hdr: dns.RR_Header{
+			Name:   question.Name,
+			Rrtype: dns.TypeHINFO,
+			Class:  dns.ClassINET,
+			Ttl:    p.localStore(ctx).TTL(),
+		},
+		Cpu: "RFC8482",
+	})
+	return response
+}
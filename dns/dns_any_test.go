@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestANYQueryLocalRecords(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.2"))
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("2001:db8::1"))
+	proxy.recordStore.AddTXTRecord("app.example.com.", []string{"v=1"})
+	proxy.recordStore.AddTXTRecord("txt.example.com.", []string{"only text"})
+
+	tests := []struct {
+		name  string
+		rtype uint16
+		count int
+	}{
+		{"app.example.com.", dns.TypeA, 2},
+		{"txt.example.com.", dns.TypeTXT, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion(tt.name, dns.TypeANY)
+			response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+			if response == nil || len(response.Answer) != tt.count {
+				t.Fatalf("Expected %d answers, got %v", tt.count, response)
+			}
+			for _, rr := range response.Answer {
+				if rr.Header().Rrtype != tt.rtype {
+					t.Errorf("Expected a single %s RRset, got %v", dns.TypeToString[tt.rtype], rr)
+				}
+			}
+			if response.Question[0].Qtype != dns.TypeANY {
+				t.Errorf("Expected the question to stay ANY, got %v", response.Question[0])
+			}
+		})
+	}
+}
+
+func TestANYQueryMinimalResponse(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 0)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+
+	query := new(dns.Msg)
+	query.SetQuestion("external.example.com.", dns.TypeANY)
+	response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 1 {
+		t.Fatalf("Expected a single answer, got %v", response)
+	}
+	hinfo, ok := response.Answer[0].(*dns.HINFO)
+	if !ok || hinfo.Cpu != "RFC8482" || hinfo.Os != "" {
+		t.Errorf("Expected a synthesised RFC 8482 HINFO record, got %v", response.Answer[0])
+	}
+	if n := queries.Load(); n != 0 {
+		t.Errorf("Expected no upstream query, got %d", n)
+	}
+}
+
+func TestANYQueryForwardUpstream(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 0)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithANYQueryPolicy(PolicyForwardUpstream)(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("external.example.com.", dns.TypeANY)
+	if response := proxy.resolveQuery(context.Background(), query, query.Question[0]); response == nil {
+		t.Fatal("Expected the upstream response")
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected the query to go upstream, got %d upstream queries", n)
+	}
+}
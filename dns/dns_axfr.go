@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// axfrMessageSize is the size a zone transfer message is kept under before
+// the next records are sent in a new message
+const axfrMessageSize = 16384
+
+// axfrRecordTypes are the record types included in a zone transfer
+var axfrRecordTypes = []uint16{
+	dns.TypeA, dns.TypeAAAA, dns.TypeCAA, dns.TypeHTTPS, dns.TypeNAPTR, dns.TypeSRV, dns.TypeTXT, dns.TypePTR,
+}
+
+// WithAXFREnabled lets secondary name servers replicate local records with zone
+// transfers (AXFR) over TCP. Only clients allowed by WithAXFRAllowedClients are served.
+func WithAXFREnabled(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.axfrEnabled = enabled
+	}
+}
+
+// WithAXFRAllowedClients sets the client networks allowed to transfer zones
+// Without any, all zone transfers are refused
+func WithAXFRAllowedClients(cidrs []netip.Prefix) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.axfrAllowedClients = append([]netip.Prefix(nil), cidrs...)
+	}
+}
+
+// axfrAllowed reports whether addr may transfer zones
+func (p *DNSProxy) axfrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.axfrAllowedClients {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAXFR returns the messages answering a zone transfer query from clientAddr
+// A refused or failed transfer is a single message carrying the error code
+func (p *DNSProxy) handleAXFR(query *dns.Msg, clientAddr netip.Addr) []*dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(query)
+
+	if len(query.Question) != 1 || query.Question[0].Qtype != dns.TypeAXFR {
+		response.Rcode = dns.RcodeNotImplemented
+		return []*dns.Msg{response}
+	}
+
+	zone := strings.ToLower(dns.Fqdn(query.Question[0].Name))
+	if !p.axfrEnabled || !p.axfrAllowed(clientAddr) || p.isRefusedAddr(clientAddr) {
+		logger.Warn("Refused AXFR of %s from %s", zone, clientAddr)
+		response.Rcode = dns.RcodeRefused
+		return []*dns.Msg{response}
+	}
+
+	records := p.zoneRecords(zone)
+	if len(records) == 0 {
+		response.Rcode = dns.RcodeNotAuth
+		return []*dns.Msg{response}
+	}
+
+	logger.Info("Serving AXFR of %s (%d records) to %s", zone, len(records), clientAddr)
+
+	// The zone starts and ends with the same SOA record (RFC 5936 section 2.2)
+	soa := p.zoneSOA(zone)
+	records = append([]dns.RR{soa}, records...)
+	records = append(records, soa)
+
+	var messages []*dns.Msg
+	msg := newAXFRMessage(query)
+	for _, rr := range records {
+		msg.Answer = append(msg.Answer, rr)
+		if len(msg.Answer) > 1 && msg.Len() > axfrMessageSize {
+			msg.Answer = msg.Answer[:len(msg.Answer)-1]
+			messages = append(messages, msg)
+			msg = newAXFRMessage(query)
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+	return append(messages, msg)
+}
+
+// newAXFRMessage returns an empty message of a zone transfer answering query
+func newAXFRMessage(query *dns.Msg) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetReply(query)
+	msg.Authoritative = true
+	msg.Compress = true
+	return msg
+}
+
+// zoneRecords returns the records of every domain at or below zone
+// Wildcard patterns cannot be written as zone data, a domain they cover
+// carries the records it would be answered with instead
+func (p *DNSProxy) zoneRecords(zone string) []dns.RR {
+	var records []dns.RR
+	for _, domain := range p.recordStore.GetAllDomains() {
+		if !dns.IsSubDomain(zone, domain) {
+			continue
+		}
+		for _, qtype := range axfrRecordTypes {
+			query := new(dns.Msg)
+			query.SetQuestion(domain, qtype)
+			if response := p.checkLocalRecords(context.Background(), query, query.Question[0]); response != nil {
+				records = append(records, response.Answer...)
+			}
+		}
+	}
+	return records
+}
+
+// zoneSOA returns the SOA record sent at the start and end of a zone transfer
+// The serial is the current time so secondaries see every transfer as a new version
+func (p *DNSProxy) zoneSOA(zone string) *dns.SOA {
+	ttl := p.recordStore.TTL()
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  uint32(time.Now().Unix()),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}
+}
@@ -0,0 +1,227 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func newAXFRTestProxy(t *testing.T, domains int) *DNSProxy {
+	t.Helper()
+
+	p := newUpdateTestProxy(
+		WithAXFREnabled(true),
+		WithAXFRAllowedClients([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}),
+	)
+	for i := 0; i < domains; i++ {
+		ip := net.IPv4(10, 0, byte(i/256), byte(i%256))
+		if _, err := p.recordStore.AddRecord(fmt.Sprintf("host%d.example.com.", i), ip); err != nil {
+			t.Fatalf("Failed to add record: %v", err)
+		}
+	}
+	return p
+}
+
+func TestAXFRTransfer(t *testing.T) {
+	p := newAXFRTestProxy(t, 2000)
+	p.recordStore.AddRecord("other.test.", net.ParseIP("10.1.0.1"))
+	p.recordStore.AddSRVRecord("_sip._tcp.example.com.", SRVRecord{Priority: 10, Weight: 5, Port: 5060, Target: "host1.example.com."})
+	p.recordStore.AddTXTRecord("host1.example.com.", []string{"v=1"})
+	addr := startTCPServer(t, p)
+
+	query := new(dns.Msg)
+	query.SetAxfr("example.com.")
+
+	transfer := &dns.Transfer{}
+	envelopes, err := transfer.In(query, addr)
+	if err != nil {
+		t.Fatalf("Failed to start transfer: %v", err)
+	}
+
+	var records []dns.RR
+	messages := 0
+	for env := range envelopes {
+		if env.Error != nil {
+			t.Fatalf("Transfer failed: %v", env.Error)
+		}
+		messages++
+		records = append(records, env.RR...)
+	}
+
+	if messages < 2 {
+		t.Errorf("Expected the zone to be split over several messages, got %d", messages)
+	}
+	if len(records) < 2 {
+		t.Fatalf("Expected at least two records, got %d", len(records))
+	}
+
+	first, ok := records[0].(*dns.SOA)
+	if !ok {
+		t.Fatalf("Expected transfer to start with SOA, got %s", records[0])
+	}
+	last, ok := records[len(records)-1].(*dns.SOA)
+	if !ok {
+		t.Fatalf("Expected transfer to end with SOA, got %s", records[len(records)-1])
+	}
+	if first.Hdr.Name != "example.com." || first.Serial != last.Serial {
+		t.Errorf("Expected matching SOA records for example.com., got %s and %s", first, last)
+	}
+
+	counts := make(map[uint16]int)
+	for _, rr := range records[1 : len(records)-1] {
+		if !dns.IsSubDomain("example.com.", rr.Header().Name) {
+			t.Errorf("Record outside zone in transfer: %s", rr)
+		}
+		counts[rr.Header().Rrtype]++
+	}
+	if counts[dns.TypeA] != 2000 {
+		t.Errorf("Expected 2000 A records, got %d", counts[dns.TypeA])
+	}
+	if counts[dns.TypeSRV] != 1 || counts[dns.TypeTXT] != 1 {
+		t.Errorf("Expected one SRV and one TXT record, got %d and %d", counts[dns.TypeSRV], counts[dns.TypeTXT])
+	}
+	if counts[dns.TypeSOA] != 0 {
+		t.Errorf("Expected SOA only at the start and end, got %d more", counts[dns.TypeSOA])
+	}
+}
+
+func TestAXFRFraming(t *testing.T) {
+	p := newAXFRTestProxy(t, 1000)
+	addr := startTCPServer(t, p)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	query := new(dns.Msg)
+	query.SetAxfr("example.com.")
+	raw, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	// DNS over TCP prefixes every message with its length
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(raw)))
+	if _, err := conn.Write(append(frame, raw...)); err != nil {
+		t.Fatalf("Failed to send query: %v", err)
+	}
+
+	soas := 0
+	messages := 0
+	records := 0
+	for soas < 2 {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			t.Fatalf("Failed to read length prefix after %d messages: %v", messages, err)
+		}
+		size := binary.BigEndian.Uint16(length[:])
+		if size > axfrMessageSize {
+			t.Errorf("Message of %d bytes is larger than %d", size, axfrMessageSize)
+		}
+
+		body := make([]byte, size)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(body); err != nil {
+			t.Fatalf("Failed to unpack message: %v", err)
+		}
+		if msg.Id != query.Id || msg.Rcode != dns.RcodeSuccess || !msg.Authoritative {
+			t.Fatalf("Unexpected message header: id=%d rcode=%d aa=%v", msg.Id, msg.Rcode, msg.Authoritative)
+		}
+
+		messages++
+		for _, rr := range msg.Answer {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				soas++
+			}
+			records++
+		}
+	}
+
+	if messages < 2 {
+		t.Errorf("Expected several messages, got %d", messages)
+	}
+	if records != 1002 {
+		t.Errorf("Expected 1000 records and two SOA records, got %d records", records)
+	}
+}
+
+func TestAXFRRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DNSProxyOption
+	}{
+		{"disabled", []DNSProxyOption{WithAXFRAllowedClients([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})}},
+		{"no allowed clients", []DNSProxyOption{WithAXFREnabled(true)}},
+		{"client not allowed", []DNSProxyOption{
+			WithAXFREnabled(true),
+			WithAXFRAllowedClients([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newUpdateTestProxy(tt.opts...)
+			p.recordStore.AddRecord("host.example.com.", net.ParseIP("10.0.0.1"))
+			addr := startTCPServer(t, p)
+
+			query := new(dns.Msg)
+			query.SetAxfr("example.com.")
+			client := &dns.Client{Net: "tcp", Timeout: 5 * time.Second}
+			response, _, err := client.Exchange(query, addr)
+			if err != nil {
+				t.Fatalf("Exchange failed: %v", err)
+			}
+			if response.Rcode != dns.RcodeRefused {
+				t.Errorf("Expected REFUSED, got %s", dns.RcodeToString[response.Rcode])
+			}
+			if len(response.Answer) != 0 {
+				t.Errorf("Expected no records, got %d", len(response.Answer))
+			}
+		})
+	}
+}
+
+func TestAXFRUnknownZone(t *testing.T) {
+	p := newAXFRTestProxy(t, 1)
+
+	query := new(dns.Msg)
+	query.SetAxfr("example.org.")
+	messages := p.handleAXFR(query, netip.MustParseAddr("127.0.0.1"))
+	if len(messages) != 1 || messages[0].Rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected a single NOTAUTH message, got %v", messages)
+	}
+}
+
+func TestGetAllDomains(t *testing.T) {
+	for name, store := range map[string]RecordStore{
+		"single":  NewDNSRecordStore(),
+		"sharded": NewShardedDNSRecordStore(4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			store.AddRecord("B.example.com", net.ParseIP("10.0.0.1"))
+			store.AddRecord("a.example.com.", net.ParseIP("2001:db8::1"))
+			store.AddRecord("*.example.com.", net.ParseIP("10.0.0.2"))
+			store.AddTXTRecord("c.example.com.", []string{"hello"})
+
+			got := store.GetAllDomains()
+			want := []string{"a.example.com.", "b.example.com.", "c.example.com."}
+			if !slices.Equal(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+}
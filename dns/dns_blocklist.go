@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// WatchBlocklistFile loads the blocklist from path and reloads it whenever the file's
+// modification time changes, checked every interval until Stop. Queries for a listed
+// name or any name under it that no local record answers get NXDOMAIN instead of going
+// upstream. The file lists one domain per line, or hosts file lines such as
+// "0.0.0.0 ads.example.com", with # comments. A reload builds a new list and swaps it
+// in, so queries see either the old or the new list. A reload that fails keeps the old
+// list and is retried on the next check.
+func (p *DNSProxy) WatchBlocklistFile(path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("blocklist watch interval must be positive, got %v", interval)
+	}
+
+	modTime, err := p.loadBlocklist(path)
+	if err != nil {
+		return err
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				logger.Warn("Failed to check blocklist %s: %v", path, err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			loaded, err := p.loadBlocklist(path)
+			if err != nil {
+				logger.Warn("Failed to reload blocklist, keeping the previous one: %v", err)
+				continue
+			}
+			modTime = loaded
+			logger.Info("Reloaded blocklist %s, version %s", path, p.BlocklistVersion())
+		}
+	}()
+	return nil
+}
+
+// BlocklistVersion returns the modification time of the loaded blocklist file as
+// nanoseconds since the Unix epoch in hex, or an empty string when none is loaded
+func (p *DNSProxy) BlocklistVersion() string {
+	version, _ := p.blocklistVersion.Load().(string)
+	return version
+}
+
+// loadBlocklist reads the blocklist at path and swaps it in, returning the file's
+// modification time when it was read
+func (p *DNSProxy) loadBlocklist(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("open blocklist: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("stat blocklist: %w", err)
+	}
+
+	blocklist := new(sync.Map)
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		// Hosts file lines put an address before the names
+		if net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+		for _, name := range fields {
+			name = strings.ToLower(dns.Fqdn(name))
+			if _, ok := dns.IsDomainName(name); !ok {
+				logger.Debug("Skipping invalid blocklist entry %q on line %d", name, line)
+				continue
+			}
+			blocklist.Store(name, struct{}{})
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("read blocklist: %w", err)
+	}
+
+	p.blocklist.Store(blocklist)
+	p.blocklistVersion.Store(fmt.Sprintf("%x", info.ModTime().UnixNano()))
+	logger.Debug("Loaded %d blocklist entries from %s", count, path)
+	return info.ModTime(), nil
+}
+
+// isBlocked reports whether name or one of its parent domains is on the blocklist
+func (p *DNSProxy) isBlocked(name string) bool {
+	blocklist := p.blocklist.Load()
+	if blocklist == nil {
+		return false
+	}
+
+	name = strings.ToLower(dns.Fqdn(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if _, ok := blocklist.Load(name[off:]); ok {
+			return true
+		}
+	}
+	return false
+}
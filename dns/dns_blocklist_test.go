@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestWatchBlocklistFile(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore(), ctx: ctx, cancel: cancel}
+	proxy.recordStore.AddRecord("local.ads.example.", net.ParseIP("10.0.0.1"))
+
+	path := filepath.Join(t.TempDir(), "blocklist")
+	writeBlocklist := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write blocklist: %v", err)
+		}
+		// Set the time explicitly, filesystem timestamps may be too coarse to change
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set blocklist mtime: %v", err)
+		}
+	}
+	resolve := func(name string) int {
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+		response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+		if response == nil {
+			t.Fatalf("Expected a response for %s", name)
+		}
+		return response.Rcode
+	}
+
+	first := time.Unix(1700000000, 0)
+	writeBlocklist("# ad servers\nAds.Example\n0.0.0.0 tracker.example.net tracking.example.net\n", first)
+	if err := proxy.WatchBlocklistFile(path, 10*time.Millisecond); err != nil {
+		t.Fatalf("WatchBlocklistFile failed: %v", err)
+	}
+	if version := proxy.BlocklistVersion(); version != "17979cfe362a0000" {
+		t.Errorf("Expected the mtime as the version, got %q", version)
+	}
+
+	tests := []struct {
+		name  string
+		rcode int
+	}{
+		{"ads.example.", dns.RcodeNameError},
+		{"cdn.ads.example.", dns.RcodeNameError},
+		{"tracking.example.net.", dns.RcodeNameError},
+		{"local.ads.example.", dns.RcodeSuccess},
+		{"example.net.", dns.RcodeSuccess},
+	}
+	for _, tt := range tests {
+		if rcode := resolve(tt.name); rcode != tt.rcode {
+			t.Errorf("%s: expected %s, got %s", tt.name, dns.RcodeToString[tt.rcode], dns.RcodeToString[rcode])
+		}
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected only the unlisted name to go upstream, got %d queries", n)
+	}
+
+	// A changed file replaces the whole list
+	writeBlocklist("example.net\n", first.Add(time.Hour))
+	deadline := time.Now().Add(2 * time.Second)
+	for resolve("example.net.") != dns.RcodeNameError {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the blocklist to be reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if rcode := resolve("ads.example."); rcode != dns.RcodeSuccess {
+		t.Errorf("Expected names dropped from the file to be unblocked, got %s", dns.RcodeToString[rcode])
+	}
+
+	// A failed reload keeps the current list
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove blocklist: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if rcode := resolve("example.net."); rcode != dns.RcodeNameError {
+		t.Errorf("Expected the list to survive a missing file, got %s", dns.RcodeToString[rcode])
+	}
+
+	proxy.Stop()
+}
+
+func TestWatchBlocklistFileErrors(t *testing.T) {
+	proxy := &DNSProxy{}
+	if err := proxy.WatchBlocklistFile(filepath.Join(t.TempDir(), "missing"), time.Second); err == nil {
+		t.Error("Expected a missing blocklist to be rejected")
+	}
+	if err := proxy.WatchBlocklistFile("unused", 0); err == nil {
+		t.Error("Expected a zero interval to be rejected")
+	}
+	if proxy.BlocklistVersion() != "" || proxy.isBlocked("anything.example.") {
+		t.Error("Expected no blocklist to be loaded")
+	}
+}
@@ -0,0 +1,152 @@
+package dns
+
+import (
+	"container/list"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+)
+
+const (
+	// defaultClientHistorySize is how many queries are kept per client
+	defaultClientHistorySize = 100
+
+	// clientHistoryIdleTimeout is how long a client's history is kept after its last query
+	clientHistoryIdleTimeout = 5 * time.Minute
+
+	// clientHistoryQueueSize bounds the entries waiting to be recorded, more are dropped
+	clientHistoryQueueSize = 1024
+)
+
+// WithClientHistorySize sets how many recent queries are kept per client for
+// GetClientHistory, 100 by default. Zero or less turns the history off.
+func WithClientHistorySize(n int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.clientHistorySize = n
+	}
+}
+
+// clientRing holds the most recent queries of one client
+type clientRing struct {
+	mu      sync.Mutex
+	entries []QueryLogEntry // ring buffer, next is the oldest once full
+	next    int
+	full    bool
+}
+
+// add records entry, overwriting the oldest entry when the ring is full
+func (r *clientRing) add(entry QueryLogEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last returns up to n of the most recent entries, oldest first
+func (r *clientRing) last(n int) []QueryLogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	result := make([]QueryLogEntry, n)
+	start := r.next - n
+	if start < 0 {
+		start += len(r.entries)
+	}
+	for i := range result {
+		result[i] = r.entries[(start+i)%len(r.entries)]
+	}
+	return result
+}
+
+// GetClientHistory returns the last n queries from clientIP, oldest first, or all that
+// are kept when n is zero or less. Queries are recorded in the background, so the most
+// recent one may not be included yet. Clients idle for 5 minutes are forgotten.
+func (p *DNSProxy) GetClientHistory(clientIP netip.Addr, n int) []QueryLogEntry {
+	ring, ok := p.clientHistory.Load(clientIP.Unmap())
+	if !ok {
+		return nil
+	}
+	return ring.(*clientRing).last(n)
+}
+
+// recordClientQuery queues entry for the client history without blocking the query path
+func (p *DNSProxy) recordClientQuery(entry QueryLogEntry) {
+	if p.clientHistorySize <= 0 {
+		return
+	}
+
+	p.historyOnce.Do(func() {
+		p.historyQueue = make(chan QueryLogEntry, clientHistoryQueueSize)
+		go p.runClientHistory()
+	})
+
+	select {
+	case p.historyQueue <- entry:
+	default:
+		logger.Debug("Client history queue full, dropping query for %s from %s", entry.Name, entry.Client)
+	}
+}
+
+// runClientHistory records queued entries and forgets idle clients until the proxy stops.
+// It is the only writer of the history, so its LRU index needs no lock.
+func (p *DNSProxy) runClientHistory() {
+	lru := list.New() // client addresses, most recently seen first
+	index := make(map[netip.Addr]*list.Element)
+	lastSeen := make(map[netip.Addr]time.Time)
+
+	evictIdle := func(now time.Time) {
+		for e := lru.Back(); e != nil; e = lru.Back() {
+			addr := e.Value.(netip.Addr)
+			if now.Sub(lastSeen[addr]) < clientHistoryIdleTimeout {
+				return
+			}
+			lru.Remove(e)
+			delete(index, addr)
+			delete(lastSeen, addr)
+			p.clientHistory.Delete(addr)
+		}
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			evictIdle(now)
+		case entry := <-p.historyQueue:
+			addrPort, err := netip.ParseAddrPort(entry.Client)
+			if err != nil {
+				continue
+			}
+			addr := addrPort.Addr().Unmap()
+
+			ring, _ := p.clientHistory.LoadOrStore(addr, &clientRing{entries: make([]QueryLogEntry, p.clientHistorySize)})
+			ring.(*clientRing).add(entry)
+
+			lastSeen[addr] = entry.Time
+			if e, ok := index[addr]; ok {
+				lru.MoveToFront(e)
+			} else {
+				index[addr] = lru.PushFront(addr)
+			}
+			evictIdle(entry.Time)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestClientRing(t *testing.T) {
+	ring := &clientRing{entries: make([]QueryLogEntry, 3)}
+	if got := ring.last(0); len(got) != 0 {
+		t.Fatalf("Expected an empty history, got %v", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		ring.add(QueryLogEntry{Name: fmt.Sprintf("q%d.", i)})
+	}
+
+	names := func(entries []QueryLogEntry) []string {
+		var result []string
+		for _, e := range entries {
+			result = append(result, e.Name)
+		}
+		return result
+	}
+	if got := fmt.Sprint(names(ring.last(0))); got != "[q2. q3. q4.]" {
+		t.Errorf("Expected the last 3 queries oldest first, got %s", got)
+	}
+	if got := fmt.Sprint(names(ring.last(2))); got != "[q3. q4.]" {
+		t.Errorf("Expected the last 2 queries, got %s", got)
+	}
+	if got := fmt.Sprint(names(ring.last(10))); got != "[q2. q3. q4.]" {
+		t.Errorf("Expected n to be capped at the history size, got %s", got)
+	}
+}
+
+// waitForHistory waits until the history of clientIP holds want entries
+func waitForHistory(t *testing.T, proxy *DNSProxy, clientIP netip.Addr, want int) []QueryLogEntry {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		history := proxy.GetClientHistory(clientIP, 0)
+		if len(history) == want || time.Now().After(deadline) {
+			return history
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetClientHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: ctx}
+	WithClientHistorySize(2)(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	for _, name := range []string{"one.example.com.", "two.example.com.", "app.example.com."} {
+		proxy.logQuery(QueryLogEntry{Time: time.Now(), Client: "127.0.0.1:5353", Name: name, Type: dns.TypeA})
+	}
+
+	client := netip.MustParseAddr("127.0.0.1")
+	history := waitForHistory(t, proxy, client, 2)
+	if len(history) != 2 || history[0].Name != "two.example.com." || history[1].Name != "app.example.com." {
+		t.Fatalf("Expected the last 2 queries, got %+v", history)
+	}
+	if got := proxy.GetClientHistory(client, 1); len(got) != 1 || got[0].Name != "app.example.com." {
+		t.Errorf("Expected the last query, got %+v", got)
+	}
+
+	// IPv4-mapped addresses are the same client
+	if got := proxy.GetClientHistory(netip.MustParseAddr("::ffff:127.0.0.1"), 0); len(got) != 2 {
+		t.Errorf("Expected the IPv4-mapped address to find the history, got %+v", got)
+	}
+	if got := proxy.GetClientHistory(netip.MustParseAddr("127.0.0.2"), 0); got != nil {
+		t.Errorf("Expected no history for another client, got %+v", got)
+	}
+}
+
+func TestClientHistoryFromQueries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: ctx}
+	WithClientHistorySize(defaultClientHistorySize)(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	query := new(dns.Msg)
+	query.SetQuestion("app.example.com.", dns.TypeA)
+	exchangeUDP(t, proxy, query)
+
+	history := waitForHistory(t, proxy, netip.MustParseAddr("127.0.0.1"), 1)
+	if len(history) != 1 || history[0].Name != "app.example.com." || history[0].Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected the query in the client history, got %+v", history)
+	}
+}
+
+func TestClientHistoryEvictsIdleClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy := &DNSProxy{ctx: ctx}
+	WithClientHistorySize(10)(proxy)
+
+	idle := netip.MustParseAddr("10.0.0.1")
+	active := netip.MustParseAddr("10.0.0.2")
+	proxy.logQuery(QueryLogEntry{Time: time.Now().Add(-10 * time.Minute), Client: "10.0.0.1:5353", Name: "old.example.com."})
+	proxy.logQuery(QueryLogEntry{Time: time.Now(), Client: "10.0.0.2:5353", Name: "new.example.com."})
+
+	waitForHistory(t, proxy, active, 1)
+	if got := waitForHistory(t, proxy, idle, 0); len(got) != 0 {
+		t.Errorf("Expected the idle client to be forgotten, got %+v", got)
+	}
+}
+
+func TestClientHistoryDisabled(t *testing.T) {
+	proxy := &DNSProxy{ctx: context.Background()}
+	WithClientHistorySize(0)(proxy)
+
+	proxy.logQuery(QueryLogEntry{Time: time.Now(), Client: "10.0.0.1:5353", Name: "app.example.com."})
+	if proxy.historyQueue != nil {
+		t.Error("Expected no history to be recorded when disabled")
+	}
+}
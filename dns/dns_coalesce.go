@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// WithQueryCoalescing makes identical queries that are waiting on an upstream share one
+// upstream exchange. Coalesced queries are counted in CoalescedQueriesTotal.
+//
+// A and AAAA queries for the same name are intentionally not merged: ANY is refused or
+// answered partially by most resolvers (RFC 8482), and sending the sibling type ahead of
+// the client doubles upstream traffic for clients that only ask for one. Each type gets
+// its own exchange, which later queries for that type join.
+func WithQueryCoalescing(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.queryCoalescing = enabled
+	}
+}
+
+// CoalescedQueriesTotal returns how many queries were answered by joining an upstream
+// exchange already in flight instead of starting their own
+func (p *DNSProxy) CoalescedQueriesTotal() uint64 {
+	return p.counters().coalescedQueries.Load()
+}
+
+// flightKey identifies queries that can share an upstream exchange
+type flightKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	do     bool // DNSSEC OK changes what the upstream returns
+}
+
+// flight is an upstream exchange in progress
+type flight struct {
+	done     chan struct{}
+	response *dns.Msg // set before done is closed, nil if every upstream failed
+}
+
+// newFlightKey returns the flight key of question in query
+func newFlightKey(query *dns.Msg, question dns.Question) flightKey {
+	key := flightKey{
+		name:   strings.ToLower(question.Name),
+		qtype:  question.Qtype,
+		qclass: question.Qclass,
+	}
+	if opt := query.IsEdns0(); opt != nil {
+		key.do = opt.Do()
+	}
+	return key
+}
+
+// exchangeUpstream forwards query to upstreams, sharing the exchange with identical
+// queries in flight when coalescing is enabled
+func (p *DNSProxy) exchangeUpstream(ctx context.Context, query *dns.Msg, question dns.Question, upstreams []string) *dns.Msg {
+	if !p.queryCoalescing {
+		return p.forwardToUpstream(ctx, query, upstreams)
+	}
+
+	key := newFlightKey(query, question)
+
+	p.flightsLock.Lock()
+	if f, ok := p.flights[key]; ok {
+		p.flightsLock.Unlock()
+		p.counters().coalescedQueries.Add(1)
+		logger.Debug("Coalescing query for %s (type %s) with one in flight", question.Name, dns.TypeToString[question.Qtype])
+		return p.waitForFlight(ctx, f, query)
+	}
+
+	f := p.startFlightLocked(key)
+	p.flightsLock.Unlock()
+
+	return p.finishFlight(key, f, p.forwardToUpstream(ctx, query, upstreams))
+}
+
+// startFlightLocked registers a new flight for key
+// The caller must hold p.flightsLock
+func (p *DNSProxy) startFlightLocked(key flightKey) *flight {
+	if p.flights == nil {
+		p.flights = make(map[flightKey]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	p.flights[key] = f
+	return f
+}
+
+// finishFlight publishes the response of f to its waiters and removes it
+func (p *DNSProxy) finishFlight(key flightKey, f *flight, response *dns.Msg) *dns.Msg {
+	// Waiters get their own copies of a copy, the caller keeps response
+	if response != nil {
+		f.response = response.Copy()
+	}
+
+	p.flightsLock.Lock()
+	delete(p.flights, key)
+	p.flightsLock.Unlock()
+
+	close(f.done)
+	return response
+}
+
+// waitForFlight waits for f and returns its response rewritten as a reply to query
+func (p *DNSProxy) waitForFlight(ctx context.Context, f *flight, query *dns.Msg) *dns.Msg {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil
+	}
+	if f.response == nil {
+		return nil
+	}
+
+	response := f.response.Copy()
+	response.Id = query.Id
+	response.Question = query.Question
+	return response
+}
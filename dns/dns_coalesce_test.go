@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// startSlowUpstream runs a DNS server that answers A and AAAA queries after delay and
+// counts the queries it receives
+func startSlowUpstream(t *testing.T, delay time.Duration) (string, *atomic.Int32) {
+	t.Helper()
+
+	var queries atomic.Int32
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		time.Sleep(delay)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch q.Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("192.0.2.1")})
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP("2001:db8::1")})
+		}
+		w.WriteMsg(m)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return conn.LocalAddr().String(), &queries
+}
+
+// resolveConcurrently resolves one query per type at the same time
+func resolveConcurrently(proxy *DNSProxy, name string, qtypes ...uint16) []*dns.Msg {
+	// The logger initializes itself lazily without synchronization
+	logger.Init(nil)
+
+	responses := make([]*dns.Msg, len(qtypes))
+	var wg sync.WaitGroup
+	for i, qtype := range qtypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := new(dns.Msg)
+			query.SetQuestion(name, qtype)
+			responses[i] = proxy.resolveQuery(context.Background(), query, query.Question[0])
+			if responses[i] != nil && responses[i].Id != query.Id {
+				responses[i] = nil
+			}
+		}()
+	}
+	wg.Wait()
+	return responses
+}
+
+func TestQueryCoalescingAAndAAAA(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 100*time.Millisecond)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithQueryCoalescing(true)(proxy)
+
+	responses := resolveConcurrently(proxy, "app.example.com.", dns.TypeA, dns.TypeAAAA, dns.TypeA, dns.TypeAAAA)
+
+	for i, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeA, dns.TypeAAAA} {
+		if responses[i] == nil || len(responses[i].Answer) != 1 || responses[i].Answer[0].Header().Rrtype != qtype {
+			t.Errorf("Expected a %s answer matching query %d, got %v", dns.TypeToString[qtype], i, responses[i])
+		}
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("Expected 2 upstream exchanges, got %d", n)
+	}
+	if n := proxy.CoalescedQueriesTotal(); n != 2 {
+		t.Errorf("Expected 2 coalesced queries, got %d", n)
+	}
+}
+
+func TestQueryCoalescingIdenticalA(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 100*time.Millisecond)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithQueryCoalescing(true)(proxy)
+
+	responses := resolveConcurrently(proxy, "app.example.com.", dns.TypeA, dns.TypeA)
+	for i, response := range responses {
+		if response == nil || len(response.Answer) != 1 || response.Answer[0].Header().Rrtype != dns.TypeA {
+			t.Errorf("Expected an A answer matching query %d, got %v", i, response)
+		}
+	}
+	// No AAAA query is sent alongside the A queries
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected 1 upstream exchange, got %d", n)
+	}
+	if n := proxy.CoalescedQueriesTotal(); n != 1 {
+		t.Errorf("Expected 1 coalesced query, got %d", n)
+	}
+}
+
+func TestQueryCoalescingDuplicates(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 100*time.Millisecond)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithQueryCoalescing(true)(proxy)
+
+	responses := resolveConcurrently(proxy, "app.example.com.", dns.TypeTXT, dns.TypeTXT, dns.TypeTXT)
+	for i, response := range responses {
+		if response == nil {
+			t.Errorf("Expected a response to query %d", i)
+		}
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected 1 upstream exchange, got %d", n)
+	}
+	if n := proxy.CoalescedQueriesTotal(); n != 2 {
+		t.Errorf("Expected 2 coalesced queries, got %d", n)
+	}
+}
+
+func TestQueryCoalescingDisabled(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 50*time.Millisecond)
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+
+	resolveConcurrently(proxy, "app.example.com.", dns.TypeA, dns.TypeA)
+	if n := queries.Load(); n != 2 {
+		t.Errorf("Expected 2 upstream exchanges without coalescing, got %d", n)
+	}
+	if n := proxy.CoalescedQueriesTotal(); n != 0 {
+		t.Errorf("Expected no coalesced queries, got %d", n)
+	}
+}
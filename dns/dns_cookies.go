@@ -0,0 +1,218 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+const (
+	// clientCookieLen is the length of an RFC 7873 client cookie
+	clientCookieLen = 8
+
+	// serverCookieLen is the length of the server cookies the proxy issues, laid out as in
+	// RFC 9018: version, 3 reserved bytes, a timestamp and an 8 byte hash
+	serverCookieLen = 16
+
+	// serverCookieVersion is the layout version of issued server cookies
+	serverCookieVersion = 1
+
+	// serverCookieLifetime is how long an issued server cookie stays valid
+	serverCookieLifetime = time.Hour
+
+	// serverCookieClockSkew is how far in the future a server cookie timestamp may be
+	serverCookieClockSkew = 5 * time.Minute
+)
+
+// WithDNSCookiesEnabled turns on RFC 7873 DNS cookies. Queries sent upstream carry a
+// random client cookie per upstream server together with the last server cookie it
+// returned, and responses whose cookie does not echo the client cookie are dropped as
+// spoofed. Clients that send a cookie get a fresh server cookie with every response.
+func WithDNSCookiesEnabled(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dnsCookies = enabled
+	}
+}
+
+// upstreamCookie is the cookie state kept for one upstream server
+type upstreamCookie struct {
+	client [clientCookieLen]byte
+
+	mu     sync.Mutex
+	server []byte // last server cookie the upstream returned
+}
+
+// upstreamCookieFor returns the cookie state of server, creating a client cookie on first use
+func (p *DNSProxy) upstreamCookieFor(server string) *upstreamCookie {
+	if cookie, ok := p.upstreamCookies.Load(server); ok {
+		return cookie.(*upstreamCookie)
+	}
+	cookie := &upstreamCookie{}
+	rand.Read(cookie.client[:])
+	actual, _ := p.upstreamCookies.LoadOrStore(server, cookie)
+	return actual.(*upstreamCookie)
+}
+
+// addUpstreamCookie returns a copy of query carrying the cookie for server, and whether
+// an OPT record had to be added for it. query is returned as is with cookies off.
+func (p *DNSProxy) addUpstreamCookie(server string, query *dns.Msg) (*dns.Msg, bool) {
+	if !p.dnsCookies {
+		return query, false
+	}
+
+	cookie := p.upstreamCookieFor(server)
+	cookie.mu.Lock()
+	data := slices.Concat(cookie.client[:], cookie.server)
+	cookie.mu.Unlock()
+
+	withCookie := query.Copy()
+	opt := withCookie.IsEdns0()
+	addedOPT := opt == nil
+	if addedOPT {
+		withCookie.SetEdns0(addedOPTUDPSize, false)
+		opt = withCookie.IsEdns0()
+	}
+
+	// A cookie from the client is meant for the proxy, not the upstream
+	removeOption(opt, dns.EDNS0COOKIE)
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(data)})
+	return withCookie, addedOPT
+}
+
+// checkUpstreamCookie validates the cookie of a response from server, remembers its
+// server cookie and removes the cookie before the response goes to the client. A
+// response without a cookie is accepted since not every upstream supports them.
+func (p *DNSProxy) checkUpstreamCookie(server string, response *dns.Msg) error {
+	if !p.dnsCookies {
+		return nil
+	}
+	opt := response.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	data, ok := findCookie(opt)
+	if !ok {
+		return nil
+	}
+	removeOption(opt, dns.EDNS0COOKIE)
+
+	cookie := p.upstreamCookieFor(server)
+	if len(data) < clientCookieLen || !bytes.Equal(data[:clientCookieLen], cookie.client[:]) {
+		logger.Debug("DNS cookie from upstream %s does not match our client cookie", server)
+		return fmt.Errorf("response from %s has a mismatched DNS cookie", server)
+	}
+
+	serverCookie := data[clientCookieLen:]
+	if len(serverCookie) < 8 || len(serverCookie) > 32 {
+		logger.Debug("DNS cookie from upstream %s has an invalid server cookie length %d", server, len(serverCookie))
+		return nil
+	}
+
+	cookie.mu.Lock()
+	cookie.server = serverCookie
+	cookie.mu.Unlock()
+	return nil
+}
+
+// setClientCookie answers the cookie a client sent in query by putting its client cookie
+// and a fresh server cookie in response. The cookie is refreshed whether or not the
+// server cookie the client sent is still valid.
+func (p *DNSProxy) setClientCookie(query, response *dns.Msg, clientAddr net.Addr) {
+	if !p.dnsCookies {
+		return
+	}
+	queryOpt := query.IsEdns0()
+	if queryOpt == nil {
+		return
+	}
+	data, ok := findCookie(queryOpt)
+	if !ok || len(data) < clientCookieLen {
+		return
+	}
+	addrPort, err := netip.ParseAddrPort(clientAddr.String())
+	if err != nil {
+		return
+	}
+	clientIP := addrPort.Addr().Unmap()
+
+	clientCookie := data[:clientCookieLen]
+	if len(data) > clientCookieLen {
+		if p.validServerCookie(clientCookie, data[clientCookieLen:], clientIP, time.Now()) {
+			logger.Debug("Refreshing DNS cookie of %s", clientIP)
+		} else {
+			logger.Debug("Invalid DNS server cookie from %s, issuing a new one", clientIP)
+		}
+	}
+
+	opt := response.IsEdns0()
+	if opt == nil {
+		response.SetEdns0(queryOpt.UDPSize(), queryOpt.Do())
+		opt = response.IsEdns0()
+	}
+	removeOption(opt, dns.EDNS0COOKIE)
+	fresh := append(bytes.Clone(clientCookie), p.serverCookie(clientCookie, clientIP, time.Now())...)
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(fresh)})
+}
+
+// serverCookie returns the server cookie issued at now to the client with clientCookie at clientIP
+func (p *DNSProxy) serverCookie(clientCookie []byte, clientIP netip.Addr, now time.Time) []byte {
+	cookie := make([]byte, serverCookieLen)
+	cookie[0] = serverCookieVersion
+	binary.BigEndian.PutUint32(cookie[4:8], uint32(now.Unix()))
+	copy(cookie[8:], p.serverCookieHash(clientCookie, cookie[:8], clientIP))
+	return cookie
+}
+
+// validServerCookie reports whether serverCookie was issued by the proxy to the client
+// with clientCookie at clientIP and has not expired
+func (p *DNSProxy) validServerCookie(clientCookie, serverCookie []byte, clientIP netip.Addr, now time.Time) bool {
+	if len(serverCookie) != serverCookieLen || serverCookie[0] != serverCookieVersion {
+		return false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint32(serverCookie[4:8])), 0)
+	if now.Sub(issued) > serverCookieLifetime || issued.Sub(now) > serverCookieClockSkew {
+		return false
+	}
+	return hmac.Equal(serverCookie[8:], p.serverCookieHash(clientCookie, serverCookie[:8], clientIP))
+}
+
+// serverCookieHash returns the 8 byte hash of a server cookie over the client cookie,
+// the cookie header and the client address
+func (p *DNSProxy) serverCookieHash(clientCookie, header []byte, clientIP netip.Addr) []byte {
+	p.cookieSecretOnce.Do(func() {
+		p.cookieSecret = make([]byte, 32)
+		rand.Read(p.cookieSecret)
+	})
+
+	mac := hmac.New(sha256.New, p.cookieSecret)
+	mac.Write(clientCookie)
+	mac.Write(header)
+	mac.Write(clientIP.AsSlice())
+	return mac.Sum(nil)[:8]
+}
+
+// findCookie returns the decoded cookie option of opt
+func findCookie(opt *dns.OPT) ([]byte, bool) {
+	for _, o := range opt.Option {
+		if cookie, ok := o.(*dns.EDNS0_COOKIE); ok {
+			data, err := hex.DecodeString(cookie.Cookie)
+			if err != nil {
+				return nil, false
+			}
+			return data, true
+		}
+	}
+	return nil, false
+}
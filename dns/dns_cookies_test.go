@@ -0,0 +1,167 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cookieUpstream is a raw upstream that answers with a server cookie, echoing the
+// client cookie unless spoof is set
+type cookieUpstream struct {
+	conn     net.PacketConn
+	received chan []byte // cookie data of each query
+	spoof    atomic.Bool
+}
+
+func startCookieUpstream(t *testing.T) *cookieUpstream {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	u := &cookieUpstream{conn: conn, received: make(chan []byte, 1)}
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := new(dns.Msg)
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			var data []byte
+			if opt := query.IsEdns0(); opt != nil {
+				data, _ = findCookie(opt)
+			}
+			u.received <- data
+
+			reply := new(dns.Msg)
+			reply.SetReply(query)
+			reply.SetEdns0(1232, false)
+			client := bytes.Clone(data[:clientCookieLen])
+			if u.spoof.Load() {
+				client[0] ^= 0xff
+			}
+			cookie := append(client, []byte("server-cookie-01")...)
+			reply.IsEdns0().Option = append(reply.IsEdns0().Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(cookie)})
+			out, _ := reply.Pack()
+			conn.WriteTo(out, addr)
+		}
+	}()
+	return u
+}
+
+func TestUpstreamDNSCookies(t *testing.T) {
+	upstream := startCookieUpstream(t)
+	server := upstream.conn.LocalAddr().String()
+
+	proxy := &DNSProxy{}
+	WithDNSCookiesEnabled(true)(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	response, err := proxy.queryUpstream(context.Background(), server, query, time.Second)
+	if err != nil {
+		t.Fatalf("Upstream query failed: %v", err)
+	}
+	first := <-upstream.received
+	if len(first) != clientCookieLen {
+		t.Fatalf("Expected only a client cookie on the first query, got %x", first)
+	}
+	if response.IsEdns0() != nil {
+		t.Errorf("Expected the OPT record added for the cookie to be stripped, got %v", response.IsEdns0())
+	}
+
+	// The server cookie is sent back with the same client cookie
+	if _, err := proxy.queryUpstream(context.Background(), server, query, time.Second); err != nil {
+		t.Fatalf("Upstream query failed: %v", err)
+	}
+	second := <-upstream.received
+	if !bytes.Equal(second[:clientCookieLen], first) || string(second[clientCookieLen:]) != "server-cookie-01" {
+		t.Errorf("Expected the client cookie and server cookie to be reused, got %x", second)
+	}
+
+	upstream.spoof.Store(true)
+	if _, err := proxy.queryUpstream(context.Background(), server, query, time.Second); err == nil {
+		t.Error("Expected a response with a mismatched client cookie to be rejected")
+	}
+	<-upstream.received
+}
+
+func TestClientDNSCookies(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	WithDNSCookiesEnabled(true)(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	clientCookie := []byte("client01")
+	exchange := func(cookie []byte) []byte {
+		query := new(dns.Msg)
+		query.SetQuestion("app.example.com.", dns.TypeA)
+		query.SetEdns0(1232, false)
+		query.IsEdns0().Option = append(query.IsEdns0().Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(cookie)})
+
+		response := new(dns.Msg)
+		if err := response.Unpack(exchangeUDP(t, proxy, query)); err != nil {
+			t.Fatalf("Failed to unpack response: %v", err)
+		}
+		if response.IsEdns0() == nil {
+			t.Fatal("Expected an OPT record in the response")
+		}
+		data, ok := findCookie(response.IsEdns0())
+		if !ok || len(data) != clientCookieLen+serverCookieLen || !bytes.Equal(data[:clientCookieLen], clientCookie) {
+			t.Fatalf("Expected the client cookie and a server cookie, got %x", data)
+		}
+		return data
+	}
+
+	clientIP := netip.MustParseAddr("127.0.0.1")
+	first := exchange(clientCookie)
+	if !proxy.validServerCookie(clientCookie, first[clientCookieLen:], clientIP, time.Now()) {
+		t.Error("Expected the issued server cookie to be valid")
+	}
+
+	refreshed := exchange(first)
+	if !proxy.validServerCookie(clientCookie, refreshed[clientCookieLen:], clientIP, time.Now()) {
+		t.Error("Expected the refreshed server cookie to be valid")
+	}
+}
+
+func TestValidServerCookie(t *testing.T) {
+	proxy := &DNSProxy{}
+	clientCookie := []byte("client01")
+	clientIP := netip.MustParseAddr("10.0.0.1")
+	now := time.Now()
+	cookie := proxy.serverCookie(clientCookie, clientIP, now)
+
+	if !proxy.validServerCookie(clientCookie, cookie, clientIP, now) {
+		t.Error("Expected the cookie to be valid")
+	}
+	if proxy.validServerCookie(clientCookie, cookie, netip.MustParseAddr("10.0.0.2"), now) {
+		t.Error("Expected the cookie to be bound to the client address")
+	}
+	if proxy.validServerCookie([]byte("client02"), cookie, clientIP, now) {
+		t.Error("Expected the cookie to be bound to the client cookie")
+	}
+	if proxy.validServerCookie(clientCookie, cookie, clientIP, now.Add(2*time.Hour)) {
+		t.Error("Expected the cookie to expire")
+	}
+
+	tampered := bytes.Clone(cookie)
+	tampered[15] ^= 1
+	if proxy.validServerCookie(clientCookie, tampered, clientIP, now) {
+		t.Error("Expected a tampered cookie to be invalid")
+	}
+}
@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"math"
+	"strings"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// WithDGADetection flags queries whose leftmost label looks machine generated, as domain
+// generation algorithms used by malware produce. A label is suspicious when its Shannon
+// entropy in bits per character is above threshold; ordinary names stay below about 3.5.
+// Only queries that would go upstream are checked. Suspicious queries are counted in
+// DGASuspiciousQueriesTotal and still forwarded unless WithDGABlock is set.
+func WithDGADetection(threshold float64) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dgaThreshold = threshold
+	}
+}
+
+// WithDGAAlertFunc sets a function called for each query flagged by DGA detection
+// fn runs on the query path and should return quickly.
+func WithDGAAlertFunc(fn func(query *dns.Msg, entropy float64)) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dgaAlert = fn
+	}
+}
+
+// WithDGABlock refuses queries flagged by DGA detection instead of forwarding them
+func WithDGABlock(block bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dgaBlock = block
+	}
+}
+
+// DGASuspiciousQueriesTotal returns how many queries DGA detection has flagged
+func (p *DNSProxy) DGASuspiciousQueriesTotal() uint64 {
+	return p.counters().dgaSuspicious.Load()
+}
+
+// checkDGA reports whether query should be refused as a likely DGA name, alerting on
+// every suspicious query
+func (p *DNSProxy) checkDGA(query *dns.Msg, question dns.Question) bool {
+	if p.dgaThreshold <= 0 {
+		return false
+	}
+
+	label, _, _ := strings.Cut(question.Name, ".")
+	entropy := shannonEntropy(strings.ToLower(label))
+	if entropy <= p.dgaThreshold {
+		return false
+	}
+
+	p.counters().dgaSuspicious.Add(1)
+	logger.Warn("Possible DGA domain %s: label entropy %.2f bits/char is above %.2f", question.Name, entropy, p.dgaThreshold)
+	if p.dgaAlert != nil {
+		p.dgaAlert(query, entropy)
+	}
+	return p.dgaBlock
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
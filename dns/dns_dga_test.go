@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"mail", 2},
+		{"a1b2c3d4e5f60789", 4},
+	}
+	for _, tt := range tests {
+		if got := shannonEntropy(tt.s); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("shannonEntropy(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestDGADetection(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 0)
+
+	var alerts []string
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithDGADetection(3.5)(proxy)
+	WithDGAAlertFunc(func(query *dns.Msg, entropy float64) {
+		alerts = append(alerts, query.Question[0].Name)
+	})(proxy)
+
+	resolve := func(name string) *dns.Msg {
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+		return proxy.resolveQuery(context.Background(), query, query.Question[0])
+	}
+
+	if response := resolve("mail.example.com."); response == nil || response.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected mail.example.com. to resolve, got %v", response)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Expected no alert for a normal label, got %v", alerts)
+	}
+
+	if response := resolve("a1b2c3d4e5f60789.example.com."); response == nil || response.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected the suspicious query to still be forwarded, got %v", response)
+	}
+	if len(alerts) != 1 || alerts[0] != "a1b2c3d4e5f60789.example.com." {
+		t.Errorf("Expected an alert for the hex label, got %v", alerts)
+	}
+	if n := proxy.DGASuspiciousQueriesTotal(); n != 1 {
+		t.Errorf("Expected 1 suspicious query, got %d", n)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("Expected both queries upstream, got %d", n)
+	}
+
+	WithDGABlock(true)(proxy)
+	if response := resolve("f0e1d2c3b4a59687.example.com."); response == nil || response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected the suspicious query to be refused, got %v", response)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("Expected the blocked query not to go upstream, got %d upstream queries", n)
+	}
+}
+
+func TestDGADetectionOff(t *testing.T) {
+	proxy := &DNSProxy{}
+	query := new(dns.Msg)
+	query.SetQuestion("a1b2c3d4e5f60789.example.com.", dns.TypeA)
+	if proxy.checkDGA(query, query.Question[0]) || proxy.DGASuspiciousQueriesTotal() != 0 {
+		t.Error("Expected no detection without WithDGADetection")
+	}
+}
@@ -0,0 +1,224 @@
+package dns
+
+import (
+	"crypto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// rrsigValidity is how long signatures made for a response stay valid. Inception
+// is backdated by rrsigClockSkew to allow for resolvers with slow clocks.
+const (
+	rrsigValidity  = 24 * time.Hour
+	rrsigClockSkew = time.Hour
+)
+
+// zoneSigningKey is the key a zone is signed with
+type zoneSigningKey struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// WithZoneSigningKey enables DNSSEC for the local records under zone. key is the
+// public DNSKEY answered for DNSKEY queries at zone and signer its private key. For
+// queries with the DO bit set, answers get an RRSIG per RRset, taken from
+// DNSRecordStore.SignZone when it signed them with this key and made with signer
+// otherwise. NODATA responses get an SOA and an NSEC record listing the types that
+// exist for the name, each with an RRSIG.
+func WithZoneSigningKey(zone string, key *dns.DNSKEY, signer crypto.Signer) DNSProxyOption {
+	return func(p *DNSProxy) {
+		if p.zoneKeys == nil {
+			p.zoneKeys = make(map[string]zoneSigningKey)
+		}
+		p.zoneKeys[strings.ToLower(dns.Fqdn(zone))] = zoneSigningKey{key: key, signer: signer}
+	}
+}
+
+// GetTypeBitmap returns the record types domain has, sorted, as listed in an NSEC type bitmap
+func (s *DNSRecordStore) GetTypeBitmap(domain string) []uint16 {
+	return typeBitmap(s, domain)
+}
+
+// GetTypeBitmap returns the record types domain has, sorted, as listed in an NSEC type bitmap
+func (s *ShardedDNSRecordStore) GetTypeBitmap(domain string) []uint16 {
+	return typeBitmap(s, domain)
+}
+
+func typeBitmap(store RecordStore, domain string) []uint16 {
+	var types []uint16
+	if store.HasRecord(domain, RecordTypeA) {
+		types = append(types, dns.TypeA)
+	}
+	if store.HasRecord(domain, RecordTypeAAAA) {
+		types = append(types, dns.TypeAAAA)
+	}
+	if IsReverseDNSDomain(domain) {
+		if _, ok := store.GetAllPTRRecords(domain); ok {
+			types = append(types, dns.TypePTR)
+		}
+	} else if len(store.GetServicePTRRecords(domain)) > 0 {
+		types = append(types, dns.TypePTR)
+	}
+	if len(store.GetCAARecords(domain)) > 0 {
+		types = append(types, dns.TypeCAA)
+	}
+	if len(store.GetHTTPSRecords(domain)) > 0 {
+		types = append(types, dns.TypeHTTPS)
+	}
+	if len(store.GetNAPTRRecords(domain)) > 0 {
+		types = append(types, dns.TypeNAPTR)
+	}
+	if len(store.GetSRVRecords(domain)) > 0 {
+		types = append(types, dns.TypeSRV)
+	}
+	if len(store.GetTXTRecords(domain)) > 0 {
+		types = append(types, dns.TypeTXT)
+	}
+
+	slices.Sort(types)
+	return types
+}
+
+// signingZone returns the closest zone with a signing key that contains name
+func (p *DNSProxy) signingZone(name string) (string, zoneSigningKey, bool) {
+	best := ""
+	for zone := range p.zoneKeys {
+		if dns.IsSubDomain(zone, name) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	zk, ok := p.zoneKeys[best]
+	return best, zk, ok
+}
+
+// addDenialOfExistence adds a signed SOA and NSEC to a NODATA response for a
+// DNSSEC-aware client. The NSEC covers only the queried name (RFC 4470 minimally
+// covering), so the zone cannot be enumerated by walking the NSEC chain.
+func (p *DNSProxy) addDenialOfExistence(store RecordStore, query, response *dns.Msg) {
+	if opt := query.IsEdns0(); opt == nil || !opt.Do() {
+		return
+	}
+	name := strings.ToLower(query.Question[0].Name)
+	zone, zk, ok := p.signingZone(name)
+	if !ok {
+		return
+	}
+
+	soa := p.zoneSOA(zone)
+	// The NSEC TTL follows the SOA minimum, RFC 4035 section 2.3
+	nsec := &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    min(soa.Minttl, soa.Hdr.Ttl),
+		},
+		NextDomain: "\\000." + name,
+		TypeBitMap: append(store.GetTypeBitmap(name), dns.TypeRRSIG, dns.TypeNSEC),
+	}
+	slices.Sort(nsec.TypeBitMap)
+
+	for _, rr := range []dns.RR{soa, nsec} {
+		sig, err := signRRset(zone, zk, []dns.RR{rr})
+		if err != nil {
+			logger.Warn("Failed to sign %s for %s: %v", dns.TypeToString[rr.Header().Rrtype], name, err)
+			return
+		}
+		response.Ns = append(response.Ns, rr, sig)
+	}
+}
+
+// signRRset returns the RRSIG over rrset made with the zone's key
+func signRRset(zone string, zk zoneSigningKey, rrset []dns.RR) (*dns.RRSIG, error) {
+	now := time.Now()
+	sig := &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Name:   rrset[0].Header().Name,
+			Rrtype: dns.TypeRRSIG,
+			Class:  dns.ClassINET,
+			Ttl:    rrset[0].Header().Ttl,
+		},
+		Algorithm:  zk.key.Algorithm,
+		KeyTag:     zk.key.KeyTag(),
+		SignerName: zone,
+		Inception:  uint32(now.Add(-rrsigClockSkew).Unix()),
+		Expiration: uint32(now.Add(rrsigValidity).Unix()),
+	}
+	if err := sig.Sign(zk.signer, rrset); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// signedRecordStore is implemented by record stores that can serve the signatures
+// made by SignZone
+type signedRecordStore interface {
+	GetRRSIG(domain string, rrtype uint16) (dns.RRSIG, bool)
+}
+
+// addRRSIGs adds an RRSIG for each RRset in the answer under a zone with a signing key
+// when the client set the DO bit. A signature made by SignZone is used when it was made
+// with the zone's key, otherwise the RRset is signed now.
+func (p *DNSProxy) addRRSIGs(store RecordStore, query, response *dns.Msg) {
+	if opt := query.IsEdns0(); opt == nil || !opt.Do() {
+		return
+	}
+	signed, _ := store.(signedRecordStore)
+
+	rrsets := make(map[rrsetKey][]dns.RR)
+	var order []rrsetKey
+	for _, rr := range response.Answer {
+		hdr := rr.Header()
+		key := rrsetKey{name: strings.ToLower(hdr.Name), rrtype: hdr.Rrtype}
+		if _, ok := rrsets[key]; !ok {
+			order = append(order, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+
+	for _, key := range order {
+		rrset := rrsets[key]
+		zone, zk, ok := p.signingZone(key.name)
+		if !ok {
+			continue
+		}
+		if signed != nil {
+			if sig, ok := signed.GetRRSIG(key.name, key.rrtype); ok && madeWith(&sig, zone, zk) {
+				sig.Hdr.Name = rrset[0].Header().Name
+				response.Answer = append(response.Answer, &sig)
+				continue
+			}
+		}
+		sig, err := signRRset(zone, zk, rrset)
+		if err != nil {
+			logger.Warn("Failed to sign %s for %s: %v", dns.TypeToString[key.rrtype], key.name, err)
+			continue
+		}
+		response.Answer = append(response.Answer, sig)
+	}
+}
+
+// madeWith reports whether sig was made with the signing key of zone
+func madeWith(sig *dns.RRSIG, zone string, zk zoneSigningKey) bool {
+	return sig.SignerName == zone && sig.Algorithm == zk.key.Algorithm && sig.KeyTag == zk.key.KeyTag()
+}
+
+// checkLocalDNSKEY answers DNSKEY queries at the apex of a zone with a signing key
+func (p *DNSProxy) checkLocalDNSKEY(query *dns.Msg, question dns.Question) *dns.Msg {
+	zk, ok := p.zoneKeys[strings.ToLower(dns.Fqdn(question.Name))]
+	if !ok {
+		return nil
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+	key := *zk.key
+	key.Hdr.Name = question.Name
+	response.Answer = append(response.Answer, &key)
+	return response
+}
@@ -0,0 +1,284 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newTestZoneKey generates an ECDSA P-256 zone signing key for zone
+func newTestZoneKey(t *testing.T, zone string) (*dns.DNSKEY, crypto.Signer) {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Failed to generate zone key: %v", err)
+	}
+	return key, priv.(crypto.Signer)
+}
+
+func TestGetTypeBitmap(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	store.AddTXTRecord("app.internal.", []string{"v=spf1 -all"})
+	store.AddRecord("*.svc.internal.", net.ParseIP("fd00::1"))
+
+	if got := store.GetTypeBitmap("APP.internal"); !slices.Equal(got, []uint16{dns.TypeA, dns.TypeTXT}) {
+		t.Errorf("Expected A and TXT, got %v", got)
+	}
+	if got := store.GetTypeBitmap("api.svc.internal."); !slices.Equal(got, []uint16{dns.TypeAAAA}) {
+		t.Errorf("Expected the wildcard AAAA, got %v", got)
+	}
+	if got := store.GetTypeBitmap("missing.internal."); len(got) != 0 {
+		t.Errorf("Expected no types, got %v", got)
+	}
+}
+
+func TestNODATANSEC(t *testing.T) {
+	key, signer := newTestZoneKey(t, "internal.")
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithZoneSigningKey("internal", key, signer)(proxy)
+	proxy.recordStore.AddRecord("plain.internal.", net.ParseIP("10.0.0.1"))
+
+	query := new(dns.Msg)
+	query.SetQuestion("plain.internal.", dns.TypeHTTPS)
+	query.SetEdns0(dns.DefaultMsgSize, true)
+
+	response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 0 {
+		t.Fatalf("Expected a NODATA response, got %v", response)
+	}
+
+	var soa *dns.SOA
+	var nsec *dns.NSEC
+	sigs := map[uint16]*dns.RRSIG{}
+	for _, rr := range response.Ns {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			soa = rr
+		case *dns.NSEC:
+			nsec = rr
+		case *dns.RRSIG:
+			sigs[rr.TypeCovered] = rr
+		}
+	}
+	if soa == nil || nsec == nil {
+		t.Fatalf("Expected an SOA and NSEC in the authority section, got %v", response.Ns)
+	}
+	if want := []uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC}; !slices.Equal(nsec.TypeBitMap, want) {
+		t.Errorf("Expected type bitmap %v, got %v", want, nsec.TypeBitMap)
+	}
+	if nsec.NextDomain != "\\000.plain.internal." {
+		t.Errorf("Expected a minimally covering NSEC, got next domain %s", nsec.NextDomain)
+	}
+	for _, rr := range []dns.RR{soa, nsec} {
+		sig := sigs[rr.Header().Rrtype]
+		if sig == nil {
+			t.Fatalf("Expected an RRSIG over %s", dns.TypeToString[rr.Header().Rrtype])
+		}
+		if err := sig.Verify(key, []dns.RR{rr}); err != nil {
+			t.Errorf("RRSIG over %s does not verify: %v", dns.TypeToString[rr.Header().Rrtype], err)
+		}
+	}
+
+	// Clients that did not ask for DNSSEC get a plain NODATA
+	plain := new(dns.Msg)
+	plain.SetQuestion("plain.internal.", dns.TypeHTTPS)
+	if response := proxy.checkLocalRecords(context.Background(), plain, plain.Question[0]); response == nil || len(response.Ns) != 0 {
+		t.Errorf("Expected no DNSSEC records without the DO bit, got %v", response)
+	}
+
+	// Names outside the signed zone are not signed
+	proxy.recordStore.AddRecord("plain.other.", net.ParseIP("10.0.0.2"))
+	query.SetQuestion("plain.other.", dns.TypeHTTPS)
+	if response := proxy.checkLocalRecords(context.Background(), query, query.Question[0]); response == nil || len(response.Ns) != 0 {
+		t.Errorf("Expected no DNSSEC records outside the zone, got %v", response)
+	}
+}
+
+func TestSignZone(t *testing.T) {
+	key, signer := newTestZoneKey(t, "internal.")
+	store := NewDNSRecordStore(WithSigningZone("internal"))
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.2"))
+	store.AddTXTRecord("app.internal.", []string{"v=spf1 -all"})
+	store.AddSRVRecord("_http._tcp.internal.", SRVRecord{Priority: 10, Weight: 5, Port: 80, Target: "app.internal."})
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.3"))
+
+	now := time.Now()
+	if err := store.SignZone(key.KeyTag(), key.Algorithm, signer, now.Add(-time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatalf("SignZone failed: %v", err)
+	}
+	if _, ok := store.GetRRSIG("app.example.com.", dns.TypeA); ok {
+		t.Error("Expected names outside the zone to be left unsigned")
+	}
+
+	proxy := &DNSProxy{recordStore: store}
+	WithZoneSigningKey("internal", key, signer)(proxy)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeTXT, dns.TypeSRV} {
+		name := "APP.internal."
+		if qtype == dns.TypeSRV {
+			name = "_http._tcp.internal."
+		}
+		query := new(dns.Msg)
+		query.SetQuestion(name, qtype)
+		query.SetEdns0(dns.DefaultMsgSize, true)
+
+		response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+		if response == nil {
+			t.Fatalf("Expected a local %s answer", dns.TypeToString[qtype])
+		}
+		var rrset []dns.RR
+		var sig *dns.RRSIG
+		for _, rr := range response.Answer {
+			if s, ok := rr.(*dns.RRSIG); ok {
+				sig = s
+			} else {
+				rrset = append(rrset, rr)
+			}
+		}
+		if sig == nil {
+			t.Fatalf("Expected an RRSIG in the %s answer, got %v", dns.TypeToString[qtype], response.Answer)
+		}
+		if err := sig.Verify(key, rrset); err != nil {
+			t.Errorf("RRSIG over %s does not verify: %v", dns.TypeToString[qtype], err)
+		}
+	}
+
+	// DNSKEY queries return the public key at the zone apex instead of going upstream
+	proxy.upstreamDNS = []string{"127.0.0.1:1"}
+	query := new(dns.Msg)
+	query.SetQuestion("internal.", dns.TypeDNSKEY)
+	response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 1 {
+		t.Fatalf("Expected a DNSKEY answer, got %v", response)
+	}
+	if got := response.Answer[0].(*dns.DNSKEY); got.PublicKey != key.PublicKey || got.KeyTag() != key.KeyTag() {
+		t.Errorf("Expected the zone's public key, got %v", got)
+	}
+
+	// Without the DO bit no signatures are sent
+	query.SetQuestion("app.internal.", dns.TypeA)
+	if response := proxy.checkLocalRecords(context.Background(), query, query.Question[0]); len(response.Answer) != 2 {
+		t.Errorf("Expected only the A records without the DO bit, got %v", response.Answer)
+	}
+}
+
+func TestSignZoneErrors(t *testing.T) {
+	key, signer := newTestZoneKey(t, "internal.")
+	now := time.Now()
+
+	if err := NewDNSRecordStore().SignZone(key.KeyTag(), key.Algorithm, signer, now, now.Add(time.Hour)); !errors.Is(err, ErrNoSigningZone) {
+		t.Errorf("Expected ErrNoSigningZone, got %v", err)
+	}
+	// One higher is the tag of the same key with the SEP flag, which is accepted
+	store := NewDNSRecordStore(WithSigningZone("internal."))
+	if err := store.SignZone(key.KeyTag()+2, key.Algorithm, signer, now, now.Add(time.Hour)); err == nil {
+		t.Error("Expected a key tag that does not match the key to be rejected")
+	}
+}
+
+// answerRRSIG resolves name with the DO bit set and returns the answer RRset and its RRSIG
+func answerRRSIG(t *testing.T, proxy *DNSProxy, name string, qtype uint16) ([]dns.RR, *dns.RRSIG) {
+	t.Helper()
+
+	query := new(dns.Msg)
+	query.SetQuestion(name, qtype)
+	query.SetEdns0(dns.DefaultMsgSize, true)
+	response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil {
+		t.Fatalf("Expected a local answer for %s", name)
+	}
+
+	var rrset []dns.RR
+	var sig *dns.RRSIG
+	for _, rr := range response.Answer {
+		if s, ok := rr.(*dns.RRSIG); ok {
+			sig = s
+		} else {
+			rrset = append(rrset, rr)
+		}
+	}
+	if sig == nil {
+		t.Fatalf("Expected an RRSIG for %s, got %v", name, response.Answer)
+	}
+	return rrset, sig
+}
+
+func TestSignZoneAfterChanges(t *testing.T) {
+	key, signer := newTestZoneKey(t, "internal.")
+	store := NewDNSRecordStore(WithSigningZone("internal"))
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	store.AddTXTRecord("app.internal.", []string{"v=1"})
+
+	now := time.Now()
+	if err := store.SignZone(key.KeyTag(), key.Algorithm, signer, now.Add(-time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatalf("SignZone failed: %v", err)
+	}
+	proxy := &DNSProxy{recordStore: store}
+	WithZoneSigningKey("internal", key, signer)(proxy)
+
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.2"))
+	if _, ok := store.GetRRSIG("app.internal.", dns.TypeA); ok {
+		t.Error("Expected adding a record to drop the stale signature")
+	}
+	rrset, sig := answerRRSIG(t, proxy, "app.internal.", dns.TypeA)
+	if len(rrset) != 2 {
+		t.Fatalf("Expected both A records, got %v", rrset)
+	}
+	if err := sig.Verify(key, rrset); err != nil {
+		t.Errorf("RRSIG over the changed A RRset does not verify: %v", err)
+	}
+
+	store.RemoveRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	rrset, sig = answerRRSIG(t, proxy, "app.internal.", dns.TypeA)
+	if err := sig.Verify(key, rrset); len(rrset) != 1 || err != nil {
+		t.Errorf("Expected a valid RRSIG over the remaining A record, got %v for %v", err, rrset)
+	}
+
+	store.AddTXTRecord("app.internal.", []string{"v=2"})
+	rrset, sig = answerRRSIG(t, proxy, "app.internal.", dns.TypeTXT)
+	if err := sig.Verify(key, rrset); len(rrset) != 2 || err != nil {
+		t.Errorf("Expected a valid RRSIG over both TXT records, got %v for %v", err, rrset)
+	}
+}
+
+func TestSignZoneUsesProxyKey(t *testing.T) {
+	storeKey, storeSigner := newTestZoneKey(t, "internal.")
+	proxyKey, proxySigner := newTestZoneKey(t, "internal.")
+	store := NewDNSRecordStore(WithSigningZone("internal"))
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+
+	now := time.Now()
+	if err := store.SignZone(storeKey.KeyTag(), storeKey.Algorithm, storeSigner, now.Add(-time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatalf("SignZone failed: %v", err)
+	}
+	proxy := &DNSProxy{recordStore: store}
+	WithZoneSigningKey("internal", proxyKey, proxySigner)(proxy)
+
+	// Signatures made with another key than the published one are not served
+	rrset, sig := answerRRSIG(t, proxy, "app.internal.", dns.TypeA)
+	if err := sig.Verify(proxyKey, rrset); err != nil {
+		t.Errorf("Expected the RRSIG to verify with the published key: %v", err)
+	}
+
+	// Without a published key for the zone nothing is signed
+	query := new(dns.Msg)
+	query.SetQuestion("app.internal.", dns.TypeA)
+	query.SetEdns0(dns.DefaultMsgSize, true)
+	unsigned := &DNSProxy{recordStore: store}
+	if response := unsigned.checkLocalRecords(context.Background(), query, query.Question[0]); len(response.Answer) != 1 {
+		t.Errorf("Expected no RRSIG without a zone signing key, got %v", response.Answer)
+	}
+}
@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// DoHPath is the path DNS over HTTPS queries are served on
+const DoHPath = "/dns-query"
+
+// dohContentType is the media type of DNS messages in DNS over HTTPS (RFC 8484)
+const dohContentType = "application/dns-message"
+
+// WithDoHServerAddr serves DNS over HTTPS (RFC 8484) over HTTP/2 on a host TCP
+// address such as ":443", started by Start. It needs WithDoHTLSConfig.
+func WithDoHServerAddr(addr string) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dohAddr = addr
+	}
+}
+
+// WithDoHTLSConfig sets the TLS config of the HTTP/2 DNS over HTTPS server
+func WithDoHTLSConfig(cfg *tls.Config) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dohTLSConfig = cfg
+	}
+}
+
+// WithDoH3ServerAddr serves DNS over HTTPS over HTTP/3 on a host UDP address, started
+// by Start alongside any HTTP/2 server. It needs WithDoH3TLSConfig and a build with the
+// quic tag, without it Start fails.
+func WithDoH3ServerAddr(addr string) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.doh3Addr = addr
+	}
+}
+
+// WithDoH3TLSConfig sets the TLS config of the HTTP/3 DNS over HTTPS server
+func WithDoH3TLSConfig(cfg *tls.Config) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.doh3TLSConfig = cfg
+	}
+}
+
+// DoHHandler returns a DNS over HTTPS handler answering queries sent as the body of a
+// POST or in the dns parameter of a GET, the same way as queries over UDP but without
+// truncating responses
+func (p *DNSProxy) DoHHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query []byte
+		switch r.Method {
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != dohContentType {
+				http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, dns.MaxMsgSize))
+			if err != nil {
+				http.Error(w, "failed to read query", http.StatusBadRequest)
+				return
+			}
+			query = body
+		case http.MethodGet:
+			decoded, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+			if err != nil {
+				http.Error(w, "invalid dns parameter", http.StatusBadRequest)
+				return
+			}
+			query = decoded
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if len(query) < 12 {
+			http.Error(w, "query too short", http.StatusBadRequest)
+			return
+		}
+
+		response := p.answerQuery(query, dohClientAddr(r), false)
+		if response == nil {
+			http.Error(w, "no DNS response", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(response)
+	})
+}
+
+// dohClientAddr returns the address of the client that sent r
+func dohClientAddr(r *http.Request) net.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return net.TCPAddrFromAddrPort(addrPort)
+}
+
+// validateDoH checks the DNS over HTTPS servers have TLS configs
+func (p *DNSProxy) validateDoH() error {
+	if p.dohAddr != "" && p.dohTLSConfig == nil {
+		return fmt.Errorf("DoH server %s needs a TLS config", p.dohAddr)
+	}
+	if p.doh3Addr != "" && p.doh3TLSConfig == nil {
+		return fmt.Errorf("DoH3 server %s needs a TLS config", p.doh3Addr)
+	}
+	return nil
+}
+
+// startDoH starts the configured DNS over HTTPS servers, which are closed when the
+// proxy stops
+func (p *DNSProxy) startDoH() error {
+	if p.dohAddr == "" && p.doh3Addr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(DoHPath, p.DoHHandler())
+
+	var ln net.Listener
+	if p.dohAddr != "" {
+		var err error
+		ln, err = net.Listen("tcp", p.dohAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for DoH: %w", err)
+		}
+	}
+
+	if p.doh3Addr != "" {
+		if err := p.startDoH3(mux); err != nil {
+			if ln != nil {
+				ln.Close()
+			}
+			return err
+		}
+	}
+
+	if ln != nil {
+		// ServeTLS offers h2 through ALPN unless the config sets its own protocols
+		server := &http.Server{Handler: mux, TLSConfig: p.dohTLSConfig.Clone()}
+		go func() {
+			<-p.ctx.Done()
+			server.Close()
+		}()
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			logger.Info("DNS over HTTPS listening on %s", ln.Addr())
+			if err := server.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("DoH server failed: %v", err)
+			}
+		}()
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build quic
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// startDoH3 serves handler over HTTP/3 on the DoH3 address until the proxy stops
+func (p *DNSProxy) startDoH3(handler http.Handler) error {
+	conn, err := net.ListenPacket("udp", p.doh3Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for DoH3: %w", err)
+	}
+
+	server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(p.doh3TLSConfig.Clone()),
+	}
+	go func() {
+		<-p.ctx.Done()
+		server.Close()
+		conn.Close()
+	}()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		logger.Info("DNS over HTTP/3 listening on %s", conn.LocalAddr())
+		if err := server.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) && p.ctx.Err() == nil {
+			logger.Error("DoH3 server failed: %v", err)
+		}
+	}()
+
+	return nil
+}
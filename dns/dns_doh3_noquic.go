@@ -0,0 +1,13 @@
+//go:build !quic
+
+package dns
+
+import (
+	"errors"
+	"net/http"
+)
+
+// startDoH3 fails: HTTP/3 needs quic-go, which is only built in with the quic tag
+func (p *DNSProxy) startDoH3(handler http.Handler) error {
+	return errors.New("DoH3 server needs a build with the quic tag")
+}
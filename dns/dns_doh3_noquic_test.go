@@ -0,0 +1,23 @@
+//go:build !quic
+
+package dns
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/fosrl/olm/device"
+)
+
+func TestDoH3NeedsQuicTag(t *testing.T) {
+	p, err := NewDNSProxy(device.NewMiddleDevice(nil), 1420, "100.96.128.0/24", []string{"127.0.0.1:1"}, false, "",
+		WithDoH3ServerAddr("127.0.0.1:0"), WithDoH3TLSConfig(&tls.Config{}))
+	if err != nil {
+		t.Fatalf("NewDNSProxy failed: %v", err)
+	}
+	if err := p.Start(); err == nil {
+		p.Stop()
+		t.Fatal("Expected Start to fail without the quic tag")
+	}
+	p.Stop()
+}
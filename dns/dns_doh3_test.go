@@ -0,0 +1,90 @@
+//go:build quic
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestDoH3MatchesDoH(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: ctx, cancel: cancel}
+	proxy.recordStore.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	proxy.recordStore.AddRecord("app.internal.", net.ParseIP("fd00::1"))
+
+	h2 := httptest.NewUnstartedServer(proxy.DoHHandler())
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	// Find a free UDP port for the HTTP/3 server, which is given an address to listen on
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a UDP port: %v", err)
+	}
+	proxy.doh3Addr = conn.LocalAddr().String()
+	conn.Close()
+
+	proxy.doh3TLSConfig = h2.TLS
+	mux := http.NewServeMux()
+	mux.Handle(DoHPath, proxy.DoHHandler())
+	if err := proxy.startDoH3(mux); err != nil {
+		t.Fatalf("startDoH3 failed: %v", err)
+	}
+	defer func() {
+		cancel()
+		proxy.wg.Wait()
+	}()
+
+	h3 := &http3.Transport{TLSClientConfig: h2.Client().Transport.(*http.Transport).TLSClientConfig}
+	defer h3.Close()
+	h3Client := &http.Client{Transport: h3}
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		query := new(dns.Msg)
+		query.SetQuestion("app.internal.", qtype)
+		data, err := query.Pack()
+		if err != nil {
+			t.Fatalf("Failed to pack query: %v", err)
+		}
+
+		resp, err := h2.Client().Post(h2.URL+DoHPath, dohContentType, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("HTTP/2 POST failed: %v", err)
+		}
+		want := dohResponse(t, resp)
+
+		resp, err = h3Client.Post("https://"+proxy.doh3Addr+DoHPath, dohContentType, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("HTTP/3 POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.ProtoMajor != 3 {
+			t.Errorf("Expected HTTP/3, got %s", resp.Proto)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		got := new(dns.Msg)
+		if err := got.Unpack(body); err != nil {
+			t.Fatalf("Failed to unpack response: %v", err)
+		}
+
+		if len(want.Answer) != 1 {
+			t.Fatalf("Expected one %s answer over HTTP/2, got %v", dns.TypeToString[qtype], want.Answer)
+		}
+		if got.Rcode != want.Rcode || len(got.Answer) != len(want.Answer) || got.Answer[0].String() != want.Answer[0].String() {
+			t.Errorf("Expected the HTTP/3 answer %v to match HTTP/2 %v", got.Answer, want.Answer)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fosrl/olm/device"
+	"github.com/miekg/dns"
+)
+
+// dohResponse checks resp is a DNS message and returns it unpacked
+func dohResponse(t *testing.T, resp *http.Response) *dns.Msg {
+	t.Helper()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dohContentType {
+		t.Errorf("Expected content type %s, got %s", dohContentType, ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(body); err != nil {
+		t.Fatalf("Failed to unpack response: %v", err)
+	}
+	return msg
+}
+
+func TestDoHHandler(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	proxy.recordStore.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+
+	server := httptest.NewUnstartedServer(proxy.DoHHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	client := server.Client()
+
+	query := new(dns.Msg)
+	query.SetQuestion("app.internal.", dns.TypeA)
+	data, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	resp, err := client.Post(server.URL+DoHPath, dohContentType, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	msg := dohResponse(t, resp)
+	if len(msg.Answer) != 1 || !msg.Answer[0].(*dns.A).A.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Unexpected POST answer %v", msg.Answer)
+	}
+
+	resp, err = client.Get(server.URL + DoHPath + "?dns=" + base64.RawURLEncoding.EncodeToString(data))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	if msg := dohResponse(t, resp); len(msg.Answer) != 1 {
+		t.Errorf("Unexpected GET answer %v", msg.Answer)
+	}
+
+	resp, err = client.Post(server.URL+DoHPath, "text/plain", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for a wrong content type, got %d", resp.StatusCode)
+	}
+}
+
+func TestDoHServerNeedsTLSConfig(t *testing.T) {
+	for _, opt := range []DNSProxyOption{WithDoHServerAddr("127.0.0.1:0"), WithDoH3ServerAddr("127.0.0.1:0")} {
+		_, err := NewDNSProxy(device.NewMiddleDevice(nil), 1420, "100.96.128.0/24", []string{"127.0.0.1:1"}, false, "", opt)
+		if err == nil {
+			t.Error("Expected an error without a TLS config")
+		}
+	}
+
+	_, err := NewDNSProxy(device.NewMiddleDevice(nil), 1420, "100.96.128.0/24", []string{"127.0.0.1:1"}, false, "",
+		WithDoHServerAddr("127.0.0.1:0"), WithDoHTLSConfig(&tls.Config{}))
+	if err != nil {
+		t.Errorf("NewDNSProxy failed: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// WithUpstreamEDNS0BufSize sets the EDNS0 buffer size advertised in queries sent
+// upstream, so upstreams do not send responses larger than the path can carry. Queries
+// with an OPT record get its UDP size replaced and queries without one get an OPT
+// record added, which is removed from the response again. Zero selects 1232 bytes, the
+// DNS Flag Day 2020 recommendation, and sizes below 512 are raised to 512 as RFC 6891
+// requires. Without this option queries are forwarded with the size the client sent.
+func WithUpstreamEDNS0BufSize(bytes uint16) DNSProxyOption {
+	return func(p *DNSProxy) {
+		if bytes == 0 {
+			bytes = addedOPTUDPSize
+		}
+		p.upstreamBufSize = max(bytes, dns.MinMsgSize)
+	}
+}
+
+// setUpstreamBufSize returns query advertising the upstream EDNS0 buffer size, copied
+// if it had to change, and whether an OPT record had to be added for it
+func (p *DNSProxy) setUpstreamBufSize(query *dns.Msg) (*dns.Msg, bool) {
+	if p.upstreamBufSize == 0 {
+		return query, false
+	}
+	if opt := query.IsEdns0(); opt != nil && opt.UDPSize() == p.upstreamBufSize {
+		return query, false
+	}
+
+	sized := query.Copy()
+	opt := sized.IsEdns0()
+	if opt == nil {
+		sized.SetEdns0(p.upstreamBufSize, false)
+		return sized, true
+	}
+	opt.SetUDPSize(p.upstreamBufSize)
+	return sized, false
+}
@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startWireUpstream starts a raw UDP upstream that sends each query it receives, as
+// read off the wire, to the returned channel and answers it
+func startWireUpstream(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	queries := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			queries <- append([]byte(nil), buf[:n]...)
+
+			query := new(dns.Msg)
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			reply := new(dns.Msg)
+			reply.SetReply(query)
+			if opt := query.IsEdns0(); opt != nil {
+				reply.SetEdns0(4096, opt.Do())
+			}
+			data, _ := reply.Pack()
+			conn.WriteTo(data, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), queries
+}
+
+func TestUpstreamEDNS0BufSize(t *testing.T) {
+	server, queries := startWireUpstream(t)
+
+	tests := []struct {
+		name       string
+		opt        DNSProxyOption
+		clientSize uint16 // 0 for a query without an OPT record
+		want       uint16 // 0 when no OPT record should be forwarded
+	}{
+		{name: "unset keeps the client's size", clientSize: 4096, want: 4096},
+		{name: "unset adds no OPT record", want: 0},
+		{name: "default size", opt: WithUpstreamEDNS0BufSize(0), clientSize: 4096, want: 1232},
+		{name: "OPT record added", opt: WithUpstreamEDNS0BufSize(1400), want: 1400},
+		{name: "OPT record updated", opt: WithUpstreamEDNS0BufSize(1400), clientSize: 512, want: 1400},
+		{name: "raised to the minimum", opt: WithUpstreamEDNS0BufSize(100), clientSize: 4096, want: 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &DNSProxy{}
+			if tt.opt != nil {
+				tt.opt(proxy)
+			}
+
+			query := new(dns.Msg)
+			query.SetQuestion("example.com.", dns.TypeA)
+			if tt.clientSize != 0 {
+				query.SetEdns0(tt.clientSize, true)
+			}
+
+			response, err := proxy.queryUpstream(context.Background(), server, query, time.Second)
+			if err != nil {
+				t.Fatalf("Upstream query failed: %v", err)
+			}
+
+			forwarded := new(dns.Msg)
+			if err := forwarded.Unpack(<-queries); err != nil {
+				t.Fatalf("Failed to unpack the forwarded query: %v", err)
+			}
+			opt := forwarded.IsEdns0()
+			switch {
+			case tt.want == 0 && opt != nil:
+				t.Errorf("Expected no OPT record upstream, got %v", opt)
+			case tt.want != 0 && opt == nil:
+				t.Errorf("Expected an OPT record with size %d upstream, got none", tt.want)
+			case opt != nil && opt.UDPSize() != tt.want:
+				t.Errorf("Expected an advertised size of %d, got %d", tt.want, opt.UDPSize())
+			}
+			if tt.clientSize != 0 && opt != nil && !opt.Do() {
+				t.Error("Expected the DO bit of the client to be kept")
+			}
+
+			if tt.clientSize == 0 && response.IsEdns0() != nil {
+				t.Errorf("Expected the added OPT record to be stripped from the response, got %v", response.IsEdns0())
+			}
+			if query.IsEdns0() != nil && query.IsEdns0().UDPSize() != tt.clientSize {
+				t.Error("Expected the client's query to be left unchanged")
+			}
+		})
+	}
+}
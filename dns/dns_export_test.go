@@ -0,0 +1,142 @@
+package dns_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fosrl/olm/dns"
+)
+
+func TestReverseDNSToIPExported(t *testing.T) {
+	tests := []struct {
+		name       string
+		reverseDNS string
+		expectedIP string
+	}{
+		{
+			name:       "IPv4",
+			reverseDNS: "10.2.0.10.in-addr.arpa.",
+			expectedIP: "10.0.2.10",
+		},
+		{
+			name:       "IPv4 without trailing dot",
+			reverseDNS: "10.2.0.10.IN-ADDR.ARPA",
+			expectedIP: "10.0.2.10",
+		},
+		{
+			name:       "IPv6",
+			reverseDNS: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			expectedIP: "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := dns.ReverseDNSToIP(tt.reverseDNS)
+			if err != nil {
+				t.Fatalf("ReverseDNSToIP(%q) returned error: %v", tt.reverseDNS, err)
+			}
+			if !ip.Equal(net.ParseIP(tt.expectedIP)) {
+				t.Errorf("ReverseDNSToIP(%q) = %v, want %s", tt.reverseDNS, ip, tt.expectedIP)
+			}
+
+			// Round trip through IPToReverseDNS
+			back, err := dns.ReverseDNSToIP(dns.IPToReverseDNS(ip))
+			if err != nil || !back.Equal(ip) {
+				t.Errorf("Round trip of %v failed: %v, %v", ip, back, err)
+			}
+		})
+	}
+}
+
+func TestReverseDNSToIPInvalid(t *testing.T) {
+	for _, input := range []string{"example.com.", "1.2.in-addr.arpa.", "999.1.1.1.in-addr.arpa.", ""} {
+		_, err := dns.ReverseDNSToIP(input)
+		if !errors.Is(err, dns.ErrInvalidReverseDNS) {
+			t.Errorf("ReverseDNSToIP(%q) error = %v, expected ErrInvalidReverseDNS", input, err)
+		}
+	}
+}
+
+func FuzzIPRoundTrip(f *testing.F) {
+	for _, seed := range []string{"0.0.0.0", "255.255.255.255", "::", "::1", "ffff:ffff::ffff:ffff", "::ffff:10.0.0.1"} {
+		ip := net.ParseIP(seed)
+		if ip4 := ip.To4(); ip4 != nil && !strings.Contains(seed, ":") {
+			ip = ip4
+		}
+		f.Add([]byte(ip))
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+			t.Skip()
+		}
+		ip := net.IP(raw)
+
+		reverse := dns.IPToReverseDNS(ip)
+		back, err := dns.ReverseDNSToIP(reverse)
+		if err != nil {
+			t.Fatalf("ReverseDNSToIP(%q) for %v returned error: %v", reverse, ip, err)
+		}
+		if !back.Equal(ip) {
+			t.Errorf("Round trip of %v through %q gave %v", ip, reverse, back)
+		}
+	})
+}
+
+func FuzzReverseDNSToIP(f *testing.F) {
+	for _, seed := range []string{
+		"0.0.0.0.in-addr.arpa.",
+		"255.255.255.255.in-addr.arpa.",
+		"0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+		"999.1.1.1.in-addr.arpa.",
+		"in-addr.arpa.",
+		"ip6.arpa",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, domain string) {
+		ip, err := dns.ReverseDNSToIP(domain)
+		if err != nil {
+			if ip != nil {
+				t.Errorf("ReverseDNSToIP(%q) returned %v with error %v", domain, ip, err)
+			}
+			return
+		}
+		if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+			t.Errorf("ReverseDNSToIP(%q) returned malformed IP %v", domain, []byte(ip))
+		}
+	})
+}
+
+func TestReverseDNSFamily(t *testing.T) {
+	tests := []struct {
+		domain         string
+		expectedFamily int
+		expectedOk     bool
+	}{
+		{domain: "1.0.0.127.in-addr.arpa.", expectedFamily: 4, expectedOk: true},
+		{domain: "1.0.0.127.IN-ADDR.ARPA", expectedFamily: 4, expectedOk: true},
+		{domain: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", expectedFamily: 6, expectedOk: true},
+		{domain: "b.IP6.Arpa.", expectedFamily: 6, expectedOk: true},
+		{domain: "example.com.", expectedFamily: 0, expectedOk: false},
+		{domain: "in-addr.arpa.example.com.", expectedFamily: 0, expectedOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			family, ok := dns.ReverseDNSFamily(tt.domain)
+			if family != tt.expectedFamily || ok != tt.expectedOk {
+				t.Errorf("ReverseDNSFamily(%q) = %d, %v, want %d, %v", tt.domain, family, ok, tt.expectedFamily, tt.expectedOk)
+			}
+			if dns.IsReverseDNSDomain(tt.domain) != tt.expectedOk {
+				t.Errorf("IsReverseDNSDomain(%q) = %v, want %v", tt.domain, !tt.expectedOk, tt.expectedOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// WithListenPort sets the port the proxy answers DNS queries on, 53 by default. The
+// proxy listens on its own userspace netstack rather than a host socket, so any port
+// works without privileges, but clients have to be sent there, for example by a
+// firewall redirect, since resolvers configured with the proxy address use port 53.
+// Port 0 is rejected by NewDNSProxy: clients could not be pointed at a random port.
+func WithListenPort(port uint16) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.listenPort = port
+	}
+}
+
+// ListenAddr returns the address the proxy listens on once Start has returned, or an
+// empty string before
+func (p *DNSProxy) ListenAddr() string {
+	addr, _ := p.listenAddr.Load().(string)
+	return addr
+}
+
+// validateListenPort checks the port set with WithListenPort
+func validateListenPort(port uint16) error {
+	if port == 0 {
+		return fmt.Errorf("listen port must not be 0")
+	}
+	return nil
+}
+
+// listenAddrString returns the proxy address and listen port as host:port
+func (p *DNSProxy) listenAddrString() string {
+	return net.JoinHostPort(p.proxyIP.String(), strconv.Itoa(int(p.listenPort)))
+}
@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/fosrl/olm/device"
+)
+
+// udpPacketTo returns a minimal IPv4 UDP packet for dst and port
+func udpPacketTo(dst [4]byte, port uint16) []byte {
+	packet := make([]byte, 28)
+	packet[0] = 0x45 // IPv4, 20 byte header
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+	packet[8] = 64 // TTL
+	packet[9] = 17 // UDP
+	copy(packet[12:], []byte{100, 96, 0, 2})
+	copy(packet[16:], dst[:])
+	binary.BigEndian.PutUint16(packet[20:], 40000)
+	binary.BigEndian.PutUint16(packet[22:], port)
+	binary.BigEndian.PutUint16(packet[24:], 8)
+	return packet
+}
+
+func TestWithListenPort(t *testing.T) {
+	newProxy := func(opts ...DNSProxyOption) (*DNSProxy, error) {
+		return NewDNSProxy(device.NewMiddleDevice(nil), 1420, "100.96.128.0/24", []string{"127.0.0.1:1"}, false, "", opts...)
+	}
+
+	if _, err := newProxy(WithListenPort(0)); err == nil {
+		t.Error("Expected port 0 to be rejected")
+	}
+
+	tests := []struct {
+		name string
+		opts []DNSProxyOption
+		port uint16
+	}{
+		{name: "default", port: DNSPort},
+		{name: "unprivileged", opts: []DNSProxyOption{WithListenPort(5353)}, port: 5353},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newProxy(tt.opts...)
+			if err != nil {
+				t.Fatalf("NewDNSProxy failed: %v", err)
+			}
+			if addr := p.ListenAddr(); addr != "" {
+				t.Errorf("Expected no listen address before Start, got %s", addr)
+			}
+
+			if err := p.Start(); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			defer p.Stop()
+
+			want := fmt.Sprintf("%s:%d", p.GetProxyIP(), tt.port)
+			if addr := p.ListenAddr(); addr != want {
+				t.Errorf("ListenAddr() = %s, expected %s", addr, want)
+			}
+
+			proxyIP := p.GetProxyIP().As4()
+			if !p.handlePacket(udpPacketTo(proxyIP, tt.port)) {
+				t.Errorf("Expected a packet to port %d to be handled", tt.port)
+			}
+			if other := tt.port + 1; p.handlePacket(udpPacketTo(proxyIP, other)) {
+				t.Errorf("Expected a packet to port %d to be passed through", other)
+			}
+		})
+	}
+}
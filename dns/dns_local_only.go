@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// WithUpstreamForwardingEnabled turns forwarding to upstream servers on or off. With
+// forwarding off the proxy only answers from local records and every other query gets
+// the rcode set by WithUpstreamDisabledRcode, REFUSED by default, so no query leaves
+// the host. Forwarding is on by default. Combined with WithAllowlist only allowlisted
+// names are ever answered by anything other than this rcode.
+func WithUpstreamForwardingEnabled(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.upstreamDisabled = !enabled
+	}
+}
+
+// WithUpstreamDisabledRcode sets the rcode answered while upstream forwarding is off,
+// such as dns.RcodeNameError to make names look nonexistent. Zero keeps REFUSED.
+func WithUpstreamDisabledRcode(rcode int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.upstreamDisabledRcode = rcode
+	}
+}
+
+// upstreamDisabledResponse answers query when upstream forwarding is off, or returns
+// nil when queries may go upstream
+func (p *DNSProxy) upstreamDisabledResponse(query *dns.Msg) *dns.Msg {
+	if !p.upstreamDisabled {
+		return nil
+	}
+
+	rcode := p.upstreamDisabledRcode
+	if rcode == 0 {
+		rcode = dns.RcodeRefused
+	}
+	response := new(dns.Msg)
+	response.SetRcode(query, rcode)
+	return response
+}
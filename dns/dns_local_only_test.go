@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestUpstreamForwardingDisabled(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 0)
+
+	tests := []struct {
+		name  string
+		opts  []DNSProxyOption
+		rcode int
+	}{
+		{name: "REFUSED by default", opts: []DNSProxyOption{WithUpstreamForwardingEnabled(false)}, rcode: dns.RcodeRefused},
+		{name: "configured NXDOMAIN", opts: []DNSProxyOption{WithUpstreamForwardingEnabled(false), WithUpstreamDisabledRcode(dns.RcodeNameError)}, rcode: dns.RcodeNameError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+			for _, opt := range tt.opts {
+				opt(proxy)
+			}
+
+			for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT} {
+				query := new(dns.Msg)
+				query.SetQuestion("app.example.com.", qtype)
+				response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+				if response == nil || response.Rcode != tt.rcode {
+					t.Errorf("Expected %s for %s, got %v", dns.RcodeToString[tt.rcode], dns.TypeToString[qtype], response)
+				}
+			}
+		})
+	}
+	if n := queries.Load(); n != 0 {
+		t.Errorf("Expected no upstream queries with forwarding disabled, got %d", n)
+	}
+
+	// Local records are still answered and forwarding can be turned back on
+	proxy := &DNSProxy{upstreamDNS: []string{upstream}, recordStore: NewDNSRecordStore()}
+	WithUpstreamForwardingEnabled(false)(proxy)
+	proxy.recordStore.AddRecord("local.example.com.", net.ParseIP("10.0.0.1"))
+	query := new(dns.Msg)
+	query.SetQuestion("local.example.com.", dns.TypeA)
+	if response := proxy.resolveQuery(context.Background(), query, query.Question[0]); response == nil || len(response.Answer) != 1 {
+		t.Errorf("Expected the local record to be answered, got %v", response)
+	}
+
+	WithUpstreamForwardingEnabled(true)(proxy)
+	query.SetQuestion("app.example.com.", dns.TypeA)
+	if response := proxy.resolveQuery(context.Background(), query, query.Question[0]); response == nil || response.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected the query to be forwarded, got %v", response)
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected 1 upstream query, got %d", n)
+	}
+}
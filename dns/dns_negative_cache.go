@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultNegativeCacheSize is how many NXDOMAIN responses a store caches at most
+const defaultNegativeCacheSize = 10000
+
+// WithNegativeCacheSize caps how many NXDOMAIN responses are cached, 10000 by default
+// Once full, the entry added longest ago is evicted. Non-positive sizes keep the default.
+func WithNegativeCacheSize(n int) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		if n > 0 {
+			s.negative.size = n
+		}
+	}
+}
+
+// AddNXDOMAIN caches that domain does not exist for ttl
+func (s *DNSRecordStore) AddNXDOMAIN(domain string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	domain = strings.ToLower(dns.Fqdn(domain))
+	s.negative.add(domain, s.now().Add(ttl))
+
+	// The expiry sweep drops the entry once it expires
+	if !s.ttlEviction {
+		return
+	}
+	s.mu.RLock()
+	sweeping := s.sweeping
+	s.mu.RUnlock()
+	if !sweeping {
+		s.mu.Lock()
+		s.startSweepLocked()
+		s.mu.Unlock()
+	}
+}
+
+// IsNXDOMAIN reports whether domain has a cached NXDOMAIN that has not expired
+func (s *DNSRecordStore) IsNXDOMAIN(domain string) bool {
+	return s.negative.contains(strings.ToLower(dns.Fqdn(domain)), s.now())
+}
+
+// negativeEntry is a cached NXDOMAIN
+type negativeEntry struct {
+	domain string
+	expiry time.Time
+}
+
+// negativeCache holds NXDOMAIN responses with their expiry. It has its own lock so
+// caching a response never waits for the store lock.
+type negativeCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element // domain -> element of order holding a *negativeEntry
+	order   *list.List               // entries, the one added longest ago first
+	size    int                      // most entries kept
+}
+
+// add caches domain until expiry, evicting the oldest entry when the cache is full
+func (c *negativeCache) add(domain string, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+
+	if elem, ok := c.entries[domain]; ok {
+		elem.Value.(*negativeEntry).expiry = expiry
+		c.order.MoveToBack(elem)
+		return
+	}
+
+	size := c.size
+	if size <= 0 {
+		size = defaultNegativeCacheSize
+	}
+	for len(c.entries) >= size {
+		c.removeLocked(c.order.Front())
+	}
+	c.entries[domain] = c.order.PushBack(&negativeEntry{domain: domain, expiry: expiry})
+}
+
+// contains reports whether domain is cached and not expired at now
+// An expired entry is dropped.
+func (c *negativeCache) contains(domain string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[domain]
+	if !ok {
+		return false
+	}
+	if now.Before(elem.Value.(*negativeEntry).expiry) {
+		return true
+	}
+	c.removeLocked(elem)
+	return false
+}
+
+// purge drops every entry expired at now and returns how many were dropped
+func (c *negativeCache) purge(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for domain, elem := range c.entries {
+		if !now.Before(elem.Value.(*negativeEntry).expiry) {
+			c.order.Remove(elem)
+			delete(c.entries, domain)
+			purged++
+		}
+	}
+	return purged
+}
+
+// len returns the number of cached entries, expired or not
+func (c *negativeCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// clear drops every entry
+func (c *negativeCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	c.order = nil
+}
+
+// removeLocked drops the entry held by elem, the caller must hold c.mu
+func (c *negativeCache) removeLocked(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*negativeEntry).domain)
+}
+
+// negativeTTL returns how long an NXDOMAIN response may be cached, taken from
+// the SOA record in the authority section as described in RFC 2308
+func negativeTTL(response *dns.Msg) (time.Duration, bool) {
+	for _, rr := range response.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+
+		ttl := min(soa.Minttl, soa.Hdr.Ttl)
+		if ttl == 0 {
+			return 0, false
+		}
+		return time.Duration(ttl) * time.Second, true
+	}
+	return 0, false
+}
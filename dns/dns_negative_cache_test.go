@@ -0,0 +1,174 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	store.AddNXDOMAIN("Missing.Example.com", 50*time.Millisecond)
+	if !store.IsNXDOMAIN("missing.example.com.") {
+		t.Error("Expected cached NXDOMAIN within TTL")
+	}
+	if store.IsNXDOMAIN("other.example.com.") {
+		t.Error("Expected no NXDOMAIN for uncached name")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if store.IsNXDOMAIN("missing.example.com.") {
+		t.Error("Expected NXDOMAIN to expire after TTL")
+	}
+
+	store.AddNXDOMAIN("zero.example.com.", 0)
+	if store.IsNXDOMAIN("zero.example.com.") {
+		t.Error("Expected zero TTL not to be cached")
+	}
+
+	store.AddNXDOMAIN("cleared.example.com.", time.Minute)
+	store.Clear()
+	if store.IsNXDOMAIN("cleared.example.com.") {
+		t.Error("Expected Clear to drop the negative cache")
+	}
+}
+
+func TestNegativeCacheSize(t *testing.T) {
+	store := NewDNSRecordStore(WithNegativeCacheSize(2), WithTTLEviction(false))
+
+	store.AddNXDOMAIN("a.example.com.", time.Minute)
+	store.AddNXDOMAIN("b.example.com.", time.Minute)
+	// Adding a cached name again makes it the newest
+	store.AddNXDOMAIN("a.example.com.", time.Minute)
+	store.AddNXDOMAIN("c.example.com.", time.Minute)
+
+	if store.IsNXDOMAIN("b.example.com.") {
+		t.Error("Expected the oldest entry to be evicted")
+	}
+	if !store.IsNXDOMAIN("a.example.com.") || !store.IsNXDOMAIN("c.example.com.") {
+		t.Error("Expected the two newest entries to stay cached")
+	}
+	if n := store.negative.len(); n != 2 {
+		t.Errorf("Expected 2 cached entries, got %d", n)
+	}
+}
+
+func TestNegativeCacheSweep(t *testing.T) {
+	store, clock := newExpiryTestStore()
+
+	store.AddNXDOMAIN("gone.example.com.", time.Minute)
+	store.AddNXDOMAIN("kept.example.com.", time.Hour)
+	clock.Advance(2 * time.Minute)
+
+	// Nothing looks the expired name up, the sweep drops it anyway
+	deadline := time.Now().Add(2 * time.Second)
+	for store.negative.len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the sweep, %d entries cached", store.negative.len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !store.IsNXDOMAIN("kept.example.com.") {
+		t.Error("Expected the unexpired entry to stay cached")
+	}
+	// Clearing leaves nothing to sweep, so the sweep stops
+	store.Clear()
+
+	// PurgeExpired drops expired entries when the sweep is off
+	store, clock = newExpiryTestStore(WithTTLEviction(false))
+	store.AddNXDOMAIN("gone.example.com.", time.Minute)
+	clock.Advance(2 * time.Minute)
+	store.PurgeExpired()
+	if n := store.negative.len(); n != 0 {
+		t.Errorf("Expected PurgeExpired to drop the expired entry, got %d cached", n)
+	}
+}
+
+func TestNegativeCacheSkipsStoreLock(t *testing.T) {
+	store := NewDNSRecordStore(WithTTLEviction(false))
+	store.AddNXDOMAIN("missing.example.com.", time.Minute)
+
+	// Lookups and new entries do not wait for a writer holding the store lock
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	done := make(chan bool)
+	go func() {
+		store.AddNXDOMAIN("other.example.com.", time.Minute)
+		done <- store.IsNXDOMAIN("missing.example.com.")
+	}()
+
+	select {
+	case cached := <-done:
+		if !cached {
+			t.Error("Expected the cached NXDOMAIN")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the negative cache not to wait for the store lock")
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	response := new(dns.Msg)
+	if _, ok := negativeTTL(response); ok {
+		t.Error("Expected no negative TTL without SOA")
+	}
+
+	response.Ns = []dns.RR{&dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Minttl: 60,
+	}}
+	if ttl, ok := negativeTTL(response); !ok || ttl != time.Minute {
+		t.Errorf("Expected 1m negative TTL, got %v %v", ttl, ok)
+	}
+}
+
+func TestProxyNegativeCacheSuppressesRequery(t *testing.T) {
+	var queries atomic.Int32
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Ns = []dns.RR{&dns.SOA{
+			Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+			Ns:     "ns.example.com.",
+			Mbox:   "hostmaster.example.com.",
+			Minttl: 60,
+		}}
+		w.WriteMsg(m)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	proxy := &DNSProxy{
+		upstreamDNS: []string{conn.LocalAddr().String()},
+		recordStore: NewDNSRecordStore(),
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("missing.example.com.", dns.TypeA)
+
+	for i := 0; i < 3; i++ {
+		response := proxy.resolveQuery(context.Background(), query, query.Question[0])
+		if response == nil || response.Rcode != dns.RcodeNameError {
+			t.Fatalf("Expected NXDOMAIN response on query %d, got %v", i, response)
+		}
+	}
+
+	if n := queries.Load(); n != 1 {
+		t.Errorf("Expected 1 upstream query within the negative TTL, got %d", n)
+	}
+	if !proxy.recordStore.IsNXDOMAIN("missing.example.com.") {
+		t.Error("Expected upstream NXDOMAIN to be cached")
+	}
+}
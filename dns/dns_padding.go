@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// addedOPTUDPSize is the EDNS0 buffer size advertised when the proxy adds an OPT record
+// to an upstream query
+const addedOPTUDPSize = 1232
+
+// WithEDNS0Padding pads queries sent upstream with the RFC 7830 padding option so their
+// wire size is a multiple of blockSize, hiding the length of the queried name. RFC 8467
+// recommends 128 byte blocks for queries. Padding is stripped from responses before they
+// reach clients. Zero, the default, turns padding off.
+func WithEDNS0Padding(blockSize int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.paddingBlockSize = max(blockSize, 0)
+	}
+}
+
+// padQuery returns a copy of query padded to a multiple of the padding block size, and
+// whether an OPT record had to be added for it. query is returned as is without padding.
+func (p *DNSProxy) padQuery(query *dns.Msg) (*dns.Msg, bool) {
+	if p.paddingBlockSize <= 0 {
+		return query, false
+	}
+
+	padded := query.Copy()
+	opt := padded.IsEdns0()
+	addedOPT := opt == nil
+	if addedOPT {
+		padded.SetEdns0(addedOPTUDPSize, false)
+		opt = padded.IsEdns0()
+	}
+	removeOption(opt, dns.EDNS0PADDING)
+
+	// Measure with an empty padding option so its 4 byte header is counted
+	padding := &dns.EDNS0_PADDING{}
+	opt.Option = append(opt.Option, padding)
+	if rem := padded.Len() % p.paddingBlockSize; rem != 0 {
+		padding.Padding = make([]byte, p.paddingBlockSize-rem)
+	}
+	return padded, addedOPT
+}
+
+// unpadResponse removes padding from an upstream response, and the whole OPT record
+// when the proxy added one the client did not send
+func unpadResponse(response *dns.Msg, addedOPT bool) {
+	if response == nil {
+		return
+	}
+	opt := response.IsEdns0()
+	if opt == nil {
+		return
+	}
+	if !addedOPT {
+		removeOption(opt, dns.EDNS0PADDING)
+		return
+	}
+	for i, rr := range response.Extra {
+		if rr == opt {
+			response.Extra = append(response.Extra[:i], response.Extra[i+1:]...)
+			return
+		}
+	}
+}
+
+// removeOption drops every option with the given code from opt
+func removeOption(opt *dns.OPT, code uint16) {
+	options := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != code {
+			options = append(options, o)
+		}
+	}
+	opt.Option = options
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPadQuery(t *testing.T) {
+	for _, blockSize := range []int{64, 128, 468} {
+		for _, labelLen := range []int{1, 10, 30, 63} {
+			for _, withEDNS := range []bool{false, true} {
+				name := fmt.Sprintf("%s.example.com.", strings.Repeat("a", labelLen))
+				t.Run(fmt.Sprintf("%d/%d/%v", blockSize, labelLen, withEDNS), func(t *testing.T) {
+					proxy := &DNSProxy{}
+					WithEDNS0Padding(blockSize)(proxy)
+
+					query := new(dns.Msg)
+					query.SetQuestion(name, dns.TypeA)
+					if withEDNS {
+						query.SetEdns0(4096, true)
+					}
+
+					padded, addedOPT := proxy.padQuery(query)
+					if addedOPT == withEDNS {
+						t.Errorf("Expected addedOPT to be %v", !withEDNS)
+					}
+					data, err := padded.Pack()
+					if err != nil {
+						t.Fatalf("Failed to pack padded query: %v", err)
+					}
+					if len(data)%blockSize != 0 {
+						t.Errorf("Expected a multiple of %d bytes, got %d", blockSize, len(data))
+					}
+					if query.IsEdns0() != nil && len(query.IsEdns0().Option) != 0 {
+						t.Error("Expected the original query to be left alone")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestPadQueryDisabled(t *testing.T) {
+	proxy := &DNSProxy{}
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	if padded, addedOPT := proxy.padQuery(query); padded != query || addedOPT {
+		t.Error("Expected no padding by default")
+	}
+}
+
+func TestUnpadResponse(t *testing.T) {
+	response := new(dns.Msg)
+	response.SetEdns0(1232, false)
+	opt := response.IsEdns0()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_PADDING{Padding: make([]byte, 20)},
+		&dns.EDNS0_LOCAL{Code: CorrelationIDOptionCode, Data: []byte("id")})
+
+	unpadResponse(response, false)
+	if opt := response.IsEdns0(); opt == nil || len(opt.Option) != 1 || opt.Option[0].Option() != CorrelationIDOptionCode {
+		t.Errorf("Expected only the padding option to be removed, got %v", opt)
+	}
+
+	unpadResponse(response, true)
+	if response.IsEdns0() != nil {
+		t.Error("Expected the added OPT record to be removed")
+	}
+}
+
+func TestEDNS0PaddingUpstreamWireSize(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	// A raw upstream that reports the size of each query and answers with padding
+	sizes := make(chan int, 1)
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			sizes <- n
+
+			query := new(dns.Msg)
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			reply := new(dns.Msg)
+			reply.SetReply(query)
+			reply.SetEdns0(1232, false)
+			opt := reply.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, 100)})
+			data, _ := reply.Pack()
+			conn.WriteTo(data, addr)
+		}
+	}()
+
+	proxy := &DNSProxy{}
+	WithEDNS0Padding(128)(proxy)
+
+	for _, name := range []string{"a.example.com.", "a-much-longer-name.subdomain.example.com."} {
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+		response, err := proxy.queryUpstream(context.Background(), conn.LocalAddr().String(), query, time.Second)
+		if err != nil {
+			t.Fatalf("Upstream query failed: %v", err)
+		}
+		if size := <-sizes; size%128 != 0 {
+			t.Errorf("Expected the upstream query for %s to be a multiple of 128 bytes, got %d", name, size)
+		}
+		if response.IsEdns0() != nil {
+			t.Errorf("Expected the OPT record added for padding to be stripped, got %v", response.IsEdns0())
+		}
+	}
+}
@@ -2,10 +2,13 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fosrl/newt/logger"
@@ -20,11 +23,15 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 )
 
 const (
 	DNSPort = 53
+
+	// maxUpstreamAttempts is how many upstream servers a query is sent to before giving up
+	maxUpstreamAttempts = 2
 )
 
 // DNSProxy implements a DNS proxy using gvisor netstack
@@ -36,7 +43,11 @@ type DNSProxy struct {
 	tunnelDNS    bool // Whether to tunnel DNS queries over WireGuard or to spit them out locally
 	mtu          int
 	middleDevice *device.MiddleDevice // Reference to MiddleDevice for packet filtering and TUN writes
-	recordStore  *DNSRecordStore      // Local DNS records
+	recordStore  RecordStore          // Local DNS records
+
+	// Split DNS rules - per-suffix upstream servers
+	splitDNS     SplitDNSConfig
+	splitDNSLock sync.RWMutex
 
 	// Tunnel DNS fields - for sending queries over WireGuard
 	tunnelIP          netip.Addr   // WireGuard interface IP (source for tunneled queries)
@@ -45,13 +56,171 @@ type DNSProxy struct {
 	tunnelActivePorts map[uint16]bool
 	tunnelPortsLock   sync.Mutex
 
+	// DNS UPDATE (RFC 2136) settings
+	dnsUpdateEnabled bool
+	dnsUpdateZone    string
+	tsigRequired     bool
+	tsigKeys         map[string]tsigKey // key name -> key
+	tsigLock         sync.RWMutex
+
+	// Zone transfer (AXFR) settings
+	axfrEnabled        bool
+	axfrAllowedClients []netip.Prefix
+
+	// Client networks refused all service, see WithRefusedClientCIDRs
+	refusedCIDRs []netip.Prefix
+	refusedLock  sync.RWMutex
+
+	// DNSSEC keys per zone, see WithZoneSigningKey
+	zoneKeys map[string]zoneSigningKey
+
+	maxResponseSize  int // largest UDP response in bytes, 0 for no limit
+	paddingBlockSize int // pad upstream queries to multiples of this size, 0 for no padding
+	anyQueryPolicy   ANYQueryPolicy
+
+	// Local-only mode, see WithUpstreamForwardingEnabled
+	upstreamDisabled      bool
+	upstreamDisabledRcode int // 0 for REFUSED
+
+	// EDNS0 buffer size advertised upstream, 0 to keep the client's, see WithUpstreamEDNS0BufSize
+	upstreamBufSize uint16
+
+	// Port queries are answered on and the address bound by Start, see WithListenPort
+	listenPort uint16
+	listenAddr atomic.Value // string
+
+	// DNS over HTTPS servers on host addresses, see WithDoHServerAddr and WithDoH3ServerAddr
+	dohAddr       string
+	dohTLSConfig  *tls.Config
+	doh3Addr      string
+	doh3TLSConfig *tls.Config
+
+	// Response rate limiting per client network, response name, type and rcode
+	rrlEnabled           bool
+	rrlRequestsPerSecond float64
+	rrlSlipRate          int
+	rrlBuckets           sync.Map // rrlKey -> *rrlBucket
+	rrlPruned            atomic.Int64
+
+	// Local record stores per tenant, see WithTenantResolver
+	tenantResolver func(clientIP netip.Addr) string
+	tenantStores   sync.Map // tenant name -> *DNSRecordStore
+
+	// RFC 7873 DNS cookies
+	dnsCookies       bool
+	upstreamCookies  sync.Map // upstream server address -> *upstreamCookie
+	cookieSecret     []byte   // keys the server cookies issued to clients
+	cookieSecretOnce sync.Once
+
+	// Names allowed upstream in allowlist mode, exact domains or wildcard patterns
+	allowlistEnabled bool
+	allowlist        map[string]struct{}
+	allowlistLock    sync.RWMutex
+
+	// Names answered with NXDOMAIN, swapped whole on reload, see WatchBlocklistFile
+	blocklist        atomic.Pointer[sync.Map] // FQDN -> struct{}
+	blocklistVersion atomic.Value             // string
+
+	// Detection of names made by domain generation algorithms
+	dgaThreshold float64 // entropy in bits per character, 0 when off
+	dgaAlert     func(query *dns.Msg, entropy float64)
+	dgaBlock     bool
+
+	// Circuit breakers per upstream server
+	upstreamBreakers sync.Map // server address -> *CircuitBreaker
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	breakersDisabled bool
+
+	// Query logging and tracing
+	correlationIDExtractor func(*dns.Msg) string
+	queryLogger            func(QueryLogEntry)
+	slowQueryThreshold     time.Duration
+
+	// Recent queries per client, see GetClientHistory
+	clientHistorySize int
+	clientHistory     sync.Map // netip.Addr -> *clientRing
+	historyOnce       sync.Once
+	historyQueue      chan QueryLogEntry
+
+	// Live stream of resolved queries, see SubscribeQueries
+	queryStream      queryStream
+	maxWSSubscribers int
+
+	// Upstream exchanges shared by identical queries
+	queryCoalescing bool
+	flights         map[flightKey]*flight
+	flightsLock     sync.Mutex
+
+	// Counters since the last ResetStats, see Stats
+	stats atomic.Pointer[proxyStats]
+
+	// Queries being answered, waited for by Stop, see WithShutdownTimeout
+	queryCtx        context.Context // cancelled when Stop stops waiting, derived from ctx
+	cancelQueries   context.CancelFunc
+	queries         sync.WaitGroup
+	inFlight        atomic.Int64
+	draining        bool // guarded by queriesLock, set once Stop starts
+	queriesLock     sync.Mutex
+	shutdownTimeout time.Duration
+
+	// Idle TCP connections to upstream servers, see WithTCPPoolSize
+	tcpPool        *TCPConnectionPool
+	tcpPoolSize    int
+	tcpIdleTimeout time.Duration
+
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 }
 
+// DNSProxyOption configures a DNSProxy
+type DNSProxyOption func(*DNSProxy)
+
+// WithRecordStore sets the store used for local records, a DNSRecordStore by default
+func WithRecordStore(store RecordStore) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.recordStore = store
+	}
+}
+
+// WithCircuitBreakers controls whether upstream servers that keep failing are skipped
+// for a while, which is the default. Without circuit breakers every query is sent to
+// the upstream servers in order.
+func WithCircuitBreakers(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.breakersDisabled = !enabled
+	}
+}
+
+// WithCircuitBreakerThreshold sets how many consecutive failures open the circuit breaker
+// of an upstream server, 5 by default
+func WithCircuitBreakerThreshold(n int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.breakerThreshold = n
+	}
+}
+
+// WithCircuitBreakerCooldown sets how long an upstream server is skipped once its circuit
+// breaker opens, 30 seconds by default
+func WithCircuitBreakerCooldown(d time.Duration) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.breakerCooldown = d
+	}
+}
+
+// WithMaxResponseSize limits UDP responses to bytes. Larger responses are truncated to fit
+// and get the TC bit so clients retry over TCP, which is not limited and is served by
+// the proxy whenever a limit is set. Limits below the
+// 512 byte RFC 1035 minimum are raised to 512.
+func WithMaxResponseSize(bytes int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.maxResponseSize = max(bytes, dns.MinMsgSize)
+	}
+}
+
 // NewDNSProxy creates a new DNS proxy
-func NewDNSProxy(middleDevice *device.MiddleDevice, mtu int, utilitySubnet string, upstreamDns []string, tunnelDns bool, tunnelIP string) (*DNSProxy, error) {
+func NewDNSProxy(middleDevice *device.MiddleDevice, mtu int, utilitySubnet string, upstreamDns []string, tunnelDns bool, tunnelIP string, opts ...DNSProxyOption) (*DNSProxy, error) {
 	proxyIP, err := PickIPFromSubnet(utilitySubnet)
 	if err != nil {
 		return nil, fmt.Errorf("failed to pick DNS proxy IP from subnet: %v", err)
@@ -71,9 +240,28 @@ func NewDNSProxy(middleDevice *device.MiddleDevice, mtu int, utilitySubnet strin
 		tunnelDNS:         tunnelDns,
 		recordStore:       NewDNSRecordStore(),
 		tunnelActivePorts: make(map[uint16]bool),
+		listenPort:        DNSPort,
+		clientHistorySize: defaultClientHistorySize,
+		rrlSlipRate:       defaultRRLSlipRate,
+		tcpPoolSize:       defaultTCPPoolSize,
+		tcpIdleTimeout:    defaultTCPIdleTimeout,
 		ctx:               ctx,
 		cancel:            cancel,
 	}
+	// Derived from ctx, so failing below or stopping releases it too
+	proxy.queryCtx, proxy.cancelQueries = context.WithCancel(ctx)
+	for _, opt := range opts {
+		opt(proxy)
+	}
+	if err := validateListenPort(proxy.listenPort); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := proxy.validateDoH(); err != nil {
+		cancel()
+		return nil, err
+	}
+	proxy.tcpPool = NewTCPConnectionPool(proxy.tcpPoolSize, proxy.tcpIdleTimeout)
 
 	// Parse tunnel IP if provided (needed for tunneled DNS)
 	if tunnelIP != "" {
@@ -87,7 +275,7 @@ func NewDNSProxy(middleDevice *device.MiddleDevice, mtu int, utilitySubnet strin
 	// Create gvisor netstack for receiving DNS queries
 	stackOpts := stack.Options{
 		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
-		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol, tcp.NewProtocol},
 		HandleLocal:        true,
 	}
 
@@ -217,21 +405,39 @@ func (p *DNSProxy) handleTunnelResponse(packet []byte) bool {
 
 // Start starts the DNS proxy and registers with the filter
 func (p *DNSProxy) Start() error {
+	// Bind the DNS listener before taking packets so a failure is returned
+	udpConn, err := p.listenDNS()
+	if err != nil {
+		return err
+	}
+	p.listenAddr.Store(p.listenAddrString())
+
+	if err := p.startDoH(); err != nil {
+		udpConn.Close()
+		return err
+	}
+
 	// Install packet filter rule
 	p.middleDevice.AddRule(p.proxyIP, p.handlePacket)
 
 	// Start DNS listener
 	p.wg.Add(2)
-	go p.runDNSListener()
+	go p.runDNSListener(udpConn)
 	go p.runPacketSender()
 
+	// Start the TCP listener for zone transfers and for clients retrying truncated answers
+	if p.tcpListenerNeeded() {
+		p.wg.Add(1)
+		go p.runTCPListener()
+	}
+
 	// Start tunnel packet sender if tunnel DNS is enabled
 	if p.tunnelDNS {
 		p.wg.Add(1)
 		go p.runTunnelPacketSender()
 	}
 
-	logger.Info("DNS proxy started on %s:%d (tunnelDNS=%v)", p.proxyIP.String(), DNSPort, p.tunnelDNS)
+	logger.Info("DNS proxy started on %s (tunnelDNS=%v)", p.ListenAddr(), p.tunnelDNS)
 	return nil
 }
 
@@ -243,7 +449,11 @@ func (p *DNSProxy) Stop() {
 			p.middleDevice.RemoveRule(p.tunnelIP)
 		}
 	}
+
+	// Answer the queries already received while the listener and packet sender still run
+	p.drainQueries()
 	p.cancel()
+	p.tcpPool.Close()
 
 	// Close the endpoint first to unblock any pending Read() calls in runPacketSender
 	if p.ep != nil {
@@ -278,14 +488,14 @@ func (p *DNSProxy) handlePacket(packet []byte) bool {
 		return false // Don't drop, malformed
 	}
 
-	// Quick check for UDP port 53
+	// Quick check for UDP to the listen port, or TCP to it when the TCP listener runs
 	proto, ok := util.GetProtocol(packet)
-	if !ok || proto != 17 { // 17 = UDP
+	if !ok || (proto != 17 && !(proto == 6 && p.tcpListenerNeeded())) { // 17 = UDP, 6 = TCP
 		return false // Not UDP, don't handle
 	}
 
 	port, ok := util.GetDestPort(packet)
-	if !ok || port != DNSPort {
+	if !ok || port != p.listenPort {
 		return false // Not DNS port
 	}
 
@@ -309,29 +519,36 @@ func (p *DNSProxy) handlePacket(packet []byte) bool {
 	return true // Drop packet from normal path
 }
 
-// runDNSListener listens for DNS queries on the netstack
-func (p *DNSProxy) runDNSListener() {
-	defer p.wg.Done()
-
+// listenDNS binds the UDP listener for DNS queries on the netstack
+func (p *DNSProxy) listenDNS() (*gonet.UDPConn, error) {
 	// Create UDP listener using gonet
 	// Parse the proxy IP to get the octets
 	ipBytes := p.proxyIP.As4()
 	laddr := &tcpip.FullAddress{
 		NIC:  1,
 		Addr: tcpip.AddrFrom4(ipBytes),
-		Port: DNSPort,
+		Port: p.listenPort,
 	}
 
 	udpConn, err := gonet.DialUDP(p.stack, laddr, nil, ipv4.ProtocolNumber)
 	if err != nil {
-		logger.Error("Failed to create DNS listener: %v", err)
-		return
+		return nil, fmt.Errorf("failed to create DNS listener: %v", err)
 	}
+	return udpConn, nil
+}
+
+// runDNSListener answers DNS queries on udpConn until the proxy is stopped
+func (p *DNSProxy) runDNSListener(udpConn *gonet.UDPConn) {
+	defer p.wg.Done()
 	defer udpConn.Close()
 
 	logger.Debug("DNS proxy listening on netstack")
 
-	// Handle DNS queries
+	p.serveDNS(udpConn)
+}
+
+// serveDNS answers DNS queries read from udpConn until the proxy is stopped
+func (p *DNSProxy) serveDNS(udpConn net.PacketConn) {
 	buf := make([]byte, 4096)
 	for {
 		select {
@@ -362,75 +579,251 @@ func (p *DNSProxy) runDNSListener() {
 }
 
 // handleDNSQuery processes a DNS query, checking local records first, then forwarding upstream
-func (p *DNSProxy) handleDNSQuery(udpConn *gonet.UDPConn, queryData []byte, clientAddr net.Addr) {
+func (p *DNSProxy) handleDNSQuery(udpConn net.PacketConn, queryData []byte, clientAddr net.Addr) {
+	responseData := p.answerQuery(queryData, clientAddr, true)
+	if responseData == nil {
+		return
+	}
+
+	if _, err := udpConn.WriteTo(responseData, clientAddr); err != nil {
+		logger.Error("Failed to send DNS response: %v", err)
+	}
+}
+
+// answerQuery returns the packed response to a DNS query from clientAddr, or nil when
+// the query gets no answer. UDP responses are capped at the maximum response size.
+func (p *DNSProxy) answerQuery(queryData []byte, clientAddr net.Addr, udp bool) []byte {
+	// Stop waits for queries already being answered
+	if !p.beginQuery() {
+		return nil
+	}
+	defer p.endQuery()
+
 	// Parse the DNS query
 	msg := new(dns.Msg)
 	if err := msg.Unpack(queryData); err != nil {
 		logger.Error("Failed to parse DNS query: %v", err)
-		return
+		return nil
+	}
+
+	if p.isRefusedClient(clientAddr) {
+		logger.Debug("Refusing query from %s, its network is refused", clientAddr)
+		response := new(dns.Msg)
+		response.SetRcode(msg, dns.RcodeRefused)
+		return p.packResponse(response, udp)
+	}
+
+	if msg.Opcode == dns.OpcodeUpdate {
+		response, err := p.handleDNSUpdate(msg, queryData)
+		if err != nil {
+			logger.Warn("Failed to handle DNS update: %v", err)
+		}
+		if response == nil {
+			return nil
+		}
+
+		responseData, err := p.packUpdateResponse(msg, response)
+		if err != nil {
+			logger.Error("Failed to pack DNS update response: %v", err)
+			return nil
+		}
+		return responseData
 	}
 
 	if len(msg.Question) == 0 {
 		logger.Debug("DNS query has no questions")
-		return
+		return nil
 	}
 
 	question := msg.Question[0]
-	logger.Debug("DNS query for %s (type %s)", question.Name, dns.TypeToString[question.Qtype])
-
-	// Check if we have local records for this query
-	var response *dns.Msg
-	if question.Qtype == dns.TypeA || question.Qtype == dns.TypeAAAA || question.Qtype == dns.TypePTR {
-		response = p.checkLocalRecords(msg, question)
+	correlationID := p.correlationID(msg)
+	if correlationID != "" {
+		logger.Debug("DNS query for %s (type %s, correlation ID %s)", question.Name, dns.TypeToString[question.Qtype], correlationID)
+	} else {
+		logger.Debug("DNS query for %s (type %s)", question.Name, dns.TypeToString[question.Qtype])
 	}
 
-	// If no local records, forward to upstream
-	if response == nil {
-		logger.Debug("No local record for %s, forwarding upstream to %v", question.Name, p.upstreamDNS)
-		response = p.forwardToUpstream(msg)
+	start := time.Now()
+	ctx := withTenant(withCorrelationID(p.queryContext(), correlationID), p.tenantFor(clientAddr))
+	response := p.resolveQuery(ctx, msg, question)
+	entry := QueryLogEntry{
+		Time:          start,
+		Client:        clientAddr.String(),
+		Name:          question.Name,
+		Type:          question.Qtype,
+		Rcode:         -1,
+		Duration:      time.Since(start),
+		CorrelationID: correlationID,
 	}
-
+	if response != nil {
+		entry.Rcode = response.Rcode
+	}
+	p.logQuery(entry)
 	if response == nil {
 		logger.Error("Failed to get DNS response for %s", question.Name)
-		return
+		return nil
+	}
+
+	// TCP is not rate limited, it is where limited clients retry
+	if udp {
+		response = p.rateLimitResponse(msg, response, clientAddr)
+	}
+	p.setClientCookie(msg, response, clientAddr)
+	return p.packResponse(response, udp)
+}
+
+// packResponse packs a DNS response, truncating it first when it goes over UDP
+func (p *DNSProxy) packResponse(response *dns.Msg, udp bool) []byte {
+	// Cap UDP answers so a small query cannot trigger a large reply towards a spoofed source,
+	// a truncated reply has TC set so real clients retry over TCP
+	if udp && p.maxResponseSize > 0 {
+		response.Truncate(p.maxResponseSize)
 	}
 
-	// Pack and send response
 	responseData, err := response.Pack()
 	if err != nil {
 		logger.Error("Failed to pack DNS response: %v", err)
-		return
+		return nil
 	}
+	return responseData
+}
 
-	_, err = udpConn.WriteTo(responseData, clientAddr)
-	if err != nil {
-		logger.Error("Failed to send DNS response: %v", err)
+// resolveQuery answers a query from local records, the negative cache or upstream
+// ctx bounds the upstream exchange and carries the query's correlation ID
+func (p *DNSProxy) resolveQuery(ctx context.Context, msg *dns.Msg, question dns.Question) *dns.Msg {
+	// Check if we have local records for this query
+	var response *dns.Msg
+	switch question.Qtype {
+	case dns.TypeA, dns.TypeAAAA, dns.TypePTR, dns.TypeCAA, dns.TypeHTTPS, dns.TypeNAPTR, dns.TypeSRV, dns.TypeTXT, dns.TypeDNSKEY:
+		response = p.checkLocalRecords(ctx, msg, question)
+	case dns.TypeANY:
+		response = p.checkANYQuery(ctx, msg, question)
+	}
+	if response != nil {
+		return response
+	}
+
+	// Nothing goes upstream in local-only mode
+	if response = p.upstreamDisabledResponse(msg); response != nil {
+		logger.Debug("Answering %s with %s, upstream forwarding is disabled", question.Name, dns.RcodeToString[response.Rcode])
+		return response
+	}
+
+	// In allowlist mode only allowlisted names go upstream
+	if !p.isAllowed(question.Name) {
+		logger.Debug("Refusing %s, it is not on the allowlist", question.Name)
+		response = new(dns.Msg)
+		response.SetRcode(msg, dns.RcodeRefused)
+		return response
+	}
+
+	if p.isBlocked(question.Name) {
+		logger.Debug("Blocking %s, it is on the blocklist", question.Name)
+		response = new(dns.Msg)
+		response.SetRcode(msg, dns.RcodeNameError)
+		return response
+	}
+
+	if p.checkDGA(msg, question) {
+		response = new(dns.Msg)
+		response.SetRcode(msg, dns.RcodeRefused)
+		return response
+	}
+
+	// Answer recently missed names locally instead of asking upstream again
+	if p.recordStore.IsNXDOMAIN(question.Name) {
+		logger.Debug("Cached NXDOMAIN for %s", question.Name)
+		response = new(dns.Msg)
+		response.SetRcode(msg, dns.RcodeNameError)
+		return response
+	}
+
+	// If no local records, forward to upstream
+	upstreams := p.upstreamsFor(question.Name)
+	logger.Debug("No local record for %s, forwarding upstream to %v", question.Name, upstreams)
+	response = p.exchangeUpstream(ctx, msg, question, upstreams)
+
+	if response != nil && response.Rcode == dns.RcodeNameError {
+		if ttl, ok := negativeTTL(response); ok {
+			p.recordStore.AddNXDOMAIN(question.Name, ttl)
+		}
 	}
+
+	return response
 }
 
-// checkLocalRecords checks if we have local records for the query
-func (p *DNSProxy) checkLocalRecords(query *dns.Msg, question dns.Question) *dns.Msg {
+// checkLocalRecords checks if we have local records for the query in the store of the
+// client's tenant, see WithTenantResolver
+func (p *DNSProxy) checkLocalRecords(ctx context.Context, query *dns.Msg, question dns.Question) *dns.Msg {
+	store := p.localStore(ctx)
+	response := p.checkLocalStore(store, query, question)
+	if response != nil && response.Rcode == dns.RcodeSuccess && len(response.Answer) == 0 {
+		p.addDenialOfExistence(store, query, response)
+	}
+	if response != nil && len(response.Answer) > 0 {
+		p.addRRSIGs(store, query, response)
+	}
+	return response
+}
+
+// checkLocalStore answers question from store, see checkLocalRecords
+func (p *DNSProxy) checkLocalStore(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	// Handle DNSKEY queries for a zone with a signing key
+	if question.Qtype == dns.TypeDNSKEY {
+		return p.checkLocalDNSKEY(query, question)
+	}
+
+	// Handle CAA queries
+	if question.Qtype == dns.TypeCAA {
+		return p.checkLocalCAARecords(store, query, question)
+	}
+
+	// Handle HTTPS queries
+	if question.Qtype == dns.TypeHTTPS {
+		return p.checkLocalHTTPSRecords(store, query, question)
+	}
+
+	// Handle NAPTR queries
+	if question.Qtype == dns.TypeNAPTR {
+		return p.checkLocalNAPTRRecords(store, query, question)
+	}
+
+	// Handle SRV queries
+	if question.Qtype == dns.TypeSRV {
+		return p.checkLocalSRVRecords(store, query, question)
+	}
+
+	// Handle TXT queries
+	if question.Qtype == dns.TypeTXT {
+		return p.checkLocalTXTRecords(store, query, question)
+	}
+
 	// Handle PTR queries
 	if question.Qtype == dns.TypePTR {
-		if ptrDomain, ok := p.recordStore.GetPTRRecord(question.Name); ok {
-			logger.Debug("Found local PTR record for %s -> %s", question.Name, ptrDomain)
+		if !IsReverseDNSDomain(question.Name) {
+			return p.checkLocalServicePTRRecords(store, query, question)
+		}
+		if ptrDomains, ok := store.GetAllPTRRecords(question.Name); ok {
+			logger.Debug("Found %d local PTR record(s) for %s -> %v", len(ptrDomains), question.Name, ptrDomains)
 
 			// Create response message
 			response := new(dns.Msg)
 			response.SetReply(query)
 			response.Authoritative = true
 
-			// Add PTR answer record
-			rr := &dns.PTR{
-				Hdr: dns.RR_Header{
-					Name:   question.Name,
-					Rrtype: dns.TypePTR,
-					Class:  dns.ClassINET,
-					Ttl:    300, // 5 minutes
-				},
-				Ptr: ptrDomain,
+			// Add PTR answer records
+			for _, ptrDomain := range ptrDomains {
+				rr := &dns.PTR{
+					Hdr: dns.RR_Header{
+						Name:   question.Name,
+						Rrtype: dns.TypePTR,
+						Class:  dns.ClassINET,
+						Ttl:    store.TTL(),
+					},
+					Ptr: ptrDomain,
+				}
+				response.Answer = append(response.Answer, rr)
 			}
-			response.Answer = append(response.Answer, rr)
 
 			return response
 		}
@@ -447,7 +840,7 @@ func (p *DNSProxy) checkLocalRecords(query *dns.Msg, question dns.Question) *dns
 		return nil
 	}
 
-	ips := p.recordStore.GetRecords(question.Name, recordType)
+	ips := store.GetRecords(question.Name, recordType)
 	if len(ips) == 0 {
 		return nil
 	}
@@ -468,7 +861,7 @@ func (p *DNSProxy) checkLocalRecords(query *dns.Msg, question dns.Question) *dns
 					Name:   question.Name,
 					Rrtype: dns.TypeA,
 					Class:  dns.ClassINET,
-					Ttl:    300, // 5 minutes
+					Ttl:    store.TTL(),
 				},
 				A: ip.To4(),
 			}
@@ -478,7 +871,7 @@ func (p *DNSProxy) checkLocalRecords(query *dns.Msg, question dns.Question) *dns
 					Name:   question.Name,
 					Rrtype: dns.TypeAAAA,
 					Class:  dns.ClassINET,
-					Ttl:    300, // 5 minutes
+					Ttl:    store.TTL(),
 				},
 				AAAA: ip.To16(),
 			}
@@ -489,46 +882,360 @@ func (p *DNSProxy) checkLocalRecords(query *dns.Msg, question dns.Question) *dns
 	return response
 }
 
-// forwardToUpstream forwards a DNS query to upstream DNS servers
-func (p *DNSProxy) forwardToUpstream(query *dns.Msg) *dns.Msg {
-	// Try primary DNS server
-	response, err := p.queryUpstream(p.upstreamDNS[0], query, 2*time.Second)
-	if err != nil && len(p.upstreamDNS) > 1 {
-		// Try secondary DNS server
-		logger.Debug("Primary DNS failed, trying secondary: %v", err)
-		response, err = p.queryUpstream(p.upstreamDNS[1], query, 2*time.Second)
-		if err != nil {
-			logger.Error("Both DNS servers failed: %v", err)
+// checkLocalCAARecords answers CAA queries from the local record store
+func (p *DNSProxy) checkLocalCAARecords(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	records := store.GetCAARecords(question.Name)
+	if len(records) == 0 {
+		return nil
+	}
+
+	logger.Debug("Found %d local CAA record(s) for %s", len(records), question.Name)
+
+	// Create response message
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+
+	// Add answer records
+	for _, rec := range records {
+		response.Answer = append(response.Answer, &dns.CAA{
+			Hdr: dns.RR_Header{
+				Name:   question.Name,
+				Rrtype: dns.TypeCAA,
+				Class:  dns.ClassINET,
+				Ttl:    store.TTL(),
+			},
+			Flag:  rec.Flags,
+			Tag:   rec.Tag,
+			Value: rec.Value,
+		})
+	}
+
+	return response
+}
+
+// checkLocalSRVRecords answers SRV queries from the local record store
+func (p *DNSProxy) checkLocalSRVRecords(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	records := store.GetSRVRecords(question.Name)
+	if len(records) == 0 {
+		return nil
+	}
+
+	logger.Debug("Found %d local SRV record(s) for %s", len(records), question.Name)
+
+	// Create response message
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+
+	// Add answer records
+	for _, rec := range records {
+		response.Answer = append(response.Answer, &dns.SRV{
+			Hdr: dns.RR_Header{
+				Name:   question.Name,
+				Rrtype: dns.TypeSRV,
+				Class:  dns.ClassINET,
+				Ttl:    store.TTL(),
+			},
+			Priority: rec.Priority,
+			Weight:   rec.Weight,
+			Port:     rec.Port,
+			Target:   rec.Target,
+		})
+	}
+
+	return response
+}
+
+// checkLocalTXTRecords answers TXT queries from the local record store
+func (p *DNSProxy) checkLocalTXTRecords(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	records := store.GetTXTRecords(question.Name)
+	if len(records) == 0 {
+		return nil
+	}
+
+	logger.Debug("Found %d local TXT record(s) for %s", len(records), question.Name)
+
+	// Create response message
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+
+	// Add answer records
+	for _, txt := range records {
+		response.Answer = append(response.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   question.Name,
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    store.TTL(),
+			},
+			Txt: txt,
+		})
+	}
+
+	return response
+}
+
+// checkLocalServicePTRRecords answers PTR queries for names that are not reverse DNS
+// names, such as DNS-SD service types, from the local record store
+func (p *DNSProxy) checkLocalServicePTRRecords(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	targets := store.GetServicePTRRecords(question.Name)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	logger.Debug("Found %d local PTR record(s) for %s", len(targets), question.Name)
+
+	// Create response message
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+
+	// Add answer records
+	for _, target := range targets {
+		response.Answer = append(response.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   question.Name,
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    store.TTL(),
+			},
+			Ptr: target,
+		})
+	}
+
+	return response
+}
+
+// checkLocalHTTPSRecords answers HTTPS queries from the local record store
+// Domains with local A/AAAA records but no HTTPS record get a NODATA response,
+// so browsers do not wait on an upstream that cannot know about the domain
+func (p *DNSProxy) checkLocalHTTPSRecords(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	records := store.GetHTTPSRecords(question.Name)
+	if len(records) == 0 &&
+		!store.HasRecord(question.Name, RecordTypeA) &&
+		!store.HasRecord(question.Name, RecordTypeAAAA) {
+		return nil
+	}
+
+	logger.Debug("Found %d local HTTPS record(s) for %s", len(records), question.Name)
+
+	// Create response message, with no answers this is NODATA
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+
+	// Add answer records
+	for _, rec := range records {
+		rr := rec.HTTPS
+		rr.Hdr.Name = question.Name
+		rr.Hdr.Ttl = store.TTL()
+		response.Answer = append(response.Answer, &rr)
+	}
+
+	return response
+}
+
+// checkLocalNAPTRRecords answers NAPTR queries from the local record store
+func (p *DNSProxy) checkLocalNAPTRRecords(store RecordStore, query *dns.Msg, question dns.Question) *dns.Msg {
+	// Records are already sorted by order then preference
+	records := store.GetNAPTRRecords(question.Name)
+	if len(records) == 0 {
+		return nil
+	}
+
+	logger.Debug("Found %d local NAPTR record(s) for %s", len(records), question.Name)
+
+	// Create response message
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+
+	// Add answer records
+	for _, rec := range records {
+		response.Answer = append(response.Answer, &dns.NAPTR{
+			Hdr: dns.RR_Header{
+				Name:   question.Name,
+				Rrtype: dns.TypeNAPTR,
+				Class:  dns.ClassINET,
+				Ttl:    store.TTL(),
+			},
+			Order:       rec.Order,
+			Preference:  rec.Preference,
+			Flags:       rec.Flags,
+			Service:     rec.Service,
+			Regexp:      rec.Regexp,
+			Replacement: dns.Fqdn(rec.Replacement),
+		})
+	}
+
+	return response
+}
+
+// forwardToUpstream forwards a DNS query to the given upstream DNS servers, trying at most
+// two of them and skipping those whose circuit breaker is open. When every breaker is
+// open the query is still sent to the server whose breaker closes next, as its probe.
+func (p *DNSProxy) forwardToUpstream(ctx context.Context, query *dns.Msg, upstreams []string) *dns.Msg {
+	var lastErr error
+	attempts := 0
+	for _, server := range upstreams {
+		if attempts == maxUpstreamAttempts {
+			break
+		}
+
+		if !p.breakersDisabled && !p.upstreamBreaker(server).Allow() {
+			logger.Debug("Skipping upstream %s, its circuit breaker is open", server)
+			continue
+		}
+		if attempts > 0 {
+			logger.Debug("Previous DNS server failed, trying %s: %v", server, lastErr)
+		}
+		attempts++
+
+		response, err := p.tryUpstream(ctx, server, query)
+		if err == nil {
+			return response
+		}
+		if errors.Is(ctx.Err(), context.Canceled) {
 			return nil
 		}
+		lastErr = err
 	}
-	return response
+
+	if attempts == 0 && len(upstreams) > 0 {
+		server := p.nextBreakerRetry(upstreams)
+		logger.Debug("All circuit breakers are open for %s, probing %s", query.Question[0].Name, server)
+		response, err := p.tryUpstream(ctx, server, query)
+		if err == nil {
+			return response
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil && !errors.Is(ctx.Err(), context.Canceled) {
+		logger.Error("All DNS servers failed: %v", lastErr)
+	}
+	return nil
+}
+
+// tryUpstream sends query to server and records the outcome with its circuit breaker
+// A query canceled by the client is not counted against the server.
+func (p *DNSProxy) tryUpstream(ctx context.Context, server string, query *dns.Msg) (*dns.Msg, error) {
+	response, err := p.queryUpstream(ctx, server, query, 2*time.Second)
+	if p.breakersDisabled {
+		return response, err
+	}
+
+	breaker := p.upstreamBreaker(server)
+	switch {
+	case err == nil:
+		breaker.RecordSuccess()
+	case errors.Is(ctx.Err(), context.Canceled):
+		breaker.RecordCanceled()
+	default:
+		if breaker.RecordFailure(); breaker.State() == BreakerOpen {
+			logger.Warn("Circuit breaker for upstream %s opened: %v", server, err)
+		}
+	}
+	return response, err
+}
+
+// nextBreakerRetry returns the upstream whose open circuit breaker lets a probe through first
+func (p *DNSProxy) nextBreakerRetry(upstreams []string) string {
+	next := upstreams[0]
+	nextAt := p.upstreamBreaker(next).retryAt()
+	for _, server := range upstreams[1:] {
+		if at := p.upstreamBreaker(server).retryAt(); at.Before(nextAt) {
+			next, nextAt = server, at
+		}
+	}
+	return next
+}
+
+// upstreamBreaker returns the circuit breaker of server, creating it on first use
+func (p *DNSProxy) upstreamBreaker(server string) *CircuitBreaker {
+	if breaker, ok := p.upstreamBreakers.Load(server); ok {
+		return breaker.(*CircuitBreaker)
+	}
+	breaker, _ := p.upstreamBreakers.LoadOrStore(server, NewCircuitBreaker(p.breakerThreshold, p.breakerCooldown))
+	return breaker.(*CircuitBreaker)
 }
 
 // queryUpstream sends a DNS query to upstream server
-func (p *DNSProxy) queryUpstream(server string, query *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+func (p *DNSProxy) queryUpstream(ctx context.Context, server string, query *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		logger.Debug("Querying upstream %s for %s (correlation ID %s)", server, query.Question[0].Name, id)
+	}
+
+	upstreamQuery, cookieOPT := p.addUpstreamCookie(server, query)
+	upstreamQuery, bufSizeOPT := p.setUpstreamBufSize(upstreamQuery)
+	upstreamQuery, paddingOPT := p.padQuery(upstreamQuery)
+	addedOPT := cookieOPT || bufSizeOPT || paddingOPT
+
+	start := time.Now()
+	var response *dns.Msg
+	var err error
 	if p.tunnelDNS {
-		return p.queryUpstreamTunnel(server, query, timeout)
+		response, err = p.queryUpstreamTunnel(ctx, server, upstreamQuery)
+	} else {
+		response, err = p.queryUpstreamDirect(ctx, server, upstreamQuery)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.checkSlowQuery(ctx, server, query, response, start)
+	if err := p.checkUpstreamCookie(server, response); err != nil {
+		return nil, err
+	}
+	if p.paddingBlockSize > 0 || addedOPT {
+		unpadResponse(response, addedOPT)
 	}
-	return p.queryUpstreamDirect(server, query, timeout)
+	return response, nil
 }
 
 // queryUpstreamDirect sends a DNS query to upstream server using miekg/dns directly (host networking)
-func (p *DNSProxy) queryUpstreamDirect(server string, query *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
-	client := &dns.Client{
-		Timeout: timeout,
+func (p *DNSProxy) queryUpstreamDirect(ctx context.Context, server string, query *dns.Msg) (*dns.Msg, error) {
+	if addr, ok := tcpUpstream(server); ok {
+		return p.queryUpstreamTCP(ctx, addr, query)
 	}
 
-	response, _, err := client.Exchange(query, server)
+	client := &dns.Client{}
+
+	conn, err := client.DialContext(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// ExchangeContext only honours the deadline, so end the read when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	response, _, err := client.ExchangeWithConnContext(ctx, query, conn)
 	if err != nil {
 		return nil, err
 	}
 
+	// The full answer did not fit in UDP, so ask again over TCP
+	if response.Truncated {
+		logger.Debug("Truncated response from %s for %s, retrying over TCP", server, query.Question[0].Name)
+		return p.queryUpstreamTCP(ctx, server, query)
+	}
+
 	return response, nil
 }
 
 // queryUpstreamTunnel sends a DNS query through the WireGuard tunnel
-func (p *DNSProxy) queryUpstreamTunnel(server string, query *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+func (p *DNSProxy) queryUpstreamTunnel(ctx context.Context, server string, query *dns.Msg) (*dns.Msg, error) {
+	if _, ok := tcpUpstream(server); ok {
+		return nil, fmt.Errorf("TCP upstream %s is not supported with tunnel DNS", server)
+	}
+
 	// Dial through the tunnel netstack
 	conn, port, err := p.dialTunnel("udp", server)
 	if err != nil {
@@ -545,8 +1252,12 @@ func (p *DNSProxy) queryUpstreamTunnel(server string, query *dns.Msg, timeout ti
 		return nil, fmt.Errorf("failed to pack query: %v", err)
 	}
 
-	// Set deadline
-	conn.SetDeadline(time.Now().Add(timeout))
+	// Set deadline, and end the read early when ctx is cancelled
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
 
 	// Send the query
 	_, err = conn.Write(queryData)
@@ -555,7 +1266,7 @@ func (p *DNSProxy) queryUpstreamTunnel(server string, query *dns.Msg, timeout ti
 	}
 
 	// Read the response
-	buf := make([]byte, 4096)
+	buf := make([]byte, max(4096, int(p.upstreamBufSize)))
 	n, err := conn.Read(buf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %v", err)
@@ -720,7 +1431,8 @@ func (p *DNSProxy) runPacketSender() {
 // AddDNSRecord adds a DNS record to the local store
 // domain should be a domain name (e.g., "example.com" or "example.com.")
 // ip should be a valid IPv4 or IPv6 address
-func (p *DNSProxy) AddDNSRecord(domain string, ip net.IP) error {
+// Returns true if the record is new and false if it was already present
+func (p *DNSProxy) AddDNSRecord(domain string, ip net.IP) (bool, error) {
 	return p.recordStore.AddRecord(domain, ip)
 }
 
@@ -735,6 +1447,12 @@ func (p *DNSProxy) GetDNSRecords(domain string, recordType RecordType) []net.IP
 	return p.recordStore.GetRecords(domain, recordType)
 }
 
+// DetectWildcardOverlaps returns the pairs of wildcard patterns in the local store
+// that match a common domain
+func (p *DNSProxy) DetectWildcardOverlaps(recordType RecordType) []WildcardOverlap {
+	return p.recordStore.DetectWildcardOverlaps(recordType)
+}
+
 // ClearDNSRecords removes all DNS records from the local store
 func (p *DNSProxy) ClearDNSRecords() {
 	p.recordStore.Clear()
@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// exchangeUDP sends query to proxy over a UDP socket pair and returns the raw reply
+func exchangeUDP(t *testing.T, proxy *DNSProxy, query *dns.Msg) []byte {
+	t.Helper()
+
+	serverConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer serverConn.Close()
+	clientConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer clientConn.Close()
+
+	data, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+	proxy.handleDNSQuery(serverConn, data, clientConn.LocalAddr())
+
+	buf := make([]byte, dns.MaxMsgSize)
+	clientConn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := clientConn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return buf[:n]
+}
+
+func TestMaxResponseSizeTruncatesUDP(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	WithMaxResponseSize(1024)(proxy)
+
+	for i := 0; i < 200; i++ {
+		proxy.recordStore.AddRecord("big.example.com.", net.IPv4(10, 0, byte(i/256), byte(i%256)))
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("big.example.com.", dns.TypeA)
+	data := exchangeUDP(t, proxy, query)
+
+	if len(data) > 1024 {
+		t.Errorf("Expected the response to fit in 1024 bytes, got %d", len(data))
+	}
+	response := new(dns.Msg)
+	if err := response.Unpack(data); err != nil {
+		t.Fatalf("Failed to unpack response: %v", err)
+	}
+	if !response.Truncated {
+		t.Error("Expected the TC bit on a truncated response")
+	}
+	if len(response.Answer) == 0 || len(response.Answer) >= 200 {
+		t.Errorf("Expected a partial answer, got %d records", len(response.Answer))
+	}
+}
+
+func TestMaxResponseSizeSmallResponse(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	WithMaxResponseSize(1024)(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	query := new(dns.Msg)
+	query.SetQuestion("app.example.com.", dns.TypeA)
+	response := new(dns.Msg)
+	if err := response.Unpack(exchangeUDP(t, proxy, query)); err != nil {
+		t.Fatalf("Failed to unpack response: %v", err)
+	}
+	if response.Truncated || len(response.Answer) != 1 {
+		t.Errorf("Expected a complete response, got TC=%v with %d records", response.Truncated, len(response.Answer))
+	}
+}
+
+func TestWithMaxResponseSizeMinimum(t *testing.T) {
+	for _, tt := range []struct{ bytes, want int }{
+		{0, 512},
+		{100, 512},
+		{512, 512},
+		{4096, 4096},
+	} {
+		t.Run(fmt.Sprint(tt.bytes), func(t *testing.T) {
+			proxy := &DNSProxy{}
+			WithMaxResponseSize(tt.bytes)(proxy)
+			if proxy.maxResponseSize != tt.want {
+				t.Errorf("Expected limit %d, got %d", tt.want, proxy.maxResponseSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"context"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// CorrelationIDOptionCode is the EDNS0 option code application SDKs use to attach a
+// correlation ID to a query, so the query can be matched with the request trace that
+// caused it. The code is in the range RFC 6891 reserves for local and experimental use.
+// The option data is the ID as plain bytes.
+const CorrelationIDOptionCode uint16 = 65001
+
+// QueryLogEntry describes one query answered by the proxy
+type QueryLogEntry struct {
+	Time          time.Time     `json:"time"`                    // when the query was received
+	Client        string        `json:"client"`                  // address of the client that sent the query
+	Name          string        `json:"name"`                    // name asked for
+	Type          uint16        `json:"type"`                    // query type, e.g. dns.TypeA
+	Rcode         int           `json:"rcode"`                   // response code, -1 if no response was sent
+	Duration      time.Duration `json:"duration"`                // time taken to resolve the query
+	CorrelationID string        `json:"correlationId,omitempty"` // empty unless the correlation ID extractor found one
+	Upstream      string        `json:"upstream,omitempty"`      // upstream server of a slow query warning
+	Slow          bool          `json:"slow,omitempty"`          // set on slow query warnings, Duration is the upstream latency
+}
+
+// WithCorrelationIDExtractor sets a function that returns the correlation ID carried by a
+// query, or an empty string for queries without one. The ID is logged with the query, set
+// on its QueryLogEntry and available to the upstream exchange through
+// CorrelationIDFromContext. CorrelationIDFromEDNS0 reads the CorrelationIDOptionCode option.
+func WithCorrelationIDExtractor(fn func(*dns.Msg) string) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.correlationIDExtractor = fn
+	}
+}
+
+// WithQueryLogger sets a function called with a QueryLogEntry for every query the proxy
+// resolves, and for every slow upstream exchange when WithSlowQueryThreshold is set, with
+// Slow set. fn runs on the query path and should return quickly.
+func WithQueryLogger(fn func(QueryLogEntry)) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.queryLogger = fn
+	}
+}
+
+// WithSlowQueryThreshold makes the proxy warn about every upstream exchange that takes
+// longer than d and count it in SlowQueriesTotal. The warning goes to the query logger as
+// an entry with Slow set, or to the log without one. Only exchanges that get a response
+// are measured, timeouts are not. Zero, the default, turns slow query alerts off.
+func WithSlowQueryThreshold(d time.Duration) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.slowQueryThreshold = d
+	}
+}
+
+// SlowQueriesTotal returns how many upstream exchanges exceeded the slow query threshold
+func (p *DNSProxy) SlowQueriesTotal() uint64 {
+	return p.counters().slowQueries.Load()
+}
+
+// CorrelationIDFromEDNS0 returns the value of the CorrelationIDOptionCode EDNS0 option
+// of msg, or an empty string if it has none
+func CorrelationIDFromEDNS0(msg *dns.Msg) string {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == CorrelationIDOptionCode {
+			return string(local.Data)
+		}
+	}
+	return ""
+}
+
+// correlationIDKey is the context key for a query's correlation ID
+type correlationIDKey struct{}
+
+// withCorrelationID returns ctx carrying id, or ctx itself when id is empty
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID of the query ctx belongs to, or an
+// empty string if it has none
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// correlationID returns the correlation ID of msg, empty without an extractor
+func (p *DNSProxy) correlationID(msg *dns.Msg) string {
+	if p.correlationIDExtractor == nil {
+		return ""
+	}
+	return p.correlationIDExtractor(msg)
+}
+
+// checkSlowQuery warns about an upstream exchange that took longer than the slow query threshold
+func (p *DNSProxy) checkSlowQuery(ctx context.Context, server string, query, response *dns.Msg, start time.Time) {
+	latency := time.Since(start)
+	if p.slowQueryThreshold <= 0 || latency <= p.slowQueryThreshold {
+		return
+	}
+	p.counters().slowQueries.Add(1)
+
+	question := query.Question[0]
+	if p.queryLogger == nil {
+		logger.Warn("Slow DNS query: upstream %s took %v to answer %s (threshold %v)", server, latency, question.Name, p.slowQueryThreshold)
+		return
+	}
+	p.queryLogger(QueryLogEntry{
+		Time:          start,
+		Name:          question.Name,
+		Type:          question.Qtype,
+		Rcode:         response.Rcode,
+		Duration:      latency,
+		CorrelationID: CorrelationIDFromContext(ctx),
+		Upstream:      server,
+		Slow:          true,
+	})
+}
+
+// logQuery logs a resolved query and passes it to the query logger
+func (p *DNSProxy) logQuery(entry QueryLogEntry) {
+	if entry.CorrelationID != "" {
+		logger.Debug("Resolved %s (type %s) for %s with rcode %d in %v, correlation ID %s",
+			entry.Name, dns.TypeToString[entry.Type], entry.Client, entry.Rcode, entry.Duration, entry.CorrelationID)
+	}
+	p.counters().record(entry)
+	p.recordClientQuery(entry)
+	p.queryStream.publish(entry)
+	if p.queryLogger != nil {
+		p.queryLogger(entry)
+	}
+}
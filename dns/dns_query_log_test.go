@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// queryWithCorrelationID builds an A query carrying id in the correlation ID EDNS0 option
+func queryWithCorrelationID(name, id string) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeA)
+	query.SetEdns0(1232, false)
+	if id != "" {
+		opt := query.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: CorrelationIDOptionCode, Data: []byte(id)})
+	}
+	return query
+}
+
+func TestCorrelationIDFromEDNS0(t *testing.T) {
+	if id := CorrelationIDFromEDNS0(queryWithCorrelationID("app.example.com.", "trace-123")); id != "trace-123" {
+		t.Errorf("Expected trace-123, got %q", id)
+	}
+	if id := CorrelationIDFromEDNS0(queryWithCorrelationID("app.example.com.", "")); id != "" {
+		t.Errorf("Expected no ID without the option, got %q", id)
+	}
+
+	plain := new(dns.Msg)
+	plain.SetQuestion("app.example.com.", dns.TypeA)
+	if id := CorrelationIDFromEDNS0(plain); id != "" {
+		t.Errorf("Expected no ID without EDNS0, got %q", id)
+	}
+}
+
+func TestCorrelationIDContext(t *testing.T) {
+	ctx := context.Background()
+	if withCorrelationID(ctx, "") != ctx {
+		t.Error("Expected an empty ID to leave the context unchanged")
+	}
+	if id := CorrelationIDFromContext(withCorrelationID(ctx, "trace-123")); id != "trace-123" {
+		t.Errorf("Expected trace-123, got %q", id)
+	}
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		t.Errorf("Expected no ID, got %q", id)
+	}
+}
+
+func TestQueryLogEntryCarriesCorrelationID(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	var entries []QueryLogEntry
+	proxy := &DNSProxy{
+		recordStore: NewDNSRecordStore(),
+		ctx:         context.Background(),
+	}
+	WithCorrelationIDExtractor(CorrelationIDFromEDNS0)(proxy)
+	WithQueryLogger(func(entry QueryLogEntry) { entries = append(entries, entry) })(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	for _, id := range []string{"trace-123", ""} {
+		data, err := queryWithCorrelationID("app.example.com.", id).Pack()
+		if err != nil {
+			t.Fatalf("Failed to pack query: %v", err)
+		}
+		proxy.handleDNSQuery(conn, data, conn.LocalAddr())
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(entries))
+	}
+	if entries[0].CorrelationID != "trace-123" {
+		t.Errorf("Expected correlation ID trace-123, got %q", entries[0].CorrelationID)
+	}
+	if entries[1].CorrelationID != "" {
+		t.Errorf("Expected no correlation ID, got %q", entries[1].CorrelationID)
+	}
+	if entries[0].Name != "app.example.com." || entries[0].Type != dns.TypeA || entries[0].Rcode != dns.RcodeSuccess {
+		t.Errorf("Unexpected log entry %+v", entries[0])
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	var delay atomic.Int64
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(time.Duration(delay.Load()))
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	var entries []QueryLogEntry
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithSlowQueryThreshold(50 * time.Millisecond)(proxy)
+	WithQueryLogger(func(entry QueryLogEntry) { entries = append(entries, entry) })(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	upstream := conn.LocalAddr().String()
+
+	if _, err := proxy.queryUpstream(context.Background(), upstream, query, time.Second); err != nil {
+		t.Fatalf("Upstream query failed: %v", err)
+	}
+	if n := proxy.SlowQueriesTotal(); n != 0 || len(entries) != 0 {
+		t.Errorf("Expected a fast answer not to count as slow, got %d and entries %v", n, entries)
+	}
+
+	delay.Store(int64(100 * time.Millisecond))
+	if _, err := proxy.queryUpstream(context.Background(), upstream, query, time.Second); err != nil {
+		t.Fatalf("Upstream query failed: %v", err)
+	}
+	if n := proxy.SlowQueriesTotal(); n != 1 {
+		t.Errorf("Expected the slow answer to be counted, got %d", n)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected one slow query warning in the query log, got %v", entries)
+	}
+	if e := entries[0]; !e.Slow || e.Upstream != upstream || e.Name != "example.com." || e.Type != dns.TypeA || e.Duration < 100*time.Millisecond {
+		t.Errorf("Expected a slow query entry for example.com. from %s taking at least 100ms, got %+v", upstream, e)
+	}
+
+	// A timeout is not a slow query
+	delay.Store(int64(300 * time.Millisecond))
+	if _, err := proxy.queryUpstream(context.Background(), upstream, query, 150*time.Millisecond); err == nil {
+		t.Fatal("Expected the upstream query to time out")
+	}
+	if n := proxy.SlowQueriesTotal(); n != 1 || len(entries) != 1 {
+		t.Errorf("Expected a timeout not to be counted, got %d and entries %v", n, entries)
+	}
+}
@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultMaxWSSubscribers is how many query stream subscribers are allowed at once
+	defaultMaxWSSubscribers = 16
+
+	// queryStreamBacklog is how many recent queries a new subscriber receives first
+	queryStreamBacklog = 100
+
+	// queryStreamBuffer bounds the queries waiting to be sent to one subscriber, more are
+	// dropped so a slow subscriber cannot hold up queries
+	queryStreamBuffer = 256
+
+	// queryStreamWriteTimeout is how long a write to a subscriber may take
+	queryStreamWriteTimeout = 10 * time.Second
+)
+
+// ErrTooManySubscribers is returned when the query stream already has the maximum
+// number of subscribers
+var ErrTooManySubscribers = errors.New("too many query stream subscribers")
+
+// WithMaxWSSubscribers caps how many clients can follow the live query stream at once,
+// 16 by default
+func WithMaxWSSubscribers(n int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		if n > 0 {
+			p.maxWSSubscribers = n
+		}
+	}
+}
+
+// QuerySubscription receives the queries resolved by the proxy, see SubscribeQueries
+type QuerySubscription struct {
+	C <-chan QueryLogEntry
+
+	ch     chan QueryLogEntry
+	stream *queryStream
+	once   sync.Once
+}
+
+// Close stops the subscription and closes C
+func (s *QuerySubscription) Close() {
+	s.once.Do(func() {
+		s.stream.mu.Lock()
+		delete(s.stream.subscribers, s)
+		s.stream.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// queryStream fans resolved queries out to subscribers and keeps the most recent ones
+// for new subscribers
+type queryStream struct {
+	mu          sync.Mutex
+	recent      *clientRing
+	subscribers map[*QuerySubscription]struct{}
+}
+
+// publish sends entry to every subscriber without blocking, dropping it for subscribers
+// that are behind
+func (q *queryStream) publish(entry QueryLogEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.recent == nil {
+		q.recent = &clientRing{entries: make([]QueryLogEntry, queryStreamBacklog)}
+	}
+	q.recent.add(entry)
+	for sub := range q.subscribers {
+		select {
+		case sub.ch <- entry:
+		default:
+		}
+	}
+}
+
+// SubscribeQueries returns a subscription that first receives up to the last 100 resolved
+// queries, then each query as it is resolved. Queries are dropped for a subscriber that
+// falls too far behind. The subscription must be closed when no longer needed.
+func (p *DNSProxy) SubscribeQueries() (*QuerySubscription, error) {
+	maxSubscribers := p.maxWSSubscribers
+	if maxSubscribers <= 0 {
+		maxSubscribers = defaultMaxWSSubscribers
+	}
+
+	q := &p.queryStream
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.subscribers) >= maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	if q.subscribers == nil {
+		q.subscribers = make(map[*QuerySubscription]struct{})
+	}
+
+	ch := make(chan QueryLogEntry, queryStreamBuffer)
+	if q.recent != nil {
+		for _, entry := range q.recent.last(0) {
+			ch <- entry
+		}
+	}
+	sub := &QuerySubscription{C: ch, ch: ch, stream: q}
+	q.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// QueryStreamHandler returns a WebSocket handler that streams resolved queries to the
+// client as JSON QueryLogEntry objects, one per line, starting with the recent backlog
+func (p *DNSProxy) QueryStreamHandler() http.Handler {
+	upgrader := websocket.Upgrader{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub, err := p.SubscribeQueries()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer sub.Close()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Debug("Failed to upgrade query stream connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		// The client sends nothing, reading only notices when it goes away
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-gone:
+				return
+			case entry := <-sub.C:
+				line, err := json.Marshal(entry)
+				if err != nil {
+					continue
+				}
+				conn.SetWriteDeadline(time.Now().Add(queryStreamWriteTimeout))
+				if err := conn.WriteMessage(websocket.TextMessage, append(line, '\n')); err != nil {
+					logger.Debug("Query stream subscriber %s went away: %v", r.RemoteAddr, err)
+					return
+				}
+			}
+		}
+	})
+}
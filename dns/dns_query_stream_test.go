@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialQueryStream(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial query stream: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readQueryEntry(t *testing.T, conn *websocket.Conn) QueryLogEntry {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read from query stream: %v", err)
+	}
+	if !strings.HasSuffix(string(data), "\n") {
+		t.Errorf("Expected a newline terminated entry, got %q", data)
+	}
+	var entry QueryLogEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("Failed to decode query entry: %v", err)
+	}
+	return entry
+}
+
+func TestQueryStream(t *testing.T) {
+	proxy := &DNSProxy{}
+	for i := range queryStreamBacklog + 5 {
+		proxy.logQuery(QueryLogEntry{Name: fmt.Sprintf("old%d.example.com.", i)})
+	}
+
+	server := httptest.NewServer(proxy.QueryStreamHandler())
+	defer server.Close()
+	conn := dialQueryStream(t, server)
+
+	// The backlog holds the last 100 queries, oldest first
+	for i := 5; i < queryStreamBacklog+5; i++ {
+		if entry := readQueryEntry(t, conn); entry.Name != fmt.Sprintf("old%d.example.com.", i) {
+			t.Fatalf("Expected old%d.example.com. from the backlog, got %s", i, entry.Name)
+		}
+	}
+
+	proxy.logQuery(QueryLogEntry{Name: "live.example.com.", Rcode: 3})
+	if entry := readQueryEntry(t, conn); entry.Name != "live.example.com." || entry.Rcode != 3 {
+		t.Errorf("Expected the live query, got %+v", entry)
+	}
+}
+
+func TestQueryStreamMaxSubscribers(t *testing.T) {
+	proxy := &DNSProxy{}
+	WithMaxWSSubscribers(1)(proxy)
+	server := httptest.NewServer(proxy.QueryStreamHandler())
+	defer server.Close()
+
+	conn := dialQueryStream(t, server)
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a second subscriber to be refused, got %v", err)
+	}
+
+	// A subscriber that disconnects frees its slot
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sub, err := proxy.SubscribeQueries()
+		if err == nil {
+			sub.Close()
+			break
+		}
+		if !errors.Is(err, ErrTooManySubscribers) || time.Now().After(deadline) {
+			t.Fatalf("Expected the slot to be freed, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueryStreamSlowSubscriber(t *testing.T) {
+	proxy := &DNSProxy{}
+	sub, err := proxy.SubscribeQueries()
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	// Publishing never blocks on a subscriber that does not read
+	done := make(chan struct{})
+	go func() {
+		for range queryStreamBuffer * 2 {
+			proxy.logQuery(QueryLogEntry{Name: "flood.example.com."})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publishing blocked on a slow subscriber")
+	}
+	if n := len(sub.C); n != queryStreamBuffer {
+		t.Errorf("Expected a full buffer of %d queries, got %d", queryStreamBuffer, n)
+	}
+}
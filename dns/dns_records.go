@@ -1,14 +1,45 @@
 package dns
 
 import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"net/netip"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
+const (
+	reverseDNSSuffixV4 = ".in-addr.arpa."
+	reverseDNSSuffixV6 = ".ip6.arpa."
+)
+
+// defaultRecordTTL is the TTL served for local records unless WithDefaultTTL is used
+const defaultRecordTTL = 5 * time.Minute
+
+// ErrStoreFull is returned when adding a record would exceed a configured store limit
+var ErrStoreFull = errors.New("DNS record store is full")
+
+// ErrInvalidReverseDNS is returned when a name is not a valid in-addr.arpa or ip6.arpa name
+var ErrInvalidReverseDNS = errors.New("invalid reverse DNS name")
+
+// ErrInvalidDomain is returned when a domain or wildcard pattern is not a valid name
+var ErrInvalidDomain = errors.New("invalid domain name")
+
+// ErrInvalidIP is returned when a string is not a valid IPv4 or IPv6 address
+var ErrInvalidIP = errors.New("invalid IP address")
+
+// ErrRecordNotFound is returned when an operation needs a record that is not in the store
+var ErrRecordNotFound = errors.New("DNS record not found")
+
 // RecordType represents the type of DNS record
 type RecordType uint16
 
@@ -18,25 +49,196 @@ const (
 	RecordTypePTR  RecordType = RecordType(dns.TypePTR)
 )
 
-// DNSRecordStore manages local DNS records for A, AAAA, and PTR queries
+// String returns the record type name, e.g. "A" or "AAAA"
+func (rt RecordType) String() string {
+	if name, ok := dns.TypeToString[uint16(rt)]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", uint16(rt))
+}
+
+// ParseRecordType converts a record type name such as "AAAA" to a RecordType
+func ParseRecordType(s string) (RecordType, error) {
+	t, ok := dns.StringToType[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown DNS record type %q", s)
+	}
+	return RecordType(t), nil
+}
+
+// MarshalJSON encodes the record type as its name
+func (rt RecordType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rt.String())
+}
+
+// UnmarshalJSON decodes a record type from its name
+func (rt *RecordType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("record type must be a string: %w", err)
+	}
+
+	parsed, err := ParseRecordType(s)
+	if err != nil {
+		return err
+	}
+
+	*rt = parsed
+	return nil
+}
+
+// DNSRecordStore manages local DNS records for A, AAAA, PTR, CAA, HTTPS, NAPTR, SRV and TXT queries
 type DNSRecordStore struct {
-	mu            sync.RWMutex
-	aRecords      map[string][]net.IP // domain -> list of IPv4 addresses
-	aaaaRecords   map[string][]net.IP // domain -> list of IPv6 addresses
-	aWildcards    map[string][]net.IP // wildcard pattern -> list of IPv4 addresses
-	aaaaWildcards map[string][]net.IP // wildcard pattern -> list of IPv6 addresses
-	ptrRecords    map[string]string   // IP address string -> domain name
+	mu                sync.RWMutex
+	aRecords          map[string][]netip.Addr         // domain -> list of IPv4 addresses
+	aaaaRecords       map[string][]netip.Addr         // domain -> list of IPv6 addresses
+	aWildcards        *dnsTrie                        // wildcard pattern -> list of IPv4 addresses
+	aaaaWildcards     *dnsTrie                        // wildcard pattern -> list of IPv6 addresses
+	ptrRecords        map[netip.Addr][]string         // IP address -> domain names
+	caaRecords        map[string][]CAARecord          // domain or wildcard pattern -> CAA records
+	httpsRecords      map[string][]HTTPSRecord        // domain or wildcard pattern -> HTTPS records
+	naptrRecords      map[string][]NAPTRRecord        // domain or wildcard pattern -> NAPTR records
+	srvRecords        map[string][]SRVRecord          // domain or wildcard pattern -> SRV records
+	servicePTRRecords map[string][]string             // service name -> PTR targets, e.g. DNS-SD instances
+	txtRecords        map[string][][]string           // domain -> TXT records, each a list of strings
+	services          map[string]registeredService    // DNS-SD instance name -> registration
+	negative          negativeCache                   // NXDOMAIN responses cached by the proxy
+	expiries          map[string]map[string]time.Time // domain -> IP address string -> expiry of expiring records
+	now               func() time.Time                // clock used for record expiry
+	weights           map[string]map[string]uint      // domain -> IP address string -> selection weight other than 1
+
+	// DNSSEC signatures made by SignZone
+	signingZone string
+	rrSigs      map[string][]dns.RRSIG // domain -> RRSIG per signed record type
+
+	// Wildcard residuals compiled by CompileAllWildcards, nil until it is first called
+	aWildcardsCompiled    map[string]*CompiledPattern
+	aaaaWildcardsCompiled map[string]*CompiledPattern
+	wildcardsDirty        bool // patterns were added since the last CompileAllWildcards
+
+	txMu sync.Mutex // held while a DNSTransaction is open
+
+	maxExactEntries     int           // max exact domains per record type, 0 for no limit
+	maxWildcardPatterns int           // max wildcard patterns per record type, 0 for no limit
+	defaultTTL          time.Duration // TTL served for local records
+	onEvict             func(domain string, ip net.IP)
+
+	// Background removal of expired records, running while any record has an expiry
+	onExpiry      func(domain string, ip net.IP, recordType RecordType)
+	ttlEviction   bool // remove expired records in the background
+	sweepInterval time.Duration
+	sweeping      bool       // guarded by mu
+	sweepMu       sync.Mutex // serializes removeExpired
+
+	// Functions told about record changes, see Subscribe
+	subscribers   map[string]recordSubscriber // name -> subscriber
+	subscriberSeq uint64
+	subscriberMu  sync.RWMutex // guards subscribers and subscriberSeq, separate from mu
+
+	// Weighted random ordering of GetRecords results
+	weightedSelection bool
+	rng               *rand.Rand
+	rngMu             sync.Mutex // guards rng, which GetRecords uses under a read lock
+
+	// Sticky client to address assignments of GetRecordSticky
+	sticky   map[stickyKey]string // -> IP address string
+	stickyMu sync.Mutex           // guards sticky, which GetRecordSticky updates under a read lock
+
+	// Liveness probes that suppress failing A/AAAA records in GetRecords
+	healthChecks map[string]map[string]context.CancelFunc // domain -> IP address string -> stops the check
+	healthyIPs   sync.Map                                 // healthKey -> latest check result, written by the checks without mu
+
+	// LRU of exact A/AAAA domains, only tracked when WithMaxCapacity is set
+	maxCapacity int
+	lru         *list.List
+	lruIndex    map[string]*list.Element
+	lruMu       sync.Mutex // guards lru and lruIndex, which GetRecords updates under a read lock
+}
+
+// DNSRecordStoreOption configures a DNSRecordStore
+type DNSRecordStoreOption func(*DNSRecordStore)
+
+// WithMaxExactEntries caps the number of exact-match domains per record type
+// Adding a new domain beyond the cap fails with ErrStoreFull
+func WithMaxExactEntries(n int) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.maxExactEntries = n
+	}
+}
+
+// WithMaxWildcardPatterns caps the number of wildcard patterns per record type
+// Adding a new pattern beyond the cap fails with ErrStoreFull
+func WithMaxWildcardPatterns(n int) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.maxWildcardPatterns = n
+	}
+}
+
+// WithDefaultTTL sets the TTL served for local records, 5 minutes by default
+func WithDefaultTTL(d time.Duration) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.defaultTTL = d
+	}
+}
+
+// WithEvictionCallback sets a function called for each record the store evicts
+// The callback is invoked with the store lock held and must not call back into the store
+func WithEvictionCallback(fn func(domain string, ip net.IP)) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.onEvict = fn
+	}
 }
 
 // NewDNSRecordStore creates a new DNS record store
-func NewDNSRecordStore() *DNSRecordStore {
-	return &DNSRecordStore{
-		aRecords:      make(map[string][]net.IP),
-		aaaaRecords:   make(map[string][]net.IP),
-		aWildcards:    make(map[string][]net.IP),
-		aaaaWildcards: make(map[string][]net.IP),
-		ptrRecords:    make(map[string]string),
+func NewDNSRecordStore(opts ...DNSRecordStoreOption) *DNSRecordStore {
+	s := &DNSRecordStore{
+		aRecords:          make(map[string][]netip.Addr),
+		aaaaRecords:       make(map[string][]netip.Addr),
+		aWildcards:        newDNSTrie(),
+		aaaaWildcards:     newDNSTrie(),
+		ptrRecords:        make(map[netip.Addr][]string),
+		caaRecords:        make(map[string][]CAARecord),
+		httpsRecords:      make(map[string][]HTTPSRecord),
+		naptrRecords:      make(map[string][]NAPTRRecord),
+		srvRecords:        make(map[string][]SRVRecord),
+		servicePTRRecords: make(map[string][]string),
+		txtRecords:        make(map[string][][]string),
+		services:          make(map[string]registeredService),
+		negative:          negativeCache{size: defaultNegativeCacheSize},
+		expiries:          make(map[string]map[string]time.Time),
+		now:               time.Now,
+		weights:           make(map[string]map[string]uint),
+		healthChecks:      make(map[string]map[string]context.CancelFunc),
+		sticky:            make(map[stickyKey]string),
+		rng:               rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+		defaultTTL:        defaultRecordTTL,
+		ttlEviction:       true,
+		sweepInterval:     defaultSweepInterval,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// TTL returns the TTL in seconds served for local records
+func (s *DNSRecordStore) TTL() uint32 {
+	return uint32(s.defaultTTL / time.Second)
+}
+
+// checkLimitLocked returns ErrStoreFull if adding domain to records would exceed limit
+// The caller must hold s.mu
+func checkLimitLocked(records map[string][]netip.Addr, domain string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	if _, exists := records[domain]; exists {
+		return nil
+	}
+	if len(records) >= limit {
+		return fmt.Errorf("%w: cannot add %s, limit of %d reached", ErrStoreFull, domain, limit)
 	}
+	return nil
 }
 
 // AddRecord adds a DNS record mapping (A or AAAA)
@@ -44,9 +246,59 @@ func NewDNSRecordStore() *DNSRecordStore {
 // domain can contain wildcards: * (0+ chars) and ? (exactly 1 char)
 // ip should be a valid IPv4 or IPv6 address
 // Automatically adds a corresponding PTR record for non-wildcard domains
-func (s *DNSRecordStore) AddRecord(domain string, ip net.IP) error {
+// Returns true if the (domain, ip) pair is new and false if it was already present
+func (s *DNSRecordStore) AddRecord(domain string, ip net.IP) (bool, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	added, err := s.addRecordLocked(domain, ip)
+	s.mu.Unlock()
+
+	if added {
+		addr, _ := ipToAddr(ip)
+		s.publish(addedEvent(domain, addr))
+	}
+	return added, err
+}
+
+// AddRecordString is AddRecord for an IP address given as a string, as found in
+// configuration files and API requests
+// Returns ErrInvalidIP when ipStr does not parse
+//
+// Deprecated: parse with netip.ParseAddr and use AddAddrRecord
+func (s *DNSRecordStore) AddRecordString(domain, ipStr string) error {
+	ip, err := parseIP(ipStr)
+	if err != nil {
+		return err
+	}
+	_, err = s.AddRecord(domain, ip)
+	return err
+}
+
+// ParseAndAddRecord adds an A or AAAA record for an IP address given as a string, as
+// found in configuration files. It returns ErrInvalidIP when ipStr does not parse.
+//
+// Deprecated: parse with netip.ParseAddr and use AddAddrRecord
+func (s *DNSRecordStore) ParseAndAddRecord(domain, ipStr string) error {
+	return s.AddRecordString(domain, ipStr)
+}
+
+// addRecordLocked adds a DNS record mapping
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) addRecordLocked(domain string, ip net.IP) (bool, error) {
+	addr, ok := ipToAddr(ip)
+	if !ok {
+		return false, &net.ParseError{Type: "IP address", Text: ip.String()}
+	}
+	return s.addAddrRecordLocked(domain, addr)
+}
+
+// addAddrRecordLocked is addRecordLocked for an unmapped netip.Addr
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) addAddrRecordLocked(domain string, addr netip.Addr) (bool, error) {
+	if strings.ContainsAny(domain, "*?") {
+		if err := validateWildcardPattern(domain); err != nil {
+			return false, err
+		}
+	}
 
 	// Ensure domain ends with a dot (FQDN format)
 	if len(domain) == 0 || domain[len(domain)-1] != '.' {
@@ -59,29 +311,47 @@ func (s *DNSRecordStore) AddRecord(domain string, ip net.IP) error {
 	// Check if domain contains wildcards
 	isWildcard := strings.ContainsAny(domain, "*?")
 
-	if ip.To4() != nil {
-		// IPv4 address
-		if isWildcard {
-			s.aWildcards[domain] = append(s.aWildcards[domain], ip)
-		} else {
-			s.aRecords[domain] = append(s.aRecords[domain], ip)
-			// Automatically add PTR record for non-wildcard domains
-			s.ptrRecords[ip.String()] = domain
+	var records map[string][]netip.Addr
+	var wildcards *dnsTrie
+	// Store IPv4-mapped IPv6 addresses such as ::ffff:1.2.3.4 in their 4 byte form
+	addr = addr.Unmap()
+	if addr.Is4() {
+		records, wildcards = s.aRecords, s.aWildcards
+	} else if addr.Is6() {
+		records, wildcards = s.aaaaRecords, s.aaaaWildcards
+	} else {
+		return false, &net.ParseError{Type: "IP address", Text: addr.String()}
+	}
+
+	if isWildcard {
+		// The wildcard trie keeps net.IPs
+		ip := net.IP(addr.AsSlice())
+		ips, _ := wildcards.get(domain)
+		if slices.ContainsFunc(ips, ip.Equal) {
+			return false, nil
 		}
-	} else if ip.To16() != nil {
-		// IPv6 address
-		if isWildcard {
-			s.aaaaWildcards[domain] = append(s.aaaaWildcards[domain], ip)
-		} else {
-			s.aaaaRecords[domain] = append(s.aaaaRecords[domain], ip)
-			// Automatically add PTR record for non-wildcard domains
-			s.ptrRecords[ip.String()] = domain
+		if err := wildcards.checkLimit(domain, s.maxWildcardPatterns); err != nil {
+			return false, err
 		}
-	} else {
-		return &net.ParseError{Type: "IP address", Text: ip.String()}
+		wildcards.set(domain, append(ips, ip))
+		s.wildcardsDirty = true
+		return true, nil
 	}
 
-	return nil
+	if slices.Contains(records[domain], addr) {
+		return false, nil
+	}
+	if err := checkLimitLocked(records, domain, s.maxExactEntries); err != nil {
+		return false, err
+	}
+	records[domain] = append(records[domain], addr)
+	s.dropRRSIGsLocked(domain)
+	// Automatically add PTR record for non-wildcard domains
+	s.addPTRLocked(addr, domain)
+	s.lruTouch(domain)
+	s.enforceCapacityLocked()
+
+	return true, nil
 }
 
 // AddPTRRecord adds a PTR record mapping an IP address to a domain name
@@ -99,19 +369,134 @@ func (s *DNSRecordStore) AddPTRRecord(ip net.IP, domain string) error {
 	// Normalize domain to lowercase FQDN
 	domain = strings.ToLower(dns.Fqdn(domain))
 
-	// Store PTR record using IP string as key
-	s.ptrRecords[ip.String()] = domain
+	addr, ok := ipToAddr(ip)
+	if !ok {
+		return &net.ParseError{Type: "IP address", Text: ip.String()}
+	}
+	s.addPTRLocked(addr, domain)
 
 	return nil
 }
 
+// AddPTRRecordString is AddPTRRecord for an IP address given as a string
+// Returns ErrInvalidIP when ipStr does not parse
+func (s *DNSRecordStore) AddPTRRecordString(ipStr, domain string) error {
+	ip, err := parseIP(ipStr)
+	if err != nil {
+		return err
+	}
+	return s.AddPTRRecord(ip, domain)
+}
+
+// BulkPTREntry is a single IP to domain mapping for BulkAddPTRRecords
+type BulkPTREntry struct {
+	IP     net.IP
+	Domain string
+}
+
+// BulkAddPTRRecords adds many PTR records while holding the lock once
+// The returned slice has one error per entry, nil for entries that were added
+func (s *DNSRecordStore) BulkAddPTRRecords(entries []BulkPTREntry) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(entries))
+	for i, entry := range entries {
+		addr, ok := ipToAddr(entry.IP)
+		if !ok {
+			errs[i] = &net.ParseError{Type: "IP address", Text: entry.IP.String()}
+			continue
+		}
+		if strings.Trim(entry.Domain, ".") == "" {
+			errs[i] = fmt.Errorf("empty domain for PTR record %s", entry.IP)
+			continue
+		}
+
+		s.addPTRLocked(addr, strings.ToLower(dns.Fqdn(entry.Domain)))
+	}
+
+	return errs
+}
+
+// BulkRemovePTRRecords removes the PTR records for many IP addresses while holding the lock once
+func (s *DNSRecordStore) BulkRemovePTRRecords(ips []net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ip := range ips {
+		if addr, ok := ipToAddr(ip); ok {
+			delete(s.ptrRecords, addr)
+		}
+	}
+}
+
+// addPTRLocked appends domain to the PTR records for ip unless it is already present
+// The caller must hold s.mu
+func (s *DNSRecordStore) addPTRLocked(addr netip.Addr, domain string) {
+	for _, existing := range s.ptrRecords[addr] {
+		if existing == domain {
+			return
+		}
+	}
+	s.ptrRecords[addr] = append(s.ptrRecords[addr], domain)
+}
+
+// removePTRLocked removes domain from the PTR records for ip
+// The caller must hold s.mu
+func (s *DNSRecordStore) removePTRLocked(addr netip.Addr, domain string) {
+	domains, ok := s.ptrRecords[addr]
+	if !ok {
+		return
+	}
+
+	remaining := make([]string, 0, len(domains))
+	for _, existing := range domains {
+		if existing != domain {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(s.ptrRecords, addr)
+	} else {
+		s.ptrRecords[addr] = remaining
+	}
+}
+
 // RemoveRecord removes a specific DNS record mapping
 // If ip is nil, removes all records for the domain (including wildcards)
 // Automatically removes corresponding PTR records for non-wildcard domains
 func (s *DNSRecordStore) RemoveRecord(domain string, ip net.IP) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	// Subscribers get an event per record that went away
+	notify := s.hasSubscribers()
+	var before []RecordEvent
+	if notify {
+		before = s.recordEventsLocked(domain, RecordRemoved)
+	}
+	s.removeRecordLocked(domain, ip)
+	var removed []RecordEvent
+	if notify {
+		removed = removedEvents(before, s.recordEventsLocked(domain, RecordRemoved))
+	}
+	s.mu.Unlock()
+
+	s.publish(removed...)
+}
+
+// RemoveRecordString is RemoveRecord for an IP address given as a string
+// An ipStr that does not parse removes nothing, rather than every record as a nil IP would
+func (s *DNSRecordStore) RemoveRecordString(domain, ipStr string) {
+	ip, err := parseIP(ipStr)
+	if err != nil {
+		return
+	}
+	s.RemoveRecord(domain, ip)
+}
 
+// removeRecordLocked removes a specific DNS record mapping, or all of them if ip is nil
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) removeRecordLocked(domain string, ip net.IP) {
 	// Ensure domain ends with a dot (FQDN format)
 	if len(domain) == 0 || domain[len(domain)-1] != '.' {
 		domain = domain + "."
@@ -119,6 +504,9 @@ func (s *DNSRecordStore) RemoveRecord(domain string, ip net.IP) {
 
 	// Normalize domain to lowercase FQDN
 	domain = strings.ToLower(dns.Fqdn(domain))
+	defer s.lruForgetIfGoneLocked(domain)
+	defer s.forgetRecordStateLocked(domain)
+	defer s.dropRRSIGsLocked(domain)
 
 	// Check if domain contains wildcards
 	isWildcard := strings.ContainsAny(domain, "*?")
@@ -126,24 +514,20 @@ func (s *DNSRecordStore) RemoveRecord(domain string, ip net.IP) {
 	if ip == nil {
 		// Remove all records for this domain
 		if isWildcard {
-			delete(s.aWildcards, domain)
-			delete(s.aaaaWildcards, domain)
+			s.aWildcards.delete(domain)
+			s.aaaaWildcards.delete(domain)
 		} else {
 			// For non-wildcard domains, remove PTR records for all IPs
-			if ips, ok := s.aRecords[domain]; ok {
-				for _, ipAddr := range ips {
-					// Only remove PTR if it points to this domain
-					if ptrDomain, exists := s.ptrRecords[ipAddr.String()]; exists && ptrDomain == domain {
-						delete(s.ptrRecords, ipAddr.String())
-					}
+			if addrs, ok := s.aRecords[domain]; ok {
+				for _, addr := range addrs {
+					// Only remove the PTR target pointing to this domain
+					s.removePTRLocked(addr, domain)
 				}
 			}
-			if ips, ok := s.aaaaRecords[domain]; ok {
-				for _, ipAddr := range ips {
-					// Only remove PTR if it points to this domain
-					if ptrDomain, exists := s.ptrRecords[ipAddr.String()]; exists && ptrDomain == domain {
-						delete(s.ptrRecords, ipAddr.String())
-					}
+			if addrs, ok := s.aaaaRecords[domain]; ok {
+				for _, addr := range addrs {
+					// Only remove the PTR target pointing to this domain
+					s.removePTRLocked(addr, domain)
 				}
 			}
 			delete(s.aRecords, domain)
@@ -152,46 +536,49 @@ func (s *DNSRecordStore) RemoveRecord(domain string, ip net.IP) {
 		return
 	}
 
-	if ip.To4() != nil {
+	addr, ok := ipToAddr(ip)
+	if !ok {
+		return
+	}
+
+	if addr.Is4() {
 		// Remove specific IPv4 address
 		if isWildcard {
-			if ips, ok := s.aWildcards[domain]; ok {
-				s.aWildcards[domain] = removeIP(ips, ip)
-				if len(s.aWildcards[domain]) == 0 {
-					delete(s.aWildcards, domain)
+			if ips, ok := s.aWildcards.get(domain); ok {
+				if remaining := removeIP(ips, ip); len(remaining) > 0 {
+					s.aWildcards.set(domain, remaining)
+				} else {
+					s.aWildcards.delete(domain)
 				}
 			}
 		} else {
-			if ips, ok := s.aRecords[domain]; ok {
-				s.aRecords[domain] = removeIP(ips, ip)
+			if addrs, ok := s.aRecords[domain]; ok {
+				s.aRecords[domain] = removeAddr(addrs, addr)
 				if len(s.aRecords[domain]) == 0 {
 					delete(s.aRecords, domain)
 				}
-				// Automatically remove PTR record if it points to this domain
-				if ptrDomain, exists := s.ptrRecords[ip.String()]; exists && ptrDomain == domain {
-					delete(s.ptrRecords, ip.String())
-				}
+				// Automatically remove the PTR target pointing to this domain
+				s.removePTRLocked(addr, domain)
 			}
 		}
-	} else if ip.To16() != nil {
+	} else {
 		// Remove specific IPv6 address
 		if isWildcard {
-			if ips, ok := s.aaaaWildcards[domain]; ok {
-				s.aaaaWildcards[domain] = removeIP(ips, ip)
-				if len(s.aaaaWildcards[domain]) == 0 {
-					delete(s.aaaaWildcards, domain)
+			if ips, ok := s.aaaaWildcards.get(domain); ok {
+				if remaining := removeIP(ips, ip); len(remaining) > 0 {
+					s.aaaaWildcards.set(domain, remaining)
+				} else {
+					s.aaaaWildcards.delete(domain)
 				}
 			}
 		} else {
-			if ips, ok := s.aaaaRecords[domain]; ok {
-				s.aaaaRecords[domain] = removeIP(ips, ip)
+			if addrs, ok := s.aaaaRecords[domain]; ok {
+				s.aaaaRecords[domain] = removeAddr(addrs, addr)
 				if len(s.aaaaRecords[domain]) == 0 {
 					delete(s.aaaaRecords, domain)
 				}
-				// Automatically remove PTR record if it points to this domain
-				if ptrDomain, exists := s.ptrRecords[ip.String()]; exists && ptrDomain == domain {
-					delete(s.ptrRecords, ip.String())
-				}
+				// Automatically remove the PTR target pointing to this domain
+				s.removePTRLocked(addr, domain)
 			}
 		}
 	}
@@ -202,7 +589,41 @@ func (s *DNSRecordStore) RemovePTRRecord(ip net.IP) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.ptrRecords, ip.String())
+	if addr, ok := ipToAddr(ip); ok {
+		delete(s.ptrRecords, addr)
+	}
+}
+
+// RemovePTRRecordTarget removes a single domain from the PTR records for an IP
+// address, leaving any other domains for the same address in place
+func (s *DNSRecordStore) RemovePTRRecordTarget(ip net.IP, domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if addr, ok := ipToAddr(ip); ok {
+		s.removePTRLocked(addr, strings.ToLower(dns.Fqdn(domain)))
+	}
+}
+
+// RemovePTRRecordsByDomain removes the domain from the PTR records of every IP
+// address that points to it and returns the number of addresses affected
+func (s *DNSRecordStore) RemovePTRRecordsByDomain(domain string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	removed := 0
+	for addr, domains := range s.ptrRecords {
+		if !slices.Contains(domains, domain) {
+			continue
+		}
+		s.removePTRLocked(addr, domain)
+		removed++
+	}
+
+	return removed
 }
 
 // GetRecords returns all IP addresses for a domain and record type
@@ -211,6 +632,11 @@ func (s *DNSRecordStore) GetRecords(domain string, recordType RecordType) []net.
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	return s.getRecordsLocked(domain, recordType)
+}
+
+// getRecordsLocked is GetRecords for callers already holding s.mu
+func (s *DNSRecordStore) getRecordsLocked(domain string, recordType RecordType) []net.IP {
 	// Normalize domain to lowercase FQDN
 	domain = strings.ToLower(dns.Fqdn(domain))
 
@@ -218,43 +644,47 @@ func (s *DNSRecordStore) GetRecords(domain string, recordType RecordType) []net.
 	switch recordType {
 	case RecordTypeA:
 		// Check exact match first
-		if ips, ok := s.aRecords[domain]; ok {
-			// Return a copy to prevent external modifications
-			records = make([]net.IP, len(ips))
-			copy(records, ips)
+		if addrs := s.healthyLocked(domain, s.unexpiredLocked(domain, s.aRecords[domain])); len(addrs) > 0 {
+			s.lruTouch(domain)
+			// Convert to net.IPs, which also keeps callers from modifying the store
+			records = addrsToIPs(addrs)
+			if s.weightedSelection {
+				s.weightedShuffleLocked(domain, records)
+			}
 			return records
 		}
 		// Check wildcard patterns
-		for pattern, ips := range s.aWildcards {
-			if matchWildcard(pattern, domain) {
-				records = append(records, ips...)
-			}
-		}
+		records = s.aWildcards.match(domain, s.aWildcardsCompiled)
 		if len(records) > 0 {
 			// Return a copy
 			result := make([]net.IP, len(records))
 			copy(result, records)
+			if s.weightedSelection {
+				s.weightedShuffleLocked(domain, result)
+			}
 			return result
 		}
 
 	case RecordTypeAAAA:
 		// Check exact match first
-		if ips, ok := s.aaaaRecords[domain]; ok {
-			// Return a copy to prevent external modifications
-			records = make([]net.IP, len(ips))
-			copy(records, ips)
+		if addrs := s.healthyLocked(domain, s.unexpiredLocked(domain, s.aaaaRecords[domain])); len(addrs) > 0 {
+			s.lruTouch(domain)
+			// Convert to net.IPs, which also keeps callers from modifying the store
+			records = addrsToIPs(addrs)
+			if s.weightedSelection {
+				s.weightedShuffleLocked(domain, records)
+			}
 			return records
 		}
 		// Check wildcard patterns
-		for pattern, ips := range s.aaaaWildcards {
-			if matchWildcard(pattern, domain) {
-				records = append(records, ips...)
-			}
-		}
+		records = s.aaaaWildcards.match(domain, s.aaaaWildcardsCompiled)
 		if len(records) > 0 {
 			// Return a copy
 			result := make([]net.IP, len(records))
 			copy(result, records)
+			if s.weightedSelection {
+				s.weightedShuffleLocked(domain, result)
+			}
 			return result
 		}
 	}
@@ -262,26 +692,234 @@ func (s *DNSRecordStore) GetRecords(domain string, recordType RecordType) []net.
 	return records
 }
 
-// GetPTRRecord returns the domain name for a PTR record query
-// domain should be in reverse DNS format (e.g., "1.0.0.127.in-addr.arpa.")
-func (s *DNSRecordStore) GetPTRRecord(domain string) (string, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// GetPTRRecordByReverseDNS returns the domain name for a PTR record query
+// reverseDomain must be in reverse DNS format (e.g., "1.0.0.127.in-addr.arpa.")
+func (s *DNSRecordStore) GetPTRRecordByReverseDNS(reverseDomain string) (string, bool) {
+	if !IsReverseDNSDomain(reverseDomain) {
+		return "", false
+	}
 
 	// Convert reverse DNS format to IP address
-	ip := reverseDNSToIP(domain)
-	if ip == nil {
+	ip, err := ReverseDNSToIP(reverseDomain)
+	if err != nil {
 		return "", false
 	}
 
+	return s.GetPTRRecordByIP(ip)
+}
+
+// GetPTRRecord returns the domain name for a PTR record query
+//
+// Deprecated: use GetPTRRecordByReverseDNS or GetPTRRecordByIP.
+func (s *DNSRecordStore) GetPTRRecord(domain string) (string, bool) {
+	return s.GetPTRRecordByReverseDNS(domain)
+}
+
+// GetPTRRecordByIP returns the domain name of the PTR record for an IP address
+// If the address has several PTR records, the first one added is returned
+func (s *DNSRecordStore) GetPTRRecordByIP(ip net.IP) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	// Look up the PTR record
-	if ptrDomain, ok := s.ptrRecords[ip.String()]; ok {
-		return ptrDomain, true
+	addr, _ := ipToAddr(ip)
+	if ptrDomains := s.livePTRLocked(addr); len(ptrDomains) > 0 {
+		return ptrDomains[0], true
 	}
 
 	return "", false
 }
 
+// GetAllPTRRecords returns every domain name for a PTR record query
+// reverseDomain must be in reverse DNS format (e.g., "1.0.0.127.in-addr.arpa.")
+func (s *DNSRecordStore) GetAllPTRRecords(reverseDomain string) ([]string, bool) {
+	if !IsReverseDNSDomain(reverseDomain) {
+		return nil, false
+	}
+
+	ip, err := ReverseDNSToIP(reverseDomain)
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addr, _ := ipToAddr(ip)
+	ptrDomains := s.livePTRLocked(addr)
+	if len(ptrDomains) == 0 {
+		return nil, false
+	}
+
+	return append([]string(nil), ptrDomains...), true
+}
+
+// GetIPsByPrefix returns every IP within prefix that has a PTR record, sorted
+func (s *DNSRecordStore) GetIPsByPrefix(prefix netip.Prefix) []net.IP {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return addrsToIPs(s.ptrAddrsInPrefixLocked(prefix))
+}
+
+// GetDomainsForPrefix maps every IP within prefix that has a PTR record to the domain
+// its PTR query answers with first
+func (s *DNSRecordStore) GetDomainsForPrefix(prefix netip.Prefix) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := make(map[string]string)
+	for _, addr := range s.ptrAddrsInPrefixLocked(prefix) {
+		domains[addr.String()] = s.livePTRLocked(addr)[0]
+	}
+	return domains
+}
+
+// ptrAddrsInPrefixLocked returns the sorted addresses within prefix with a live PTR record
+// The caller must hold s.mu
+func (s *DNSRecordStore) ptrAddrsInPrefixLocked(prefix netip.Prefix) []netip.Addr {
+	var addrs []netip.Addr
+	for addr := range s.ptrRecords {
+		if prefix.Contains(addr) && len(s.livePTRLocked(addr)) > 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return addrs
+}
+
+// GetAllDomains returns every domain with at least one record, sorted
+// Wildcard patterns are not domains and are left out
+func (s *DNSRecordStore) GetAllDomains() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	collect := func(domain string) {
+		if !strings.ContainsAny(domain, "*?") {
+			seen[domain] = struct{}{}
+		}
+	}
+	for domain := range s.aRecords {
+		collect(domain)
+	}
+	for domain := range s.aaaaRecords {
+		collect(domain)
+	}
+	for domain := range s.caaRecords {
+		collect(domain)
+	}
+	for domain := range s.httpsRecords {
+		collect(domain)
+	}
+	for domain := range s.naptrRecords {
+		collect(domain)
+	}
+	for domain := range s.srvRecords {
+		collect(domain)
+	}
+	for domain := range s.servicePTRRecords {
+		collect(domain)
+	}
+	for domain := range s.txtRecords {
+		collect(domain)
+	}
+
+	domains := make([]string, 0, len(seen))
+	for domain := range seen {
+		domains = append(domains, domain)
+	}
+	slices.Sort(domains)
+	return domains
+}
+
+// GetDomainsByType returns every exact domain with A or AAAA records, depending on
+// recordType, and its addresses. Expired records are left out. The result is a copy
+// built under the read lock, meant for bulk reads such as generating firewall rules
+// rather than for the query path.
+func (s *DNSRecordStore) GetDomainsByType(recordType RecordType) map[string][]net.IP {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records map[string][]netip.Addr
+	switch recordType {
+	case RecordTypeA:
+		records = s.aRecords
+	case RecordTypeAAAA:
+		records = s.aaaaRecords
+	default:
+		return nil
+	}
+
+	domains := make(map[string][]net.IP, len(records))
+	for domain, addrs := range records {
+		if live := s.unexpiredLocked(domain, addrs); len(live) > 0 {
+			domains[domain] = addrsToIPs(live)
+		}
+	}
+	return domains
+}
+
+// GetDomainsByIP returns every exact domain with an unexpired A or AAAA record for ip,
+// sorted. Unlike the PTR records, which only hold names registered for reverse
+// lookups, this answers which names an address serves, for example when requesting
+// a certificate for it.
+func (s *DNSRecordStore) GetDomainsByIP(ip net.IP) []string {
+	addr, ok := ipToAddr(ip)
+	if !ok {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := s.aaaaRecords
+	if addr.Is4() {
+		records = s.aRecords
+	}
+
+	var domains []string
+	for domain, addrs := range records {
+		if slices.Contains(addrs, addr) && !s.isExpiredLocked(domain, addr) {
+			domains = append(domains, domain)
+		}
+	}
+	slices.Sort(domains)
+	return domains
+}
+
+// GetWildcardPatternsByType returns every wildcard pattern with A or AAAA records,
+// depending on recordType, and its addresses, see GetDomainsByType
+func (s *DNSRecordStore) GetWildcardPatternsByType(recordType RecordType) map[string][]net.IP {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var wildcards *dnsTrie
+	switch recordType {
+	case RecordTypeA:
+		wildcards = s.aWildcards
+	case RecordTypeAAAA:
+		wildcards = s.aaaaWildcards
+	default:
+		return nil
+	}
+
+	patterns := wildcards.patterns()
+	for pattern, ips := range patterns {
+		patterns[pattern] = cloneIPs(ips)
+	}
+	return patterns
+}
+
+// cloneIPs deep copies ips so callers cannot modify the stored addresses
+func cloneIPs(ips []net.IP) []net.IP {
+	clones := make([]net.IP, len(ips))
+	for i, ip := range ips {
+		clones[i] = slices.Clone(ip)
+	}
+	return clones
+}
+
 // HasRecord checks if a domain has any records of the specified type
 // Checks both exact matches and wildcard patterns
 func (s *DNSRecordStore) HasRecord(domain string, recordType RecordType) bool {
@@ -294,25 +932,21 @@ func (s *DNSRecordStore) HasRecord(domain string, recordType RecordType) bool {
 	switch recordType {
 	case RecordTypeA:
 		// Check exact match
-		if _, ok := s.aRecords[domain]; ok {
+		if len(s.unexpiredLocked(domain, s.aRecords[domain])) > 0 {
 			return true
 		}
 		// Check wildcard patterns
-		for pattern := range s.aWildcards {
-			if matchWildcard(pattern, domain) {
-				return true
-			}
+		if s.aWildcards.matches(domain, s.aWildcardsCompiled) {
+			return true
 		}
 	case RecordTypeAAAA:
 		// Check exact match
-		if _, ok := s.aaaaRecords[domain]; ok {
+		if len(s.unexpiredLocked(domain, s.aaaaRecords[domain])) > 0 {
 			return true
 		}
 		// Check wildcard patterns
-		for pattern := range s.aaaaWildcards {
-			if matchWildcard(pattern, domain) {
-				return true
-			}
+		if s.aaaaWildcards.matches(domain, s.aaaaWildcardsCompiled) {
+			return true
 		}
 	}
 
@@ -320,18 +954,27 @@ func (s *DNSRecordStore) HasRecord(domain string, recordType RecordType) bool {
 }
 
 // HasPTRRecord checks if a PTR record exists for the given reverse DNS domain
-func (s *DNSRecordStore) HasPTRRecord(domain string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *DNSRecordStore) HasPTRRecord(reverseDomain string) bool {
+	if !IsReverseDNSDomain(reverseDomain) {
+		return false
+	}
 
 	// Convert reverse DNS format to IP address
-	ip := reverseDNSToIP(domain)
-	if ip == nil {
+	ip, err := ReverseDNSToIP(reverseDomain)
+	if err != nil {
 		return false
 	}
 
-	_, ok := s.ptrRecords[ip.String()]
-	return ok
+	return s.HasPTRRecordForIP(ip)
+}
+
+// HasPTRRecordForIP checks if a PTR record exists for the given IP address
+func (s *DNSRecordStore) HasPTRRecordForIP(ip net.IP) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addr, _ := ipToAddr(ip)
+	return len(s.livePTRLocked(addr)) > 0
 }
 
 // Clear removes all records from the store
@@ -339,11 +982,146 @@ func (s *DNSRecordStore) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.aRecords = make(map[string][]net.IP)
-	s.aaaaRecords = make(map[string][]net.IP)
-	s.aWildcards = make(map[string][]net.IP)
-	s.aaaaWildcards = make(map[string][]net.IP)
-	s.ptrRecords = make(map[string]string)
+	s.aRecords = make(map[string][]netip.Addr)
+	s.aaaaRecords = make(map[string][]netip.Addr)
+	s.aWildcards = newDNSTrie()
+	s.aaaaWildcards = newDNSTrie()
+	s.aWildcardsCompiled = nil
+	s.aaaaWildcardsCompiled = nil
+	s.wildcardsDirty = false
+	s.ptrRecords = make(map[netip.Addr][]string)
+	s.caaRecords = make(map[string][]CAARecord)
+	s.httpsRecords = make(map[string][]HTTPSRecord)
+	s.naptrRecords = make(map[string][]NAPTRRecord)
+	s.srvRecords = make(map[string][]SRVRecord)
+	s.servicePTRRecords = make(map[string][]string)
+	s.txtRecords = make(map[string][][]string)
+	s.services = make(map[string]registeredService)
+	s.negative.clear()
+	s.expiries = make(map[string]map[string]time.Time)
+	s.weights = make(map[string]map[string]uint)
+	s.rrSigs = nil
+	s.stopAllHealthChecksLocked()
+	s.resetStickyLocked()
+	s.resetLRULocked()
+}
+
+// ClearExactRecords removes every exact A, AAAA and PTR record while leaving the
+// wildcard patterns in place, for example when the peer list is replaced but the zone
+// defaults stay. Expiries, weights, health checks and sticky assignments go with the
+// records. The OnExpiry callback is called for each removed record that had an expiry.
+func (s *DNSRecordStore) ClearExactRecords() {
+	// Hold off the sweep so a record is not reported by both
+	s.sweepMu.Lock()
+	defer s.sweepMu.Unlock()
+
+	s.mu.Lock()
+	var cleared []expiredRecord
+	if s.onExpiry != nil {
+		for domain, expiries := range s.expiries {
+			for ipStr := range expiries {
+				cleared = append(cleared, expiredRecord{domain: domain, ip: net.ParseIP(ipStr)})
+			}
+		}
+	}
+	s.aRecords = make(map[string][]netip.Addr)
+	s.aaaaRecords = make(map[string][]netip.Addr)
+	s.ptrRecords = make(map[netip.Addr][]string)
+	s.expiries = make(map[string]map[string]time.Time)
+	s.weights = make(map[string]map[string]uint)
+	s.stopAllHealthChecksLocked()
+	s.resetStickyLocked()
+	s.resetLRULocked()
+	s.mu.Unlock()
+
+	for _, rec := range cleared {
+		s.notifyExpiry(rec)
+	}
+}
+
+// ClearWildcards removes every A and AAAA wildcard pattern while leaving the exact
+// records in place. Wildcard patterns cannot expire, so OnExpiry is not called.
+func (s *DNSRecordStore) ClearWildcards() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.aWildcards = newDNSTrie()
+	s.aaaaWildcards = newDNSTrie()
+	s.aWildcardsCompiled = nil
+	s.aaaaWildcardsCompiled = nil
+	s.wildcardsDirty = false
+	s.resetStickyLocked()
+}
+
+// validateWildcardPattern checks that the labels of a wildcard pattern without * or ?
+// are valid RFC 1123 labels. The pattern "*" on its own matches everything and is allowed.
+func validateWildcardPattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+
+	literal := 0
+	for _, label := range strings.Split(strings.TrimSuffix(pattern, "."), ".") {
+		if strings.ContainsAny(label, "*?") {
+			continue
+		}
+		if !isValidLabel(label) {
+			return fmt.Errorf("%w: %q has an invalid label %q", ErrInvalidDomain, pattern, label)
+		}
+		literal++
+	}
+
+	if literal == 0 {
+		return fmt.Errorf("%w: %q has no labels besides wildcards", ErrInvalidDomain, pattern)
+	}
+	return nil
+}
+
+// isValidLabel reports whether label is a valid RFC 1123 host name label:
+// 1 to 63 letters, digits or hyphens, not starting or ending with a hyphen
+func isValidLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// forgetRecordStateLocked drops the expiries, weights and health checks kept for records of
+// domain that no longer exist
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) forgetRecordStateLocked(domain string) {
+	pruneRecordState(s.expiries, domain, s.hasRecordLocked)
+	pruneRecordState(s.weights, domain, s.hasRecordLocked)
+	for ipStr := range s.healthChecks[domain] {
+		if !s.hasRecordLocked(domain, net.ParseIP(ipStr)) {
+			s.stopHealthCheckLocked(healthKey{domain: domain, ip: ipStr})
+		}
+	}
+}
+
+// pruneRecordState removes the entries of state[domain] for which hasRecord(domain, ip) is false
+func pruneRecordState[V any](state map[string]map[string]V, domain string, hasRecord func(string, net.IP) bool) {
+	entries, ok := state[domain]
+	if !ok {
+		return
+	}
+	for ipStr := range entries {
+		if !hasRecord(domain, net.ParseIP(ipStr)) {
+			delete(entries, ipStr)
+		}
+	}
+	if len(entries) == 0 {
+		delete(state, domain)
+	}
 }
 
 // removeIP is a helper function to remove a specific IP from a slice
@@ -357,6 +1135,17 @@ func removeIP(ips []net.IP, toRemove net.IP) []net.IP {
 	return result
 }
 
+// removeAddr is removeIP for netip.Addrs
+func removeAddr(addrs []netip.Addr, toRemove netip.Addr) []netip.Addr {
+	result := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr != toRemove {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
 // matchWildcard checks if a domain matches a wildcard pattern
 // Pattern supports * (0+ chars) and ? (exactly 1 char)
 // Special case: *.domain.com does not match domain.com itself
@@ -424,20 +1213,27 @@ func matchWildcardInternal(pattern, domain string, pi, di int) bool {
 	return matchWildcardInternal(pattern, domain, pi+1, di+1)
 }
 
-// reverseDNSToIP converts a reverse DNS query name to an IP address
+// ReverseDNSToIP converts a reverse DNS query name to an IP address
 // Supports both IPv4 (in-addr.arpa) and IPv6 (ip6.arpa) formats
-func reverseDNSToIP(domain string) net.IP {
+// Returns an error wrapping ErrInvalidReverseDNS if the name cannot be converted
+func ReverseDNSToIP(domain string) (net.IP, error) {
+	input := domain
+
 	// Normalize to lowercase and ensure FQDN
 	domain = strings.ToLower(dns.Fqdn(domain))
 
+	var ip net.IP
+
+	family, _ := ReverseDNSFamily(domain)
+
 	// Check for IPv4 reverse DNS (in-addr.arpa)
-	if strings.HasSuffix(domain, ".in-addr.arpa.") {
+	if family == 4 {
 		// Remove the suffix
-		ipPart := strings.TrimSuffix(domain, ".in-addr.arpa.")
+		ipPart := strings.TrimSuffix(domain, reverseDNSSuffixV4)
 		// Split by dots and reverse
 		parts := strings.Split(ipPart, ".")
 		if len(parts) != 4 {
-			return nil
+			return nil, fmt.Errorf("%w: %q", ErrInvalidReverseDNS, input)
 		}
 		// Reverse the octets
 		reversed := make([]string, 4)
@@ -445,17 +1241,15 @@ func reverseDNSToIP(domain string) net.IP {
 			reversed[i] = parts[3-i]
 		}
 		// Parse as IP
-		return net.ParseIP(strings.Join(reversed, "."))
-	}
-
-	// Check for IPv6 reverse DNS (ip6.arpa)
-	if strings.HasSuffix(domain, ".ip6.arpa.") {
+		ip = net.ParseIP(strings.Join(reversed, "."))
+	} else if family == 6 {
+		// Check for IPv6 reverse DNS (ip6.arpa)
 		// Remove the suffix
-		ipPart := strings.TrimSuffix(domain, ".ip6.arpa.")
+		ipPart := strings.TrimSuffix(domain, reverseDNSSuffixV6)
 		// Split by dots and reverse
 		parts := strings.Split(ipPart, ".")
 		if len(parts) != 32 {
-			return nil
+			return nil, fmt.Errorf("%w: %q", ErrInvalidReverseDNS, input)
 		}
 		// Reverse the nibbles and group into 16-bit hex values
 		reversed := make([]string, 32)
@@ -468,10 +1262,35 @@ func reverseDNSToIP(domain string) net.IP {
 			ipv6Parts = append(ipv6Parts, reversed[i]+reversed[i+1]+reversed[i+2]+reversed[i+3])
 		}
 		// Parse as IP
-		return net.ParseIP(strings.Join(ipv6Parts, ":"))
+		ip = net.ParseIP(strings.Join(ipv6Parts, ":"))
 	}
 
-	return nil
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidReverseDNS, input)
+	}
+
+	return ip, nil
+}
+
+// IsReverseDNSDomain reports whether domain is in the in-addr.arpa or ip6.arpa zone
+func IsReverseDNSDomain(domain string) bool {
+	_, ok := ReverseDNSFamily(domain)
+	return ok
+}
+
+// ReverseDNSFamily returns 4 for names in the in-addr.arpa zone and 6 for
+// names in the ip6.arpa zone. The comparison is case-insensitive.
+func ReverseDNSFamily(domain string) (family int, ok bool) {
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	switch {
+	case strings.HasSuffix(domain, reverseDNSSuffixV4):
+		return 4, true
+	case strings.HasSuffix(domain, reverseDNSSuffixV6):
+		return 6, true
+	default:
+		return 0, false
+	}
 }
 
 // IPToReverseDNS converts an IP address to reverse DNS format
@@ -494,4 +1313,23 @@ func IPToReverseDNS(ip net.IP) string {
 	}
 
 	return ""
-}
\ No newline at end of file
+}
+
+// IPStringToReverseDNS converts an IP address given as a string to reverse DNS format
+// Returns ErrInvalidIP when ipStr does not parse
+func IPStringToReverseDNS(ipStr string) (string, error) {
+	ip, err := parseIP(ipStr)
+	if err != nil {
+		return "", err
+	}
+	return IPToReverseDNS(ip), nil
+}
+
+// parseIP parses an IPv4 or IPv6 address, returning ErrInvalidIP when it does not parse
+func parseIP(ipStr string) (net.IP, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidIP, ipStr)
+	}
+	return ip, nil
+}
@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+)
+
+// AddAddrRecord adds an A or AAAA record for addr, depending on its family. It is the
+// allocation free form of AddRecord: the store keeps addresses as netip.Addr, so a
+// net.IP is converted on the way in. IPv4-mapped IPv6 addresses are stored as IPv4
+// and the zero Addr is rejected.
+func (s *DNSRecordStore) AddAddrRecord(domain string, addr netip.Addr) error {
+	s.mu.Lock()
+	added, err := s.addAddrRecordLocked(domain, addr)
+	s.mu.Unlock()
+
+	if added {
+		s.publish(addedEvent(domain, addr.Unmap()))
+	}
+	return err
+}
+
+// ipToAddr converts ip to the form the store keys records by, with IPv4-mapped IPv6
+// addresses unmapped. It returns false when ip is not a valid address.
+func ipToAddr(ip net.IP) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// addrsToIPs converts addrs to net.IPs sharing one backing array
+func addrsToIPs(addrs []netip.Addr) []net.IP {
+	size := 0
+	for _, addr := range addrs {
+		size += addr.BitLen() / 8
+	}
+
+	buf := make([]byte, size)
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		n := addr.BitLen() / 8
+		ips[i], buf = net.IP(buf[:n:n]), buf[n:]
+		// The last 4 bytes of the 16 byte form are the IPv4 address
+		b := addr.As16()
+		copy(ips[i], b[16-n:])
+	}
+	return ips
+}
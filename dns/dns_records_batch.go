@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"net"
+	"sort"
+)
+
+// RecordPair is a single domain to IP mapping for the batch record functions
+type RecordPair struct {
+	Domain string
+	IP     net.IP
+}
+
+// sortedPairs returns the entries of a batch map ordered by domain
+func sortedPairs(entries map[string]net.IP) []RecordPair {
+	pairs := make([]RecordPair, 0, len(entries))
+	for domain, ip := range entries {
+		pairs = append(pairs, RecordPair{Domain: domain, IP: ip})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Domain < pairs[j].Domain
+	})
+	return pairs
+}
+
+// AddRecordBatch adds many A or AAAA records while holding the lock once
+// Map iteration order is random, so entries are applied in domain order and the
+// returned slice has one error per entry in that order, nil for entries that were added
+func (s *DNSRecordStore) AddRecordBatch(entries map[string]net.IP) []error {
+	return s.AddRecordBatchOrdered(sortedPairs(entries))
+}
+
+// AddRecordBatchOrdered adds many A or AAAA records in order while holding the lock once
+// The returned slice has one error per entry, nil for entries that were added or already present
+func (s *DNSRecordStore) AddRecordBatchOrdered(entries []RecordPair) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(entries))
+	for i, entry := range entries {
+		_, errs[i] = s.addRecordLocked(entry.Domain, entry.IP)
+	}
+
+	return errs
+}
+
+// RemoveRecordBatch removes many records while holding the lock once
+// A nil IP removes all records for the domain. Entries are applied in domain order
+// and the returned slice has one error per entry in that order
+func (s *DNSRecordStore) RemoveRecordBatch(entries map[string]net.IP) []error {
+	pairs := sortedPairs(entries)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(pairs))
+	for i, entry := range pairs {
+		if entry.IP != nil && entry.IP.To16() == nil {
+			errs[i] = &net.ParseError{Type: "IP address", Text: entry.IP.String()}
+			continue
+		}
+		s.removeRecordLocked(entry.Domain, entry.IP)
+	}
+
+	return errs
+}
@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestAddRecordBatch(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	errs := store.AddRecordBatch(map[string]net.IP{
+		"b.example.com.":  net.ParseIP("10.0.0.2"),
+		"a.example.com.":  net.ParseIP("10.0.0.1"),
+		"c.example.com.":  {1, 2, 3},
+		"*.wild.example.": net.ParseIP("2001:db8::1"),
+	})
+	if len(errs) != 4 {
+		t.Fatalf("Expected 4 errors, got %d", len(errs))
+	}
+
+	// Entries are reported in domain order: *.wild.example., a, b, c
+	for i, err := range errs[:3] {
+		if err != nil {
+			t.Errorf("Expected entry %d to succeed, got %v", i, err)
+		}
+	}
+	var parseErr *net.ParseError
+	if !errors.As(errs[3], &parseErr) {
+		t.Errorf("Expected ParseError for invalid IP, got %v", errs[3])
+	}
+
+	if !store.HasRecord("a.example.com.", RecordTypeA) || !store.HasRecord("x.wild.example.", RecordTypeAAAA) {
+		t.Error("Expected batch records to be added")
+	}
+	if !store.HasPTRRecordForIP(net.ParseIP("10.0.0.2")) {
+		t.Error("Expected PTR record for batch entry")
+	}
+	if store.HasPTRRecordForIP(net.ParseIP("2001:db8::1")) {
+		t.Error("Expected no PTR record for wildcard entry")
+	}
+}
+
+func TestAddRecordBatchOrdered(t *testing.T) {
+	store := NewDNSRecordStore(WithMaxExactEntries(1))
+
+	errs := store.AddRecordBatchOrdered([]RecordPair{
+		{Domain: "first.example.com.", IP: net.ParseIP("10.0.0.1")},
+		{Domain: "second.example.com.", IP: net.ParseIP("10.0.0.2")},
+		{Domain: "first.example.com.", IP: net.ParseIP("10.0.0.3")},
+	})
+
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("Expected first and third entries to succeed, got %v", errs)
+	}
+	if !errors.Is(errs[1], ErrStoreFull) {
+		t.Errorf("Expected ErrStoreFull for second entry, got %v", errs[1])
+	}
+	if ips := store.GetRecords("first.example.com.", RecordTypeA); len(ips) != 2 {
+		t.Errorf("Expected 2 IPs for first.example.com., got %v", ips)
+	}
+}
+
+func TestRemoveRecordBatch(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("a.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("b.example.com.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("b.example.com.", net.ParseIP("10.0.0.3"))
+
+	errs := store.RemoveRecordBatch(map[string]net.IP{
+		"a.example.com.": nil,
+		"b.example.com.": net.ParseIP("10.0.0.2"),
+		"c.example.com.": {1, 2, 3},
+	})
+
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Errorf("Expected only the invalid IP to fail, got %v", errs)
+	}
+	if store.HasRecord("a.example.com.", RecordTypeA) || store.HasPTRRecordForIP(net.ParseIP("10.0.0.1")) {
+		t.Error("Expected a.example.com. and its PTR record to be removed")
+	}
+	if ips := store.GetRecords("b.example.com.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.3")) {
+		t.Errorf("Expected only 10.0.0.3 to remain, got %v", ips)
+	}
+}
@@ -0,0 +1,265 @@
+package dns
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// benchmarkSizes are the store sizes every CRUD benchmark runs at
+var benchmarkSizes = []int{10_000, 100_000, 1_000_000}
+
+var (
+	benchmarkStoresMu sync.Mutex
+	benchmarkStores   = make(map[int]*DNSRecordStore)
+	benchmarkDomains  = make(map[int][]string)
+)
+
+// randomFQDNs returns n distinct random domain names, the same ones on every call
+func randomFQDNs(n int) []string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+
+	r := rand.New(rand.NewSource(int64(n)))
+	domains := make([]string, n)
+	label := make([]byte, 8)
+	for i := range domains {
+		for j := range label {
+			label[j] = letters[r.Intn(len(letters))]
+		}
+		// The index keeps names distinct
+		domains[i] = fmt.Sprintf("%s%d.%s.bench.internal.", label[:4], i, label[4:])
+	}
+	return domains
+}
+
+// benchmarkIP returns a distinct IPv4 address for i
+func benchmarkIP(i int) net.IP {
+	return net.IPv4(10, byte(i>>16), byte(i>>8), byte(i))
+}
+
+// populateStore adds a record for every domain to store
+func populateStore(b *testing.B, store *DNSRecordStore, domains []string) {
+	b.Helper()
+	for i, domain := range domains {
+		if _, err := store.AddRecord(domain, benchmarkIP(i)); err != nil {
+			b.Fatalf("Failed to add record: %v", err)
+		}
+	}
+}
+
+// sharedBenchmarkStore returns a store with size records and their domains
+// Building a store with a million records is slow, so read-only benchmarks share one per size
+func sharedBenchmarkStore(b *testing.B, size int) (*DNSRecordStore, []string) {
+	b.Helper()
+
+	benchmarkStoresMu.Lock()
+	defer benchmarkStoresMu.Unlock()
+
+	if store, ok := benchmarkStores[size]; ok {
+		return store, benchmarkDomains[size]
+	}
+
+	domains := randomFQDNs(size)
+	store := NewDNSRecordStore()
+	populateStore(b, store, domains)
+	benchmarkStores[size] = store
+	benchmarkDomains[size] = domains
+	return store, domains
+}
+
+func BenchmarkAddRecord(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			domains := randomFQDNs(size + b.N)
+			store := NewDNSRecordStore()
+			populateStore(b, store, domains[:size])
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.AddRecord(domains[size+i], benchmarkIP(size+i))
+			}
+		})
+	}
+}
+
+func BenchmarkAddAddrRecord(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			domains := randomFQDNs(size + b.N)
+			store := NewDNSRecordStore()
+			populateStore(b, store, domains[:size])
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := size + i
+				store.AddAddrRecord(domains[n], netip.AddrFrom4([4]byte{10, byte(n >> 16), byte(n >> 8), byte(n)}))
+			}
+		})
+	}
+}
+
+func BenchmarkGetRecordsExact(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			store, domains := sharedBenchmarkStore(b, size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if ips := store.GetRecords(domains[i%size], RecordTypeA); len(ips) != 1 {
+					b.Fatalf("Expected 1 record, got %d", len(ips))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetRecordsWildcard measures a lookup answered by a wildcard pattern as the
+// number of patterns grows, each store also holding 10,000 exact records
+func BenchmarkGetRecordsWildcard(b *testing.B) {
+	for _, patterns := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("patterns=%d", patterns), func(b *testing.B) {
+			b.ReportAllocs()
+
+			store := NewDNSRecordStore()
+			populateStore(b, store, randomFQDNs(10_000))
+			for i := 0; i < patterns; i++ {
+				store.AddRecord(fmt.Sprintf("*.svc%d.bench.internal.", i), benchmarkIP(i))
+			}
+			domain := fmt.Sprintf("host.svc%d.bench.internal.", patterns-1)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if ips := store.GetRecords(domain, RecordTypeA); len(ips) != 1 {
+					b.Fatalf("Expected 1 record, got %d", len(ips))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRemoveRecord(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			// Add one extra record per iteration so the store never drops below size
+			domains := randomFQDNs(size + b.N)
+			store := NewDNSRecordStore()
+			populateStore(b, store, domains)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.RemoveRecord(domains[i], nil)
+			}
+		})
+	}
+}
+
+func BenchmarkConcurrentGetRecords(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			store, domains := sharedBenchmarkStore(b, size)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					store.GetRecords(domains[r.Intn(size)], RecordTypeA)
+				}
+			})
+		})
+	}
+}
+
+// wildcardBenchmarkLengths are the domain lengths the wildcard matching benchmarks run at
+var wildcardBenchmarkLengths = []int{10, 50, 100}
+
+// wildcardBenchmarkCase is a pattern and a domain of the given length it matches
+type wildcardBenchmarkCase struct {
+	name    string
+	pattern string
+	domain  string
+}
+
+// wildcardBenchmarkCases returns one matching case per pattern category for each length.
+// matchWildcard and path.Match agree on all of them, so both benchmarks get the same work.
+func wildcardBenchmarkCases(b *testing.B) []wildcardBenchmarkCase {
+	b.Helper()
+
+	var cases []wildcardBenchmarkCase
+	for _, n := range wildcardBenchmarkLengths {
+		// Labels of 7 letters, e.g. "abcdefg.abcdefg.ab."
+		domain := make([]byte, n)
+		for i := range domain {
+			domain[i] = byte('a' + i%8)
+			if i%8 == 7 || i == n-1 {
+				domain[i] = '.'
+			}
+		}
+
+		// Every fourth letter becomes ?
+		question := append([]byte(nil), domain...)
+		for i := 3; i < n; i += 4 {
+			if question[i] != '.' {
+				question[i] = '?'
+			}
+		}
+
+		firstDot := strings.IndexByte(string(domain), '.')
+		for _, c := range []wildcardBenchmarkCase{
+			{name: "exact", pattern: string(domain)},
+			{name: "leading-star", pattern: "*" + string(domain[firstDot:])},
+			{name: "question-mark", pattern: string(question)},
+			{name: "combined", pattern: "*" + string(question[firstDot:n-2]) + "*"},
+		} {
+			c.name = fmt.Sprintf("%s/len=%d", c.name, n)
+			c.domain = string(domain)
+			if matched, err := path.Match(c.pattern, c.domain); err != nil || !matched || !matchWildcard(c.pattern, c.domain) {
+				b.Fatalf("Expected %s to match %s with both matchers", c.pattern, c.domain)
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases
+}
+
+// BenchmarkMatchWildcard measures matchWildcard on the cases BenchmarkPathMatch uses
+func BenchmarkMatchWildcard(b *testing.B) {
+	for _, c := range wildcardBenchmarkCases(b) {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !matchWildcard(c.pattern, c.domain) {
+					b.Fatal("Expected a match")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPathMatch measures path.Match as a reference for BenchmarkMatchWildcard
+func BenchmarkPathMatch(b *testing.B) {
+	for _, c := range wildcardBenchmarkCases(b) {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if matched, _ := path.Match(c.pattern, c.domain); !matched {
+					b.Fatal("Expected a match")
+				}
+			}
+		})
+	}
+}
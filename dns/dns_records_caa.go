@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// CAARecord is a certificate authority authorization record, matching the dns.CAA fields
+type CAARecord struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// AddCAARecord adds a CAA record for a domain
+// domain can contain wildcards: * (0+ chars) and ? (exactly 1 char)
+func (s *DNSRecordStore) AddCAARecord(domain string, rec CAARecord) error {
+	if rec.Tag == "" {
+		return fmt.Errorf("CAA record for %s has an empty tag", domain)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	for _, existing := range s.caaRecords[domain] {
+		if existing == rec {
+			return nil
+		}
+	}
+	s.caaRecords[domain] = append(s.caaRecords[domain], rec)
+
+	return nil
+}
+
+// GetCAARecords returns the CAA records for a domain
+// First checks for an exact match, then checks wildcard patterns
+func (s *DNSRecordStore) GetCAARecords(domain string) []CAARecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	// Check exact match first
+	if records, ok := s.caaRecords[domain]; ok {
+		// Return a copy to prevent external modifications
+		return append([]CAARecord(nil), records...)
+	}
+
+	// Check wildcard patterns
+	var records []CAARecord
+	for pattern, patternRecords := range s.caaRecords {
+		if strings.ContainsAny(pattern, "*?") && matchWildcard(pattern, domain) {
+			records = append(records, patternRecords...)
+		}
+	}
+
+	return records
+}
+
+// RemoveCAARecord removes a CAA record from a domain
+// If rec is nil, removes all CAA records for the domain
+func (s *DNSRecordStore) RemoveCAARecord(domain string, rec *CAARecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	if rec == nil {
+		delete(s.caaRecords, domain)
+		return
+	}
+
+	records, ok := s.caaRecords[domain]
+	if !ok {
+		return
+	}
+
+	remaining := make([]CAARecord, 0, len(records))
+	for _, existing := range records {
+		if existing != *rec {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(s.caaRecords, domain)
+	} else {
+		s.caaRecords[domain] = remaining
+	}
+}
+
+// HasCAARecord checks if a domain has any CAA records, including via wildcard patterns
+func (s *DNSRecordStore) HasCAARecord(domain string) bool {
+	return len(s.GetCAARecords(domain)) > 0
+}
@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCAARecords(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	issue := CAARecord{Flags: 0, Tag: "issue", Value: "pki.corp."}
+	iodef := CAARecord{Flags: 0, Tag: "iodef", Value: "mailto:pki@corp.internal"}
+
+	if err := store.AddCAARecord("corp.internal", issue); err != nil {
+		t.Fatalf("Failed to add CAA record: %v", err)
+	}
+	if err := store.AddCAARecord("corp.internal.", iodef); err != nil {
+		t.Fatalf("Failed to add CAA record: %v", err)
+	}
+	// Duplicates are ignored
+	if err := store.AddCAARecord("CORP.internal.", issue); err != nil {
+		t.Fatalf("Failed to add CAA record: %v", err)
+	}
+	if err := store.AddCAARecord("corp.internal.", CAARecord{Value: "x"}); err == nil {
+		t.Error("Expected error for CAA record without tag")
+	}
+
+	records := store.GetCAARecords("corp.internal.")
+	if len(records) != 2 || records[0] != issue || records[1] != iodef {
+		t.Errorf("Expected [issue iodef] CAA records, got %v", records)
+	}
+	if !store.HasCAARecord("corp.internal.") {
+		t.Error("Expected HasCAARecord to return true")
+	}
+
+	store.RemoveCAARecord("corp.internal.", &iodef)
+	if records := store.GetCAARecords("corp.internal."); len(records) != 1 || records[0] != issue {
+		t.Errorf("Expected only issue CAA record after removal, got %v", records)
+	}
+
+	store.RemoveCAARecord("corp.internal.", nil)
+	if store.HasCAARecord("corp.internal.") {
+		t.Error("Expected HasCAARecord to return false after removing all")
+	}
+}
+
+func TestCAARecordWildcard(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	issue := CAARecord{Flags: 0, Tag: "issue", Value: "pki.corp."}
+	if err := store.AddCAARecord("*.corp.internal.", issue); err != nil {
+		t.Fatalf("Failed to add CAA record: %v", err)
+	}
+
+	for _, domain := range []string{"host.corp.internal.", "a.b.corp.internal."} {
+		if records := store.GetCAARecords(domain); len(records) != 1 || records[0] != issue {
+			t.Errorf("Expected wildcard CAA record for %s, got %v", domain, records)
+		}
+	}
+	if store.HasCAARecord("corp.example.") {
+		t.Error("Expected no CAA record for unrelated domain")
+	}
+}
+
+func TestCheckLocalRecordsCAA(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	proxy.recordStore.AddCAARecord("*.corp.internal.", CAARecord{Flags: 0, Tag: "issue", Value: "pki.corp."})
+
+	query := new(dns.Msg)
+	query.SetQuestion("host.corp.internal.", dns.TypeCAA)
+
+	response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil {
+		t.Fatal("Expected local CAA response")
+	}
+	if len(response.Answer) != 1 {
+		t.Fatalf("Expected 1 answer, got %d", len(response.Answer))
+	}
+	caa, ok := response.Answer[0].(*dns.CAA)
+	if !ok || caa.Tag != "issue" || caa.Value != "pki.corp." || caa.Hdr.Name != "host.corp.internal." {
+		t.Errorf("Unexpected CAA answer: %v", response.Answer[0])
+	}
+
+	query.SetQuestion("example.com.", dns.TypeCAA)
+	if response := proxy.checkLocalRecords(context.Background(), query, query.Question[0]); response != nil {
+		t.Errorf("Expected no local CAA response for unknown domain, got %v", response)
+	}
+}
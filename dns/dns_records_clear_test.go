@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// populateClearTestStore adds exact records, PTR records and wildcard patterns to store
+func populateClearTestStore(t *testing.T, store RecordStore) {
+	t.Helper()
+	for domain, ip := range map[string]string{
+		"peer1.internal.":   "10.0.0.1",
+		"peer2.internal.":   "fd00::2",
+		"*.zone.internal.":  "10.0.1.1",
+		"*.zone6.internal.": "fd00::100",
+	} {
+		if _, err := store.AddRecord(domain, net.ParseIP(ip)); err != nil {
+			t.Fatalf("Failed to add %s: %v", domain, err)
+		}
+	}
+}
+
+func TestClearExactRecords(t *testing.T) {
+	var mu sync.Mutex
+	var expired []string
+	store, _ := newExpiryTestStore(WithOnExpiry(func(domain string, ip net.IP, recordType RecordType) {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, domain+" "+ip.String()+" "+recordType.String())
+	}))
+	populateClearTestStore(t, store)
+	store.AddRecordWithTTL("lease.internal.", net.ParseIP("10.0.0.3"), time.Hour)
+	store.AddPTRRecord(net.ParseIP("10.0.0.4"), "manual.internal.")
+
+	store.ClearExactRecords()
+
+	for _, domain := range []string{"peer1.internal.", "lease.internal."} {
+		if ips := store.GetRecords(domain, RecordTypeA); len(ips) != 0 {
+			t.Errorf("Expected no A records for %s, got %v", domain, ips)
+		}
+	}
+	if ips := store.GetRecords("peer2.internal.", RecordTypeAAAA); len(ips) != 0 {
+		t.Errorf("Expected no AAAA records for peer2.internal., got %v", ips)
+	}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.4"} {
+		if store.HasPTRRecordForIP(net.ParseIP(ip)) {
+			t.Errorf("Expected the PTR record for %s to be removed", ip)
+		}
+	}
+	if _, ok := store.GetRecordExpiry("lease.internal.", net.ParseIP("10.0.0.3")); ok {
+		t.Error("Expected the expiry of lease.internal. to be removed")
+	}
+
+	// Wildcard patterns are untouched
+	if ips := store.GetRecords("host.zone.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.1.1")) {
+		t.Errorf("Expected the A wildcard to still match, got %v", ips)
+	}
+	if ips := store.GetRecords("host.zone6.internal.", RecordTypeAAAA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("fd00::100")) {
+		t.Errorf("Expected the AAAA wildcard to still match, got %v", ips)
+	}
+
+	// Only the record with an expiry is reported
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"lease.internal. 10.0.0.3 A"}; !slices.Equal(expired, want) {
+		t.Errorf("OnExpiry calls = %v, expected %v", expired, want)
+	}
+}
+
+func TestClearWildcards(t *testing.T) {
+	store := NewDNSRecordStore()
+	populateClearTestStore(t, store)
+	if err := store.CompileAllWildcards(); err != nil {
+		t.Fatalf("CompileAllWildcards failed: %v", err)
+	}
+
+	store.ClearWildcards()
+
+	if store.HasRecord("host.zone.internal.", RecordTypeA) {
+		t.Error("Expected the A wildcard to be removed")
+	}
+	if store.HasRecord("host.zone6.internal.", RecordTypeAAAA) {
+		t.Error("Expected the AAAA wildcard to be removed")
+	}
+	if patterns := store.GetWildcardPatternsByType(RecordTypeA); len(patterns) != 0 {
+		t.Errorf("Expected no A wildcard patterns, got %v", patterns)
+	}
+
+	// Exact records and their PTR records are untouched
+	if ips := store.GetRecords("peer1.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected peer1.internal. to keep its A record, got %v", ips)
+	}
+	if ips := store.GetRecords("peer2.internal.", RecordTypeAAAA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("fd00::2")) {
+		t.Errorf("Expected peer2.internal. to keep its AAAA record, got %v", ips)
+	}
+	if !store.HasPTRRecordForIP(net.ParseIP("10.0.0.1")) {
+		t.Error("Expected the PTR record for 10.0.0.1 to remain")
+	}
+
+	// New patterns can be added afterwards
+	store.AddRecord("*.zone.internal.", net.ParseIP("10.0.1.2"))
+	if ips := store.GetRecords("host.zone.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.1.2")) {
+		t.Errorf("Expected the new wildcard to match, got %v", ips)
+	}
+}
+
+func TestShardedClearExactRecordsAndWildcards(t *testing.T) {
+	store := NewShardedDNSRecordStore(4)
+	populateClearTestStore(t, store)
+
+	store.ClearExactRecords()
+	if store.HasRecord("peer1.internal.", RecordTypeA) {
+		t.Error("Expected peer1.internal. to be removed")
+	}
+	if !store.HasRecord("host.zone.internal.", RecordTypeA) {
+		t.Error("Expected the A wildcard to remain")
+	}
+
+	populateClearTestStore(t, store)
+	store.ClearWildcards()
+	if !store.HasRecord("peer1.internal.", RecordTypeA) {
+		t.Error("Expected peer1.internal. to remain")
+	}
+	if store.HasRecord("host.zone.internal.", RecordTypeA) {
+		t.Error("Expected the A wildcard to be removed")
+	}
+}
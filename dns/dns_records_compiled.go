@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompiledPattern is a wildcard pattern split at each * into literal chunks, so
+// matching scans the domain once per chunk instead of backtracking character by
+// character. Matching follows matchWildcard, including the rule that a leading *.
+// matches at least one character.
+type CompiledPattern struct {
+	pattern  string
+	chunks   []string // text between *s, which may contain ?
+	minStart int      // first index of the domain the second chunk may start at
+}
+
+// CompileWildcard compiles a lowercase wildcard pattern
+func CompileWildcard(pattern string) (*CompiledPattern, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty wildcard pattern")
+	}
+	if !strings.ContainsAny(pattern, "*?") {
+		return nil, fmt.Errorf("%s is not a wildcard pattern", pattern)
+	}
+
+	c := &CompiledPattern{pattern: pattern, chunks: strings.Split(pattern, "*")}
+	if strings.HasPrefix(pattern, "*.") {
+		c.minStart = 1
+	}
+	return c, nil
+}
+
+// String returns the pattern c was compiled from
+func (c *CompiledPattern) String() string {
+	return c.pattern
+}
+
+// Match reports whether the lowercase domain matches the pattern
+func (c *CompiledPattern) Match(domain string) bool {
+	first, last := c.chunks[0], c.chunks[len(c.chunks)-1]
+	if len(c.chunks) == 1 {
+		return len(domain) == len(first) && chunkAt(first, domain, 0)
+	}
+	if len(domain) < len(first)+len(last) || !chunkAt(first, domain, 0) {
+		return false
+	}
+
+	// The leftmost position of each middle chunk leaves the most room for the rest
+	pos := max(len(first), c.minStart)
+	end := len(domain) - len(last)
+	for _, chunk := range c.chunks[1 : len(c.chunks)-1] {
+		i := indexChunk(chunk, domain[:end], pos)
+		if i < 0 {
+			return false
+		}
+		pos = i + len(chunk)
+	}
+	return pos <= end && chunkAt(last, domain, end)
+}
+
+// chunkAt reports whether chunk matches domain at index i, with ? matching any character
+func chunkAt(chunk, domain string, i int) bool {
+	if i+len(chunk) > len(domain) {
+		return false
+	}
+	for j := 0; j < len(chunk); j++ {
+		if chunk[j] != '?' && chunk[j] != domain[i+j] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexChunk returns the first index from start where chunk matches domain, or -1
+func indexChunk(chunk, domain string, start int) int {
+	if !strings.Contains(chunk, "?") {
+		if start > len(domain) {
+			return -1
+		}
+		if i := strings.Index(domain[start:], chunk); i >= 0 {
+			return start + i
+		}
+		return -1
+	}
+	for i := start; i+len(chunk) <= len(domain); i++ {
+		if chunkAt(chunk, domain, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// CompileAllWildcards compiles every A and AAAA wildcard pattern so GetRecords no
+// longer matches them character by character. Patterns added afterwards are matched
+// uncompiled until CompileAllWildcards is called again; it does nothing when no
+// patterns were added since the last call.
+func (s *DNSRecordStore) CompileAllWildcards() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.aWildcardsCompiled != nil && !s.wildcardsDirty {
+		return nil
+	}
+
+	aCompiled, err := compileTrie(s.aWildcards)
+	if err != nil {
+		return err
+	}
+	aaaaCompiled, err := compileTrie(s.aaaaWildcards)
+	if err != nil {
+		return err
+	}
+
+	s.aWildcardsCompiled = aCompiled
+	s.aaaaWildcardsCompiled = aaaaCompiled
+	s.wildcardsDirty = false
+	return nil
+}
+
+// CompileAllWildcards compiles the wildcard patterns, see DNSRecordStore.CompileAllWildcards
+func (s *ShardedDNSRecordStore) CompileAllWildcards() error {
+	return s.wildcards.CompileAllWildcards()
+}
+
+// compileTrie compiles the residual patterns of the trie, keyed by residual. The trie
+// matches residuals against the unmatched left part of a name, so one compiled form
+// serves every pattern sharing the residual.
+func compileTrie(t *dnsTrie) (map[string]*CompiledPattern, error) {
+	compiled := make(map[string]*CompiledPattern)
+	var visit func(node *dnsTrieNode) error
+	visit = func(node *dnsTrieNode) error {
+		for residual := range node.wildcards {
+			if _, ok := compiled[residual]; ok {
+				continue
+			}
+			c, err := CompileWildcard(residual)
+			if err != nil {
+				return fmt.Errorf("compile %s: %w", residual, err)
+			}
+			compiled[residual] = c
+		}
+		for _, child := range node.children {
+			if err := visit(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(t.root); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// matchResidual matches name against residual, using its compiled form when there is one
+func matchResidual(compiled map[string]*CompiledPattern, residual, name string) bool {
+	if c, ok := compiled[residual]; ok {
+		return c.Match(name)
+	}
+	return matchWildcard(residual, name)
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCompiledPatternMatch(t *testing.T) {
+	for _, tt := range wildcardMatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := CompileWildcard(tt.pattern)
+			if err != nil {
+				// Exact names are not wildcard patterns
+				if strings.ContainsAny(tt.pattern, "*?") {
+					t.Fatalf("CompileWildcard(%q) failed: %v", tt.pattern, err)
+				}
+				return
+			}
+			if got := c.Match(tt.domain); got != tt.expected {
+				t.Errorf("Match(%q) with pattern %q = %v, expected %v", tt.domain, tt.pattern, got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := CompileWildcard("app.internal."); err == nil {
+		t.Error("Expected a pattern without wildcards to be rejected")
+	}
+}
+
+func FuzzCompiledPatternMatch(f *testing.F) {
+	for _, tt := range wildcardMatchTests {
+		f.Add(tt.pattern, tt.domain)
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, domain string) {
+		// matchWildcard backtracks once per *, keep inputs small enough to finish quickly
+		if len(pattern) > 64 || len(domain) > 128 || strings.Count(pattern, "*") > 4 {
+			t.Skip()
+		}
+		c, err := CompileWildcard(pattern)
+		if err != nil {
+			return
+		}
+		if got, want := c.Match(domain), matchWildcard(pattern, domain); got != want {
+			t.Errorf("Match(%q) with pattern %q = %v, matchWildcard = %v", domain, pattern, got, want)
+		}
+	})
+}
+
+func TestCompileAllWildcards(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("*.prod.internal.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("db-?.internal.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("*.prod.internal.", net.ParseIP("fd00::1"))
+
+	if err := store.CompileAllWildcards(); err != nil {
+		t.Fatalf("CompileAllWildcards failed: %v", err)
+	}
+	if store.wildcardsDirty {
+		t.Error("Expected the compiled cache to be clean after compiling")
+	}
+	if len(store.aWildcardsCompiled) != 2 || len(store.aaaaWildcardsCompiled) != 1 {
+		t.Errorf("Expected 2 A and 1 AAAA compiled patterns, got %d and %d", len(store.aWildcardsCompiled), len(store.aaaaWildcardsCompiled))
+	}
+
+	if ips := store.GetRecords("api.prod.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected the compiled pattern to match, got %v", ips)
+	}
+	if ips := store.GetRecords("db-1.internal.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected the compiled ? pattern to match, got %v", ips)
+	}
+	if ips := store.GetRecords("prod.internal.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected *. to need a label, got %v", ips)
+	}
+
+	// Patterns added after compiling are matched uncompiled until the next call
+	store.AddRecord("*.dev.internal.", net.ParseIP("10.0.0.3"))
+	store.AddRecord("web*.internal.", net.ParseIP("10.0.0.4"))
+	if !store.wildcardsDirty {
+		t.Error("Expected adding a wildcard to mark the compiled cache dirty")
+	}
+	if ips := store.GetRecords("web1.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.4")) {
+		t.Errorf("Expected the uncompiled pattern to match, got %v", ips)
+	}
+	if err := store.CompileAllWildcards(); err != nil {
+		t.Fatalf("CompileAllWildcards failed: %v", err)
+	}
+	if _, ok := store.aWildcardsCompiled["web*"]; !ok {
+		t.Error("Expected recompiling to pick up the new pattern")
+	}
+
+	store.Clear()
+	if store.aWildcardsCompiled != nil || store.wildcardsDirty {
+		t.Error("Expected Clear to drop the compiled patterns")
+	}
+}
@@ -0,0 +1,156 @@
+package dns
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// randomStoreInput returns a domain and IP from small pools so goroutines collide on the same keys
+func randomStoreInput(r *rand.Rand) (string, net.IP) {
+	domain := fmt.Sprintf("host%d.svc%d.example.com.", r.Intn(64), r.Intn(4))
+	switch r.Intn(8) {
+	case 0:
+		domain = fmt.Sprintf("*.svc%d.example.com.", r.Intn(4))
+	case 1:
+		domain = strings.ToUpper(domain)
+	}
+
+	if r.Intn(2) == 0 {
+		return domain, net.IPv4(10, 0, byte(r.Intn(4)), byte(r.Intn(256)))
+	}
+	ip := net.ParseIP("2001:db8::")
+	ip[14], ip[15] = byte(r.Intn(4)), byte(r.Intn(256))
+	return domain, ip
+}
+
+// runConcurrently calls op from goroutines workers until d has passed
+func runConcurrently(t *testing.T, goroutines int, d time.Duration, op func(r *rand.Rand)) {
+	t.Helper()
+
+	deadline := time.Now().Add(d)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) {
+				op(r)
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
+
+// TestDNSRecordStoreConcurrency runs the public store methods against one store from
+// many goroutines and is meant to be run with -race. The store has no public snapshot
+// API; snapshots and restores are exercised through transactions, which snapshot the
+// store on commit when limits are set.
+func TestDNSRecordStoreConcurrency(t *testing.T) {
+	duration := 5 * time.Second
+	if testing.Short() {
+		duration = 500 * time.Millisecond
+	}
+
+	store := NewDNSRecordStore(WithMaxCapacity(96), WithMaxExactEntries(128))
+
+	runConcurrently(t, 16, duration, func(r *rand.Rand) {
+		domain, ip := randomStoreInput(r)
+		recordType := RecordTypeA
+		if ip.To4() == nil {
+			recordType = RecordTypeAAAA
+		}
+
+		switch r.Intn(12) {
+		case 0, 1:
+			store.AddRecord(domain, ip)
+		case 2:
+			store.RemoveRecord(domain, ip)
+		case 3:
+			store.RemoveRecord(domain, nil)
+		case 4, 5:
+			store.GetRecords(domain, recordType)
+		case 6:
+			store.HasRecord(domain, recordType)
+		case 7:
+			store.AddPTRRecord(ip, domain)
+		case 8:
+			store.GetPTRRecord(domain)
+			store.GetPTRRecordByIP(ip)
+		case 9:
+			store.HasPTRRecord(IPToReverseDNS(ip))
+			store.GetAllPTRRecords(IPToReverseDNS(ip))
+		case 10:
+			tx := store.BeginTx()
+			tx.AddRecord(domain, ip)
+			other, otherIP := randomStoreInput(r)
+			tx.RemoveRecord(other, otherIP)
+			if r.Intn(4) == 0 {
+				tx.Rollback()
+			} else {
+				tx.Commit()
+			}
+		case 11:
+			if r.Intn(50) == 0 {
+				store.Clear()
+			} else {
+				store.GetAllDomains()
+			}
+		}
+	})
+
+	// Every remaining record must still have its PTR, whatever order the goroutines ran in.
+	// Wildcards have no PTR records and would answer for the other record type, drop them first.
+	for i := 0; i < 4; i++ {
+		store.RemoveRecord(fmt.Sprintf("*.svc%d.example.com.", i), nil)
+	}
+	for _, domain := range store.GetAllDomains() {
+		for _, ip := range append(store.GetRecords(domain, RecordTypeA), store.GetRecords(domain, RecordTypeAAAA)...) {
+			if !store.HasPTRRecordForIP(ip) {
+				t.Errorf("Missing PTR record for %s -> %s", domain, ip)
+			}
+		}
+	}
+}
+
+func TestClearUnderLoad(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	done := make(chan struct{})
+	var clears sync.WaitGroup
+	clears.Add(1)
+	go func() {
+		defer clears.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				store.Clear()
+			}
+		}
+	}()
+
+	runConcurrently(t, 8, 500*time.Millisecond, func(r *rand.Rand) {
+		domain, ip := randomStoreInput(r)
+		if r.Intn(2) == 0 {
+			store.AddRecord(domain, ip)
+			return
+		}
+		store.GetRecords(domain, RecordTypeA)
+		store.GetRecords(domain, RecordTypeAAAA)
+		store.GetPTRRecordByIP(ip)
+	})
+	close(done)
+	clears.Wait()
+
+	store.Clear()
+	if domains := store.GetAllDomains(); len(domains) != 0 {
+		t.Errorf("Expected empty store after Clear, got %v", domains)
+	}
+}
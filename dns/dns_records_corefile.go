@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// hostsOptions are the hosts plugin settings that can appear among inline entries
+var hostsOptions = map[string]bool{
+	"ttl":         true,
+	"no_reverse":  true,
+	"reload":      true,
+	"fallthrough": true,
+}
+
+// corefileServer is a server block of a Corefile, such as "example.org:53 { ... }"
+type corefileServer struct {
+	keys       []string
+	directives []corefileDirective
+}
+
+// corefileDirective is a plugin line of a server block with its optional sub-block
+type corefileDirective struct {
+	name  string
+	args  []string
+	line  int
+	block []corefileLine
+}
+
+// corefileLine is one line of tokens inside a directive block
+type corefileLine struct {
+	tokens []string
+	line   int
+}
+
+// ImportCorefileHostsBlock adds the inline entries of every hosts plugin block in a
+// CoreDNS Corefile, given as text. Each entry is an IP address followed by one or more
+// names, like a line of /etc/hosts. Hosts files the blocks refer to are not read, since
+// their paths belong to the CoreDNS host, and plugin options such as ttl are ignored.
+// It returns how many records were imported. Invalid entries are reported in the
+// returned error, joined with errors.Join, and do not stop the import.
+func (s *DNSRecordStore) ImportCorefileHostsBlock(corefile string) (int, error) {
+	servers, err := parseCorefile(corefile)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	count := 0
+	for _, server := range servers {
+		for _, directive := range server.directives {
+			if directive.name != "hosts" {
+				continue
+			}
+			for _, entry := range directive.block {
+				if hostsOptions[entry.tokens[0]] {
+					continue
+				}
+				n, err := s.importHostsEntry(entry)
+				count += n
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// importHostsEntry adds the records of a hosts line, returning how many were imported
+func (s *DNSRecordStore) importHostsEntry(entry corefileLine) (int, error) {
+	if len(entry.tokens) < 2 {
+		return 0, fmt.Errorf("line %d: hosts entry needs an IP address and a name", entry.line)
+	}
+	ip := net.ParseIP(entry.tokens[0])
+	if ip == nil {
+		return 0, fmt.Errorf("line %d: invalid IP address %q", entry.line, entry.tokens[0])
+	}
+
+	var errs []error
+	count := 0
+	for _, name := range entry.tokens[1:] {
+		if _, err := s.AddRecord(name, ip); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", entry.line, err))
+			continue
+		}
+		count++
+	}
+	return count, errors.Join(errs...)
+}
+
+// ImportCorefileFileBlock imports zonefile, the text of the zone file named by the first
+// file plugin block of a CoreDNS Corefile, with ImportZoneFile. The file is passed in
+// rather than read from the path in the Corefile, which belongs to the CoreDNS host.
+// Relative names are completed by each zone the block lists, or by the zones of its
+// server block when it lists none. It returns how many records were imported.
+func (s *DNSRecordStore) ImportCorefileFileBlock(corefile, zonefile string) (int, error) {
+	servers, err := parseCorefile(corefile)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, server := range servers {
+		for _, directive := range server.directives {
+			if directive.name != "file" {
+				continue
+			}
+			if len(directive.args) == 0 {
+				return 0, fmt.Errorf("line %d: file block has no zone file", directive.line)
+			}
+
+			filename, zones := directive.args[0], directive.args[1:]
+			if len(zones) == 0 {
+				zones = server.keys
+			}
+
+			var errs []error
+			count := 0
+			for _, zone := range zones {
+				n, err := s.importZone(zonefile, corefileZone(zone), filename)
+				count += n
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+			return count, errors.Join(errs...)
+		}
+	}
+	return 0, fmt.Errorf("no file block in Corefile")
+}
+
+// corefileZone returns the zone of a server block key such as "dns://example.org:53"
+func corefileZone(key string) string {
+	if _, rest, ok := strings.Cut(key, "://"); ok {
+		key = rest
+	}
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		key = host
+	}
+	return strings.ToLower(dns.Fqdn(key))
+}
+
+// corefileToken is a word of a Corefile and the line it is on
+type corefileToken struct {
+	text string
+	line int
+}
+
+// parseCorefile splits a Corefile into its server blocks. Only the structure used by
+// the importers is understood: server blocks in braces holding plugin lines, each with
+// at most one level of sub-block. Comments start with #.
+func parseCorefile(corefile string) ([]corefileServer, error) {
+	var tokens []corefileToken
+	braces := strings.NewReplacer("{", " { ", "}", " } ")
+	for i, line := range strings.Split(corefile, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, field := range strings.Fields(braces.Replace(line)) {
+			tokens = append(tokens, corefileToken{text: field, line: i + 1})
+		}
+	}
+
+	var servers []corefileServer
+	for i := 0; i < len(tokens); {
+		var server corefileServer
+		for ; i < len(tokens) && tokens[i].text != "{"; i++ {
+			if tokens[i].text == "}" {
+				return nil, fmt.Errorf("line %d: unexpected }", tokens[i].line)
+			}
+			for _, key := range strings.Split(tokens[i].text, ",") {
+				if key != "" {
+					server.keys = append(server.keys, key)
+				}
+			}
+		}
+		if i == len(tokens) {
+			return nil, fmt.Errorf("server block %s has no body", strings.Join(server.keys, " "))
+		}
+		if len(server.keys) == 0 {
+			return nil, fmt.Errorf("line %d: server block has no zone", tokens[i].line)
+		}
+
+		for i++; ; {
+			if i == len(tokens) {
+				return nil, fmt.Errorf("server block %s is not closed", strings.Join(server.keys, " "))
+			}
+			if tokens[i].text == "}" {
+				i++
+				break
+			}
+			if tokens[i].text == "{" {
+				return nil, fmt.Errorf("line %d: unexpected {", tokens[i].line)
+			}
+			directive, next, err := parseCorefileDirective(tokens, i)
+			if err != nil {
+				return nil, err
+			}
+			server.directives = append(server.directives, directive)
+			i = next
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// parseCorefileDirective parses the plugin line starting at tokens[i] and its
+// sub-block, returning the index of the token after it
+func parseCorefileDirective(tokens []corefileToken, i int) (corefileDirective, int, error) {
+	directive := corefileDirective{name: tokens[i].text, line: tokens[i].line}
+	lineTokens := func(line int) []string {
+		var words []string
+		for ; i < len(tokens) && tokens[i].line == line && tokens[i].text != "{" && tokens[i].text != "}"; i++ {
+			words = append(words, tokens[i].text)
+		}
+		return words
+	}
+
+	i++
+	directive.args = lineTokens(directive.line)
+	if i == len(tokens) || tokens[i].text != "{" {
+		return directive, i, nil
+	}
+
+	for i++; ; {
+		if i == len(tokens) {
+			return directive, i, fmt.Errorf("line %d: %s block is not closed", directive.line, directive.name)
+		}
+		switch tokens[i].text {
+		case "}":
+			return directive, i + 1, nil
+		case "{":
+			return directive, i, fmt.Errorf("line %d: nested blocks are not supported", tokens[i].line)
+		}
+		line := tokens[i].line
+		directive.block = append(directive.block, corefileLine{tokens: lineTokens(line), line: line})
+	}
+}
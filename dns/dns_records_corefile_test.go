@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testCorefile = `
+# Migrated from the old resolver
+corp.internal:53 {
+    hosts {
+        10.0.0.1 app.corp.internal api.corp.internal
+        fd00::1  app.corp.internal
+        not-an-ip db.corp.internal
+        ttl 60
+        fallthrough
+    }
+    file db.corp.internal
+    forward . 1.1.1.1
+}
+
+dns://lab.internal {
+    hosts /etc/hosts lab.internal {
+        10.1.0.1 gw.lab.internal
+    }
+}
+`
+
+func TestImportCorefileHostsBlock(t *testing.T) {
+	store := NewDNSRecordStore()
+	count, err := store.ImportCorefileHostsBlock(testCorefile)
+	if count != 4 {
+		t.Errorf("Expected 4 records to be imported, got %d", count)
+	}
+	if err == nil || !strings.Contains(err.Error(), `line 7: invalid IP address "not-an-ip"`) {
+		t.Errorf("Expected the invalid entry to be reported, got %v", err)
+	}
+
+	if ips := store.GetRecords("api.corp.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected api.corp.internal to resolve to 10.0.0.1, got %v", ips)
+	}
+	if ips := store.GetRecords("app.corp.internal.", RecordTypeAAAA); len(ips) != 1 {
+		t.Errorf("Expected the IPv6 entry to be imported, got %v", ips)
+	}
+	if ips := store.GetRecords("gw.lab.internal.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected the second server block to be imported, got %v", ips)
+	}
+	if store.HasRecord("db.corp.internal.", RecordTypeA) || store.HasRecord("ttl.", RecordTypeA) {
+		t.Error("Expected invalid entries and options to be skipped")
+	}
+}
+
+func TestImportCorefileFileBlock(t *testing.T) {
+	zonefile := `$TTL 300
+@       IN SOA ns1 admin 1 3600 600 86400 60
+        IN NS  ns1
+app     IN A     10.0.0.1
+app     IN AAAA  fd00::1
+app     IN TXT   "v=spf1 -all"
+_http._tcp IN SRV 10 5 80 app
+@       IN CAA   0 issue "letsencrypt.org"
+mail    IN MX    10 app
+`
+	store := NewDNSRecordStore()
+	count, err := store.ImportCorefileFileBlock(testCorefile, zonefile)
+	if count != 5 {
+		t.Errorf("Expected 5 records to be imported, got %d", count)
+	}
+	if err == nil || !strings.Contains(err.Error(), "unsupported record type MX") {
+		t.Errorf("Expected the MX record to be reported, got %v", err)
+	}
+
+	if ips := store.GetRecords("app.corp.internal.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected relative names to use the server block zone, got %v", ips)
+	}
+	if srv := store.GetSRVRecords("_http._tcp.corp.internal."); len(srv) != 1 || srv[0].Target != "app.corp.internal." {
+		t.Errorf("Expected the SRV record to be imported, got %v", srv)
+	}
+	if caa := store.GetCAARecords("corp.internal."); len(caa) != 1 || caa[0].Value != "letsencrypt.org" {
+		t.Errorf("Expected the CAA record at the apex, got %v", caa)
+	}
+
+	if _, err := store.ImportCorefileFileBlock(". {\n    forward . 1.1.1.1\n}\n", zonefile); err == nil {
+		t.Error("Expected a Corefile without a file block to be rejected")
+	}
+}
+
+func TestImportZoneFileSyntaxError(t *testing.T) {
+	store := NewDNSRecordStore()
+	count, err := store.ImportZoneFile("app IN A 10.0.0.1\nbad IN A not-an-ip\nlate IN A 10.0.0.2\n", "corp.internal")
+	if count != 1 || err == nil {
+		t.Errorf("Expected the import to stop at the syntax error after 1 record, got %d, %v", count, err)
+	}
+}
+
+func TestParseCorefileErrors(t *testing.T) {
+	for _, corefile := range []string{
+		"corp.internal {\n    hosts {\n        10.0.0.1 a\n",
+		"corp.internal\n",
+		"}\n",
+		"{\n}\n",
+		"corp.internal {\n    hosts {\n        { }\n    }\n}\n",
+	} {
+		if _, err := parseCorefile(corefile); err == nil {
+			t.Errorf("Expected %q to be rejected", corefile)
+		}
+	}
+}
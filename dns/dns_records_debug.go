@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// debugDomainLimit is how many exact domains String lists
+const debugDomainLimit = 5
+
+// String returns a multi-line summary of the store for debugging: record counts by
+// type, the first exact A/AAAA domains in alphabetical order with their IPs, and the
+// wildcard patterns
+func (s *DNSRecordStore) String() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	aWildcards := s.aWildcards.patterns()
+	aaaaWildcards := s.aaaaWildcards.patterns()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "DNSRecordStore: %d A, %d AAAA, %d PTR, %d CAA, %d HTTPS, %d NAPTR, %d SRV, %d TXT records\n",
+		countValues(s.aRecords)+countValues(aWildcards),
+		countValues(s.aaaaRecords)+countValues(aaaaWildcards),
+		countValues(s.ptrRecords),
+		countValues(s.caaRecords),
+		countValues(s.httpsRecords),
+		countValues(s.naptrRecords),
+		countValues(s.srvRecords),
+		countValues(s.txtRecords))
+
+	domains := slices.Collect(maps.Keys(s.aRecords))
+	for domain := range s.aaaaRecords {
+		if _, ok := s.aRecords[domain]; !ok {
+			domains = append(domains, domain)
+		}
+	}
+	slices.Sort(domains)
+	fmt.Fprintf(&b, "Domains (%d):\n", len(domains))
+	for _, domain := range domains[:min(len(domains), debugDomainLimit)] {
+		addrs := append(slices.Clone(s.aRecords[domain]), s.aaaaRecords[domain]...)
+		fmt.Fprintf(&b, "  %s %s\n", domain, joinAddrs(addrs))
+	}
+	if len(domains) > debugDomainLimit {
+		fmt.Fprintf(&b, "  ... and %d more\n", len(domains)-debugDomainLimit)
+	}
+
+	patterns := mergePatterns(aWildcards, aaaaWildcards)
+	fmt.Fprintf(&b, "Wildcards (%d):\n", len(patterns))
+	for _, pattern := range slices.Sorted(maps.Keys(patterns)) {
+		fmt.Fprintf(&b, "  %s %s\n", pattern, joinIPs(patterns[pattern]))
+	}
+
+	return b.String()
+}
+
+// GoString returns a Go expression that rebuilds the A, AAAA and PTR records of the
+// store with AddRecord and AddPTRRecord calls, for printing in test failures with %#v
+func (s *DNSRecordStore) GoString() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var b strings.Builder
+	b.WriteString("func() *dns.DNSRecordStore {\n\ts := dns.NewDNSRecordStore()\n")
+
+	addRecord := func(domain string, ip string) {
+		fmt.Fprintf(&b, "\ts.AddRecord(%s, net.ParseIP(%s))\n", strconv.Quote(domain), strconv.Quote(ip))
+	}
+	for _, records := range []map[string][]netip.Addr{s.aRecords, s.aaaaRecords} {
+		for _, domain := range slices.Sorted(maps.Keys(records)) {
+			for _, addr := range records[domain] {
+				addRecord(domain, addr.String())
+			}
+		}
+	}
+	for _, wildcards := range []*dnsTrie{s.aWildcards, s.aaaaWildcards} {
+		patterns := wildcards.patterns()
+		for _, pattern := range slices.Sorted(maps.Keys(patterns)) {
+			for _, ip := range patterns[pattern] {
+				addRecord(pattern, ip.String())
+			}
+		}
+	}
+
+	// AddRecord adds the PTR records of exact domains, only the others need adding
+	addrs := slices.SortedFunc(maps.Keys(s.ptrRecords), netip.Addr.Compare)
+	for _, addr := range addrs {
+		for _, domain := range s.ptrRecords[addr] {
+			if s.hasRecordLocked(domain, net.IP(addr.AsSlice())) {
+				continue
+			}
+			fmt.Fprintf(&b, "\ts.AddPTRRecord(net.ParseIP(%s), %s)\n", strconv.Quote(addr.String()), strconv.Quote(domain))
+		}
+	}
+
+	b.WriteString("\treturn s\n}()")
+	return b.String()
+}
+
+// countValues returns the number of values across the slices of m
+func countValues[K comparable, V any](m map[K][]V) int {
+	var n int
+	for _, values := range m {
+		n += len(values)
+	}
+	return n
+}
+
+// mergePatterns returns the IPv4 and IPv6 wildcard patterns in one map
+func mergePatterns(a, aaaa map[string][]net.IP) map[string][]net.IP {
+	merged := make(map[string][]net.IP, len(a)+len(aaaa))
+	for pattern, ips := range a {
+		merged[pattern] = ips
+	}
+	for pattern, ips := range aaaa {
+		merged[pattern] = append(slices.Clone(merged[pattern]), ips...)
+	}
+	return merged
+}
+
+// joinAddrs returns addrs separated by commas
+func joinAddrs(addrs []netip.Addr) string {
+	values := make([]string, len(addrs))
+	for i, addr := range addrs {
+		values[i] = addr.String()
+	}
+	return strings.Join(values, ", ")
+}
+
+// joinIPs returns ips separated by commas
+func joinIPs(ips []net.IP) string {
+	values := make([]string, len(ips))
+	for i, ip := range ips {
+		values[i] = ip.String()
+	}
+	return strings.Join(values, ", ")
+}
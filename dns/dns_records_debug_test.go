@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"fmt"
+	"go/parser"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDNSRecordStoreString(t *testing.T) {
+	store := NewDNSRecordStore()
+	for i := 1; i <= 7; i++ {
+		store.AddRecord(fmt.Sprintf("host%d.internal.", i), net.IPv4(10, 0, 0, byte(i)))
+	}
+	store.AddRecord("host1.internal.", net.ParseIP("fd00::1"))
+	store.AddRecord("*.svc.internal.", net.ParseIP("10.0.1.1"))
+
+	got := fmt.Sprintf("%v", store)
+	for _, want := range []string{
+		"8 A, 1 AAAA, 8 PTR",
+		"Domains (7):",
+		"  host1.internal. 10.0.0.1, fd00::1\n",
+		"  host5.internal. 10.0.0.5\n",
+		"... and 2 more",
+		"Wildcards (1):",
+		"  *.svc.internal. 10.0.1.1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected String() to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "host6.internal.") {
+		t.Errorf("Expected only the first 5 domains, got:\n%s", got)
+	}
+}
+
+func TestDNSRecordStoreGoString(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("app.internal.", net.ParseIP("fd00::1"))
+	store.AddRecord("*.svc.internal.", net.ParseIP("10.0.1.1"))
+	store.AddPTRRecord(net.ParseIP("10.0.0.9"), "legacy.internal.")
+
+	got := fmt.Sprintf("%#v", store)
+	if _, err := parser.ParseExpr(got); err != nil {
+		t.Fatalf("GoString() is not a valid Go expression: %v\n%s", err, got)
+	}
+
+	want := "func() *dns.DNSRecordStore {\n" +
+		"\ts := dns.NewDNSRecordStore()\n" +
+		"\ts.AddRecord(\"app.internal.\", net.ParseIP(\"10.0.0.1\"))\n" +
+		"\ts.AddRecord(\"app.internal.\", net.ParseIP(\"fd00::1\"))\n" +
+		"\ts.AddRecord(\"*.svc.internal.\", net.ParseIP(\"10.0.1.1\"))\n" +
+		"\ts.AddPTRRecord(net.ParseIP(\"10.0.0.9\"), \"legacy.internal.\")\n" +
+		"\treturn s\n" +
+		"}()"
+	if got != want {
+		t.Errorf("GoString() =\n%s\nexpected\n%s", got, want)
+	}
+}
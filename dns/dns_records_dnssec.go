@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNoSigningZone is returned by SignZone when the store was created without WithSigningZone
+var ErrNoSigningZone = errors.New("no signing zone set")
+
+// WithSigningZone sets the zone apex that SignZone signs records as. The proxy
+// publishes the DNSKEY of the zone given with WithZoneSigningKey.
+func WithSigningZone(zone string) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.signingZone = strings.ToLower(dns.Fqdn(zone))
+	}
+}
+
+// SignZone pre-computes RRSIGs valid from inception to expiry for the exact A, AAAA,
+// TXT and SRV RRsets under the signing zone, replacing any earlier signatures. The
+// DNSKEY for privateKey must have the tag keyTag. It should be the key given to the
+// proxy with WithZoneSigningKey for the zone: the proxy only serves signatures made
+// with the key it publishes, and signs RRsets without one itself. Adding or removing
+// a record drops the signatures of its name. Wildcard records are not signed.
+func (s *DNSRecordStore) SignZone(keyTag uint16, algorithm uint8, privateKey crypto.Signer, inception, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.signingZone == "" {
+		return ErrNoSigningZone
+	}
+	if _, err := newZoneDNSKEY(s.signingZone, algorithm, privateKey.Public(), keyTag); err != nil {
+		return err
+	}
+
+	rrSigs := make(map[string][]dns.RRSIG)
+	for set, rrset := range s.rrsetsLocked() {
+		sig := dns.RRSIG{
+			Hdr: dns.RR_Header{
+				Name:   set.name,
+				Rrtype: dns.TypeRRSIG,
+				Class:  dns.ClassINET,
+				Ttl:    s.TTL(),
+			},
+			Algorithm:  algorithm,
+			KeyTag:     keyTag,
+			SignerName: s.signingZone,
+			Inception:  uint32(inception.Unix()),
+			Expiration: uint32(expiry.Unix()),
+		}
+		if err := sig.Sign(privateKey, rrset); err != nil {
+			return fmt.Errorf("sign %s %s: %w", set.name, dns.TypeToString[set.rrtype], err)
+		}
+		rrSigs[set.name] = append(rrSigs[set.name], sig)
+	}
+
+	s.rrSigs = rrSigs
+	return nil
+}
+
+// GetRRSIG returns the RRSIG made by SignZone over the rrtype RRset of domain
+func (s *DNSRecordStore) GetRRSIG(domain string, rrtype uint16) (dns.RRSIG, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain = strings.ToLower(dns.Fqdn(domain))
+	for _, sig := range s.rrSigs[domain] {
+		if sig.TypeCovered == rrtype {
+			return sig, true
+		}
+	}
+	return dns.RRSIG{}, false
+}
+
+// dropRRSIGsLocked forgets the signatures of domain after its records change
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) dropRRSIGsLocked(domain string) {
+	if len(s.rrSigs) > 0 {
+		delete(s.rrSigs, strings.ToLower(dns.Fqdn(domain)))
+	}
+}
+
+// rrsetKey identifies an RRset signed by SignZone
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// rrsetsLocked returns the exact A, AAAA, TXT and SRV RRsets under the signing zone,
+// built as checkLocalRecords serves them
+// The caller must hold s.mu
+func (s *DNSRecordStore) rrsetsLocked() map[rrsetKey][]dns.RR {
+	ttl := s.TTL()
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+	inZone := func(name string) bool {
+		return !strings.ContainsAny(name, "*?") && dns.IsSubDomain(s.signingZone, name)
+	}
+
+	rrsets := make(map[rrsetKey][]dns.RR)
+	addIPs := func(records map[string][]netip.Addr, rrtype uint16) {
+		for name, addrs := range records {
+			if !inZone(name) {
+				continue
+			}
+			for _, ip := range addrsToIPs(s.unexpiredLocked(name, addrs)) {
+				key := rrsetKey{name: name, rrtype: rrtype}
+				if rrtype == dns.TypeA {
+					rrsets[key] = append(rrsets[key], &dns.A{Hdr: header(name, rrtype), A: ip})
+				} else {
+					rrsets[key] = append(rrsets[key], &dns.AAAA{Hdr: header(name, rrtype), AAAA: ip})
+				}
+			}
+		}
+	}
+	addIPs(s.aRecords, dns.TypeA)
+	addIPs(s.aaaaRecords, dns.TypeAAAA)
+
+	for name, records := range s.txtRecords {
+		if !inZone(name) {
+			continue
+		}
+		key := rrsetKey{name: name, rrtype: dns.TypeTXT}
+		for _, txt := range records {
+			rrsets[key] = append(rrsets[key], &dns.TXT{Hdr: header(name, dns.TypeTXT), Txt: txt})
+		}
+	}
+	for name, records := range s.srvRecords {
+		if !inZone(name) {
+			continue
+		}
+		key := rrsetKey{name: name, rrtype: dns.TypeSRV}
+		for _, rec := range records {
+			rrsets[key] = append(rrsets[key], &dns.SRV{
+				Hdr:      header(name, dns.TypeSRV),
+				Priority: rec.Priority,
+				Weight:   rec.Weight,
+				Port:     rec.Port,
+				Target:   rec.Target,
+			})
+		}
+	}
+
+	for key, rrset := range rrsets {
+		if len(rrset) == 0 {
+			delete(rrsets, key)
+		}
+	}
+	return rrsets
+}
+
+// newZoneDNSKEY builds the DNSKEY for public at zone. Zone keys with and without the
+// SEP flag have different tags, so the flags are picked to match keyTag.
+func newZoneDNSKEY(zone string, algorithm uint8, public crypto.PublicKey, keyTag uint16) (*dns.DNSKEY, error) {
+	encoded, err := encodeDNSKEYPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, flags := range []uint16{dns.ZONE | dns.SEP, dns.ZONE} {
+		key := &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET},
+			Flags:     flags,
+			Protocol:  3,
+			Algorithm: algorithm,
+			PublicKey: encoded,
+		}
+		if key.KeyTag() == keyTag {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key tag %d does not match the private key", keyTag)
+}
+
+// encodeDNSKEYPublicKey encodes public in the DNSKEY public key format, RFC 3110,
+// RFC 6605 and RFC 8080
+func encodeDNSKEYPublicKey(public crypto.PublicKey) (string, error) {
+	var buf []byte
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		exponent := big.NewInt(int64(pub.E)).Bytes()
+		if len(exponent) > 255 {
+			return "", fmt.Errorf("RSA exponent too large")
+		}
+		buf = append([]byte{byte(len(exponent))}, exponent...)
+		buf = append(buf, pub.N.Bytes()...)
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		buf = append(pub.X.FillBytes(make([]byte, size)), pub.Y.FillBytes(make([]byte, size))...)
+	case ed25519.PublicKey:
+		buf = pub
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", public)
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,283 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultSweepInterval is how often expired records are removed in the background
+	defaultSweepInterval = time.Second
+
+	// expiryCallbackTimeout bounds how long a sweep waits for the OnExpiry callback
+	expiryCallbackTimeout = 5 * time.Second
+)
+
+// WithOnExpiry sets a function called for each record that expires, before the record and
+// its PTR are removed. Expired records are removed by a background sweep that runs while the
+// store holds expiring records. fn is called without the store lock held; a panic is recovered
+// and logged, and if fn takes longer than 5 seconds the record is removed without waiting.
+func WithOnExpiry(fn func(domain string, ip net.IP, recordType RecordType)) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.onExpiry = fn
+	}
+}
+
+// WithTTLEviction controls whether expired records are removed by a background sweep,
+// which is the default. Without it no goroutine is started and callers remove expired
+// records by calling PurgeExpired. Lookups skip expired records either way.
+func WithTTLEviction(enabled bool) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.ttlEviction = enabled
+	}
+}
+
+// PurgeExpired removes every expired A and AAAA record together with its PTR and returns
+// the number of records removed. OnExpiry callbacks fire as they do for the background sweep.
+// Expired NXDOMAIN responses are dropped from the negative cache too, without being counted.
+func (s *DNSRecordStore) PurgeExpired() int {
+	return s.removeExpired()
+}
+
+// AddRecordWithTTL adds an A or AAAA record that expires once ttl has passed
+func (s *DNSRecordStore) AddRecordWithTTL(domain string, ip net.IP, ttl time.Duration) error {
+	return s.AddRecordWithExpiry(domain, ip, s.now().Add(ttl))
+}
+
+// AddRecordWithExpiry adds an A or AAAA record that expires at the given wall-clock time,
+// for example the end of a DHCP lease. Adding a record that already exists sets its expiry.
+// Expired records are skipped by lookups. Only exact domains can expire, wildcard patterns
+// are rejected with ErrInvalidDomain.
+func (s *DNSRecordStore) AddRecordWithExpiry(domain string, ip net.IP, expiry time.Time) error {
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+	if strings.ContainsAny(domain, "*?") {
+		return fmt.Errorf("%w: wildcard pattern %s cannot expire", ErrInvalidDomain, domain)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.addRecordLocked(domain, ip); err != nil {
+		return err
+	}
+
+	// The record may have been evicted right away by a full LRU
+	if !s.hasRecordLocked(domain, ip) {
+		return nil
+	}
+	if s.expiries[domain] == nil {
+		s.expiries[domain] = make(map[string]time.Time)
+	}
+	s.expiries[domain][ip.String()] = expiry
+	s.startSweepLocked()
+	return nil
+}
+
+// RenewRecord pushes the expiry of the record for domain and ip back by extension, for
+// example when a DHCP lease is renewed. Records without an expiry are left as they are.
+// It returns ErrRecordNotFound if there is no such record or it has already expired.
+func (s *DNSRecordStore) RenewRecord(domain string, ip net.IP, extension time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.renewLocked(domain, ip, func(expiry time.Time) time.Time {
+		return expiry.Add(extension)
+	})
+}
+
+// RenewRecordAbs sets the expiry of the record for domain and ip to newExpiry
+// It behaves like RenewRecord otherwise
+func (s *DNSRecordStore) RenewRecordAbs(domain string, ip net.IP, newExpiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.renewLocked(domain, ip, func(time.Time) time.Time {
+		return newExpiry
+	})
+}
+
+// renewLocked replaces the expiry of a live record with renew(current expiry)
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) renewLocked(domain string, ip net.IP, renew func(time.Time) time.Time) error {
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	addr, _ := ipToAddr(ip)
+	if !s.hasRecordLocked(domain, ip) || s.isExpiredLocked(domain, addr) {
+		return fmt.Errorf("%w: %s %s", ErrRecordNotFound, domain, ip)
+	}
+
+	key := addr.String()
+	if expiry, ok := s.expiries[domain][key]; ok {
+		s.expiries[domain][key] = renew(expiry)
+	}
+	return nil
+}
+
+// GetRecordExpiry returns when the record for domain and ip expires
+// It returns false if there is no such record or it does not expire
+func (s *DNSRecordStore) GetRecordExpiry(domain string, ip net.IP) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiry, ok := s.expiries[strings.ToLower(dns.Fqdn(domain))][ip.String()]
+	return expiry, ok
+}
+
+// hasRecordLocked reports whether domain has an exact A or AAAA record for ip
+// The caller must hold s.mu
+func (s *DNSRecordStore) hasRecordLocked(domain string, ip net.IP) bool {
+	addr, ok := ipToAddr(ip)
+	if !ok {
+		return false
+	}
+	if addr.Is4() {
+		return slices.Contains(s.aRecords[domain], addr)
+	}
+	return slices.Contains(s.aaaaRecords[domain], addr)
+}
+
+// isExpiredLocked reports whether the record for domain and addr has expired
+// The caller must hold s.mu
+func (s *DNSRecordStore) isExpiredLocked(domain string, addr netip.Addr) bool {
+	expiry, ok := s.expiries[domain][addr.String()]
+	return ok && s.now().After(expiry)
+}
+
+// unexpiredLocked returns addrs without the records of domain that have expired
+// The caller must hold s.mu
+func (s *DNSRecordStore) unexpiredLocked(domain string, addrs []netip.Addr) []netip.Addr {
+	if len(s.expiries[domain]) == 0 {
+		return addrs
+	}
+	return slices.DeleteFunc(slices.Clone(addrs), func(addr netip.Addr) bool {
+		return s.isExpiredLocked(domain, addr)
+	})
+}
+
+// livePTRLocked returns the PTR targets of addr whose records have not expired
+// The caller must hold s.mu
+func (s *DNSRecordStore) livePTRLocked(addr netip.Addr) []string {
+	domains := s.ptrRecords[addr]
+	if len(s.expiries) == 0 {
+		return domains
+	}
+	return slices.DeleteFunc(slices.Clone(domains), func(domain string) bool {
+		return s.isExpiredLocked(domain, addr)
+	})
+}
+
+// expiredRecord is a record found past its expiry by a sweep
+type expiredRecord struct {
+	domain string
+	ip     net.IP
+}
+
+// startSweepLocked starts the background sweep unless it is disabled or already running
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) startSweepLocked() {
+	if s.sweeping || !s.ttlEviction {
+		return
+	}
+	s.sweeping = true
+	go s.sweepLoop(s.sweepInterval)
+}
+
+// sweepLoop removes expired records every interval until no expiring records or cached
+// NXDOMAIN responses are left
+func (s *DNSRecordStore) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.removeExpired()
+
+		s.mu.Lock()
+		if len(s.expiries) == 0 && s.negative.len() == 0 {
+			s.sweeping = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+	}
+}
+
+// removeExpired removes every expired record and its PTR, calling the OnExpiry
+// callback for each one first. It returns the number of records removed.
+func (s *DNSRecordStore) removeExpired() int {
+	// One sweep at a time so callbacks fire once per record
+	s.sweepMu.Lock()
+	defer s.sweepMu.Unlock()
+
+	now := s.now()
+	s.negative.purge(now)
+
+	s.mu.RLock()
+	var expired []expiredRecord
+	for domain, expiries := range s.expiries {
+		for ipStr, expiry := range expiries {
+			if now.After(expiry) {
+				expired = append(expired, expiredRecord{domain: domain, ip: net.ParseIP(ipStr)})
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(expired) == 0 {
+		return 0
+	}
+
+	if s.onExpiry != nil {
+		for _, rec := range expired {
+			s.notifyExpiry(rec)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for _, rec := range expired {
+		// The record may have been removed or given a new expiry while the callback ran
+		if addr, _ := ipToAddr(rec.ip); !s.isExpiredLocked(rec.domain, addr) {
+			continue
+		}
+		s.removeRecordLocked(rec.domain, rec.ip)
+		removed++
+	}
+	return removed
+}
+
+// notifyExpiry calls the OnExpiry callback for rec, recovering a panic and giving up
+// waiting after expiryCallbackTimeout
+func (s *DNSRecordStore) notifyExpiry(rec expiredRecord) {
+	recordType := RecordTypeAAAA
+	if rec.ip.To4() != nil {
+		recordType = RecordTypeA
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("OnExpiry callback for %s %s panicked: %v", rec.domain, rec.ip, r)
+			}
+		}()
+		s.onExpiry(rec.domain, rec.ip, recordType)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(expiryCallbackTimeout):
+		logger.Warn("OnExpiry callback for %s %s did not return within %v", rec.domain, rec.ip, expiryCallbackTimeout)
+	}
+}
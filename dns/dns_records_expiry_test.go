@@ -0,0 +1,395 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for expiry tests
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newExpiryTestStore(opts ...DNSRecordStoreOption) (*DNSRecordStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewDNSRecordStore(opts...)
+	store.now = clock.Now
+	store.sweepInterval = 5 * time.Millisecond
+	return store, clock
+}
+
+// waitForRemoval waits until the store no longer holds any expiring record
+func waitForRemoval(t *testing.T, store *DNSRecordStore) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		store.mu.RLock()
+		remaining := len(store.expiries)
+		store.mu.RUnlock()
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the sweep to remove expired records")
+}
+
+func TestAddRecordWithExpiry(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	ip := net.ParseIP("10.0.0.5")
+	expiry := clock.Now().Add(time.Hour)
+
+	if err := store.AddRecordWithExpiry("Lease.example.com", ip, expiry); err != nil {
+		t.Fatalf("AddRecordWithExpiry failed: %v", err)
+	}
+
+	got, ok := store.GetRecordExpiry("lease.example.com.", ip)
+	if !ok || !got.Equal(expiry) {
+		t.Errorf("Expected expiry %v, got %v, %v", expiry, got, ok)
+	}
+	if ips := store.GetRecords("lease.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Fatalf("Expected record before expiry, got %v", ips)
+	}
+
+	clock.Advance(time.Hour + time.Second)
+
+	if ips := store.GetRecords("lease.example.com.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected expired record to be skipped, got %v", ips)
+	}
+	if store.HasRecord("lease.example.com.", RecordTypeA) {
+		t.Error("Expected HasRecord to be false for an expired record")
+	}
+	if domain, ok := store.GetPTRRecordByIP(ip); ok {
+		t.Errorf("Expected no PTR for an expired record, got %s", domain)
+	}
+}
+
+func TestExpiringRecordsCoexist(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	permanent := net.ParseIP("10.0.0.1")
+	withTTL := net.ParseIP("10.0.0.2")
+	withExpiry := net.ParseIP("10.0.0.3")
+
+	store.AddRecord("host.example.com.", permanent)
+	if err := store.AddRecordWithTTL("host.example.com.", withTTL, 10*time.Minute); err != nil {
+		t.Fatalf("AddRecordWithTTL failed: %v", err)
+	}
+	if err := store.AddRecordWithExpiry("host.example.com.", withExpiry, clock.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("AddRecordWithExpiry failed: %v", err)
+	}
+
+	if _, ok := store.GetRecordExpiry("host.example.com.", permanent); ok {
+		t.Error("Expected no expiry for a record added with AddRecord")
+	}
+	if got, ok := store.GetRecordExpiry("host.example.com.", withTTL); !ok || !got.Equal(clock.Now().Add(10*time.Minute)) {
+		t.Errorf("Expected TTL record to expire in 10 minutes, got %v, %v", got, ok)
+	}
+
+	if ips := store.GetRecords("host.example.com.", RecordTypeA); len(ips) != 3 {
+		t.Fatalf("Expected 3 records, got %v", ips)
+	}
+
+	clock.Advance(30 * time.Minute)
+	ips := store.GetRecords("host.example.com.", RecordTypeA)
+	if len(ips) != 2 || !ips[0].Equal(permanent) || !ips[1].Equal(withExpiry) {
+		t.Errorf("Expected permanent and absolute-expiry records, got %v", ips)
+	}
+
+	clock.Advance(time.Hour)
+	ips = store.GetRecords("host.example.com.", RecordTypeA)
+	if len(ips) != 1 || !ips[0].Equal(permanent) {
+		t.Errorf("Expected only the permanent record, got %v", ips)
+	}
+}
+
+func TestAddRecordWithExpiryUpdatesAndRemoves(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	ip := net.ParseIP("2001:db8::5")
+
+	store.AddRecordWithExpiry("v6.example.com.", ip, clock.Now().Add(time.Minute))
+	store.AddRecordWithExpiry("v6.example.com.", ip, clock.Now().Add(time.Hour))
+
+	clock.Advance(2 * time.Minute)
+	if ips := store.GetRecords("v6.example.com.", RecordTypeAAAA); len(ips) != 1 {
+		t.Errorf("Expected re-adding to extend the expiry, got %v", ips)
+	}
+
+	store.RemoveRecord("v6.example.com.", ip)
+	if _, ok := store.GetRecordExpiry("v6.example.com.", ip); ok {
+		t.Error("Expected expiry to be dropped with the record")
+	}
+
+	// A later permanent record for the same pair must not inherit the old expiry
+	store.AddRecord("v6.example.com.", ip)
+	clock.Advance(2 * time.Hour)
+	if ips := store.GetRecords("v6.example.com.", RecordTypeAAAA); len(ips) != 1 {
+		t.Errorf("Expected permanent record to stay, got %v", ips)
+	}
+}
+
+func TestExpiredRecordFallsBackToWildcard(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	store.AddRecord("*.example.com.", net.ParseIP("10.9.9.9"))
+	store.AddRecordWithTTL("host.example.com.", net.ParseIP("10.0.0.1"), time.Minute)
+
+	clock.Advance(2 * time.Minute)
+	ips := store.GetRecords("host.example.com.", RecordTypeA)
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.9.9.9")) {
+		t.Errorf("Expected the wildcard record once the exact one expired, got %v", ips)
+	}
+}
+
+func TestAddRecordWithExpiryRejectsWildcard(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	err := store.AddRecordWithExpiry("*.example.com.", net.ParseIP("10.0.0.1"), clock.Now().Add(time.Hour))
+	if !errors.Is(err, ErrInvalidDomain) {
+		t.Errorf("Expected ErrInvalidDomain, got %v", err)
+	}
+}
+
+func TestOnExpiryCallback(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	var store *DNSRecordStore
+	store, clock := newExpiryTestStore(WithOnExpiry(func(domain string, ip net.IP, recordType RecordType) {
+		mu.Lock()
+		calls[domain+" "+ip.String()+" "+recordType.String()]++
+		mu.Unlock()
+
+		// The record is only removed once the callback has returned
+		if _, ok := store.GetRecordExpiry(domain, ip); !ok {
+			t.Errorf("Expected %s %s to still be stored during the callback", domain, ip)
+		}
+	}))
+
+	store.AddRecord("static.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecordWithTTL("lease.example.com.", net.ParseIP("10.0.0.2"), time.Minute)
+	store.AddRecordWithTTL("lease.example.com.", net.ParseIP("2001:db8::2"), time.Minute)
+	store.AddRecordWithTTL("later.example.com.", net.ParseIP("10.0.0.3"), time.Hour)
+
+	clock.Advance(2 * time.Minute)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, v4 := store.GetRecordExpiry("lease.example.com.", net.ParseIP("10.0.0.2"))
+		_, v6 := store.GetRecordExpiry("lease.example.com.", net.ParseIP("2001:db8::2"))
+		if !v4 && !v6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for expired records to be removed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Let a few more sweeps run to catch repeated callbacks
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	want := map[string]int{
+		"lease.example.com. 10.0.0.2 A":       1,
+		"lease.example.com. 2001:db8::2 AAAA": 1,
+	}
+	if len(calls) != len(want) {
+		t.Errorf("Expected callbacks %v, got %v", want, calls)
+	}
+	for key, n := range want {
+		if calls[key] != n {
+			t.Errorf("Expected %d callback(s) for %s, got %d", n, key, calls[key])
+		}
+	}
+	mu.Unlock()
+
+	store.mu.RLock()
+	_, ptrV4 := store.ptrRecords[netip.MustParseAddr("10.0.0.2")]
+	_, ptrV6 := store.ptrRecords[netip.MustParseAddr("2001:db8::2")]
+	store.mu.RUnlock()
+	if ptrV4 || ptrV6 {
+		t.Error("Expected PTR records of expired records to be removed")
+	}
+	if !store.HasRecord("static.example.com.", RecordTypeA) || !store.HasRecord("later.example.com.", RecordTypeA) {
+		t.Error("Expected records that have not expired to remain")
+	}
+	if _, ok := store.GetPTRRecordByIP(net.ParseIP("10.0.0.1")); !ok {
+		t.Error("Expected PTR of the permanent record to remain")
+	}
+}
+
+func TestOnExpiryCallbackPanic(t *testing.T) {
+	store, clock := newExpiryTestStore(WithOnExpiry(func(string, net.IP, RecordType) {
+		panic("callback failed")
+	}))
+
+	store.AddRecordWithTTL("lease.example.com.", net.ParseIP("10.0.0.2"), time.Minute)
+	clock.Advance(2 * time.Minute)
+	waitForRemoval(t, store)
+
+	if ips := store.GetRecords("lease.example.com.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected record to be removed despite the panic, got %v", ips)
+	}
+}
+
+func TestSweepStopsWhenNothingExpires(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	store.AddRecordWithTTL("lease.example.com.", net.ParseIP("10.0.0.2"), time.Minute)
+
+	clock.Advance(2 * time.Minute)
+	waitForRemoval(t, store)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.RLock()
+		sweeping := store.sweeping
+		store.mu.RUnlock()
+		if !sweeping {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the sweep to stop once no expiring records are left")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A new expiring record starts it again
+	store.AddRecordWithTTL("lease.example.com.", net.ParseIP("10.0.0.2"), time.Minute)
+	clock.Advance(2 * time.Minute)
+	waitForRemoval(t, store)
+}
+
+func TestRenewRecord(t *testing.T) {
+	store, clock := newExpiryTestStore(WithOnExpiry(func(domain string, ip net.IP, _ RecordType) {
+		t.Errorf("Unexpected expiry of %s %s", domain, ip)
+	}))
+	ip := net.ParseIP("10.0.0.2")
+	start := clock.Now()
+
+	store.AddRecordWithTTL("lease.example.com.", ip, time.Minute)
+	if err := store.RenewRecord("LEASE.example.com", ip, time.Hour); err != nil {
+		t.Fatalf("RenewRecord failed: %v", err)
+	}
+	if got, _ := store.GetRecordExpiry("lease.example.com.", ip); !got.Equal(start.Add(time.Minute + time.Hour)) {
+		t.Errorf("Expected expiry extended by an hour, got %v", got)
+	}
+
+	newExpiry := start.Add(24 * time.Hour)
+	if err := store.RenewRecordAbs("lease.example.com.", ip, newExpiry); err != nil {
+		t.Fatalf("RenewRecordAbs failed: %v", err)
+	}
+	if got, _ := store.GetRecordExpiry("lease.example.com.", ip); !got.Equal(newExpiry) {
+		t.Errorf("Expected expiry %v, got %v", newExpiry, got)
+	}
+
+	clock.Advance(2 * time.Hour)
+	time.Sleep(20 * time.Millisecond) // let the sweep run
+
+	if ips := store.GetRecords("lease.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected renewed record to remain, got %v", ips)
+	}
+	if !store.HasPTRRecordForIP(ip) {
+		t.Error("Expected PTR to remain after renewal")
+	}
+}
+
+func TestRenewRecordNotFound(t *testing.T) {
+	store, clock := newExpiryTestStore()
+	ip := net.ParseIP("10.0.0.2")
+
+	if err := store.RenewRecord("missing.example.com.", ip, time.Hour); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound for a missing record, got %v", err)
+	}
+
+	// Expired but not swept yet still counts as gone
+	store.sweepInterval = time.Hour
+	store.AddRecordWithTTL("lease.example.com.", ip, time.Minute)
+	clock.Advance(2 * time.Minute)
+	if err := store.RenewRecordAbs("lease.example.com.", ip, clock.Now().Add(time.Hour)); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound for an expired record, got %v", err)
+	}
+
+	// Permanent records have nothing to renew
+	store.AddRecord("static.example.com.", ip)
+	if err := store.RenewRecord("static.example.com.", ip, time.Hour); err != nil {
+		t.Errorf("Expected renewing a permanent record to succeed, got %v", err)
+	}
+	if _, ok := store.GetRecordExpiry("static.example.com.", ip); ok {
+		t.Error("Expected a permanent record to stay permanent")
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	var mu sync.Mutex
+	var expired []string
+	store, clock := newExpiryTestStore(
+		WithTTLEviction(false),
+		WithOnExpiry(func(domain string, ip net.IP, _ RecordType) {
+			mu.Lock()
+			expired = append(expired, domain+" "+ip.String())
+			mu.Unlock()
+		}),
+	)
+
+	store.AddRecord("static.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecordWithTTL("a.example.com.", net.ParseIP("10.0.0.2"), time.Minute)
+	store.AddRecordWithTTL("a.example.com.", net.ParseIP("2001:db8::2"), time.Minute)
+	store.AddRecordWithTTL("b.example.com.", net.ParseIP("10.0.0.3"), time.Hour)
+
+	store.mu.RLock()
+	sweeping := store.sweeping
+	store.mu.RUnlock()
+	if sweeping {
+		t.Error("Expected no background sweep with TTL eviction disabled")
+	}
+
+	if n := store.PurgeExpired(); n != 0 {
+		t.Errorf("Expected nothing to purge yet, purged %d", n)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if n := store.PurgeExpired(); n != 2 {
+		t.Errorf("Expected 2 records purged, got %d", n)
+	}
+	if len(expired) != 2 {
+		t.Errorf("Expected 2 OnExpiry callbacks, got %v", expired)
+	}
+
+	store.mu.RLock()
+	_, aLeft := store.aRecords["a.example.com."]
+	_, aaaaLeft := store.aaaaRecords["a.example.com."]
+	_, ptrLeft := store.ptrRecords[netip.MustParseAddr("10.0.0.2")]
+	store.mu.RUnlock()
+	if aLeft || aaaaLeft || ptrLeft {
+		t.Error("Expected purged records and their PTRs to be removed from the maps")
+	}
+
+	// Purging again finds nothing new
+	if n := store.PurgeExpired(); n != 0 {
+		t.Errorf("Expected nothing left to purge, purged %d", n)
+	}
+
+	clock.Advance(time.Hour)
+	if n := store.PurgeExpired(); n != 1 {
+		t.Errorf("Expected 1 record purged, got %d", n)
+	}
+	if !store.HasRecord("static.example.com.", RecordTypeA) {
+		t.Error("Expected the permanent record to remain")
+	}
+	if len(expired) != 3 {
+		t.Errorf("Expected 3 OnExpiry callbacks in total, got %v", expired)
+	}
+}
@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// defaultHealthCheckInterval is used when RegisterHealthCheck is given no interval
+const defaultHealthCheckInterval = 10 * time.Second
+
+// HealthCheckFunc reports whether the backend at ip is alive
+// ctx is cancelled when the check takes longer than its interval or is unregistered
+type HealthCheckFunc func(ctx context.Context, ip net.IP) bool
+
+// healthKey identifies the record a health check belongs to
+type healthKey struct {
+	domain string
+	ip     string
+}
+
+// RegisterHealthCheck polls check for the record of domain and ip every interval. While
+// the check fails the address is left out of GetRecords without being deleted, and it is
+// served again once the check passes. The address counts as healthy until the first check
+// completes. Registering again for the same record replaces the previous check, and
+// removing the record or clearing the store stops it. Only exact domains are checked.
+func (s *DNSRecordStore) RegisterHealthCheck(domain string, ip net.IP, check HealthCheckFunc, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+	key := healthKey{domain: domain, ip: ip.String()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopHealthCheckLocked(key)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if s.healthChecks[domain] == nil {
+		s.healthChecks[domain] = make(map[string]context.CancelFunc)
+	}
+	s.healthChecks[domain][key.ip] = cancel
+	s.healthyIPs.Store(key, true)
+
+	go s.runHealthCheck(ctx, key, slices.Clone(ip), check, interval)
+}
+
+// UnregisterHealthCheck stops the health check of the record for domain and ip
+// The address is served again whatever the last result was
+func (s *DNSRecordStore) UnregisterHealthCheck(domain string, ip net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopHealthCheckLocked(healthKey{domain: strings.ToLower(dns.Fqdn(domain)), ip: ip.String()})
+}
+
+// GetHealthStatus returns the latest health check result for each checked address of domain
+func (s *DNSRecordStore) GetHealthStatus(domain string) map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain = strings.ToLower(dns.Fqdn(domain))
+	status := make(map[string]bool, len(s.healthChecks[domain]))
+	for ipStr := range s.healthChecks[domain] {
+		status[ipStr] = s.isHealthy(healthKey{domain: domain, ip: ipStr})
+	}
+	return status
+}
+
+// runHealthCheck runs check every interval until ctx is cancelled
+func (s *DNSRecordStore) runHealthCheck(ctx context.Context, key healthKey, ip net.IP, check HealthCheckFunc, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		healthy := check(checkCtx, ip)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if previous, _ := s.healthyIPs.Swap(key, healthy); previous != healthy {
+			if healthy {
+				logger.Info("Health check for %s %s passed, serving it again", key.domain, key.ip)
+			} else {
+				logger.Warn("Health check for %s %s failed, suppressing it", key.domain, key.ip)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isHealthy reports whether the last check for key passed, true for unchecked records
+func (s *DNSRecordStore) isHealthy(key healthKey) bool {
+	healthy, ok := s.healthyIPs.Load(key)
+	return !ok || healthy.(bool)
+}
+
+// healthyLocked returns addrs without the records of domain whose health check is failing
+// The caller must hold s.mu
+func (s *DNSRecordStore) healthyLocked(domain string, addrs []netip.Addr) []netip.Addr {
+	if len(s.healthChecks[domain]) == 0 {
+		return addrs
+	}
+	return slices.DeleteFunc(slices.Clone(addrs), func(addr netip.Addr) bool {
+		return !s.isHealthy(healthKey{domain: domain, ip: addr.String()})
+	})
+}
+
+// stopHealthCheckLocked cancels the health check for key and forgets its result
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) stopHealthCheckLocked(key healthKey) {
+	if cancel, ok := s.healthChecks[key.domain][key.ip]; ok {
+		cancel()
+		delete(s.healthChecks[key.domain], key.ip)
+		if len(s.healthChecks[key.domain]) == 0 {
+			delete(s.healthChecks, key.domain)
+		}
+	}
+	s.healthyIPs.Delete(key)
+}
+
+// stopAllHealthChecksLocked cancels every health check
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) stopAllHealthChecksLocked() {
+	for _, checks := range s.healthChecks {
+		for _, cancel := range checks {
+			cancel()
+		}
+	}
+	s.healthChecks = make(map[string]map[string]context.CancelFunc)
+	s.healthyIPs.Clear()
+}
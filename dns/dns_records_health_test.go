@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// switchableCheck is a HealthCheckFunc whose result is set per IP by the test
+type switchableCheck struct {
+	mu      sync.Mutex
+	healthy map[string]bool
+	calls   atomic.Int64
+}
+
+func newSwitchableCheck() *switchableCheck {
+	return &switchableCheck{healthy: make(map[string]bool)}
+}
+
+func (c *switchableCheck) set(ip string, healthy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.healthy[ip] = healthy
+}
+
+func (c *switchableCheck) check(_ context.Context, ip net.IP) bool {
+	c.calls.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	healthy, ok := c.healthy[ip.String()]
+	return !ok || healthy
+}
+
+// waitForStatus waits until the health status of ip for domain is want
+func waitForStatus(t *testing.T, store *DNSRecordStore, domain, ip string, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if healthy, ok := store.GetHealthStatus(domain)[ip]; ok && healthy == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Health status of %s %s did not become %v", domain, ip, want)
+}
+
+func TestHealthCheckSuppressesFailingIPs(t *testing.T) {
+	store := NewDNSRecordStore()
+	t.Cleanup(store.Clear)
+
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.2"))
+
+	check := newSwitchableCheck()
+	check.set("10.0.0.2", false)
+	store.RegisterHealthCheck("app.example.com.", net.ParseIP("10.0.0.1"), check.check, 5*time.Millisecond)
+	store.RegisterHealthCheck("App.Example.com", net.ParseIP("10.0.0.2"), check.check, 5*time.Millisecond)
+
+	waitForStatus(t, store, "app.example.com.", "10.0.0.2", false)
+	ips := store.GetRecords("app.example.com.", RecordTypeA)
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("Expected only the healthy address, got %v", ips)
+	}
+
+	// The failing record is suppressed, not deleted
+	if !store.HasRecord("app.example.com.", RecordTypeA) {
+		t.Error("Expected the record to still exist")
+	}
+	if _, ok := store.GetPTRRecordByIP(net.ParseIP("10.0.0.2")); !ok {
+		t.Error("Expected the PTR of the suppressed address to be kept")
+	}
+
+	check.set("10.0.0.2", true)
+	waitForStatus(t, store, "app.example.com.", "10.0.0.2", true)
+	if ips := store.GetRecords("app.example.com.", RecordTypeA); len(ips) != 2 {
+		t.Errorf("Expected the address to be reinstated, got %v", ips)
+	}
+
+	status := store.GetHealthStatus("app.example.com.")
+	if len(status) != 2 || !status["10.0.0.1"] || !status["10.0.0.2"] {
+		t.Errorf("Unexpected health status %v", status)
+	}
+}
+
+func TestHealthCheckAllFailingFallsBackToWildcard(t *testing.T) {
+	store := NewDNSRecordStore()
+	t.Cleanup(store.Clear)
+
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("*.example.com.", net.ParseIP("10.0.0.9"))
+
+	check := newSwitchableCheck()
+	check.set("10.0.0.1", false)
+	store.RegisterHealthCheck("app.example.com.", net.ParseIP("10.0.0.1"), check.check, 5*time.Millisecond)
+	waitForStatus(t, store, "app.example.com.", "10.0.0.1", false)
+
+	ips := store.GetRecords("app.example.com.", RecordTypeA)
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.9")) {
+		t.Errorf("Expected the wildcard answer when every address is failing, got %v", ips)
+	}
+}
+
+func TestUnregisterHealthCheck(t *testing.T) {
+	store := NewDNSRecordStore()
+	t.Cleanup(store.Clear)
+
+	ip := net.ParseIP("2001:db8::1")
+	store.AddRecord("app.example.com.", ip)
+
+	check := newSwitchableCheck()
+	check.set(ip.String(), false)
+	store.RegisterHealthCheck("app.example.com.", ip, check.check, 5*time.Millisecond)
+	waitForStatus(t, store, "app.example.com.", ip.String(), false)
+
+	store.UnregisterHealthCheck("app.example.com.", ip)
+	if ips := store.GetRecords("app.example.com.", RecordTypeAAAA); len(ips) != 1 {
+		t.Errorf("Expected the address to be served after unregistering, got %v", ips)
+	}
+	if status := store.GetHealthStatus("app.example.com."); len(status) != 0 {
+		t.Errorf("Expected no health status after unregistering, got %v", status)
+	}
+}
+
+func TestHealthChecksStopOnClearAndRemoval(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	ip := net.ParseIP("10.0.0.1")
+	store.AddRecord("app.example.com.", ip)
+	store.AddRecord("db.example.com.", ip)
+
+	check := newSwitchableCheck()
+	store.RegisterHealthCheck("app.example.com.", ip, check.check, 5*time.Millisecond)
+	store.RegisterHealthCheck("db.example.com.", ip, check.check, 5*time.Millisecond)
+	waitForStatus(t, store, "app.example.com.", ip.String(), true)
+
+	store.RemoveRecord("app.example.com.", ip)
+	if status := store.GetHealthStatus("app.example.com."); len(status) != 0 {
+		t.Errorf("Expected removing the record to stop its check, got %v", status)
+	}
+	if status := store.GetHealthStatus("db.example.com."); len(status) != 1 {
+		t.Errorf("Expected the other check to keep running, got %v", status)
+	}
+
+	store.Clear()
+	if status := store.GetHealthStatus("db.example.com."); len(status) != 0 {
+		t.Errorf("Expected Clear to stop all checks, got %v", status)
+	}
+
+	// Let a check that was already running finish, then make sure none run again
+	time.Sleep(20 * time.Millisecond)
+	calls := check.calls.Load()
+	time.Sleep(30 * time.Millisecond)
+	if got := check.calls.Load(); got != calls {
+		t.Errorf("Expected no checks after Clear, got %d more", got-calls)
+	}
+}
@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// HTTPSRecord is an HTTPS (type 65) service binding record carrying ALPN and ECH hints
+type HTTPSRecord struct {
+	dns.HTTPS
+}
+
+// AddHTTPSRecord adds an HTTPS record for a domain
+// domain can contain wildcards: * (0+ chars) and ? (exactly 1 char)
+// The record header is replaced, so only the priority, target and parameters matter
+func (s *DNSRecordStore) AddHTTPSRecord(domain string, rec dns.HTTPS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+	record := newHTTPSRecord(domain, &rec)
+
+	for _, existing := range s.httpsRecords[domain] {
+		if dns.IsDuplicate(&existing.HTTPS, &record.HTTPS) {
+			return nil
+		}
+	}
+	s.httpsRecords[domain] = append(s.httpsRecords[domain], record)
+
+	return nil
+}
+
+// GetHTTPSRecords returns the HTTPS records for a domain
+// First checks for an exact match, then checks wildcard patterns
+func (s *DNSRecordStore) GetHTTPSRecords(domain string) []HTTPSRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	// Check exact match first
+	if records, ok := s.httpsRecords[domain]; ok {
+		return copyHTTPSRecords(records)
+	}
+
+	// Check wildcard patterns
+	var records []HTTPSRecord
+	for pattern, patternRecords := range s.httpsRecords {
+		if strings.ContainsAny(pattern, "*?") && matchWildcard(pattern, domain) {
+			records = append(records, copyHTTPSRecords(patternRecords)...)
+		}
+	}
+
+	return records
+}
+
+// RemoveHTTPSRecord removes an HTTPS record from a domain
+// If rec is nil, removes all HTTPS records for the domain
+func (s *DNSRecordStore) RemoveHTTPSRecord(domain string, rec *dns.HTTPS) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	if rec == nil {
+		delete(s.httpsRecords, domain)
+		return
+	}
+
+	records, ok := s.httpsRecords[domain]
+	if !ok {
+		return
+	}
+
+	target := newHTTPSRecord(domain, rec)
+	remaining := make([]HTTPSRecord, 0, len(records))
+	for _, existing := range records {
+		if !dns.IsDuplicate(&existing.HTTPS, &target.HTTPS) {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(s.httpsRecords, domain)
+	} else {
+		s.httpsRecords[domain] = remaining
+	}
+}
+
+// HasHTTPSRecord checks if a domain has any HTTPS records, including via wildcard patterns
+func (s *DNSRecordStore) HasHTTPSRecord(domain string) bool {
+	return len(s.GetHTTPSRecords(domain)) > 0
+}
+
+// newHTTPSRecord copies rec with a header for domain so records can be compared
+func newHTTPSRecord(domain string, rec *dns.HTTPS) HTTPSRecord {
+	record := HTTPSRecord{*dns.Copy(rec).(*dns.HTTPS)}
+	record.Hdr = dns.RR_Header{
+		Name:   domain,
+		Rrtype: dns.TypeHTTPS,
+		Class:  dns.ClassINET,
+		Ttl:    300, // 5 minutes
+	}
+	return record
+}
+
+// copyHTTPSRecords deep copies records to prevent external modifications
+func copyHTTPSRecords(records []HTTPSRecord) []HTTPSRecord {
+	result := make([]HTTPSRecord, len(records))
+	for i, rec := range records {
+		result[i] = HTTPSRecord{*dns.Copy(&rec.HTTPS).(*dns.HTTPS)}
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newTestHTTPS(priority uint16, target string, alpn ...string) dns.HTTPS {
+	rec := dns.HTTPS{}
+	rec.Priority = priority
+	rec.Target = target
+	if len(alpn) > 0 {
+		rec.Value = []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: alpn}}
+	}
+	return rec
+}
+
+func TestHTTPSRecords(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	h2 := newTestHTTPS(1, ".", "h2")
+	h3 := newTestHTTPS(2, ".", "h3")
+
+	if err := store.AddHTTPSRecord("app.example.com", h2); err != nil {
+		t.Fatalf("Failed to add HTTPS record: %v", err)
+	}
+	if err := store.AddHTTPSRecord("APP.example.com.", h3); err != nil {
+		t.Fatalf("Failed to add HTTPS record: %v", err)
+	}
+	// Duplicates are ignored
+	if err := store.AddHTTPSRecord("app.example.com.", h2); err != nil {
+		t.Fatalf("Failed to add HTTPS record: %v", err)
+	}
+
+	records := store.GetHTTPSRecords("app.example.com.")
+	if len(records) != 2 || records[0].Priority != 1 || records[1].Priority != 2 {
+		t.Fatalf("Expected 2 HTTPS records, got %v", records)
+	}
+	if !store.HasHTTPSRecord("app.example.com.") {
+		t.Error("Expected HasHTTPSRecord to return true")
+	}
+
+	store.RemoveHTTPSRecord("app.example.com.", &h2)
+	if records := store.GetHTTPSRecords("app.example.com."); len(records) != 1 || records[0].Priority != 2 {
+		t.Errorf("Expected only the h3 HTTPS record after removal, got %v", records)
+	}
+
+	store.RemoveHTTPSRecord("app.example.com.", nil)
+	if store.HasHTTPSRecord("app.example.com.") {
+		t.Error("Expected HasHTTPSRecord to return false after removing all")
+	}
+}
+
+func TestCheckLocalRecordsHTTPS(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	proxy.recordStore.AddHTTPSRecord("*.svc.internal.", newTestHTTPS(1, ".", "h2"))
+	proxy.recordStore.AddRecord("plain.internal.", net.ParseIP("10.0.0.1"))
+
+	tests := []struct {
+		name            string
+		domain          string
+		expectResponse  bool
+		expectedAnswers int
+	}{
+		{name: "wildcard record", domain: "api.svc.internal.", expectResponse: true, expectedAnswers: 1},
+		{name: "NODATA for local A record", domain: "plain.internal.", expectResponse: true, expectedAnswers: 0},
+		{name: "unknown domain", domain: "example.com.", expectResponse: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := new(dns.Msg)
+			query.SetQuestion(tt.domain, dns.TypeHTTPS)
+
+			response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+			if (response != nil) != tt.expectResponse {
+				t.Fatalf("Expected response %v, got %v", tt.expectResponse, response)
+			}
+			if response == nil {
+				return
+			}
+			if response.Rcode != dns.RcodeSuccess {
+				t.Errorf("Expected NOERROR, got %s", dns.RcodeToString[response.Rcode])
+			}
+			if len(response.Answer) != tt.expectedAnswers {
+				t.Fatalf("Expected %d answers, got %d", tt.expectedAnswers, len(response.Answer))
+			}
+			if tt.expectedAnswers > 0 && response.Answer[0].Header().Name != tt.domain {
+				t.Errorf("Expected answer name %s, got %s", tt.domain, response.Answer[0].Header().Name)
+			}
+		})
+	}
+}
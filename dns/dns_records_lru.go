@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"container/list"
+	"net"
+	"net/netip"
+)
+
+// WithMaxCapacity caps the total number of exact A and AAAA domains in the store
+// When the cap is exceeded the least recently used domain is evicted together
+// with its PTR records. Wildcard patterns and PTR records do not count.
+func WithMaxCapacity(n int) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.maxCapacity = n
+		s.lru = list.New()
+		s.lruIndex = make(map[string]*list.Element)
+	}
+}
+
+// lruEnabled reports whether the store tracks recency for capacity eviction
+func (s *DNSRecordStore) lruEnabled() bool {
+	return s.maxCapacity > 0
+}
+
+// lruTouch marks domain as most recently used
+// The caller must hold s.mu for reading or writing
+func (s *DNSRecordStore) lruTouch(domain string) {
+	if !s.lruEnabled() {
+		return
+	}
+
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+
+	if elem, ok := s.lruIndex[domain]; ok {
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.lruIndex[domain] = s.lru.PushFront(domain)
+}
+
+// lruForgetIfGoneLocked stops tracking domain once it has no exact A or AAAA records
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) lruForgetIfGoneLocked(domain string) {
+	if !s.lruEnabled() {
+		return
+	}
+	if _, ok := s.aRecords[domain]; ok {
+		return
+	}
+	if _, ok := s.aaaaRecords[domain]; ok {
+		return
+	}
+
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+
+	if elem, ok := s.lruIndex[domain]; ok {
+		s.lru.Remove(elem)
+		delete(s.lruIndex, domain)
+	}
+}
+
+// enforceCapacityLocked evicts least recently used domains until the store is within capacity
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) enforceCapacityLocked() {
+	if !s.lruEnabled() {
+		return
+	}
+
+	for len(s.aRecords)+len(s.aaaaRecords) > s.maxCapacity {
+		s.lruMu.Lock()
+		elem := s.lru.Back()
+		if elem == nil {
+			s.lruMu.Unlock()
+			return
+		}
+		domain := elem.Value.(string)
+		s.lru.Remove(elem)
+		delete(s.lruIndex, domain)
+		s.lruMu.Unlock()
+
+		s.evictDomainLocked(domain)
+	}
+}
+
+// evictDomainLocked removes all exact A and AAAA records for domain and their PTR records
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) evictDomainLocked(domain string) {
+	var evicted []netip.Addr
+	evicted = append(evicted, s.aRecords[domain]...)
+	evicted = append(evicted, s.aaaaRecords[domain]...)
+	delete(s.aRecords, domain)
+	delete(s.aaaaRecords, domain)
+	s.forgetRecordStateLocked(domain)
+
+	for _, addr := range evicted {
+		s.removePTRLocked(addr, domain)
+		if s.onEvict != nil {
+			s.onEvict(domain, net.IP(addr.AsSlice()))
+		}
+	}
+}
+
+// resetLRULocked drops all recency tracking
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) resetLRULocked() {
+	if !s.lruEnabled() {
+		return
+	}
+
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+
+	s.lru.Init()
+	s.lruIndex = make(map[string]*list.Element)
+}
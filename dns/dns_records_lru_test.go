@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMaxCapacityEvictsOldest(t *testing.T) {
+	const capacity = 3
+	store := NewDNSRecordStore(WithMaxCapacity(capacity))
+
+	domains := []string{"a.example.com.", "b.example.com.", "c.example.com.", "d.example.com."}
+	for i, domain := range domains {
+		ip := net.IPv4(10, 0, 0, byte(i+1))
+		if _, err := store.AddRecord(domain, ip); err != nil {
+			t.Fatalf("Failed to add record for %s: %v", domain, err)
+		}
+	}
+
+	if ips := store.GetRecords("a.example.com.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected oldest domain to be evicted, got %v", ips)
+	}
+	for _, domain := range domains[1:] {
+		if ips := store.GetRecords(domain, RecordTypeA); len(ips) != 1 {
+			t.Errorf("Expected %s to remain, got %v", domain, ips)
+		}
+	}
+
+	// The PTR record of the evicted domain is removed too
+	if store.HasPTRRecordForIP(net.ParseIP("10.0.0.1")) {
+		t.Error("Expected PTR record of evicted domain to be removed")
+	}
+	if !store.HasPTRRecordForIP(net.ParseIP("10.0.0.4")) {
+		t.Error("Expected PTR record of remaining domain to exist")
+	}
+}
+
+func TestMaxCapacityGetRecordsRefreshes(t *testing.T) {
+	var evicted []string
+	store := NewDNSRecordStore(
+		WithMaxCapacity(2),
+		WithEvictionCallback(func(domain string, ip net.IP) {
+			evicted = append(evicted, domain)
+		}),
+	)
+
+	store.AddRecord("a.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("b.example.com.", net.ParseIP("10.0.0.2"))
+
+	// Touch a so that b becomes the least recently used
+	store.GetRecords("a.example.com.", RecordTypeA)
+	store.AddRecord("c.example.com.", net.ParseIP("10.0.0.3"))
+
+	if ips := store.GetRecords("a.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected recently used domain to remain, got %v", ips)
+	}
+	if ips := store.GetRecords("b.example.com.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected least recently used domain to be evicted, got %v", ips)
+	}
+	if len(evicted) != 1 || evicted[0] != "b.example.com." {
+		t.Errorf("Expected eviction callback for b.example.com., got %v", evicted)
+	}
+}
+
+func TestMaxCapacityIgnoresWildcards(t *testing.T) {
+	store := NewDNSRecordStore(WithMaxCapacity(1))
+
+	store.AddRecord("*.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("*.example.org.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("a.example.net.", net.ParseIP("10.0.0.3"))
+
+	if ips := store.GetRecords("host.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected wildcard to remain, got %v", ips)
+	}
+	if ips := store.GetRecords("a.example.net.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected exact record to remain, got %v", ips)
+	}
+
+	// A removed domain no longer takes a slot in the LRU
+	store.RemoveRecord("a.example.net.", nil)
+	store.AddRecord("b.example.net.", net.ParseIP("10.0.0.4"))
+	store.AddRecord("c.example.net.", net.ParseIP("10.0.0.5"))
+	if ips := store.GetRecords("b.example.net.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected b.example.net. to be evicted, got %v", ips)
+	}
+	if ips := store.GetRecords("c.example.net.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected c.example.net. to remain, got %v", ips)
+	}
+}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidNAPTR is returned when a NAPTR record is malformed
+var ErrInvalidNAPTR = errors.New("invalid NAPTR record")
+
+// NAPTRRecord is a naming authority pointer record, matching the dns.NAPTR fields
+type NAPTRRecord struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// validate checks that the regexp is a delimited POSIX ERE substitution
+// ("!pattern!replacement!flags") and that it is not combined with a replacement
+func (r NAPTRRecord) validate() error {
+	if r.Regexp == "" {
+		return nil
+	}
+
+	if r.Replacement != "" && r.Replacement != "." {
+		return fmt.Errorf("%w: regexp and replacement are mutually exclusive", ErrInvalidNAPTR)
+	}
+
+	delim := r.Regexp[:1]
+	parts := strings.Split(r.Regexp[1:], delim)
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: regexp %q is not of the form %spattern%sreplacement%sflags", ErrInvalidNAPTR, r.Regexp, delim, delim, delim)
+	}
+
+	if _, err := regexp.CompilePOSIX(parts[0]); err != nil {
+		return fmt.Errorf("%w: regexp %q: %w", ErrInvalidNAPTR, r.Regexp, err)
+	}
+
+	return nil
+}
+
+// AddNAPTRRecord adds a NAPTR record for a domain
+// domain can contain wildcards: * (0+ chars) and ? (exactly 1 char)
+func (s *DNSRecordStore) AddNAPTRRecord(domain string, rec NAPTRRecord) error {
+	if err := rec.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	for _, existing := range s.naptrRecords[domain] {
+		if existing == rec {
+			return nil
+		}
+	}
+	s.naptrRecords[domain] = append(s.naptrRecords[domain], rec)
+
+	return nil
+}
+
+// GetNAPTRRecords returns the NAPTR records for a domain sorted by order then preference
+// First checks for an exact match, then checks wildcard patterns
+func (s *DNSRecordStore) GetNAPTRRecords(domain string) []NAPTRRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	var records []NAPTRRecord
+	if exact, ok := s.naptrRecords[domain]; ok {
+		// Copy to prevent external modifications
+		records = append(records, exact...)
+	} else {
+		// Check wildcard patterns
+		for pattern, patternRecords := range s.naptrRecords {
+			if strings.ContainsAny(pattern, "*?") && matchWildcard(pattern, domain) {
+				records = append(records, patternRecords...)
+			}
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Order != records[j].Order {
+			return records[i].Order < records[j].Order
+		}
+		return records[i].Preference < records[j].Preference
+	})
+
+	return records
+}
+
+// RemoveNAPTRRecord removes a NAPTR record from a domain
+// If rec is nil, removes all NAPTR records for the domain
+func (s *DNSRecordStore) RemoveNAPTRRecord(domain string, rec *NAPTRRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	if rec == nil {
+		delete(s.naptrRecords, domain)
+		return
+	}
+
+	records, ok := s.naptrRecords[domain]
+	if !ok {
+		return
+	}
+
+	remaining := make([]NAPTRRecord, 0, len(records))
+	for _, existing := range records {
+		if existing != *rec {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(s.naptrRecords, domain)
+	} else {
+		s.naptrRecords[domain] = remaining
+	}
+}
+
+// HasNAPTRRecord checks if a domain has any NAPTR records, including via wildcard patterns
+func (s *DNSRecordStore) HasNAPTRRecord(domain string) bool {
+	return len(s.GetNAPTRRecords(domain)) > 0
+}
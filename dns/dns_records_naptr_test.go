@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNAPTRRecords(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	sip := NAPTRRecord{Order: 100, Preference: 10, Flags: "u", Service: "E2U+sip", Regexp: "!^.*$!sip:info@corp.internal!"}
+	udp := NAPTRRecord{Order: 50, Preference: 20, Flags: "s", Service: "SIP+D2U", Replacement: "_sip._udp.corp.internal."}
+	tcp := NAPTRRecord{Order: 50, Preference: 10, Flags: "s", Service: "SIP+D2T", Replacement: "_sip._tcp.corp.internal."}
+
+	for _, rec := range []NAPTRRecord{sip, udp, tcp, sip} {
+		if err := store.AddNAPTRRecord("corp.internal", rec); err != nil {
+			t.Fatalf("Failed to add NAPTR record: %v", err)
+		}
+	}
+
+	// Sorted by order then preference, duplicates ignored
+	records := store.GetNAPTRRecords("CORP.internal.")
+	if len(records) != 3 || records[0] != tcp || records[1] != udp || records[2] != sip {
+		t.Errorf("Expected NAPTR records sorted [tcp udp sip], got %v", records)
+	}
+
+	store.RemoveNAPTRRecord("corp.internal.", &udp)
+	if records := store.GetNAPTRRecords("corp.internal."); len(records) != 2 {
+		t.Errorf("Expected 2 NAPTR records after removal, got %v", records)
+	}
+
+	store.RemoveNAPTRRecord("corp.internal.", nil)
+	if store.HasNAPTRRecord("corp.internal.") {
+		t.Error("Expected HasNAPTRRecord to return false after removing all")
+	}
+}
+
+func TestNAPTRRecordValidation(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	tests := []struct {
+		name string
+		rec  NAPTRRecord
+	}{
+		{name: "invalid pattern", rec: NAPTRRecord{Regexp: "!^(.*$!sip:\\1!"}},
+		{name: "missing delimiters", rec: NAPTRRecord{Regexp: "!^.*$"}},
+		{name: "regexp with replacement", rec: NAPTRRecord{Regexp: "!^.*$!sip:a@b!", Replacement: "x.example."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.AddNAPTRRecord("corp.internal.", tt.rec); !errors.Is(err, ErrInvalidNAPTR) {
+				t.Errorf("Expected ErrInvalidNAPTR, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckLocalRecordsNAPTR(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	proxy.recordStore.AddNAPTRRecord("*.e164.corp.internal.", NAPTRRecord{Order: 20, Preference: 10, Flags: "u", Service: "E2U+sip", Regexp: "!^.*$!sip:b@corp.internal!"})
+	proxy.recordStore.AddNAPTRRecord("*.e164.corp.internal.", NAPTRRecord{Order: 10, Preference: 10, Flags: "u", Service: "E2U+sip", Regexp: "!^.*$!sip:a@corp.internal!"})
+
+	query := new(dns.Msg)
+	query.SetQuestion("4.3.2.1.e164.corp.internal.", dns.TypeNAPTR)
+
+	response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 2 {
+		t.Fatalf("Expected 2 NAPTR answers, got %v", response)
+	}
+
+	first, ok := response.Answer[0].(*dns.NAPTR)
+	if !ok || first.Order != 10 {
+		t.Errorf("Expected lowest order NAPTR first, got %v", response.Answer[0])
+	}
+}
@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+)
+
+// maxOverlapCandidates bounds the domains generated from one pattern when looking
+// for an overlap, so patterns with many wildcards stay cheap to check
+const maxOverlapCandidates = 256
+
+// WildcardOverlap is a pair of wildcard patterns that both match ExampleDomain.
+// Queries for such names get the addresses of both patterns.
+type WildcardOverlap struct {
+	PatternA      string `json:"patternA"`
+	PatternB      string `json:"patternB"`
+	ExampleDomain string `json:"exampleDomain"` // a domain matched by both patterns
+}
+
+// DetectWildcardOverlaps returns every pair of A or AAAA wildcard patterns, depending
+// on recordType, that match a common domain. Domains are generated from each pattern
+// by filling its wildcards with the literal labels of both patterns, so the check can
+// miss overlaps that only show up for other names. Pairs are sorted by pattern and the
+// result is empty when no patterns overlap.
+func (s *DNSRecordStore) DetectWildcardOverlaps(recordType RecordType) []WildcardOverlap {
+	patterns := make([]string, 0)
+	for pattern, ips := range s.GetWildcardPatternsByType(recordType) {
+		if len(ips) > 0 {
+			patterns = append(patterns, pattern)
+		}
+	}
+	slices.Sort(patterns)
+
+	overlaps := make([]WildcardOverlap, 0)
+	for i, a := range patterns {
+		for _, b := range patterns[i+1:] {
+			if example, ok := wildcardOverlap(a, b); ok {
+				overlaps = append(overlaps, WildcardOverlap{PatternA: a, PatternB: b, ExampleDomain: example})
+			}
+		}
+	}
+	return overlaps
+}
+
+// DetectWildcardOverlaps returns the overlapping wildcard patterns, see
+// DNSRecordStore.DetectWildcardOverlaps
+func (s *ShardedDNSRecordStore) DetectWildcardOverlaps(recordType RecordType) []WildcardOverlap {
+	return s.wildcards.DetectWildcardOverlaps(recordType)
+}
+
+// wildcardOverlap returns a domain matched by both a and b
+func wildcardOverlap(a, b string) (string, bool) {
+	fills := overlapFills(a, b)
+	for _, pair := range [][2]string{{a, b}, {b, a}} {
+		for _, domain := range expandWildcards(pair[0], fills) {
+			if matchWildcard(pair[1], domain) {
+				return domain, true
+			}
+		}
+	}
+	return "", false
+}
+
+// overlapFills returns the strings substituted for * when generating domains: a
+// placeholder label followed by the literal labels of the patterns
+func overlapFills(patterns ...string) []string {
+	fills := []string{"a"}
+	for _, pattern := range patterns {
+		for _, label := range strings.Split(strings.TrimSuffix(pattern, "."), ".") {
+			if label != "" && !strings.ContainsAny(label, "*?") && !slices.Contains(fills, label) {
+				fills = append(fills, label)
+			}
+		}
+	}
+	return fills
+}
+
+// expandWildcards returns the domains made by replacing each * in pattern with every
+// combination of fills and each ? with a, up to maxOverlapCandidates of them
+func expandWildcards(pattern string, fills []string) []string {
+	domains := []string{""}
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			next := make([]string, 0, len(domains)*len(fills))
+			for _, domain := range domains {
+				for _, fill := range fills {
+					if len(next) == maxOverlapCandidates {
+						break
+					}
+					next = append(next, domain+fill)
+				}
+			}
+			domains = next
+		case '?':
+			for i := range domains {
+				domains[i] += "a"
+			}
+		default:
+			for i := range domains {
+				domains[i] += string(c)
+			}
+		}
+	}
+	return domains
+}
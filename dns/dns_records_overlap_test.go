@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDetectWildcardOverlaps(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("*.prod.corp.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("*.*.corp.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("api.*.corp.", net.ParseIP("10.0.0.3"))
+	store.AddRecord("*.other.", net.ParseIP("10.0.0.4"))
+	store.AddRecord("*.prod.corp.", net.ParseIP("fd00::1"))
+
+	overlaps := store.DetectWildcardOverlaps(RecordTypeA)
+	want := []WildcardOverlap{
+		{PatternA: "*.*.corp.", PatternB: "*.prod.corp.", ExampleDomain: "a.prod.corp."},
+		{PatternA: "*.*.corp.", PatternB: "api.*.corp.", ExampleDomain: "api.a.corp."},
+		{PatternA: "*.prod.corp.", PatternB: "api.*.corp.", ExampleDomain: "api.prod.corp."},
+	}
+	if len(overlaps) != len(want) {
+		t.Fatalf("Expected %d overlaps, got %v", len(want), overlaps)
+	}
+	for i, overlap := range overlaps {
+		if overlap != want[i] {
+			t.Errorf("Overlap %d: expected %+v, got %+v", i, want[i], overlap)
+		}
+		if !matchWildcard(overlap.PatternA, overlap.ExampleDomain) || !matchWildcard(overlap.PatternB, overlap.ExampleDomain) {
+			t.Errorf("Example %s does not match both %s and %s", overlap.ExampleDomain, overlap.PatternA, overlap.PatternB)
+		}
+	}
+
+	if overlaps := store.DetectWildcardOverlaps(RecordTypeAAAA); overlaps == nil || len(overlaps) != 0 {
+		t.Errorf("Expected an empty slice for a single AAAA pattern, got %v", overlaps)
+	}
+}
+
+func TestDetectWildcardOverlapsNone(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("*.prod.corp.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("*.dev.corp.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("db?.corp.", net.ParseIP("10.0.0.3"))
+	store.AddRecord("app.corp.", net.ParseIP("10.0.0.4"))
+
+	if overlaps := store.DetectWildcardOverlaps(RecordTypeA); overlaps == nil || len(overlaps) != 0 {
+		t.Errorf("Expected no overlaps, got %v", overlaps)
+	}
+
+	sharded := NewShardedDNSRecordStore(4)
+	sharded.AddRecord("*.prod.corp.", net.ParseIP("10.0.0.1"))
+	sharded.AddRecord("*.*.corp.", net.ParseIP("10.0.0.2"))
+	if overlaps := sharded.DetectWildcardOverlaps(RecordTypeA); len(overlaps) != 1 {
+		t.Errorf("Expected the sharded store to report one overlap, got %v", overlaps)
+	}
+}
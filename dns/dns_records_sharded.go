@@ -0,0 +1,288 @@
+package dns
+
+import (
+	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultShardCount is the number of shards used when NewShardedDNSRecordStore is given zero
+const defaultShardCount = 16
+
+// RecordStore is the set of record store operations used by DNSProxy
+// Both DNSRecordStore and ShardedDNSRecordStore implement it
+type RecordStore interface {
+	AddRecord(domain string, ip net.IP) (bool, error)
+	RemoveRecord(domain string, ip net.IP)
+	GetRecords(domain string, recordType RecordType) []net.IP
+	HasRecord(domain string, recordType RecordType) bool
+	GetAllPTRRecords(reverseDomain string) ([]string, bool)
+	GetAllDomains() []string
+	GetDomainsByIP(ip net.IP) []string
+	AddCAARecord(domain string, rec CAARecord) error
+	RemoveCAARecord(domain string, rec *CAARecord)
+	GetCAARecords(domain string) []CAARecord
+	AddHTTPSRecord(domain string, rec dns.HTTPS) error
+	RemoveHTTPSRecord(domain string, rec *dns.HTTPS)
+	GetHTTPSRecords(domain string) []HTTPSRecord
+	AddNAPTRRecord(domain string, rec NAPTRRecord) error
+	RemoveNAPTRRecord(domain string, rec *NAPTRRecord)
+	GetNAPTRRecords(domain string) []NAPTRRecord
+	AddSRVRecord(domain string, rec SRVRecord) error
+	RemoveSRVRecord(domain string, rec *SRVRecord)
+	GetSRVRecords(domain string) []SRVRecord
+	AddServicePTRRecord(domain, target string) error
+	RemoveServicePTRRecord(domain, target string)
+	GetServicePTRRecords(domain string) []string
+	AddTXTRecord(domain string, txt []string) error
+	RemoveTXTRecords(domain string)
+	GetTXTRecords(domain string) [][]string
+	AddNXDOMAIN(domain string, ttl time.Duration)
+	IsNXDOMAIN(domain string) bool
+	GetTypeBitmap(domain string) []uint16
+	DetectWildcardOverlaps(recordType RecordType) []WildcardOverlap
+	TTL() uint32
+	Clear()
+}
+
+var (
+	_ RecordStore = (*DNSRecordStore)(nil)
+	_ RecordStore = (*ShardedDNSRecordStore)(nil)
+)
+
+// ShardedDNSRecordStore spreads exact-match records over several DNSRecordStores,
+// each with its own lock, to reduce lock contention under high query rates.
+// Records are routed by an FNV-1a hash of the domain. Wildcard patterns can match
+// any name so they live in a separate store consulted after the exact shard.
+// Options such as WithMaxCapacity apply to each shard individually.
+type ShardedDNSRecordStore struct {
+	shards    []*DNSRecordStore
+	wildcards *DNSRecordStore
+}
+
+// NewShardedDNSRecordStore creates a store with numShards shards, 16 if numShards is zero or less
+func NewShardedDNSRecordStore(numShards int, opts ...DNSRecordStoreOption) *ShardedDNSRecordStore {
+	if numShards <= 0 {
+		numShards = defaultShardCount
+	}
+
+	s := &ShardedDNSRecordStore{
+		shards:    make([]*DNSRecordStore, numShards),
+		wildcards: NewDNSRecordStore(opts...),
+	}
+	for i := range s.shards {
+		s.shards[i] = NewDNSRecordStore(opts...)
+	}
+	return s
+}
+
+// shardFor returns the store responsible for domain
+func (s *ShardedDNSRecordStore) shardFor(domain string) *DNSRecordStore {
+	domain = strings.ToLower(dns.Fqdn(domain))
+	if strings.ContainsAny(domain, "*?") {
+		return s.wildcards
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// AddRecord adds a DNS record mapping (A or AAAA)
+// Returns true if the (domain, ip) pair is new and false if it was already present
+func (s *ShardedDNSRecordStore) AddRecord(domain string, ip net.IP) (bool, error) {
+	return s.shardFor(domain).AddRecord(domain, ip)
+}
+
+// RemoveRecord removes a specific DNS record mapping, or all records for domain if ip is nil
+func (s *ShardedDNSRecordStore) RemoveRecord(domain string, ip net.IP) {
+	s.shardFor(domain).RemoveRecord(domain, ip)
+}
+
+// GetRecords returns all IP addresses for a domain and record type
+// First checks for exact matches, then checks wildcard patterns
+func (s *ShardedDNSRecordStore) GetRecords(domain string, recordType RecordType) []net.IP {
+	if records := s.shardFor(domain).GetRecords(domain, recordType); len(records) > 0 {
+		return records
+	}
+	return s.wildcards.GetRecords(domain, recordType)
+}
+
+// HasRecord checks if a domain has any records of the specified type
+func (s *ShardedDNSRecordStore) HasRecord(domain string, recordType RecordType) bool {
+	return s.shardFor(domain).HasRecord(domain, recordType) || s.wildcards.HasRecord(domain, recordType)
+}
+
+// GetAllPTRRecords returns every domain name for a PTR record query
+// PTR records live in the shard of the domain they point to, so every shard is checked
+func (s *ShardedDNSRecordStore) GetAllPTRRecords(reverseDomain string) ([]string, bool) {
+	var domains []string
+	for _, shard := range s.shards {
+		if found, ok := shard.GetAllPTRRecords(reverseDomain); ok {
+			domains = append(domains, found...)
+		}
+	}
+	return domains, len(domains) > 0
+}
+
+// GetAllDomains returns every domain with at least one record across all shards, sorted
+func (s *ShardedDNSRecordStore) GetAllDomains() []string {
+	var domains []string
+	for _, shard := range s.shards {
+		domains = append(domains, shard.GetAllDomains()...)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// GetDomainsByIP returns every domain with a record for ip across all shards, sorted
+func (s *ShardedDNSRecordStore) GetDomainsByIP(ip net.IP) []string {
+	var domains []string
+	for _, shard := range s.shards {
+		domains = append(domains, shard.GetDomainsByIP(ip)...)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// AddCAARecord adds a CAA record for a domain
+func (s *ShardedDNSRecordStore) AddCAARecord(domain string, rec CAARecord) error {
+	return s.shardFor(domain).AddCAARecord(domain, rec)
+}
+
+// RemoveCAARecord removes a CAA record from a domain, or all of them if rec is nil
+func (s *ShardedDNSRecordStore) RemoveCAARecord(domain string, rec *CAARecord) {
+	s.shardFor(domain).RemoveCAARecord(domain, rec)
+}
+
+// GetCAARecords returns the CAA records for a domain
+func (s *ShardedDNSRecordStore) GetCAARecords(domain string) []CAARecord {
+	if records := s.shardFor(domain).GetCAARecords(domain); len(records) > 0 {
+		return records
+	}
+	return s.wildcards.GetCAARecords(domain)
+}
+
+// AddHTTPSRecord adds an HTTPS record for a domain
+func (s *ShardedDNSRecordStore) AddHTTPSRecord(domain string, rec dns.HTTPS) error {
+	return s.shardFor(domain).AddHTTPSRecord(domain, rec)
+}
+
+// RemoveHTTPSRecord removes an HTTPS record from a domain, or all of them if rec is nil
+func (s *ShardedDNSRecordStore) RemoveHTTPSRecord(domain string, rec *dns.HTTPS) {
+	s.shardFor(domain).RemoveHTTPSRecord(domain, rec)
+}
+
+// GetHTTPSRecords returns the HTTPS records for a domain
+func (s *ShardedDNSRecordStore) GetHTTPSRecords(domain string) []HTTPSRecord {
+	if records := s.shardFor(domain).GetHTTPSRecords(domain); len(records) > 0 {
+		return records
+	}
+	return s.wildcards.GetHTTPSRecords(domain)
+}
+
+// AddNAPTRRecord adds a NAPTR record for a domain
+func (s *ShardedDNSRecordStore) AddNAPTRRecord(domain string, rec NAPTRRecord) error {
+	return s.shardFor(domain).AddNAPTRRecord(domain, rec)
+}
+
+// RemoveNAPTRRecord removes a NAPTR record from a domain, or all of them if rec is nil
+func (s *ShardedDNSRecordStore) RemoveNAPTRRecord(domain string, rec *NAPTRRecord) {
+	s.shardFor(domain).RemoveNAPTRRecord(domain, rec)
+}
+
+// GetNAPTRRecords returns the NAPTR records for a domain sorted by order then preference
+func (s *ShardedDNSRecordStore) GetNAPTRRecords(domain string) []NAPTRRecord {
+	if records := s.shardFor(domain).GetNAPTRRecords(domain); len(records) > 0 {
+		return records
+	}
+	return s.wildcards.GetNAPTRRecords(domain)
+}
+
+// AddSRVRecord adds an SRV record for a domain
+func (s *ShardedDNSRecordStore) AddSRVRecord(domain string, rec SRVRecord) error {
+	return s.shardFor(domain).AddSRVRecord(domain, rec)
+}
+
+// RemoveSRVRecord removes an SRV record from a domain, or all of them if rec is nil
+func (s *ShardedDNSRecordStore) RemoveSRVRecord(domain string, rec *SRVRecord) {
+	s.shardFor(domain).RemoveSRVRecord(domain, rec)
+}
+
+// GetSRVRecords returns the SRV records for a domain sorted by priority then weight
+func (s *ShardedDNSRecordStore) GetSRVRecords(domain string) []SRVRecord {
+	if records := s.shardFor(domain).GetSRVRecords(domain); len(records) > 0 {
+		return records
+	}
+	return s.wildcards.GetSRVRecords(domain)
+}
+
+// AddServicePTRRecord adds a PTR record from a service name to a target name
+func (s *ShardedDNSRecordStore) AddServicePTRRecord(domain, target string) error {
+	return s.shardFor(domain).AddServicePTRRecord(domain, target)
+}
+
+// RemoveServicePTRRecord removes a PTR target from a name, or all of them if target is empty
+func (s *ShardedDNSRecordStore) RemoveServicePTRRecord(domain, target string) {
+	s.shardFor(domain).RemoveServicePTRRecord(domain, target)
+}
+
+// GetServicePTRRecords returns the PTR targets for a service name
+func (s *ShardedDNSRecordStore) GetServicePTRRecords(domain string) []string {
+	return s.shardFor(domain).GetServicePTRRecords(domain)
+}
+
+// AddTXTRecord adds a TXT record for a domain
+func (s *ShardedDNSRecordStore) AddTXTRecord(domain string, txt []string) error {
+	return s.shardFor(domain).AddTXTRecord(domain, txt)
+}
+
+// RemoveTXTRecords removes all TXT records for a domain
+func (s *ShardedDNSRecordStore) RemoveTXTRecords(domain string) {
+	s.shardFor(domain).RemoveTXTRecords(domain)
+}
+
+// GetTXTRecords returns the TXT records for a domain
+func (s *ShardedDNSRecordStore) GetTXTRecords(domain string) [][]string {
+	return s.shardFor(domain).GetTXTRecords(domain)
+}
+
+// AddNXDOMAIN caches that domain does not exist for ttl
+func (s *ShardedDNSRecordStore) AddNXDOMAIN(domain string, ttl time.Duration) {
+	s.shardFor(domain).AddNXDOMAIN(domain, ttl)
+}
+
+// IsNXDOMAIN reports whether domain has a cached NXDOMAIN that has not expired
+func (s *ShardedDNSRecordStore) IsNXDOMAIN(domain string) bool {
+	return s.shardFor(domain).IsNXDOMAIN(domain)
+}
+
+// TTL returns the TTL in seconds served for local records
+func (s *ShardedDNSRecordStore) TTL() uint32 {
+	return s.wildcards.TTL()
+}
+
+// Clear removes all records from every shard
+func (s *ShardedDNSRecordStore) Clear() {
+	for _, shard := range s.shards {
+		shard.Clear()
+	}
+	s.wildcards.Clear()
+}
+
+// ClearExactRecords removes the exact A, AAAA and PTR records of every shard, see
+// DNSRecordStore.ClearExactRecords
+func (s *ShardedDNSRecordStore) ClearExactRecords() {
+	for _, shard := range s.shards {
+		shard.ClearExactRecords()
+	}
+}
+
+// ClearWildcards removes every wildcard pattern, see DNSRecordStore.ClearWildcards
+func (s *ShardedDNSRecordStore) ClearWildcards() {
+	s.wildcards.ClearWildcards()
+}
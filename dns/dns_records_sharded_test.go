@@ -0,0 +1,100 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedDNSRecordStore(t *testing.T) {
+	store := NewShardedDNSRecordStore(0)
+	if len(store.shards) != defaultShardCount {
+		t.Fatalf("Expected %d shards, got %d", defaultShardCount, len(store.shards))
+	}
+
+	for i := 0; i < 64; i++ {
+		domain := fmt.Sprintf("host%d.example.com.", i)
+		if _, err := store.AddRecord(domain, net.IPv4(10, 0, 0, byte(i))); err != nil {
+			t.Fatalf("Failed to add record for %s: %v", domain, err)
+		}
+	}
+	if _, err := store.AddRecord("*.wild.example.com.", net.ParseIP("10.1.0.1")); err != nil {
+		t.Fatalf("Failed to add wildcard record: %v", err)
+	}
+
+	used := 0
+	for _, shard := range store.shards {
+		if len(shard.aRecords) > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("Expected records to be spread across shards, got %d shard(s) in use", used)
+	}
+
+	if ips := store.GetRecords("HOST7.example.com", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 7)) {
+		t.Errorf("Expected exact record, got %v", ips)
+	}
+	if ips := store.GetRecords("a.wild.example.com.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.1.0.1")) {
+		t.Errorf("Expected wildcard record, got %v", ips)
+	}
+	if !store.HasRecord("b.wild.example.com.", RecordTypeA) {
+		t.Error("Expected HasRecord to find wildcard record")
+	}
+
+	// The same IP pointed to by domains in different shards returns every PTR target
+	store.AddRecord("other.example.org.", net.IPv4(10, 0, 0, 7))
+	domains, ok := store.GetAllPTRRecords("7.0.0.10.in-addr.arpa.")
+	if !ok || len(domains) != 2 {
+		t.Errorf("Expected 2 PTR targets, got %v", domains)
+	}
+
+	store.RemoveRecord("host7.example.com.", nil)
+	if store.HasRecord("host7.example.com.", RecordTypeA) {
+		t.Error("Expected record to be removed")
+	}
+
+	store.AddNXDOMAIN("missing.example.com.", time.Minute)
+	if !store.IsNXDOMAIN("missing.example.com.") {
+		t.Error("Expected cached NXDOMAIN")
+	}
+
+	store.Clear()
+	if store.HasRecord("host1.example.com.", RecordTypeA) || store.HasRecord("a.wild.example.com.", RecordTypeA) {
+		t.Error("Expected Clear to remove all records")
+	}
+}
+
+func benchmarkConcurrentGetRecords(b *testing.B, store RecordStore) {
+	const goroutines = 16
+	const domains = 1024
+
+	names := make([]string, domains)
+	for i := range names {
+		names[i] = fmt.Sprintf("host%d.example.com.", i)
+		store.AddRecord(names[i], net.IPv4(10, 0, byte(i>>8), byte(i)))
+	}
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < b.N; i += goroutines {
+				store.GetRecords(names[i%domains], RecordTypeA)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func BenchmarkConcurrentGetRecordsSingle(b *testing.B) {
+	benchmarkConcurrentGetRecords(b, NewDNSRecordStore())
+}
+
+func BenchmarkConcurrentGetRecordsSharded(b *testing.B) {
+	benchmarkConcurrentGetRecords(b, NewShardedDNSRecordStore(0))
+}
@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SRVRecord is a service locator record, matching the dns.SRV fields
+type SRVRecord struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// AddSRVRecord adds an SRV record for a domain such as "_http._tcp.example.com."
+// domain can contain wildcards: * (0+ chars) and ? (exactly 1 char)
+func (s *DNSRecordStore) AddSRVRecord(domain string, rec SRVRecord) error {
+	if strings.Trim(rec.Target, ".") == "" {
+		return fmt.Errorf("SRV record for %s has an empty target", domain)
+	}
+	rec.Target = strings.ToLower(dns.Fqdn(rec.Target))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addSRVLocked(domain, rec)
+	return nil
+}
+
+// addSRVLocked adds an SRV record unless it already exists
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) addSRVLocked(domain string, rec SRVRecord) {
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	if slices.Contains(s.srvRecords[domain], rec) {
+		return
+	}
+	s.srvRecords[domain] = append(s.srvRecords[domain], rec)
+	s.dropRRSIGsLocked(domain)
+}
+
+// GetSRVRecords returns the SRV records for a domain sorted by priority then weight
+// First checks for an exact match, then checks wildcard patterns
+func (s *DNSRecordStore) GetSRVRecords(domain string) []SRVRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	var records []SRVRecord
+	if exact, ok := s.srvRecords[domain]; ok {
+		// Copy to prevent external modifications
+		records = append(records, exact...)
+	} else {
+		// Check wildcard patterns
+		for pattern, patternRecords := range s.srvRecords {
+			if strings.ContainsAny(pattern, "*?") && matchWildcard(pattern, domain) {
+				records = append(records, patternRecords...)
+			}
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		return records[i].Weight > records[j].Weight
+	})
+
+	return records
+}
+
+// RemoveSRVRecord removes an SRV record from a domain
+// If rec is nil, removes all SRV records for the domain
+func (s *DNSRecordStore) RemoveSRVRecord(domain string, rec *SRVRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+	defer s.dropRRSIGsLocked(domain)
+
+	if rec == nil {
+		delete(s.srvRecords, domain)
+		return
+	}
+
+	target := *rec
+	target.Target = strings.ToLower(dns.Fqdn(target.Target))
+
+	remaining := slices.DeleteFunc(slices.Clone(s.srvRecords[domain]), func(existing SRVRecord) bool {
+		return existing == target
+	})
+	if len(remaining) == 0 {
+		delete(s.srvRecords, domain)
+	} else {
+		s.srvRecords[domain] = remaining
+	}
+}
+
+// HasSRVRecord checks if a domain has any SRV records, including via wildcard patterns
+func (s *DNSRecordStore) HasSRVRecord(domain string) bool {
+	return len(s.GetSRVRecords(domain)) > 0
+}
+
+// AddServicePTRRecord adds a PTR record from a name that is not a reverse DNS name,
+// such as a DNS-SD service type "_http._tcp.local.", to a target name
+func (s *DNSRecordStore) AddServicePTRRecord(domain, target string) error {
+	if IsReverseDNSDomain(domain) {
+		return fmt.Errorf("%s is a reverse DNS name, use AddPTRRecord", domain)
+	}
+	if strings.Trim(target, ".") == "" {
+		return fmt.Errorf("PTR record for %s has an empty target", domain)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addServicePTRLocked(domain, target)
+	return nil
+}
+
+// addServicePTRLocked adds a PTR target for a name unless it already exists
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) addServicePTRLocked(domain, target string) {
+	domain = strings.ToLower(dns.Fqdn(domain))
+	target = dns.Fqdn(target)
+
+	if slices.Contains(s.servicePTRRecords[domain], target) {
+		return
+	}
+	s.servicePTRRecords[domain] = append(s.servicePTRRecords[domain], target)
+}
+
+// GetServicePTRRecords returns the PTR targets for a name that is not a reverse DNS name
+func (s *DNSRecordStore) GetServicePTRRecords(domain string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain = strings.ToLower(dns.Fqdn(domain))
+	return slices.Clone(s.servicePTRRecords[domain])
+}
+
+// RemoveServicePTRRecord removes a PTR target from a name
+// If target is empty, removes all PTR records for the name
+func (s *DNSRecordStore) RemoveServicePTRRecord(domain, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeServicePTRLocked(domain, target)
+}
+
+// removeServicePTRLocked removes a PTR target from a name, or all of them if target is empty
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) removeServicePTRLocked(domain, target string) {
+	domain = strings.ToLower(dns.Fqdn(domain))
+	if target == "" {
+		delete(s.servicePTRRecords, domain)
+		return
+	}
+
+	target = dns.Fqdn(target)
+	remaining := slices.DeleteFunc(slices.Clone(s.servicePTRRecords[domain]), func(existing string) bool {
+		return strings.EqualFold(existing, target)
+	})
+	if len(remaining) == 0 {
+		delete(s.servicePTRRecords, domain)
+	} else {
+		s.servicePTRRecords[domain] = remaining
+	}
+}
@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSRVRecords(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	backup := SRVRecord{Priority: 20, Weight: 0, Port: 8080, Target: "backup.corp.internal"}
+	primary := SRVRecord{Priority: 10, Weight: 5, Port: 80, Target: "web.corp.internal."}
+	if err := store.AddSRVRecord("_http._tcp.corp.internal.", backup); err != nil {
+		t.Fatalf("Failed to add SRV record: %v", err)
+	}
+	store.AddSRVRecord("_HTTP._tcp.corp.internal", primary)
+	store.AddSRVRecord("_http._tcp.corp.internal.", primary)
+
+	records := store.GetSRVRecords("_http._tcp.corp.internal.")
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 SRV records, got %v", records)
+	}
+	if records[0].Target != "web.corp.internal." || records[1].Target != "backup.corp.internal." {
+		t.Errorf("Expected records sorted by priority, got %v", records)
+	}
+
+	if err := store.AddSRVRecord("_http._tcp.corp.internal.", SRVRecord{Port: 80}); err == nil {
+		t.Error("Expected error for SRV record without target")
+	}
+
+	store.RemoveSRVRecord("_http._tcp.corp.internal.", &backup)
+	if records := store.GetSRVRecords("_http._tcp.corp.internal."); len(records) != 1 {
+		t.Errorf("Expected 1 SRV record after removal, got %v", records)
+	}
+	store.RemoveSRVRecord("_http._tcp.corp.internal.", nil)
+	if store.HasSRVRecord("_http._tcp.corp.internal.") {
+		t.Error("Expected all SRV records to be removed")
+	}
+}
+
+func TestServicePTRRecords(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	store.AddServicePTRRecord("_http._tcp.local.", "Printer._http._tcp.local.")
+	store.AddServicePTRRecord("_http._tcp.local.", "NAS._http._tcp.local.")
+	store.AddServicePTRRecord("_http._tcp.local.", "NAS._http._tcp.local.")
+
+	if targets := store.GetServicePTRRecords("_HTTP._tcp.local."); len(targets) != 2 {
+		t.Errorf("Expected 2 PTR targets, got %v", targets)
+	}
+	if err := store.AddServicePTRRecord("1.0.0.10.in-addr.arpa.", "host.local."); err == nil {
+		t.Error("Expected error for reverse DNS name")
+	}
+
+	store.RemoveServicePTRRecord("_http._tcp.local.", "nas._http._tcp.local.")
+	if targets := store.GetServicePTRRecords("_http._tcp.local."); len(targets) != 1 || targets[0] != "Printer._http._tcp.local." {
+		t.Errorf("Expected only the printer to remain, got %v", targets)
+	}
+}
+
+func TestCheckLocalRecordsSRVAndServicePTR(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	proxy.recordStore.AddSRVRecord("_ipp._tcp.local.", SRVRecord{Priority: 0, Weight: 0, Port: 631, Target: "printer.local."})
+	proxy.recordStore.AddServicePTRRecord("_ipp._tcp.local.", "Office._ipp._tcp.local.")
+
+	query := new(dns.Msg)
+	query.SetQuestion("_ipp._tcp.local.", dns.TypeSRV)
+	response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 1 {
+		t.Fatalf("Expected 1 SRV answer, got %v", response)
+	}
+	if srv, ok := response.Answer[0].(*dns.SRV); !ok || srv.Port != 631 || srv.Target != "printer.local." {
+		t.Errorf("Unexpected SRV answer: %v", response.Answer[0])
+	}
+
+	query.SetQuestion("_ipp._tcp.local.", dns.TypePTR)
+	response = proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 1 {
+		t.Fatalf("Expected 1 PTR answer, got %v", response)
+	}
+	if ptr, ok := response.Answer[0].(*dns.PTR); !ok || ptr.Ptr != "Office._ipp._tcp.local." {
+		t.Errorf("Unexpected PTR answer: %v", response.Answer[0])
+	}
+}
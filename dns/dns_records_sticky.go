@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"hash/fnv"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// stickyKey identifies a client's assignment for one domain and record type
+type stickyKey struct {
+	domain     string
+	recordType RecordType
+	clientKey  string
+}
+
+// GetRecordSticky returns one address of domain for clientKey, typically the client's IP,
+// so that stateful protocols keep reaching the same backend. A client is first given an
+// address by rendezvous hashing over the addresses GetRecords would return, and keeps it
+// for as long as that address is served, even when other addresses are added. If the
+// address goes away the client is hashed again over the remaining ones. Assignments are
+// dropped by Clear. It returns false if the domain has no records of recordType.
+func (s *DNSRecordStore) GetRecordSticky(domain string, recordType RecordType, clientKey string) (net.IP, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+	key := stickyKey{domain: domain, recordType: recordType, clientKey: clientKey}
+
+	ips := s.getRecordsLocked(domain, recordType)
+
+	s.stickyMu.Lock()
+	defer s.stickyMu.Unlock()
+
+	if len(ips) == 0 {
+		delete(s.sticky, key)
+		return nil, false
+	}
+
+	if assigned, ok := s.sticky[key]; ok {
+		for _, ip := range ips {
+			if ip.String() == assigned {
+				return ip, true
+			}
+		}
+	}
+
+	ip := rendezvousPick(clientKey, ips)
+	s.sticky[key] = ip.String()
+	return ip, true
+}
+
+// rendezvousPick returns the address with the highest hash of clientKey and the address,
+// so each address only takes over the clients it wins when added
+func rendezvousPick(clientKey string, ips []net.IP) net.IP {
+	var best net.IP
+	var bestScore uint64
+	for _, ip := range ips {
+		h := fnv.New64a()
+		h.Write([]byte(clientKey))
+		h.Write([]byte{0})
+		h.Write([]byte(ip.String()))
+		// Ties go to the lower address so the pick does not depend on the order of ips
+		if score := h.Sum64(); best == nil || score > bestScore || score == bestScore && ip.String() < best.String() {
+			best, bestScore = ip, score
+		}
+	}
+	return best
+}
+
+// resetStickyLocked drops all sticky assignments
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) resetStickyLocked() {
+	s.stickyMu.Lock()
+	defer s.stickyMu.Unlock()
+
+	s.sticky = make(map[stickyKey]string)
+}
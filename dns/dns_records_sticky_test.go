@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestGetRecordStickyStableAfterAddingBackend(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.2"))
+
+	assigned := make(map[string]string)
+	backends := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		client := fmt.Sprintf("192.168.1.%d", i)
+		ip, ok := store.GetRecordSticky("app.example.com.", RecordTypeA, client)
+		if !ok {
+			t.Fatalf("Expected an address for %s", client)
+		}
+		assigned[client] = ip.String()
+		backends[ip.String()]++
+	}
+	if len(backends) != 2 {
+		t.Errorf("Expected clients spread over both backends, got %v", backends)
+	}
+
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.3"))
+
+	for client, want := range assigned {
+		for i := 0; i < 3; i++ {
+			ip, _ := store.GetRecordSticky("APP.example.com", RecordTypeA, client)
+			if ip.String() != want {
+				t.Fatalf("Expected %s to stay on %s after adding a backend, got %s", client, want, ip)
+			}
+		}
+	}
+
+	// New clients can land on the new backend
+	onNew := false
+	for i := 0; i < 100 && !onNew; i++ {
+		ip, _ := store.GetRecordSticky("app.example.com.", RecordTypeA, fmt.Sprintf("172.16.0.%d", i))
+		onNew = ip.Equal(net.ParseIP("10.0.0.3"))
+	}
+	if !onNew {
+		t.Error("Expected some new clients to be assigned the new backend")
+	}
+}
+
+func TestGetRecordStickyRehashesOnRemoval(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("app.example.com.", net.ParseIP("2001:db8::1"))
+	store.AddRecord("app.example.com.", net.ParseIP("2001:db8::2"))
+
+	first, _ := store.GetRecordSticky("app.example.com.", RecordTypeAAAA, "client")
+	store.RemoveRecord("app.example.com.", first)
+
+	second, ok := store.GetRecordSticky("app.example.com.", RecordTypeAAAA, "client")
+	if !ok || second.Equal(first) {
+		t.Fatalf("Expected the client to move off the removed address, got %v, %v", second, ok)
+	}
+
+	// Adding the old address back does not move the client again
+	store.AddRecord("app.example.com.", first)
+	if ip, _ := store.GetRecordSticky("app.example.com.", RecordTypeAAAA, "client"); !ip.Equal(second) {
+		t.Errorf("Expected the client to stay on %s, got %s", second, ip)
+	}
+}
+
+func TestGetRecordStickyClear(t *testing.T) {
+	store := NewDNSRecordStore()
+	if _, ok := store.GetRecordSticky("app.example.com.", RecordTypeA, "client"); ok {
+		t.Error("Expected no address for a missing domain")
+	}
+
+	store.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+	store.GetRecordSticky("app.example.com.", RecordTypeA, "client")
+	store.Clear()
+
+	if len(store.sticky) != 0 {
+		t.Errorf("Expected Clear to drop sticky assignments, got %v", store.sticky)
+	}
+	if _, ok := store.GetRecordSticky("app.example.com.", RecordTypeA, "client"); ok {
+		t.Error("Expected no address after Clear")
+	}
+}
+
+func TestGetRecordStickyWildcard(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("*.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("*.example.com.", net.ParseIP("10.0.0.2"))
+
+	want, ok := store.GetRecordSticky("host.example.com.", RecordTypeA, "client")
+	if !ok {
+		t.Fatal("Expected an address from the wildcard")
+	}
+	for i := 0; i < 10; i++ {
+		if ip, _ := store.GetRecordSticky("host.example.com.", RecordTypeA, "client"); !ip.Equal(want) {
+			t.Fatalf("Expected %s every time, got %s", want, ip)
+		}
+	}
+}
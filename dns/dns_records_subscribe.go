@@ -0,0 +1,181 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+// subscriberTimeout bounds how long a change waits for each subscriber
+const subscriberTimeout = 5 * time.Second
+
+// RecordEventType says whether a RecordEvent is for an added or a removed record
+type RecordEventType int
+
+const (
+	// RecordAdded is sent when AddRecord or AddAddrRecord stores a new record
+	RecordAdded RecordEventType = iota
+	// RecordRemoved is sent for each record RemoveRecord removes
+	RecordRemoved
+)
+
+// String returns "added" or "removed"
+func (t RecordEventType) String() string {
+	if t == RecordRemoved {
+		return "removed"
+	}
+	return "added"
+}
+
+// RecordEvent is an A or AAAA record change passed to subscribers
+type RecordEvent struct {
+	Type       RecordEventType
+	Domain     string // lowercase FQDN or wildcard pattern
+	IP         net.IP
+	RecordType RecordType
+}
+
+// CancelFunc removes the subscriber it was returned for
+type CancelFunc func()
+
+// recordSubscriber is a function registered with Subscribe
+type recordSubscriber struct {
+	id uint64
+	fn func(RecordEvent)
+}
+
+// Subscribe calls fn for every A and AAAA record added with AddRecord or AddAddrRecord
+// and removed with RemoveRecord, or changed by a committed DNSTransaction, once the
+// change is made and the store lock released.
+// Subscribers are called one at a time in name order and the change returns once all
+// have run. A panic in fn is recovered and logged, and a subscriber taking longer than
+// 5 seconds is no longer waited for. Subscribing with a name already in use replaces
+// the earlier subscriber. The returned CancelFunc removes the subscriber.
+func (s *DNSRecordStore) Subscribe(name string, fn func(RecordEvent)) CancelFunc {
+	s.subscriberMu.Lock()
+	defer s.subscriberMu.Unlock()
+
+	if s.subscribers == nil {
+		s.subscribers = make(map[string]recordSubscriber)
+	}
+	s.subscriberSeq++
+	id := s.subscriberSeq
+	s.subscribers[name] = recordSubscriber{id: id, fn: fn}
+
+	return func() {
+		s.subscriberMu.Lock()
+		defer s.subscriberMu.Unlock()
+
+		// A later Subscribe with the same name is left alone
+		if sub, ok := s.subscribers[name]; ok && sub.id == id {
+			delete(s.subscribers, name)
+		}
+	}
+}
+
+// hasSubscribers reports whether any subscriber is registered
+func (s *DNSRecordStore) hasSubscribers() bool {
+	s.subscriberMu.RLock()
+	defer s.subscriberMu.RUnlock()
+
+	return len(s.subscribers) > 0
+}
+
+// publish calls every subscriber with each of events
+// The caller must not hold s.mu
+func (s *DNSRecordStore) publish(events ...RecordEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	s.subscriberMu.RLock()
+	names := make([]string, 0, len(s.subscribers))
+	for name := range s.subscribers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	subscribers := make([]recordSubscriber, len(names))
+	for i, name := range names {
+		subscribers[i] = s.subscribers[name]
+	}
+	s.subscriberMu.RUnlock()
+
+	for _, event := range events {
+		for i, sub := range subscribers {
+			notifySubscriber(names[i], sub.fn, event)
+		}
+	}
+}
+
+// notifySubscriber calls fn with event, recovering a panic and giving up waiting after
+// subscriberTimeout
+func notifySubscriber(name string, fn func(RecordEvent), event RecordEvent) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Record subscriber %s panicked on %s %s: %v", name, event.Domain, event.IP, r)
+			}
+		}()
+		fn(event)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(subscriberTimeout):
+		logger.Warn("Record subscriber %s did not return within %v", name, subscriberTimeout)
+	}
+}
+
+// addedEvent returns the event for a record of domain added for addr
+func addedEvent(domain string, addr netip.Addr) RecordEvent {
+	recordType := RecordTypeAAAA
+	if addr.Is4() {
+		recordType = RecordTypeA
+	}
+	return RecordEvent{
+		Type:       RecordAdded,
+		Domain:     strings.ToLower(dns.Fqdn(domain)),
+		IP:         net.IP(addr.AsSlice()),
+		RecordType: recordType,
+	}
+}
+
+// recordEventsLocked returns an event of type t for every A and AAAA record of domain,
+// exact or wildcard
+// The caller must hold s.mu
+func (s *DNSRecordStore) recordEventsLocked(domain string, t RecordEventType) []RecordEvent {
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	var events []RecordEvent
+	add := func(recordType RecordType, ips []net.IP) {
+		for _, ip := range ips {
+			events = append(events, RecordEvent{Type: t, Domain: domain, IP: ip, RecordType: recordType})
+		}
+	}
+	if strings.ContainsAny(domain, "*?") {
+		ips, _ := s.aWildcards.get(domain)
+		add(RecordTypeA, cloneIPs(ips))
+		ips, _ = s.aaaaWildcards.get(domain)
+		add(RecordTypeAAAA, cloneIPs(ips))
+	} else {
+		add(RecordTypeA, addrsToIPs(s.aRecords[domain]))
+		add(RecordTypeAAAA, addrsToIPs(s.aaaaRecords[domain]))
+	}
+	return events
+}
+
+// removedEvents returns the events of before that are not in after
+func removedEvents(before, after []RecordEvent) []RecordEvent {
+	return slices.DeleteFunc(before, func(event RecordEvent) bool {
+		return slices.ContainsFunc(after, func(kept RecordEvent) bool {
+			return kept.IP.Equal(event.IP)
+		})
+	})
+}
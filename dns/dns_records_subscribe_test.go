@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// eventStrings formats events as "type domain ip recordType" for comparison
+func eventStrings(events []RecordEvent) []string {
+	out := make([]string, len(events))
+	for i, e := range events {
+		out[i] = e.Type.String() + " " + e.Domain + " " + e.IP.String() + " " + e.RecordType.String()
+	}
+	return out
+}
+
+func TestSubscribe(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	var metrics, peers []RecordEvent
+	cancelMetrics := store.Subscribe("metrics", func(e RecordEvent) {
+		metrics = append(metrics, e)
+	})
+	store.Subscribe("peers", func(e RecordEvent) {
+		// The store lock is released before subscribers run
+		store.GetRecords(e.Domain, e.RecordType)
+		peers = append(peers, e)
+	})
+
+	store.AddRecord("App.Internal", net.ParseIP("10.0.0.1"))
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1")) // duplicate, no event
+	store.AddAddrRecord("app.internal.", netip.MustParseAddr("fd00::1"))
+	store.AddRecord("*.svc.internal.", net.ParseIP("10.0.1.1"))
+	store.RemoveRecord("app.internal.", nil)
+	store.RemoveRecord("missing.internal.", nil) // nothing removed, no event
+	store.RemoveRecord("*.svc.internal.", net.ParseIP("10.0.1.1"))
+
+	want := []string{
+		"added app.internal. 10.0.0.1 A",
+		"added app.internal. fd00::1 AAAA",
+		"added *.svc.internal. 10.0.1.1 A",
+		"removed app.internal. 10.0.0.1 A",
+		"removed app.internal. fd00::1 AAAA",
+		"removed *.svc.internal. 10.0.1.1 A",
+	}
+	if got := eventStrings(metrics); !slices.Equal(got, want) {
+		t.Errorf("metrics got %v, expected %v", got, want)
+	}
+	if got := eventStrings(peers); !slices.Equal(got, want) {
+		t.Errorf("peers got %v, expected %v", got, want)
+	}
+
+	cancelMetrics()
+	cancelMetrics() // cancelling twice is harmless
+	store.AddRecord("db.internal.", net.ParseIP("10.0.0.2"))
+	if len(metrics) != len(want) {
+		t.Errorf("Expected no events after cancel, got %v", eventStrings(metrics[len(want):]))
+	}
+	if len(peers) != len(want)+1 {
+		t.Errorf("Expected peers to keep receiving events, got %d", len(peers))
+	}
+}
+
+func TestSubscribePanicAndReplace(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	cancelOld := store.Subscribe("sub", func(RecordEvent) {
+		t.Error("Expected the replaced subscriber not to be called")
+	})
+	var calls int
+	store.Subscribe("sub", func(RecordEvent) { calls++ })
+	store.Subscribe("bad", func(RecordEvent) { panic("boom") })
+
+	// Cancelling the replaced subscriber leaves its successor in place
+	cancelOld()
+
+	if _, err := store.AddRecord("app.internal.", net.ParseIP("10.0.0.1")); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call after a panicking subscriber, got %d", calls)
+	}
+}
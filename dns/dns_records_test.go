@@ -1,168 +1,290 @@
 package dns
 
 import (
+	"encoding/json"
+	"errors"
+	"math/rand"
 	"net"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"testing/quick"
+	"time"
+	"unicode/utf8"
 )
 
+// wildcardMatchTests are the matchWildcard vectors, also used to seed FuzzMatchWildcard
+var wildcardMatchTests = []struct {
+	name     string
+	pattern  string
+	domain   string
+	expected bool
+}{
+	// Basic wildcard tests
+	{
+		name:     "*.autoco.internal matches host.autoco.internal",
+		pattern:  "*.autoco.internal.",
+		domain:   "host.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "*.autoco.internal matches longerhost.autoco.internal",
+		pattern:  "*.autoco.internal.",
+		domain:   "longerhost.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "*.autoco.internal matches sub.host.autoco.internal",
+		pattern:  "*.autoco.internal.",
+		domain:   "sub.host.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "*.autoco.internal does NOT match autoco.internal",
+		pattern:  "*.autoco.internal.",
+		domain:   "autoco.internal.",
+		expected: false,
+	},
+
+	// Question mark wildcard tests
+	{
+		name:     "host-0?.autoco.internal matches host-01.autoco.internal",
+		pattern:  "host-0?.autoco.internal.",
+		domain:   "host-01.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "host-0?.autoco.internal matches host-0a.autoco.internal",
+		pattern:  "host-0?.autoco.internal.",
+		domain:   "host-0a.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "host-0?.autoco.internal does NOT match host-0.autoco.internal",
+		pattern:  "host-0?.autoco.internal.",
+		domain:   "host-0.autoco.internal.",
+		expected: false,
+	},
+	{
+		name:     "host-0?.autoco.internal does NOT match host-012.autoco.internal",
+		pattern:  "host-0?.autoco.internal.",
+		domain:   "host-012.autoco.internal.",
+		expected: false,
+	},
+
+	// Combined wildcard tests
+	{
+		name:     "*.host-0?.autoco.internal matches sub.host-01.autoco.internal",
+		pattern:  "*.host-0?.autoco.internal.",
+		domain:   "sub.host-01.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "*.host-0?.autoco.internal matches prefix.host-0a.autoco.internal",
+		pattern:  "*.host-0?.autoco.internal.",
+		domain:   "prefix.host-0a.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "*.host-0?.autoco.internal does NOT match host-01.autoco.internal",
+		pattern:  "*.host-0?.autoco.internal.",
+		domain:   "host-01.autoco.internal.",
+		expected: false,
+	},
+
+	// Multiple asterisks
+	{
+		name:     "*.*. autoco.internal matches any.thing.autoco.internal",
+		pattern:  "*.*.autoco.internal.",
+		domain:   "any.thing.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "*.*.autoco.internal does NOT match single.autoco.internal",
+		pattern:  "*.*.autoco.internal.",
+		domain:   "single.autoco.internal.",
+		expected: false,
+	},
+
+	// Asterisk in middle
+	{
+		name:     "host-*.autoco.internal matches host-anything.autoco.internal",
+		pattern:  "host-*.autoco.internal.",
+		domain:   "host-anything.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "host-*.autoco.internal matches host-.autoco.internal (empty match)",
+		pattern:  "host-*.autoco.internal.",
+		domain:   "host-.autoco.internal.",
+		expected: true,
+	},
+
+	// Multiple question marks
+	{
+		name:     "host-??.autoco.internal matches host-01.autoco.internal",
+		pattern:  "host-??.autoco.internal.",
+		domain:   "host-01.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "host-??.autoco.internal does NOT match host-1.autoco.internal",
+		pattern:  "host-??.autoco.internal.",
+		domain:   "host-1.autoco.internal.",
+		expected: false,
+	},
+
+	// Exact match (no wildcards)
+	{
+		name:     "exact.autoco.internal matches exact.autoco.internal",
+		pattern:  "exact.autoco.internal.",
+		domain:   "exact.autoco.internal.",
+		expected: true,
+	},
+	{
+		name:     "exact.autoco.internal does NOT match other.autoco.internal",
+		pattern:  "exact.autoco.internal.",
+		domain:   "other.autoco.internal.",
+		expected: false,
+	},
+
+	// Edge cases
+	{
+		name:     "* matches anything",
+		pattern:  "*",
+		domain:   "anything.at.all.",
+		expected: true,
+	},
+	{
+		name:     "*.* matches multi.level.",
+		pattern:  "*.*",
+		domain:   "multi.level.",
+		expected: true,
+	},
+}
+
 func TestWildcardMatching(t *testing.T) {
-	tests := []struct {
-		name     string
-		pattern  string
-		domain   string
-		expected bool
-	}{
-		// Basic wildcard tests
-		{
-			name:     "*.autoco.internal matches host.autoco.internal",
-			pattern:  "*.autoco.internal.",
-			domain:   "host.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "*.autoco.internal matches longerhost.autoco.internal",
-			pattern:  "*.autoco.internal.",
-			domain:   "longerhost.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "*.autoco.internal matches sub.host.autoco.internal",
-			pattern:  "*.autoco.internal.",
-			domain:   "sub.host.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "*.autoco.internal does NOT match autoco.internal",
-			pattern:  "*.autoco.internal.",
-			domain:   "autoco.internal.",
-			expected: false,
-		},
+	for _, tt := range wildcardMatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := matchWildcard(tt.pattern, tt.domain)
+			if result != tt.expected {
+				t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.domain, result, tt.expected)
+			}
+		})
+	}
+}
 
-		// Question mark wildcard tests
-		{
-			name:     "host-0?.autoco.internal matches host-01.autoco.internal",
-			pattern:  "host-0?.autoco.internal.",
-			domain:   "host-01.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "host-0?.autoco.internal matches host-0a.autoco.internal",
-			pattern:  "host-0?.autoco.internal.",
-			domain:   "host-0a.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "host-0?.autoco.internal does NOT match host-0.autoco.internal",
-			pattern:  "host-0?.autoco.internal.",
-			domain:   "host-0.autoco.internal.",
-			expected: false,
-		},
-		{
-			name:     "host-0?.autoco.internal does NOT match host-012.autoco.internal",
-			pattern:  "host-0?.autoco.internal.",
-			domain:   "host-012.autoco.internal.",
-			expected: false,
-		},
+// wildcardRegexp converts a wildcard pattern to the regular expression it should match like
+// A leading "*." needs at least one character before the dot, any other * matches zero or more
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^(?s)")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if i == 0 && len(pattern) > 1 && pattern[1] == '.' {
+				expr.WriteString(".+")
+			} else {
+				expr.WriteString(".*")
+			}
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
 
-		// Combined wildcard tests
-		{
-			name:     "*.host-0?.autoco.internal matches sub.host-01.autoco.internal",
-			pattern:  "*.host-0?.autoco.internal.",
-			domain:   "sub.host-01.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "*.host-0?.autoco.internal matches prefix.host-0a.autoco.internal",
-			pattern:  "*.host-0?.autoco.internal.",
-			domain:   "prefix.host-0a.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "*.host-0?.autoco.internal does NOT match host-01.autoco.internal",
-			pattern:  "*.host-0?.autoco.internal.",
-			domain:   "host-01.autoco.internal.",
-			expected: false,
-		},
+// isASCII reports whether s has only single byte characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
 
-		// Multiple asterisks
-		{
-			name:     "*.*. autoco.internal matches any.thing.autoco.internal",
-			pattern:  "*.*.autoco.internal.",
-			domain:   "any.thing.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "*.*.autoco.internal does NOT match single.autoco.internal",
-			pattern:  "*.*.autoco.internal.",
-			domain:   "single.autoco.internal.",
-			expected: false,
-		},
+func FuzzMatchWildcard(f *testing.F) {
+	for _, tt := range wildcardMatchTests {
+		f.Add(tt.pattern, tt.domain)
+	}
 
-		// Asterisk in middle
-		{
-			name:     "host-*.autoco.internal matches host-anything.autoco.internal",
-			pattern:  "host-*.autoco.internal.",
-			domain:   "host-anything.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "host-*.autoco.internal matches host-.autoco.internal (empty match)",
-			pattern:  "host-*.autoco.internal.",
-			domain:   "host-.autoco.internal.",
-			expected: true,
-		},
+	f.Fuzz(func(t *testing.T, pattern, domain string) {
+		// The matcher backtracks once per *, keep inputs small enough to finish quickly
+		if len(pattern) > 64 || len(domain) > 128 || strings.Count(pattern, "*") > 4 {
+			t.Skip()
+		}
 
-		// Multiple question marks
-		{
-			name:     "host-??.autoco.internal matches host-01.autoco.internal",
-			pattern:  "host-??.autoco.internal.",
-			domain:   "host-01.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "host-??.autoco.internal does NOT match host-1.autoco.internal",
-			pattern:  "host-??.autoco.internal.",
-			domain:   "host-1.autoco.internal.",
-			expected: false,
-		},
+		got := matchWildcard(pattern, domain)
 
-		// Exact match (no wildcards)
-		{
-			name:     "exact.autoco.internal matches exact.autoco.internal",
-			pattern:  "exact.autoco.internal.",
-			domain:   "exact.autoco.internal.",
-			expected: true,
-		},
-		{
-			name:     "exact.autoco.internal does NOT match other.autoco.internal",
-			pattern:  "exact.autoco.internal.",
-			domain:   "other.autoco.internal.",
-			expected: false,
-		},
+		// The matcher works on bytes and the regexp on runes, so they only agree on ASCII
+		if !isASCII(pattern) || !isASCII(domain) {
+			return
+		}
+		if want := wildcardRegexp(pattern).MatchString(domain); got != want {
+			t.Errorf("matchWildcard(%q, %q) = %v, reference = %v", pattern, domain, got, want)
+		}
+	})
+}
 
-		// Edge cases
-		{
-			name:     "* matches anything",
-			pattern:  "*",
-			domain:   "anything.at.all.",
-			expected: true,
-		},
-		{
-			name:     "*.* matches multi.level.",
-			pattern:  "*.*",
-			domain:   "multi.level.",
-			expected: true,
-		},
-	}
+func FuzzAddRecord(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		".",
+		"...",
+		"example.com",
+		"EXAMPLE.com.",
+		"a..b.",
+		"host\x00.example.com",
+		strings.Repeat("a.", 130),
+		strings.Repeat("a", 64) + ".example.com",
+		"bücher.example.",
+		"日本.jp",
+	} {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+
+	f.Fuzz(func(t *testing.T, domain string, ipv4 bool) {
+		// Wildcard patterns are matched rather than looked up, see FuzzMatchWildcard
+		if strings.ContainsAny(domain, "*?") {
+			t.Skip()
+		}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := matchWildcard(tt.pattern, tt.domain)
-			if result != tt.expected {
-				t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.domain, result, tt.expected)
-			}
-		})
-	}
+		ip, recordType := net.ParseIP("10.0.0.1"), RecordTypeA
+		if !ipv4 {
+			ip, recordType = net.ParseIP("fd00::1"), RecordTypeAAAA
+		}
+
+		store := NewDNSRecordStore()
+		added, err := store.AddRecord(domain, ip)
+		if err != nil {
+			return
+		}
+		if !added {
+			t.Fatalf("AddRecord(%q) on an empty store reported a duplicate", domain)
+		}
+
+		fqdn := strings.ToLower(domain)
+		if !strings.HasSuffix(fqdn, ".") {
+			fqdn += "."
+		}
+		if ips := store.GetRecords(fqdn, recordType); !slices.ContainsFunc(ips, ip.Equal) {
+			t.Fatalf("AddRecord(%q) succeeded but GetRecords(%q) = %v", domain, fqdn, ips)
+		}
+
+		// The normalised form names the same record
+		added, err = store.AddRecord(fqdn, ip)
+		if err != nil || added {
+			t.Fatalf("Expected AddRecord(%q) after AddRecord(%q) to be a duplicate, got added=%v err=%v", fqdn, domain, added, err)
+		}
+	})
 }
 
 func TestDNSRecordStoreWildcard(t *testing.T) {
@@ -170,14 +292,14 @@ func TestDNSRecordStoreWildcard(t *testing.T) {
 
 	// Add wildcard records
 	wildcardIP := net.ParseIP("10.0.0.1")
-	err := store.AddRecord("*.autoco.internal", wildcardIP)
+	_, err := store.AddRecord("*.autoco.internal", wildcardIP)
 	if err != nil {
 		t.Fatalf("Failed to add wildcard record: %v", err)
 	}
 
 	// Add exact record
 	exactIP := net.ParseIP("10.0.0.2")
-	err = store.AddRecord("exact.autoco.internal", exactIP)
+	_, err = store.AddRecord("exact.autoco.internal", exactIP)
 	if err != nil {
 		t.Fatalf("Failed to add exact record: %v", err)
 	}
@@ -212,7 +334,7 @@ func TestDNSRecordStoreComplexWildcard(t *testing.T) {
 
 	// Add complex wildcard pattern
 	ip1 := net.ParseIP("10.0.0.1")
-	err := store.AddRecord("*.host-0?.autoco.internal", ip1)
+	_, err := store.AddRecord("*.host-0?.autoco.internal", ip1)
 	if err != nil {
 		t.Fatalf("Failed to add wildcard record: %v", err)
 	}
@@ -244,7 +366,7 @@ func TestDNSRecordStoreRemoveWildcard(t *testing.T) {
 
 	// Add wildcard record
 	ip := net.ParseIP("10.0.0.1")
-	err := store.AddRecord("*.autoco.internal", ip)
+	_, err := store.AddRecord("*.autoco.internal", ip)
 	if err != nil {
 		t.Fatalf("Failed to add wildcard record: %v", err)
 	}
@@ -273,18 +395,18 @@ func TestDNSRecordStoreMultipleWildcards(t *testing.T) {
 	ip2 := net.ParseIP("10.0.0.2")
 	ip3 := net.ParseIP("10.0.0.3")
 
-	err := store.AddRecord("*.prod.autoco.internal", ip1)
+	_, err := store.AddRecord("*.prod.autoco.internal", ip1)
 	if err != nil {
 		t.Fatalf("Failed to add first wildcard: %v", err)
 	}
 
-	err = store.AddRecord("*.dev.autoco.internal", ip2)
+	_, err = store.AddRecord("*.dev.autoco.internal", ip2)
 	if err != nil {
 		t.Fatalf("Failed to add second wildcard: %v", err)
 	}
 
 	// Add a broader wildcard that matches both
-	err = store.AddRecord("*.autoco.internal", ip3)
+	_, err = store.AddRecord("*.autoco.internal", ip3)
 	if err != nil {
 		t.Fatalf("Failed to add third wildcard: %v", err)
 	}
@@ -313,7 +435,7 @@ func TestDNSRecordStoreIPv6Wildcard(t *testing.T) {
 
 	// Add IPv6 wildcard record
 	ip := net.ParseIP("2001:db8::1")
-	err := store.AddRecord("*.autoco.internal", ip)
+	_, err := store.AddRecord("*.autoco.internal", ip)
 	if err != nil {
 		t.Fatalf("Failed to add IPv6 wildcard record: %v", err)
 	}
@@ -333,7 +455,7 @@ func TestHasRecordWildcard(t *testing.T) {
 
 	// Add wildcard record
 	ip := net.ParseIP("10.0.0.1")
-	err := store.AddRecord("*.autoco.internal", ip)
+	_, err := store.AddRecord("*.autoco.internal", ip)
 	if err != nil {
 		t.Fatalf("Failed to add wildcard record: %v", err)
 	}
@@ -354,7 +476,7 @@ func TestDNSRecordStoreCaseInsensitive(t *testing.T) {
 
 	// Add record with mixed case
 	ip := net.ParseIP("10.0.0.1")
-	err := store.AddRecord("MyHost.AutoCo.Internal", ip)
+	_, err := store.AddRecord("MyHost.AutoCo.Internal", ip)
 	if err != nil {
 		t.Fatalf("Failed to add mixed case record: %v", err)
 	}
@@ -379,7 +501,7 @@ func TestDNSRecordStoreCaseInsensitive(t *testing.T) {
 
 	// Test wildcard with mixed case
 	wildcardIP := net.ParseIP("10.0.0.2")
-	err = store.AddRecord("*.Example.Com", wildcardIP)
+	_, err = store.AddRecord("*.Example.Com", wildcardIP)
 	if err != nil {
 		t.Fatalf("Failed to add mixed case wildcard: %v", err)
 	}
@@ -447,6 +569,44 @@ func TestPTRRecordIPv4(t *testing.T) {
 	}
 }
 
+func TestPTRRecordByIP(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	ip := net.ParseIP("192.168.1.1")
+	ip6 := net.ParseIP("2001:db8::1")
+	domain := "host.example.com."
+	if err := store.AddPTRRecord(ip, domain); err != nil {
+		t.Fatalf("Failed to add PTR record: %v", err)
+	}
+	if err := store.AddPTRRecord(ip6, domain); err != nil {
+		t.Fatalf("Failed to add PTR record: %v", err)
+	}
+
+	for _, lookup := range []net.IP{ip, ip6} {
+		result, ok := store.GetPTRRecordByIP(lookup)
+		if !ok || result != domain {
+			t.Errorf("Expected GetPTRRecordByIP(%v) = %q, got %q, %v", lookup, domain, result, ok)
+		}
+		if !store.HasPTRRecordForIP(lookup) {
+			t.Errorf("Expected HasPTRRecordForIP(%v) to return true", lookup)
+		}
+
+		// The reverse DNS lookup should agree with the IP lookup
+		result, ok = store.GetPTRRecordByReverseDNS(IPToReverseDNS(lookup))
+		if !ok || result != domain {
+			t.Errorf("Expected GetPTRRecordByReverseDNS for %v = %q, got %q, %v", lookup, domain, result, ok)
+		}
+	}
+
+	other := net.ParseIP("192.168.1.2")
+	if _, ok := store.GetPTRRecordByIP(other); ok {
+		t.Error("Expected PTR record not to be found for different IP")
+	}
+	if store.HasPTRRecordForIP(other) {
+		t.Error("Expected HasPTRRecordForIP to return false for different IP")
+	}
+}
+
 func TestPTRRecordIPv6(t *testing.T) {
 	store := NewDNSRecordStore()
 
@@ -556,6 +716,76 @@ func TestIPToReverseDNS(t *testing.T) {
 	}
 }
 
+func TestIPStringToReverseDNS(t *testing.T) {
+	if got, err := IPStringToReverseDNS("192.168.1.1"); err != nil || got != "1.1.168.192.in-addr.arpa." {
+		t.Errorf("IPStringToReverseDNS(192.168.1.1) = %q, %v", got, err)
+	}
+	if got, err := IPStringToReverseDNS("::1"); err != nil || !strings.HasSuffix(got, ".ip6.arpa.") {
+		t.Errorf("IPStringToReverseDNS(::1) = %q, %v", got, err)
+	}
+	for _, ipStr := range []string{"", "not-an-ip", "192.168.1", "10.0.0.1/24"} {
+		if _, err := IPStringToReverseDNS(ipStr); !errors.Is(err, ErrInvalidIP) {
+			t.Errorf("IPStringToReverseDNS(%q) error = %v, want ErrInvalidIP", ipStr, err)
+		}
+	}
+}
+
+func TestParseAndAddRecord(t *testing.T) {
+	store := NewDNSRecordStore()
+	if err := store.ParseAndAddRecord("app.internal", "10.0.0.1"); err != nil {
+		t.Fatalf("ParseAndAddRecord failed: %v", err)
+	}
+	if err := store.ParseAndAddRecord("app.internal", "fd00::1"); err != nil {
+		t.Fatalf("ParseAndAddRecord failed: %v", err)
+	}
+	if ips := store.GetRecords("app.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected the A record, got %v", ips)
+	}
+	if ips := store.GetRecords("app.internal.", RecordTypeAAAA); len(ips) != 1 {
+		t.Errorf("Expected the AAAA record, got %v", ips)
+	}
+
+	if err := store.ParseAndAddRecord("bad.internal", "10.0.0.256"); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("Expected ErrInvalidIP, got %v", err)
+	}
+	if store.HasRecord("bad.internal.", RecordTypeA) {
+		t.Error("Expected nothing to be added for an invalid address")
+	}
+}
+
+func TestRecordStringVariants(t *testing.T) {
+	store := NewDNSRecordStore()
+	if err := store.AddRecordString("app.internal.", "10.0.0.1"); err != nil {
+		t.Fatalf("AddRecordString failed: %v", err)
+	}
+	if err := store.AddRecordString("app.internal.", "10.0.0.2"); err != nil {
+		t.Fatalf("AddRecordString failed: %v", err)
+	}
+	if err := store.AddRecordString("app.internal.", "nope"); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("Expected ErrInvalidIP from AddRecordString, got %v", err)
+	}
+
+	// An invalid address must not fall back to removing every record
+	store.RemoveRecordString("app.internal.", "nope")
+	if ips := store.GetRecords("app.internal.", RecordTypeA); len(ips) != 2 {
+		t.Errorf("Expected both records to survive an invalid removal, got %v", ips)
+	}
+	store.RemoveRecordString("app.internal.", "10.0.0.1")
+	if ips := store.GetRecords("app.internal.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Expected only 10.0.0.2 to remain, got %v", ips)
+	}
+
+	if err := store.AddPTRRecordString("10.0.0.9", "manual.internal."); err != nil {
+		t.Fatalf("AddPTRRecordString failed: %v", err)
+	}
+	if domains, ok := store.GetAllPTRRecords("9.0.0.10.in-addr.arpa."); !ok || len(domains) != 1 || domains[0] != "manual.internal." {
+		t.Errorf("Expected the PTR record, got %v", domains)
+	}
+	if err := store.AddPTRRecordString("", "manual.internal."); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("Expected ErrInvalidIP from AddPTRRecordString, got %v", err)
+	}
+}
+
 func TestReverseDNSToIP(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -603,19 +833,19 @@ func TestReverseDNSToIP(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := reverseDNSToIP(tt.reverseDNS)
+			result, err := ReverseDNSToIP(tt.reverseDNS)
 			if tt.shouldMatch {
-				if result == nil {
-					t.Errorf("reverseDNSToIP(%q) returned nil, expected IP", tt.reverseDNS)
+				if err != nil {
+					t.Errorf("ReverseDNSToIP(%q) returned error %v, expected IP", tt.reverseDNS, err)
 					return
 				}
 				expectedIP := net.ParseIP(tt.expectedIP)
 				if !result.Equal(expectedIP) {
-					t.Errorf("reverseDNSToIP(%q) = %v, want %v", tt.reverseDNS, result, expectedIP)
+					t.Errorf("ReverseDNSToIP(%q) = %v, want %v", tt.reverseDNS, result, expectedIP)
 				}
 			} else {
-				if result != nil {
-					t.Errorf("reverseDNSToIP(%q) = %v, expected nil", tt.reverseDNS, result)
+				if !errors.Is(err, ErrInvalidReverseDNS) {
+					t.Errorf("ReverseDNSToIP(%q) = %v, %v, expected ErrInvalidReverseDNS", tt.reverseDNS, result, err)
 				}
 			}
 		})
@@ -695,7 +925,7 @@ func TestAutomaticPTRRecordOnAdd(t *testing.T) {
 	// Add an A record - should automatically add PTR record
 	domain := "host.example.com."
 	ip := net.ParseIP("192.168.1.100")
-	err := store.AddRecord(domain, ip)
+	_, err := store.AddRecord(domain, ip)
 	if err != nil {
 		t.Fatalf("Failed to add A record: %v", err)
 	}
@@ -713,7 +943,7 @@ func TestAutomaticPTRRecordOnAdd(t *testing.T) {
 	// Add AAAA record - should also automatically add PTR record
 	domain6 := "ipv6host.example.com."
 	ip6 := net.ParseIP("2001:db8::1")
-	err = store.AddRecord(domain6, ip6)
+	_, err = store.AddRecord(domain6, ip6)
 	if err != nil {
 		t.Fatalf("Failed to add AAAA record: %v", err)
 	}
@@ -796,7 +1026,7 @@ func TestNoPTRForWildcardRecords(t *testing.T) {
 	// Add wildcard record - should NOT create PTR record
 	domain := "*.example.com."
 	ip := net.ParseIP("192.168.1.100")
-	err := store.AddRecord(domain, ip)
+	_, err := store.AddRecord(domain, ip)
 	if err != nil {
 		t.Fatalf("Failed to add wildcard record: %v", err)
 	}
@@ -814,7 +1044,7 @@ func TestNoPTRForWildcardRecords(t *testing.T) {
 	}
 }
 
-func TestPTRRecordOverwrite(t *testing.T) {
+func TestPTRRecordMultipleDomains(t *testing.T) {
 	store := NewDNSRecordStore()
 
 	// Add first domain with IP
@@ -832,17 +1062,25 @@ func TestPTRRecordOverwrite(t *testing.T) {
 		t.Errorf("Expected PTR to point to %q, got %q", domain1, result)
 	}
 
-	// Add second domain with same IP - should overwrite PTR
+	// Add second domain with same IP - should be appended, not overwrite
 	domain2 := "host2.example.com."
 	store.AddRecord(domain2, ip)
 
-	// Verify PTR now points to second domain (last one added)
-	result, ok = store.GetPTRRecord(reverseDomain)
+	// Adding the same domain again should not duplicate it
+	store.AddPTRRecord(ip, domain2)
+
+	all, ok := store.GetAllPTRRecords(reverseDomain)
 	if !ok {
-		t.Fatal("Expected PTR record to still exist")
+		t.Fatal("Expected PTR records to still exist")
 	}
-	if result != domain2 {
-		t.Errorf("Expected PTR to point to %q (overwritten), got %q", domain2, result)
+	if len(all) != 2 || all[0] != domain1 || all[1] != domain2 {
+		t.Errorf("Expected PTR records [%s %s], got %v", domain1, domain2, all)
+	}
+
+	// The single lookup returns the first domain added
+	result, _ = store.GetPTRRecord(reverseDomain)
+	if result != domain1 {
+		t.Errorf("Expected PTR to point to %q, got %q", domain1, result)
 	}
 
 	// Remove first domain - PTR should remain pointing to second domain
@@ -862,3 +1100,491 @@ func TestPTRRecordOverwrite(t *testing.T) {
 		t.Error("Expected PTR record to be removed after removing second domain")
 	}
 }
+
+func TestRemovePTRRecordTarget(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	ip := net.ParseIP("10.0.0.5")
+	store.AddPTRRecord(ip, "a.example.com.")
+	store.AddPTRRecord(ip, "b.example.com.")
+
+	store.RemovePTRRecordTarget(ip, "A.example.com")
+
+	all, ok := store.GetAllPTRRecords(IPToReverseDNS(ip))
+	if !ok || len(all) != 1 || all[0] != "b.example.com." {
+		t.Errorf("Expected PTR records [b.example.com.], got %v", all)
+	}
+
+	store.RemovePTRRecordTarget(ip, "b.example.com.")
+	if store.HasPTRRecordForIP(ip) {
+		t.Error("Expected PTR record to be removed after removing last target")
+	}
+}
+
+func TestBulkPTRRecords(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	entries := []BulkPTREntry{
+		{IP: net.ParseIP("10.0.0.1"), Domain: "peer1.example.com"},
+		{IP: nil, Domain: "invalid.example.com."},
+		{IP: net.ParseIP("10.0.0.2"), Domain: ""},
+		{IP: net.ParseIP("2001:db8::3"), Domain: "Peer3.Example.com."},
+	}
+
+	errs := store.BulkAddPTRRecords(entries)
+	if len(errs) != len(entries) {
+		t.Fatalf("Expected %d errors, got %d", len(entries), len(errs))
+	}
+	if errs[0] != nil || errs[3] != nil {
+		t.Errorf("Expected valid entries to succeed, got %v, %v", errs[0], errs[3])
+	}
+	if errs[1] == nil || errs[2] == nil {
+		t.Errorf("Expected invalid entries to fail, got %v, %v", errs[1], errs[2])
+	}
+
+	if result, ok := store.GetPTRRecordByIP(net.ParseIP("10.0.0.1")); !ok || result != "peer1.example.com." {
+		t.Errorf("Expected peer1.example.com., got %q", result)
+	}
+	if result, ok := store.GetPTRRecordByIP(net.ParseIP("2001:db8::3")); !ok || result != "peer3.example.com." {
+		t.Errorf("Expected peer3.example.com., got %q", result)
+	}
+	if store.HasPTRRecordForIP(net.ParseIP("10.0.0.2")) {
+		t.Error("Expected no PTR record for entry with empty domain")
+	}
+
+	store.BulkRemovePTRRecords([]net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::3")})
+	if store.HasPTRRecordForIP(net.ParseIP("10.0.0.1")) || store.HasPTRRecordForIP(net.ParseIP("2001:db8::3")) {
+		t.Error("Expected PTR records to be removed")
+	}
+}
+
+func TestRemovePTRRecordsByDomain(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	ip1 := net.ParseIP("10.0.0.1")
+	ip2 := net.ParseIP("10.0.0.2")
+	ip3 := net.ParseIP("2001:db8::1")
+	store.AddPTRRecord(ip1, "old.example.com.")
+	store.AddPTRRecord(ip2, "old.example.com.")
+	store.AddPTRRecord(ip2, "new.example.com.")
+	store.AddPTRRecord(ip3, "other.example.com.")
+
+	if removed := store.RemovePTRRecordsByDomain("OLD.example.com"); removed != 2 {
+		t.Errorf("Expected 2 PTR records removed, got %d", removed)
+	}
+
+	if store.HasPTRRecordForIP(ip1) {
+		t.Error("Expected PTR record for 10.0.0.1 to be removed")
+	}
+	if result, ok := store.GetPTRRecordByIP(ip2); !ok || result != "new.example.com." {
+		t.Errorf("Expected 10.0.0.2 to keep new.example.com., got %q", result)
+	}
+	if !store.HasPTRRecordForIP(ip3) {
+		t.Error("Expected unrelated PTR record to remain")
+	}
+
+	if removed := store.RemovePTRRecordsByDomain("old.example.com."); removed != 0 {
+		t.Errorf("Expected 0 PTR records removed on second call, got %d", removed)
+	}
+}
+
+func TestRecordTypeString(t *testing.T) {
+	tests := []struct {
+		recordType RecordType
+		expected   string
+	}{
+		{RecordTypeA, "A"},
+		{RecordTypeAAAA, "AAAA"},
+		{RecordTypePTR, "PTR"},
+		{RecordType(65280), "TYPE65280"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.recordType.String(); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+
+	for _, name := range []string{"A", "aaaa", "PTR"} {
+		if _, err := ParseRecordType(name); err != nil {
+			t.Errorf("ParseRecordType(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := ParseRecordType("BOGUS"); err == nil {
+		t.Error("Expected error for unknown record type")
+	}
+}
+
+func TestRecordTypeJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]RecordType{"type": RecordTypeAAAA})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"type":"AAAA"}` {
+		t.Errorf("Expected {\"type\":\"AAAA\"}, got %s", data)
+	}
+
+	var decoded map[string]RecordType
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded["type"] != RecordTypeAAAA {
+		t.Errorf("Expected AAAA, got %v", decoded["type"])
+	}
+
+	var rt RecordType
+	if err := json.Unmarshal([]byte(`28`), &rt); err == nil {
+		t.Error("Expected error when unmarshalling a number")
+	}
+}
+
+func TestDNSRecordStoreOptions(t *testing.T) {
+	store := NewDNSRecordStore(
+		WithMaxExactEntries(2),
+		WithMaxWildcardPatterns(1),
+		WithDefaultTTL(30*time.Second),
+	)
+
+	if store.TTL() != 30 {
+		t.Errorf("Expected TTL 30, got %d", store.TTL())
+	}
+	if ttl := NewDNSRecordStore().TTL(); ttl != 300 {
+		t.Errorf("Expected default TTL 300, got %d", ttl)
+	}
+
+	if _, err := store.AddRecord("a.example.com.", net.ParseIP("10.0.0.1")); err != nil {
+		t.Fatalf("Failed to add record: %v", err)
+	}
+	if _, err := store.AddRecord("b.example.com.", net.ParseIP("10.0.0.2")); err != nil {
+		t.Fatalf("Failed to add record: %v", err)
+	}
+	// More IPs for an existing domain do not count towards the cap
+	if _, err := store.AddRecord("a.example.com.", net.ParseIP("10.0.0.3")); err != nil {
+		t.Errorf("Expected adding an IP to an existing domain to succeed, got %v", err)
+	}
+	if _, err := store.AddRecord("c.example.com.", net.ParseIP("10.0.0.4")); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("Expected ErrStoreFull for third domain, got %v", err)
+	}
+	// The cap is per record type
+	if _, err := store.AddRecord("c.example.com.", net.ParseIP("2001:db8::1")); err != nil {
+		t.Errorf("Expected AAAA record to succeed, got %v", err)
+	}
+
+	if _, err := store.AddRecord("*.example.com.", net.ParseIP("10.0.0.5")); err != nil {
+		t.Fatalf("Failed to add wildcard record: %v", err)
+	}
+	if _, err := store.AddRecord("*.example.org.", net.ParseIP("10.0.0.6")); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("Expected ErrStoreFull for second wildcard pattern, got %v", err)
+	}
+}
+
+func TestAddRecordDuplicate(t *testing.T) {
+	store := NewDNSRecordStore()
+	ip := net.ParseIP("10.0.0.1")
+
+	added, err := store.AddRecord("peer.example.com.", ip)
+	if err != nil || !added {
+		t.Fatalf("Expected first insert to be new, got %v %v", added, err)
+	}
+	added, err = store.AddRecord("PEER.example.com", ip)
+	if err != nil || added {
+		t.Errorf("Expected duplicate insert to report false, got %v %v", added, err)
+	}
+	if ips := store.GetRecords("peer.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected duplicate not to be appended, got %v", ips)
+	}
+	if domains, _ := store.GetAllPTRRecords("1.0.0.10.in-addr.arpa."); len(domains) != 1 {
+		t.Errorf("Expected a single PTR target, got %v", domains)
+	}
+
+	if added, _ := store.AddRecord("peer.example.com.", net.ParseIP("10.0.0.2")); !added {
+		t.Error("Expected a new IP for an existing domain to be new")
+	}
+	if added, _ := store.AddRecord("*.example.com.", ip); !added {
+		t.Error("Expected first wildcard insert to be new")
+	}
+	if added, _ := store.AddRecord("*.example.com.", ip); added {
+		t.Error("Expected duplicate wildcard insert to report false")
+	}
+}
+
+func TestAddRecordWildcardValidation(t *testing.T) {
+	ip := net.ParseIP("10.0.0.1")
+
+	valid := []string{"*", "*.autoco.internal.", "host-*.autoco.internal", "?.example.com.", "*.*.autoco.internal."}
+	for _, pattern := range valid {
+		store := NewDNSRecordStore()
+		if _, err := store.AddRecord(pattern, ip); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", pattern, err)
+		}
+	}
+
+	invalid := []string{"*.", "*..corp.", "*.-corp.internal.", "*.corp_x.internal.", "*.*"}
+	for _, pattern := range invalid {
+		store := NewDNSRecordStore()
+		if _, err := store.AddRecord(pattern, ip); !errors.Is(err, ErrInvalidDomain) {
+			t.Errorf("Expected ErrInvalidDomain for %q, got %v", pattern, err)
+		}
+	}
+
+	store := NewDNSRecordStore()
+	store.AddRecord("*", ip)
+	if ips := store.GetRecords("anything.at.all.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected * to match everything, got %v", ips)
+	}
+}
+
+// recordPair is a domain and IP generated for TestAddGetRoundTrip
+type recordPair struct {
+	Domain string // as passed to AddRecord, possibly uppercase and without a trailing dot
+	IP     net.IP // IPv4, IPv6 or IPv4-mapped IPv6
+}
+
+// Generate implements quick.Generator with valid, non-wildcard domains
+func (recordPair) Generate(r *rand.Rand, _ int) reflect.Value {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	labels := make([]string, 1+r.Intn(4))
+	for i := range labels {
+		label := make([]byte, 1+r.Intn(12))
+		for j := range label {
+			label[j] = letters[r.Intn(len(letters))]
+		}
+		labels[i] = string(label)
+	}
+	domain := strings.Join(labels, ".")
+	if r.Intn(2) == 0 {
+		domain += "."
+	}
+
+	var ip net.IP
+	switch r.Intn(3) {
+	case 0:
+		ip = net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))).To4()
+	case 1:
+		// net.IPv4 returns the 16 byte ::ffff:a.b.c.d form
+		ip = net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+	default:
+		ip = make(net.IP, net.IPv6len)
+		r.Read(ip)
+		ip[0] = 0x20 // keep it out of the IPv4-mapped range
+	}
+
+	return reflect.ValueOf(recordPair{Domain: domain, IP: ip})
+}
+
+func TestAddGetRoundTrip(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	roundTrip := func(pair recordPair) bool {
+		if _, err := store.AddRecord(pair.Domain, pair.IP); err != nil {
+			t.Logf("AddRecord(%q, %v) failed: %v", pair.Domain, pair.IP, err)
+			return false
+		}
+
+		recordType := RecordTypeAAAA
+		if pair.IP.To4() != nil {
+			recordType = RecordTypeA
+		}
+
+		// Lookups must find the record whatever the case and trailing dot
+		normalized := strings.ToLower(pair.Domain)
+		if !strings.HasSuffix(normalized, ".") {
+			normalized += "."
+		}
+		for _, domain := range []string{pair.Domain, normalized, strings.ToUpper(pair.Domain)} {
+			ips := store.GetRecords(domain, recordType)
+			if !slices.ContainsFunc(ips, pair.IP.Equal) {
+				t.Logf("GetRecords(%q) = %v, missing %v", domain, ips, pair.IP)
+				return false
+			}
+			if recordType == RecordTypeA && slices.ContainsFunc(ips, func(ip net.IP) bool { return len(ip) != net.IPv4len }) {
+				t.Logf("GetRecords(%q) = %v, expected 4 byte IPv4 addresses", domain, ips)
+				return false
+			}
+		}
+		return true
+	}
+
+	config := &quick.Config{MaxCount: 1000, Rand: rand.New(rand.NewSource(1))}
+	if err := quick.Check(roundTrip, config); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetDomainsByType(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("db.internal.", net.ParseIP("fd00::1"))
+	store.AddRecord("*.svc.internal.", net.ParseIP("10.0.1.1"))
+	store.AddRecord("*", net.ParseIP("10.0.2.1"))
+	store.AddRecord("web-?.internal.", net.ParseIP("fd00::2"))
+	store.AddRecordWithTTL("old.internal.", net.ParseIP("10.0.0.9"), -time.Second)
+
+	a := store.GetDomainsByType(RecordTypeA)
+	if len(a) != 1 || len(a["app.internal."]) != 2 {
+		t.Errorf("Expected app.internal. with two addresses, got %v", a)
+	}
+	if aaaa := store.GetDomainsByType(RecordTypeAAAA); len(aaaa) != 1 || !aaaa["db.internal."][0].Equal(net.ParseIP("fd00::1")) {
+		t.Errorf("Expected db.internal., got %v", aaaa)
+	}
+
+	patterns := store.GetWildcardPatternsByType(RecordTypeA)
+	if len(patterns) != 2 || len(patterns["*.svc.internal."]) != 1 || len(patterns["*."]) != 1 {
+		t.Errorf("Expected the *.svc.internal. and * patterns, got %v", patterns)
+	}
+	if patterns := store.GetWildcardPatternsByType(RecordTypeAAAA); len(patterns["web-?.internal."]) != 1 {
+		t.Errorf("Expected the web-?.internal. pattern, got %v", patterns)
+	}
+	if got := store.GetDomainsByType(RecordTypePTR); got != nil {
+		t.Errorf("Expected nil for PTR, got %v", got)
+	}
+
+	// The results are copies
+	a["app.internal."][0][0] = 192
+	delete(a, "app.internal.")
+	patterns["*.svc.internal."][0][0] = 192
+	if ips := store.GetRecords("app.internal.", RecordTypeA); len(ips) != 2 || ips[0][0] != 10 {
+		t.Errorf("Expected the store to be unaffected by changes to the result, got %v", ips)
+	}
+	if ips := store.GetRecords("api.svc.internal.", RecordTypeA); slices.ContainsFunc(ips, func(ip net.IP) bool { return ip[0] != 10 }) {
+		t.Errorf("Expected the wildcard to be unaffected by changes to the result, got %v", ips)
+	}
+}
+
+func TestGetIPsByPrefix(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.2"))
+	store.AddRecord("db.internal.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("other.internal.", net.ParseIP("192.168.1.1"))
+	store.AddRecord("v6.internal.", net.ParseIP("fd00::1"))
+	store.AddRecord("v6.other.", net.ParseIP("fd01::1"))
+	store.AddPTRRecord(net.ParseIP("10.0.0.3"), "manual.internal.")
+
+	tests := []struct {
+		name    string
+		prefix  string
+		want    []string
+		domains map[string]string
+	}{
+		{
+			name:    "IPv4 prefix",
+			prefix:  "10.0.0.0/8",
+			want:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			domains: map[string]string{"10.0.0.1": "db.internal.", "10.0.0.2": "app.internal.", "10.0.0.3": "manual.internal."},
+		},
+		{
+			name:    "IPv6 prefix",
+			prefix:  "fd00::/16",
+			want:    []string{"fd00::1"},
+			domains: map[string]string{"fd00::1": "v6.internal."},
+		},
+		{
+			name:    "no matches",
+			prefix:  "172.16.0.0/12",
+			domains: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := netip.MustParsePrefix(tt.prefix)
+
+			var got []string
+			for _, ip := range store.GetIPsByPrefix(prefix) {
+				got = append(got, ip.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetIPsByPrefix(%s) = %v, expected %v", prefix, got, tt.want)
+			}
+			if domains := store.GetDomainsForPrefix(prefix); !reflect.DeepEqual(domains, tt.domains) {
+				t.Errorf("GetDomainsForPrefix(%s) = %v, expected %v", prefix, domains, tt.domains)
+			}
+		})
+	}
+}
+
+func TestAddAddrRecord(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	if err := store.AddAddrRecord("app.internal.", netip.MustParseAddr("10.0.0.1")); err != nil {
+		t.Fatalf("AddAddrRecord failed: %v", err)
+	}
+	// IPv4-mapped addresses are stored as IPv4
+	if err := store.AddAddrRecord("app.internal.", netip.MustParseAddr("::ffff:10.0.0.2")); err != nil {
+		t.Fatalf("AddAddrRecord failed: %v", err)
+	}
+	if err := store.AddAddrRecord("app.internal.", netip.MustParseAddr("fd00::1")); err != nil {
+		t.Fatalf("AddAddrRecord failed: %v", err)
+	}
+	// A duplicate of a record added with AddRecord is not stored twice
+	store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+	if err := store.AddAddrRecord("app.internal.", netip.Addr{}); err == nil {
+		t.Error("Expected an error for the zero Addr")
+	}
+
+	ips := store.GetRecords("app.internal.", RecordTypeA)
+	if len(ips) != 2 || !ips[0].Equal(net.ParseIP("10.0.0.1")) || !ips[1].Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Expected A records 10.0.0.1 and 10.0.0.2, got %v", ips)
+	}
+	if len(ips[1]) != net.IPv4len {
+		t.Errorf("Expected a 4 byte IPv4 address, got %d bytes", len(ips[1]))
+	}
+	// Returned addresses must not alias each other or the store
+	ips[0][3] = 99
+	if got := store.GetRecords("app.internal.", RecordTypeA); !got[0].Equal(net.ParseIP("10.0.0.1")) || !got[1].Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Modifying a returned IP changed the store: %v", got)
+	}
+
+	if ips := store.GetRecords("app.internal.", RecordTypeAAAA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("fd00::1")) {
+		t.Errorf("Expected AAAA record fd00::1, got %v", ips)
+	}
+	if domain, ok := store.GetPTRRecordByIP(net.ParseIP("10.0.0.2")); !ok || domain != "app.internal." {
+		t.Errorf("Expected PTR record app.internal. for 10.0.0.2, got %q, %v", domain, ok)
+	}
+
+	store.RemoveRecord("app.internal.", net.ParseIP("::ffff:10.0.0.2"))
+	if ips := store.GetRecords("app.internal.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected 1 A record after removing the mapped address, got %v", ips)
+	}
+	if store.HasPTRRecordForIP(net.ParseIP("10.0.0.2")) {
+		t.Error("Expected the PTR record for 10.0.0.2 to be removed")
+	}
+}
+
+func TestGetDomainsByIP(t *testing.T) {
+	stores := map[string]RecordStore{
+		"single":  NewDNSRecordStore(),
+		"sharded": NewShardedDNSRecordStore(4),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			store.AddRecord("web.internal.", net.ParseIP("10.0.0.1"))
+			store.AddRecord("api.internal.", net.ParseIP("10.0.0.1"))
+			store.AddRecord("app.internal.", net.ParseIP("10.0.0.1"))
+			store.AddRecord("app.internal.", net.ParseIP("fd00::1"))
+			store.AddRecord("db.internal.", net.ParseIP("10.0.0.2"))
+			store.AddRecord("*.wild.internal.", net.ParseIP("10.0.0.1"))
+
+			want := []string{"api.internal.", "app.internal.", "web.internal."}
+			if got := store.GetDomainsByIP(net.ParseIP("10.0.0.1")); !slices.Equal(got, want) {
+				t.Errorf("GetDomainsByIP(10.0.0.1) = %v, expected %v", got, want)
+			}
+			if got := store.GetDomainsByIP(net.ParseIP("fd00::1")); !slices.Equal(got, []string{"app.internal."}) {
+				t.Errorf("GetDomainsByIP(fd00::1) = %v, expected [app.internal.]", got)
+			}
+			if got := store.GetDomainsByIP(net.ParseIP("10.0.0.9")); len(got) != 0 {
+				t.Errorf("GetDomainsByIP(10.0.0.9) = %v, expected none", got)
+			}
+
+			// Removing one domain leaves the others for the same IP
+			store.RemoveRecord("api.internal.", nil)
+			want = []string{"app.internal.", "web.internal."}
+			if got := store.GetDomainsByIP(net.ParseIP("10.0.0.1")); !slices.Equal(got, want) {
+				t.Errorf("GetDomainsByIP(10.0.0.1) after removal = %v, expected %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AddTXTRecord adds a TXT record made of one or more strings for a domain
+func (s *DNSRecordStore) AddTXTRecord(domain string, txt []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addTXTLocked(domain, txt)
+	return nil
+}
+
+// addTXTLocked adds a TXT record unless an identical one exists
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) addTXTLocked(domain string, txt []string) {
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	for _, existing := range s.txtRecords[domain] {
+		if slices.Equal(existing, txt) {
+			return
+		}
+	}
+	s.txtRecords[domain] = append(s.txtRecords[domain], slices.Clone(txt))
+	s.dropRRSIGsLocked(domain)
+}
+
+// GetTXTRecords returns the TXT records for a domain, each as its list of strings
+func (s *DNSRecordStore) GetTXTRecords(domain string) [][]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	records := make([][]string, 0, len(s.txtRecords[domain]))
+	for _, txt := range s.txtRecords[domain] {
+		// Copy to prevent external modifications
+		records = append(records, slices.Clone(txt))
+	}
+	return records
+}
+
+// RemoveTXTRecords removes all TXT records for a domain
+func (s *DNSRecordStore) RemoveTXTRecords(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.txtRecords, strings.ToLower(dns.Fqdn(domain)))
+	s.dropRRSIGsLocked(domain)
+}
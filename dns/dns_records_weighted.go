@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// WithWeightedSelection makes GetRecords return the addresses of a domain in a weighted
+// random order instead of the order they were added, so clients that pick the first
+// address spread their load. Addresses added with AddRecord have weight 1.
+func WithWeightedSelection(enabled bool) DNSRecordStoreOption {
+	return func(s *DNSRecordStore) {
+		s.weightedSelection = enabled
+	}
+}
+
+// AddWeightedRecord adds an A or AAAA record with a selection weight, or sets the weight
+// of an existing record. An address with weight 3 comes first three times as often as
+// one with weight 1. Only exact domains can be weighted.
+func (s *DNSRecordStore) AddWeightedRecord(domain string, ip net.IP, weight uint) error {
+	if weight == 0 {
+		return fmt.Errorf("invalid weight 0 for %s %s: weights start at 1", domain, ip)
+	}
+
+	// Normalize domain to lowercase FQDN
+	domain = strings.ToLower(dns.Fqdn(domain))
+	if strings.ContainsAny(domain, "*?") {
+		return fmt.Errorf("%w: wildcard pattern %s cannot be weighted", ErrInvalidDomain, domain)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.addRecordLocked(domain, ip); err != nil {
+		return err
+	}
+
+	// The record may have been evicted right away by a full LRU
+	if !s.hasRecordLocked(domain, ip) {
+		return nil
+	}
+
+	// Weight 1 is the default and is not stored
+	if weight == 1 {
+		delete(s.weights[domain], ip.String())
+		if len(s.weights[domain]) == 0 {
+			delete(s.weights, domain)
+		}
+		return nil
+	}
+	if s.weights[domain] == nil {
+		s.weights[domain] = make(map[string]uint)
+	}
+	s.weights[domain][ip.String()] = weight
+	return nil
+}
+
+// GetRecordWeight returns the selection weight of the record for domain and ip
+// It returns false if there is no such record
+func (s *DNSRecordStore) GetRecordWeight(domain string, ip net.IP) (uint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain = strings.ToLower(dns.Fqdn(domain))
+	if !s.hasRecordLocked(domain, ip) {
+		return 0, false
+	}
+	return s.weightLocked(domain, ip), true
+}
+
+// weightLocked returns the weight of a record, 1 unless set with AddWeightedRecord
+// The caller must hold s.mu
+func (s *DNSRecordStore) weightLocked(domain string, ip net.IP) uint {
+	if weight, ok := s.weights[domain][ip.String()]; ok {
+		return weight
+	}
+	return 1
+}
+
+// weightedShuffleLocked reorders ips in place by a weighted random shuffle. Each address
+// gets the key u^(1/weight) for a uniform random u and the highest keys come first, which
+// puts an address first with probability proportional to its weight.
+// The caller must hold s.mu
+func (s *DNSRecordStore) weightedShuffleLocked(domain string, ips []net.IP) {
+	if len(ips) < 2 {
+		return
+	}
+
+	keys := make([]float64, len(ips))
+	s.rngMu.Lock()
+	for i, ip := range ips {
+		keys[i] = math.Pow(s.rng.Float64(), 1/float64(s.weightLocked(domain, ip)))
+	}
+	s.rngMu.Unlock()
+
+	sort.Sort(byKeyDesc{ips: ips, keys: keys})
+}
+
+// byKeyDesc sorts IPs by their keys, highest first
+type byKeyDesc struct {
+	ips  []net.IP
+	keys []float64
+}
+
+func (b byKeyDesc) Len() int           { return len(b.ips) }
+func (b byKeyDesc) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKeyDesc) Swap(i, j int) {
+	b.ips[i], b.ips[j] = b.ips[j], b.ips[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
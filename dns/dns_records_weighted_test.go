@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"testing"
+)
+
+func TestWeightedSelectionDisabledKeepsOrder(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("lb.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddWeightedRecord("lb.example.com.", net.ParseIP("10.0.0.2"), 100)
+	store.AddRecord("lb.example.com.", net.ParseIP("10.0.0.3"))
+
+	for i := 0; i < 20; i++ {
+		ips := store.GetRecords("lb.example.com.", RecordTypeA)
+		if len(ips) != 3 || !ips[0].Equal(net.ParseIP("10.0.0.1")) || !ips[2].Equal(net.ParseIP("10.0.0.3")) {
+			t.Fatalf("Expected insertion order without weighted selection, got %v", ips)
+		}
+	}
+}
+
+func TestWeightedSelection(t *testing.T) {
+	store := NewDNSRecordStore(WithWeightedSelection(true))
+	store.rng = rand.New(rand.NewPCG(1, 2))
+
+	light := net.ParseIP("10.0.0.1")
+	heavy := net.ParseIP("10.0.0.2")
+	store.AddRecord("lb.example.com.", light)
+	if err := store.AddWeightedRecord("lb.example.com.", heavy, 3); err != nil {
+		t.Fatalf("AddWeightedRecord failed: %v", err)
+	}
+
+	const rounds = 4000
+	heavyFirst := 0
+	for i := 0; i < rounds; i++ {
+		ips := store.GetRecords("lb.example.com.", RecordTypeA)
+		if len(ips) != 2 {
+			t.Fatalf("Expected 2 records, got %v", ips)
+		}
+		if ips[0].Equal(heavy) {
+			heavyFirst++
+		}
+	}
+
+	// Weight 3 against weight 1 should come first about 75% of the time
+	if share := float64(heavyFirst) / rounds; share < 0.70 || share > 0.80 {
+		t.Errorf("Expected the weight 3 address first about 75%% of the time, got %.1f%%", share*100)
+	}
+}
+
+func TestWeightedSelectionWildcard(t *testing.T) {
+	store := NewDNSRecordStore(WithWeightedSelection(true))
+	store.AddRecord("*.example.com.", net.ParseIP("10.0.0.1"))
+	store.AddRecord("*.example.com.", net.ParseIP("10.0.0.2"))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		ips := store.GetRecords("host.example.com.", RecordTypeA)
+		if len(ips) != 2 {
+			t.Fatalf("Expected 2 records, got %v", ips)
+		}
+		seen[ips[0].String()] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("Expected wildcard answers to be shuffled, first addresses seen: %v", seen)
+	}
+}
+
+func TestAddWeightedRecord(t *testing.T) {
+	store := NewDNSRecordStore()
+	ip := net.ParseIP("2001:db8::1")
+
+	if err := store.AddWeightedRecord("lb.example.com.", ip, 0); err == nil {
+		t.Error("Expected an error for weight 0")
+	}
+	if err := store.AddWeightedRecord("*.example.com.", ip, 2); !errors.Is(err, ErrInvalidDomain) {
+		t.Errorf("Expected ErrInvalidDomain for a wildcard, got %v", err)
+	}
+	if _, ok := store.GetRecordWeight("lb.example.com.", ip); ok {
+		t.Error("Expected no weight for a missing record")
+	}
+
+	store.AddRecord("lb.example.com.", ip)
+	if weight, ok := store.GetRecordWeight("lb.example.com.", ip); !ok || weight != 1 {
+		t.Errorf("Expected AddRecord to give weight 1, got %d, %v", weight, ok)
+	}
+
+	store.AddWeightedRecord("LB.example.com", ip, 5)
+	if weight, _ := store.GetRecordWeight("lb.example.com.", ip); weight != 5 {
+		t.Errorf("Expected weight 5, got %d", weight)
+	}
+	if _, ok := store.GetPTRRecordByIP(ip); !ok {
+		t.Error("Expected weighted record to have a PTR")
+	}
+
+	// The weight goes with the record
+	store.RemoveRecord("lb.example.com.", ip)
+	store.AddRecord("lb.example.com.", ip)
+	if weight, _ := store.GetRecordWeight("lb.example.com.", ip); weight != 1 {
+		t.Errorf("Expected weight to reset after removal, got %d", weight)
+	}
+}
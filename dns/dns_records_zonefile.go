@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ImportZoneFile adds the records of an RFC 1035 zone file, given as text, with
+// relative names completed by origin. A, AAAA, TXT, SRV and CAA records are imported,
+// SOA and NS records are skipped since the store is not authoritative for the zone.
+// It returns how many records were imported, counting ones already in the store.
+// Records that cannot be imported are reported in the returned error, joined with
+// errors.Join, and do not stop the import. A syntax error stops it at that line.
+func (s *DNSRecordStore) ImportZoneFile(zonefile, origin string) (int, error) {
+	return s.importZone(zonefile, origin, "")
+}
+
+// importZone is ImportZoneFile with filename used in error messages
+func (s *DNSRecordStore) importZone(zonefile, origin, filename string) (int, error) {
+	zp := dns.NewZoneParser(strings.NewReader(zonefile), dns.Fqdn(origin), filename)
+
+	var errs []error
+	count := 0
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		imported, err := s.importRR(rr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("import %s: %w", rr.Header().Name, err))
+			continue
+		}
+		if imported {
+			count++
+		}
+	}
+	if err := zp.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return count, errors.Join(errs...)
+}
+
+// importRR adds a single zone file record, reporting false for records that are skipped
+func (s *DNSRecordStore) importRR(rr dns.RR) (bool, error) {
+	name := rr.Header().Name
+	switch rr := rr.(type) {
+	case *dns.A:
+		_, err := s.AddRecord(name, rr.A)
+		return true, err
+	case *dns.AAAA:
+		_, err := s.AddRecord(name, rr.AAAA)
+		return true, err
+	case *dns.TXT:
+		return true, s.AddTXTRecord(name, rr.Txt)
+	case *dns.SRV:
+		return true, s.AddSRVRecord(name, SRVRecord{Priority: rr.Priority, Weight: rr.Weight, Port: rr.Port, Target: rr.Target})
+	case *dns.CAA:
+		return true, s.AddCAARecord(name, CAARecord{Flags: rr.Flag, Tag: rr.Tag, Value: rr.Value})
+	case *dns.SOA, *dns.NS:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported record type %s", dns.TypeToString[rr.Header().Rrtype])
+	}
+}
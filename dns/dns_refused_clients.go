@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// WithRefusedClientCIDRs refuses all queries from clients in prefixes, such as a guest
+// network that should get no DNS service. Refused clients get REFUSED before the query
+// is looked at any further, and zone transfers are refused to them as well.
+func WithRefusedClientCIDRs(prefixes []netip.Prefix) DNSProxyOption {
+	return func(p *DNSProxy) {
+		for _, prefix := range prefixes {
+			p.AddRefusedCIDR(prefix)
+		}
+	}
+}
+
+// AddRefusedCIDR refuses queries from clients in prefix
+func (p *DNSProxy) AddRefusedCIDR(prefix netip.Prefix) {
+	if !prefix.IsValid() {
+		return
+	}
+	prefix = prefix.Masked()
+
+	p.refusedLock.Lock()
+	defer p.refusedLock.Unlock()
+
+	if !slices.Contains(p.refusedCIDRs, prefix) {
+		p.refusedCIDRs = append(p.refusedCIDRs, prefix)
+	}
+}
+
+// RemoveRefusedCIDR serves clients in prefix again, unless another refused prefix contains them
+func (p *DNSProxy) RemoveRefusedCIDR(prefix netip.Prefix) {
+	prefix = prefix.Masked()
+
+	p.refusedLock.Lock()
+	defer p.refusedLock.Unlock()
+
+	p.refusedCIDRs = slices.DeleteFunc(p.refusedCIDRs, func(refused netip.Prefix) bool {
+		return refused == prefix
+	})
+}
+
+// isRefusedClient reports whether clientAddr is in a refused prefix
+func (p *DNSProxy) isRefusedClient(clientAddr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(clientAddr.String())
+	if err != nil {
+		return false
+	}
+	return p.isRefusedAddr(addrPort.Addr())
+}
+
+// isRefusedAddr reports whether addr is in a refused prefix
+func (p *DNSProxy) isRefusedAddr(addr netip.Addr) bool {
+	p.refusedLock.RLock()
+	defer p.refusedLock.RUnlock()
+
+	addr = addr.Unmap()
+	for _, prefix := range p.refusedCIDRs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRefusedClientCIDRs(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	WithRefusedClientCIDRs([]netip.Prefix{netip.MustParsePrefix("192.168.50.0/24")})(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	rcode := func() int {
+		query := new(dns.Msg)
+		query.SetQuestion("app.example.com.", dns.TypeA)
+		response := new(dns.Msg)
+		if err := response.Unpack(exchangeUDP(t, proxy, query)); err != nil {
+			t.Fatalf("Failed to unpack response: %v", err)
+		}
+		return response.Rcode
+	}
+
+	// The test client is on 127.0.0.1, outside the refused network
+	if got := rcode(); got != dns.RcodeSuccess {
+		t.Errorf("Expected a client outside the refused networks to be served, got %s", dns.RcodeToString[got])
+	}
+
+	proxy.AddRefusedCIDR(netip.MustParsePrefix("127.0.0.1/8"))
+	if got := rcode(); got != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for a refused client, got %s", dns.RcodeToString[got])
+	}
+	if !proxy.isRefusedAddr(netip.MustParseAddr("::ffff:192.168.50.7")) {
+		t.Error("Expected IPv4-mapped addresses to match the refused network")
+	}
+
+	proxy.RemoveRefusedCIDR(netip.MustParsePrefix("127.0.0.0/8"))
+	if got := rcode(); got != dns.RcodeSuccess {
+		t.Errorf("Expected the client to be served once its network is removed, got %s", dns.RcodeToString[got])
+	}
+}
+
+func TestRefusedClientAXFR(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithAXFREnabled(true)(proxy)
+	WithAXFRAllowedClients([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})(proxy)
+	WithRefusedClientCIDRs([]netip.Prefix{netip.MustParsePrefix("10.9.0.0/16")})(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+
+	query := new(dns.Msg)
+	query.SetAxfr("example.com.")
+	if msgs := proxy.handleAXFR(query, netip.MustParseAddr("10.9.0.1")); msgs[0].Rcode != dns.RcodeRefused {
+		t.Errorf("Expected a refused client to be denied zone transfers, got %s", dns.RcodeToString[msgs[0].Rcode])
+	}
+	if msgs := proxy.handleAXFR(query, netip.MustParseAddr("10.1.0.1")); msgs[0].Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected an allowed client to transfer the zone, got %s", dns.RcodeToString[msgs[0].Rcode])
+	}
+}
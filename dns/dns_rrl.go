@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultRRLRequestsPerSecond is how many identical responses a client network gets per second
+	defaultRRLRequestsPerSecond = 5
+
+	// defaultRRLSlipRate lets every second rate limited response through unchanged
+	defaultRRLSlipRate = 2
+
+	// rrlIdleTimeout is how long an unused response bucket is kept
+	rrlIdleTimeout = time.Minute
+
+	// rrlIPv4PrefixLen and rrlIPv6PrefixLen group clients into networks, since an attacker
+	// can spoof any address of a victim network
+	rrlIPv4PrefixLen = 24
+	rrlIPv6PrefixLen = 56
+)
+
+// WithRRLEnabled turns on response rate limiting. Identical responses to one client network
+// above the configured rate are replaced by empty truncated responses, so a spoofed source
+// gets little amplification while a real client retries over TCP, which the proxy serves
+// whenever rate limiting is on.
+func WithRRLEnabled(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.rrlEnabled = enabled
+	}
+}
+
+// WithRRLRequestsPerSecond sets how many identical responses per second a client network
+// gets before rate limiting starts, 5 by default
+func WithRRLRequestsPerSecond(rps float64) DNSProxyOption {
+	return func(p *DNSProxy) {
+		if rps > 0 {
+			p.rrlRequestsPerSecond = rps
+		}
+	}
+}
+
+// WithRRLSlipRate sends every nth rate limited response unchanged so legitimate clients
+// caught in a limited network are still answered, 2 by default. Zero truncates every one.
+func WithRRLSlipRate(n int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.rrlSlipRate = max(n, 0)
+	}
+}
+
+// RateLimitedResponsesTotal returns how many responses were truncated by response rate limiting
+func (p *DNSProxy) RateLimitedResponsesTotal() uint64 {
+	return p.counters().rateLimited.Load()
+}
+
+// rrlKey identifies one kind of response to one client network
+type rrlKey struct {
+	prefix netip.Prefix
+	qname  string
+	qtype  uint16
+	rcode  int
+}
+
+// rrlBucket is the rate limiting state of one rrlKey
+type rrlBucket struct {
+	limiter  *rate.Limiter
+	limited  atomic.Uint64 // rate limited responses, for the slip rate
+	lastSeen atomic.Int64  // unix nanoseconds
+}
+
+// rateLimitResponse returns response, or an empty truncated reply to query when the
+// client's network has exceeded the response rate
+func (p *DNSProxy) rateLimitResponse(query, response *dns.Msg, clientAddr net.Addr) *dns.Msg {
+	if !p.rrlEnabled || len(query.Question) == 0 {
+		return response
+	}
+	addrPort, err := netip.ParseAddrPort(clientAddr.String())
+	if err != nil {
+		return response
+	}
+	clientIP := addrPort.Addr().Unmap()
+	bits := rrlIPv4PrefixLen
+	if clientIP.Is6() {
+		bits = rrlIPv6PrefixLen
+	}
+	prefix, _ := clientIP.Prefix(bits)
+
+	question := query.Question[0]
+	key := rrlKey{prefix: prefix, qname: strings.ToLower(question.Name), qtype: question.Qtype, rcode: response.Rcode}
+
+	now := time.Now()
+	p.pruneRRLBuckets(now)
+	bucket := p.rrlBucketFor(key)
+	bucket.lastSeen.Store(now.UnixNano())
+	if bucket.limiter.AllowN(now, 1) {
+		return response
+	}
+
+	if n := bucket.limited.Add(1); p.rrlSlipRate > 0 && n%uint64(p.rrlSlipRate) == 0 {
+		return response
+	}
+	p.counters().rateLimited.Add(1)
+	logger.Debug("Rate limiting %s response for %s to %s", dns.RcodeToString[response.Rcode], question.Name, prefix)
+
+	truncated := new(dns.Msg)
+	truncated.SetReply(query)
+	truncated.Rcode = response.Rcode
+	truncated.Truncated = true
+	return truncated
+}
+
+// rrlBucketFor returns the bucket of key, creating a full one on first use
+func (p *DNSProxy) rrlBucketFor(key rrlKey) *rrlBucket {
+	if bucket, ok := p.rrlBuckets.Load(key); ok {
+		return bucket.(*rrlBucket)
+	}
+	rps := p.rrlRequestsPerSecond
+	if rps <= 0 {
+		rps = defaultRRLRequestsPerSecond
+	}
+	bucket := &rrlBucket{limiter: rate.NewLimiter(rate.Limit(rps), max(int(rps), 1))}
+	actual, _ := p.rrlBuckets.LoadOrStore(key, bucket)
+	return actual.(*rrlBucket)
+}
+
+// pruneRRLBuckets drops idle buckets, at most once per idle timeout
+func (p *DNSProxy) pruneRRLBuckets(now time.Time) {
+	last := p.rrlPruned.Load()
+	if now.UnixNano()-last < int64(rrlIdleTimeout) || !p.rrlPruned.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	p.rrlBuckets.Range(func(key, bucket any) bool {
+		if now.UnixNano()-bucket.(*rrlBucket).lastSeen.Load() > int64(rrlIdleTimeout) {
+			p.rrlBuckets.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRateLimitResponse(t *testing.T) {
+	proxy := &DNSProxy{}
+	WithRRLEnabled(true)(proxy)
+	WithRRLRequestsPerSecond(2)(proxy)
+	WithRRLSlipRate(3)(proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("victim.example.com.", dns.TypeTXT)
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Answer = append(response.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: "victim.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+		Txt: []string{"a large answer"},
+	})
+
+	spoofed := &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 53}
+	var truncated, full int
+	for i := 0; i < 8; i++ {
+		// Addresses in one /24 share a bucket
+		spoofed.IP[15] = byte(i)
+		got := proxy.rateLimitResponse(query, response, spoofed)
+		if got.Truncated {
+			truncated++
+			if len(got.Answer) != 0 || got.Id != query.Id {
+				t.Errorf("Expected an empty truncated reply, got %v", got)
+			}
+		} else {
+			full++
+		}
+	}
+	// 2 within the rate, then 6 limited of which every 3rd slips through
+	if full != 4 || truncated != 4 {
+		t.Errorf("Expected 4 full and 4 truncated responses, got %d and %d", full, truncated)
+	}
+	if n := proxy.RateLimitedResponsesTotal(); n != 4 {
+		t.Errorf("Expected 4 rate limited responses, got %d", n)
+	}
+
+	// Another network and another name have their own buckets
+	other := &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 53}
+	if got := proxy.rateLimitResponse(query, response, other); got.Truncated {
+		t.Error("Expected a different network not to be limited")
+	}
+	otherQuery := new(dns.Msg)
+	otherQuery.SetQuestion("other.example.com.", dns.TypeTXT)
+	if got := proxy.rateLimitResponse(otherQuery, response, spoofed); got.Truncated {
+		t.Error("Expected a different name not to be limited")
+	}
+}
+
+func TestRateLimitResponseDisabled(t *testing.T) {
+	proxy := &DNSProxy{}
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	response := new(dns.Msg)
+	response.SetReply(query)
+
+	client := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}
+	for i := 0; i < 20; i++ {
+		if got := proxy.rateLimitResponse(query, response, client); got != response {
+			t.Fatal("Expected responses to pass through with RRL off")
+		}
+	}
+}
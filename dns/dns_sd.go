@@ -0,0 +1,171 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// dnsSDServicesName is the DNS-SD service type enumeration name (RFC 6763 section 9)
+const dnsSDServicesName = "_services._dns-sd._udp."
+
+// ErrServiceNotFound is returned when deregistering a DNS-SD service that is not registered
+var ErrServiceNotFound = errors.New("DNS-SD service not registered")
+
+// serviceTypeRe matches a DNS-SD service type such as "_http._tcp"
+var serviceTypeRe = regexp.MustCompile(`^_[a-z0-9-]{1,15}\._(tcp|udp)$`)
+
+// ServiceDescription describes a DNS-SD service instance
+type ServiceDescription struct {
+	Name       string   // instance name, e.g. "Office Printer"
+	Type       string   // service type, e.g. "_http._tcp"
+	Domain     string   // domain the service is registered in, e.g. "local."
+	Host       string   // target host name; a single label is placed in Domain
+	Port       uint16   // port the service listens on
+	IPs        []net.IP // addresses of Host
+	TXTRecords []string // key=value pairs for the TXT record
+}
+
+// registeredService is a service added by RegisterService and the host addresses
+// it added to the store, which are removed again when the last user goes away
+type registeredService struct {
+	sd    ServiceDescription
+	added []net.IP
+}
+
+// names returns the service type name, instance name and host name of the service
+func (sd ServiceDescription) names() (typeName, instance, host string) {
+	domain := strings.ToLower(dns.Fqdn(sd.Domain))
+	typeName = strings.ToLower(sd.Type) + "." + domain
+	instance = sd.Name + "." + typeName
+
+	host = strings.ToLower(strings.TrimSuffix(sd.Host, "."))
+	if !strings.Contains(host, ".") {
+		host += "." + domain
+	}
+	return typeName, instance, dns.Fqdn(host)
+}
+
+// validate checks the description before anything is added to the store
+func (sd ServiceDescription) validate() error {
+	if sd.Name == "" || strings.Contains(sd.Name, ".") {
+		return fmt.Errorf("invalid DNS-SD instance name %q", sd.Name)
+	}
+	if !serviceTypeRe.MatchString(strings.ToLower(sd.Type)) {
+		return fmt.Errorf("invalid DNS-SD service type %q, expected e.g. _http._tcp", sd.Type)
+	}
+	if strings.Trim(sd.Domain, ".") == "" {
+		return fmt.Errorf("DNS-SD service %s has no domain", sd.Name)
+	}
+	if strings.Trim(sd.Host, ".") == "" {
+		return fmt.Errorf("DNS-SD service %s has no host", sd.Name)
+	}
+	if sd.Port == 0 {
+		return fmt.Errorf("DNS-SD service %s has no port", sd.Name)
+	}
+	for _, ip := range sd.IPs {
+		if ip.To16() == nil {
+			return &net.ParseError{Type: "IP address", Text: ip.String()}
+		}
+	}
+	return nil
+}
+
+// RegisterService adds the DNS-SD records for a service in one step: the service type
+// enumeration PTR, the service type PTR, the instance SRV and TXT records and the
+// host A/AAAA records. Either all records are added or none are.
+func (s *DNSRecordStore) RegisterService(sd ServiceDescription) error {
+	if err := sd.validate(); err != nil {
+		return err
+	}
+	typeName, instance, host := sd.names()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Add the host records first, they are the only ones that can fail
+	var added []net.IP
+	for _, ip := range sd.IPs {
+		isNew, err := s.addRecordLocked(host, ip)
+		if err != nil {
+			for _, addedIP := range added {
+				s.removeRecordLocked(host, addedIP)
+			}
+			return fmt.Errorf("add address for %s: %w", host, err)
+		}
+		if isNew {
+			added = append(added, ip)
+		}
+	}
+
+	txt := sd.TXTRecords
+	if len(txt) == 0 {
+		// RFC 6763 section 6.1 requires a TXT record, even if it is empty
+		txt = []string{""}
+	}
+
+	s.addServicePTRLocked(dnsSDServicesName+strings.ToLower(dns.Fqdn(sd.Domain)), typeName)
+	s.addServicePTRLocked(typeName, instance)
+	s.addSRVLocked(instance, SRVRecord{Port: sd.Port, Target: host})
+	s.addTXTLocked(instance, txt)
+
+	s.services[strings.ToLower(instance)] = registeredService{sd: sd, added: added}
+
+	return nil
+}
+
+// DeregisterService removes the records added by RegisterService
+// Host addresses still used by another registered service are kept
+func (s *DNSRecordStore) DeregisterService(name, serviceType, domain string) error {
+	typeName, instance, _ := ServiceDescription{Name: name, Type: serviceType, Domain: domain}.names()
+	key := strings.ToLower(instance)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	svc, ok := s.services[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, instance)
+	}
+	delete(s.services, key)
+	_, _, host := svc.sd.names()
+
+	delete(s.srvRecords, key)
+	delete(s.txtRecords, key)
+	s.removeServicePTRLocked(typeName, instance)
+	if len(s.servicePTRRecords[typeName]) == 0 {
+		s.removeServicePTRLocked(dnsSDServicesName+strings.ToLower(dns.Fqdn(domain)), typeName)
+	}
+
+	for _, ip := range svc.added {
+		if otherKey, ok := s.serviceUsingLocked(host, ip); ok {
+			// Hand the address over to a service that still needs it
+			other := s.services[otherKey]
+			other.added = append(other.added, ip)
+			s.services[otherKey] = other
+			continue
+		}
+		s.removeRecordLocked(host, ip)
+	}
+
+	return nil
+}
+
+// serviceUsingLocked returns the key of a registered service that uses ip for host
+// The caller must hold s.mu
+func (s *DNSRecordStore) serviceUsingLocked(host string, ip net.IP) (string, bool) {
+	for key, other := range s.services {
+		if _, _, otherHost := other.sd.names(); otherHost != host {
+			continue
+		}
+		if slices.ContainsFunc(other.sd.IPs, ip.Equal) {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRegisterService(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	err := store.RegisterService(ServiceDescription{
+		Name:       "Office Printer",
+		Type:       "_ipp._tcp",
+		Domain:     "corp.internal",
+		Host:       "printer",
+		Port:       631,
+		IPs:        []net.IP{net.ParseIP("10.0.0.20"), net.ParseIP("fd00::20")},
+		TXTRecords: []string{"rp=ipp/print", "color=T"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+
+	if types := store.GetServicePTRRecords("_services._dns-sd._udp.corp.internal."); len(types) != 1 || types[0] != "_ipp._tcp.corp.internal." {
+		t.Errorf("Expected service type enumeration PTR, got %v", types)
+	}
+	if instances := store.GetServicePTRRecords("_ipp._tcp.corp.internal."); len(instances) != 1 || instances[0] != "Office Printer._ipp._tcp.corp.internal." {
+		t.Errorf("Expected service instance PTR, got %v", instances)
+	}
+	srv := store.GetSRVRecords("Office Printer._ipp._tcp.corp.internal.")
+	if len(srv) != 1 || srv[0].Port != 631 || srv[0].Target != "printer.corp.internal." {
+		t.Errorf("Expected SRV record, got %v", srv)
+	}
+	txt := store.GetTXTRecords("office printer._ipp._tcp.corp.internal.")
+	if len(txt) != 1 || len(txt[0]) != 2 || txt[0][0] != "rp=ipp/print" {
+		t.Errorf("Expected TXT record, got %v", txt)
+	}
+	if !store.HasRecord("printer.corp.internal.", RecordTypeA) || !store.HasRecord("printer.corp.internal.", RecordTypeAAAA) {
+		t.Error("Expected host A and AAAA records")
+	}
+
+	if err := store.DeregisterService("Office Printer", "_ipp._tcp", "corp.internal."); err != nil {
+		t.Fatalf("DeregisterService failed: %v", err)
+	}
+	if len(store.GetServicePTRRecords("_services._dns-sd._udp.corp.internal.")) != 0 ||
+		len(store.GetServicePTRRecords("_ipp._tcp.corp.internal.")) != 0 ||
+		store.HasSRVRecord("Office Printer._ipp._tcp.corp.internal.") ||
+		len(store.GetTXTRecords("Office Printer._ipp._tcp.corp.internal.")) != 0 ||
+		store.HasRecord("printer.corp.internal.", RecordTypeA) {
+		t.Error("Expected DeregisterService to remove every record")
+	}
+
+	if err := store.DeregisterService("Office Printer", "_ipp._tcp", "corp.internal."); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("Expected ErrServiceNotFound, got %v", err)
+	}
+}
+
+func TestRegisterServiceSharedHost(t *testing.T) {
+	store := NewDNSRecordStore()
+	ip := net.ParseIP("10.0.0.30")
+
+	// An address added outside DNS-SD is left alone
+	store.AddRecord("other.local.", net.ParseIP("10.0.0.40"))
+
+	store.RegisterService(ServiceDescription{Name: "web", Type: "_http._tcp", Domain: "local.", Host: "nas", Port: 80, IPs: []net.IP{ip}})
+	store.RegisterService(ServiceDescription{Name: "files", Type: "_smb._tcp", Domain: "local.", Host: "nas", Port: 445, IPs: []net.IP{ip}})
+	store.RegisterService(ServiceDescription{Name: "other", Type: "_ssh._tcp", Domain: "local.", Host: "other.local.", Port: 22, IPs: []net.IP{net.ParseIP("10.0.0.40")}})
+
+	store.DeregisterService("web", "_http._tcp", "local.")
+	if !store.HasRecord("nas.local.", RecordTypeA) {
+		t.Error("Expected host address to remain while another service uses it")
+	}
+	if types := store.GetServicePTRRecords("_services._dns-sd._udp.local."); len(types) != 2 {
+		t.Errorf("Expected 2 remaining service types, got %v", types)
+	}
+
+	store.DeregisterService("files", "_smb._tcp", "local.")
+	if store.HasRecord("nas.local.", RecordTypeA) {
+		t.Error("Expected host address to be removed with the last service")
+	}
+
+	store.DeregisterService("other", "_ssh._tcp", "local.")
+	if !store.HasRecord("other.local.", RecordTypeA) {
+		t.Error("Expected pre-existing address not to be removed")
+	}
+}
+
+func TestRegisterServiceValidation(t *testing.T) {
+	valid := ServiceDescription{Name: "web", Type: "_http._tcp", Domain: "local.", Host: "nas", Port: 80}
+
+	tests := []struct {
+		name   string
+		modify func(sd *ServiceDescription)
+	}{
+		{name: "empty name", modify: func(sd *ServiceDescription) { sd.Name = "" }},
+		{name: "bad type", modify: func(sd *ServiceDescription) { sd.Type = "http" }},
+		{name: "no domain", modify: func(sd *ServiceDescription) { sd.Domain = "" }},
+		{name: "no host", modify: func(sd *ServiceDescription) { sd.Host = "" }},
+		{name: "no port", modify: func(sd *ServiceDescription) { sd.Port = 0 }},
+		{name: "bad ip", modify: func(sd *ServiceDescription) { sd.IPs = []net.IP{{1, 2, 3}} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewDNSRecordStore()
+			sd := valid
+			tt.modify(&sd)
+			if err := store.RegisterService(sd); err == nil {
+				t.Error("Expected validation error")
+			}
+			if len(store.GetServicePTRRecords("_services._dns-sd._udp.local.")) != 0 {
+				t.Error("Expected nothing to be added")
+			}
+		})
+	}
+
+	// A store limit failure adds nothing
+	store := NewDNSRecordStore(WithMaxExactEntries(1))
+	store.AddRecord("full.local.", net.ParseIP("10.0.0.1"))
+	sd := valid
+	sd.IPs = []net.IP{net.ParseIP("10.0.0.2")}
+	if err := store.RegisterService(sd); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("Expected ErrStoreFull, got %v", err)
+	}
+	if store.HasSRVRecord("web._http._tcp.local.") {
+		t.Error("Expected no records after a failed registration")
+	}
+}
+
+func TestCheckLocalRecordsTXT(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	proxy.recordStore.AddTXTRecord("web._http._tcp.local.", []string{"path=/"})
+
+	query := new(dns.Msg)
+	query.SetQuestion("web._http._tcp.local.", dns.TypeTXT)
+	response := proxy.checkLocalRecords(context.Background(), query, query.Question[0])
+	if response == nil || len(response.Answer) != 1 {
+		t.Fatalf("Expected 1 TXT answer, got %v", response)
+	}
+	if txt, ok := response.Answer[0].(*dns.TXT); !ok || len(txt.Txt) != 1 || txt.Txt[0] != "path=/" {
+		t.Errorf("Unexpected TXT answer: %v", response.Answer[0])
+	}
+}
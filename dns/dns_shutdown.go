@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"context"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+)
+
+// WithShutdownTimeout bounds how long Stop waits for queries being answered to finish.
+// Queries still running after d are cancelled and dropped. Without a timeout Stop waits
+// for all of them, which the upstream query timeout keeps finite.
+func WithShutdownTimeout(d time.Duration) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.shutdownTimeout = d
+	}
+}
+
+// queryContext returns the context queries are answered under, cancelled when Stop
+// gives up waiting for them
+func (p *DNSProxy) queryContext() context.Context {
+	if p.queryCtx != nil {
+		return p.queryCtx
+	}
+	return p.ctx
+}
+
+// beginQuery registers a query being answered, returning false once Stop has started
+// Each successful call must be matched by endQuery
+func (p *DNSProxy) beginQuery() bool {
+	p.queriesLock.Lock()
+	defer p.queriesLock.Unlock()
+
+	if p.draining {
+		return false
+	}
+	p.queries.Add(1)
+	p.inFlight.Add(1)
+	return true
+}
+
+// endQuery marks a query registered by beginQuery as answered
+func (p *DNSProxy) endQuery() {
+	p.inFlight.Add(-1)
+	p.queries.Done()
+}
+
+// drainQueries stops new queries from being answered and waits for the ones in flight,
+// cancelling them once the shutdown timeout passes
+func (p *DNSProxy) drainQueries() {
+	p.queriesLock.Lock()
+	p.draining = true
+	p.queriesLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.queries.Wait()
+		close(done)
+	}()
+
+	if n := p.inFlight.Load(); n > 0 {
+		logger.Info("Waiting for %d in-flight DNS queries", n)
+	}
+
+	var timeout <-chan time.Time
+	if p.shutdownTimeout > 0 {
+		timer := time.NewTimer(p.shutdownTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-done:
+	case <-timeout:
+		logger.Warn("Dropping %d DNS queries still in flight after %v", p.inFlight.Load(), p.shutdownTimeout)
+		if p.cancelQueries != nil {
+			p.cancelQueries()
+		}
+		<-done
+	}
+}
@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fosrl/olm/device"
+	"github.com/miekg/dns"
+)
+
+// startQuery answers a query for name in the background once upstream has received it,
+// returning a channel with the packed response
+func startQuery(t *testing.T, proxy *DNSProxy, name string, received func() bool) <-chan []byte {
+	t.Helper()
+
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeA)
+	data, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	result := make(chan []byte, 1)
+	go func() {
+		result <- proxy.answerQuery(data, &net.UDPAddr{IP: net.ParseIP("100.96.0.2"), Port: 40000}, true)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !received() {
+		if time.Now().After(deadline) {
+			t.Fatal("Upstream did not receive the query")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return result
+}
+
+func TestStopWaitsForInFlightQueries(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, 300*time.Millisecond)
+	proxy, err := NewDNSProxy(device.NewMiddleDevice(nil), 1420, "100.96.128.0/24", []string{upstream}, false, "")
+	if err != nil {
+		t.Fatalf("NewDNSProxy failed: %v", err)
+	}
+
+	result := startQuery(t, proxy, "slow.example.com.", func() bool { return queries.Load() == 1 })
+	proxy.Stop()
+
+	select {
+	case data := <-result:
+		response := new(dns.Msg)
+		if err := response.Unpack(data); err != nil || len(response.Answer) != 1 {
+			t.Errorf("Expected the in-flight query to be answered, got %v (%v)", response, err)
+		}
+	default:
+		t.Fatal("Expected Stop to wait for the in-flight query")
+	}
+
+	// Queries arriving after Stop are not answered
+	query := new(dns.Msg)
+	query.SetQuestion("late.example.com.", dns.TypeA)
+	data, _ := query.Pack()
+	if response := proxy.answerQuery(data, &net.UDPAddr{IP: net.ParseIP("100.96.0.2"), Port: 40000}, true); response != nil {
+		t.Error("Expected no answer after Stop")
+	}
+}
+
+func TestStopShutdownTimeout(t *testing.T) {
+	upstream, queries := startSlowUpstream(t, time.Second)
+	proxy, err := NewDNSProxy(device.NewMiddleDevice(nil), 1420, "100.96.128.0/24", []string{upstream}, false, "",
+		WithShutdownTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewDNSProxy failed: %v", err)
+	}
+
+	result := startQuery(t, proxy, "slow.example.com.", func() bool { return queries.Load() == 1 })
+	start := time.Now()
+	proxy.Stop()
+	elapsed := time.Since(start)
+
+	if elapsed < 200*time.Millisecond || elapsed > 800*time.Millisecond {
+		t.Errorf("Expected Stop to return after the 200ms shutdown timeout, took %v", elapsed)
+	}
+	select {
+	case data := <-result:
+		if data != nil {
+			t.Errorf("Expected the cancelled query to get no answer, got %d bytes", len(data))
+		}
+	default:
+		t.Fatal("Expected the cancelled query to have returned")
+	}
+}
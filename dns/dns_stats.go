@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the query latency histogram buckets
+// Queries slower than the last bound fall into a final overflow bucket.
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// DNSProxyStats is a snapshot of the proxy's counters since it started or since the last
+// ResetStats
+type DNSProxyStats struct {
+	Since                time.Time       `json:"since"`                // when counting started
+	Queries              uint64          `json:"queries"`              // queries resolved, answered or not
+	Failures             uint64          `json:"failures"`             // queries no response could be found for
+	SlowQueries          uint64          `json:"slowQueries"`          // upstream exchanges over the slow query threshold
+	CoalescedQueries     uint64          `json:"coalescedQueries"`     // queries that joined an upstream exchange in flight
+	DGASuspiciousQueries uint64          `json:"dgaSuspiciousQueries"` // queries flagged by DGA detection
+	RateLimitedResponses uint64          `json:"rateLimitedResponses"` // responses truncated by response rate limiting
+	Latency              []LatencyBucket `json:"latency"`              // query latency histogram
+}
+
+// LatencyBucket counts the queries resolved within one range of the latency histogram
+type LatencyBucket struct {
+	UpperBound time.Duration `json:"upperBound"` // queries up to this latency and above the previous bound, 0 for the overflow bucket
+	Count      uint64        `json:"count"`
+}
+
+// proxyStats holds the counters behind DNSProxyStats
+// ResetStats swaps in a fresh proxyStats so every counter is zeroed at once.
+type proxyStats struct {
+	since            time.Time
+	queries          atomic.Uint64
+	failures         atomic.Uint64
+	slowQueries      atomic.Uint64
+	coalescedQueries atomic.Uint64
+	dgaSuspicious    atomic.Uint64
+	rateLimited      atomic.Uint64
+	latency          []atomic.Uint64 // one per latency bound, then the overflow bucket
+}
+
+func newProxyStats() *proxyStats {
+	return &proxyStats{
+		since:   time.Now(),
+		latency: make([]atomic.Uint64, len(latencyBounds)+1),
+	}
+}
+
+// record counts a resolved query
+func (s *proxyStats) record(entry QueryLogEntry) {
+	s.queries.Add(1)
+	if entry.Rcode < 0 {
+		s.failures.Add(1)
+	}
+	i := 0
+	for i < len(latencyBounds) && entry.Duration > latencyBounds[i] {
+		i++
+	}
+	s.latency[i].Add(1)
+}
+
+// counters returns the current counters, creating them on first use
+func (p *DNSProxy) counters() *proxyStats {
+	if stats := p.stats.Load(); stats != nil {
+		return stats
+	}
+	p.stats.CompareAndSwap(nil, newProxyStats())
+	return p.stats.Load()
+}
+
+// Stats returns a snapshot of the proxy's counters
+func (p *DNSProxy) Stats() DNSProxyStats {
+	s := p.counters()
+	stats := DNSProxyStats{
+		Since:                s.since,
+		Queries:              s.queries.Load(),
+		Failures:             s.failures.Load(),
+		SlowQueries:          s.slowQueries.Load(),
+		CoalescedQueries:     s.coalescedQueries.Load(),
+		DGASuspiciousQueries: s.dgaSuspicious.Load(),
+		RateLimitedResponses: s.rateLimited.Load(),
+		Latency:              make([]LatencyBucket, len(s.latency)),
+	}
+	for i := range s.latency {
+		if i < len(latencyBounds) {
+			stats.Latency[i].UpperBound = latencyBounds[i]
+		}
+		stats.Latency[i].Count = s.latency[i].Load()
+	}
+	return stats
+}
+
+// ResetStats zeroes every counter reported by Stats and the *Total methods, for scrapers
+// that compute rates from the counts of each interval
+func (p *DNSProxy) ResetStats() {
+	p.stats.Store(newProxyStats())
+}
@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsAndReset(t *testing.T) {
+	proxy := &DNSProxy{}
+	proxy.logQuery(QueryLogEntry{Name: "a.example.com.", Rcode: 0, Duration: 500 * time.Microsecond})
+	proxy.logQuery(QueryLogEntry{Name: "b.example.com.", Rcode: 0, Duration: 30 * time.Millisecond})
+	proxy.logQuery(QueryLogEntry{Name: "c.example.com.", Rcode: -1, Duration: 2 * time.Second})
+	proxy.counters().coalescedQueries.Add(1)
+
+	stats := proxy.Stats()
+	if stats.Queries != 3 || stats.Failures != 1 || stats.CoalescedQueries != 1 {
+		t.Errorf("Unexpected counters %+v", stats)
+	}
+	if len(stats.Latency) != len(latencyBounds)+1 {
+		t.Fatalf("Expected %d latency buckets, got %d", len(latencyBounds)+1, len(stats.Latency))
+	}
+	want := map[time.Duration]uint64{time.Millisecond: 1, 50 * time.Millisecond: 1, 0: 1}
+	for _, bucket := range stats.Latency {
+		if bucket.Count != want[bucket.UpperBound] {
+			t.Errorf("Expected %d queries up to %v, got %d", want[bucket.UpperBound], bucket.UpperBound, bucket.Count)
+		}
+	}
+
+	proxy.ResetStats()
+	stats = proxy.Stats()
+	if stats.Queries != 0 || stats.Failures != 0 || proxy.CoalescedQueriesTotal() != 0 {
+		t.Errorf("Expected zeroed counters after a reset, got %+v", stats)
+	}
+	for _, bucket := range stats.Latency {
+		if bucket.Count != 0 {
+			t.Errorf("Expected an empty latency histogram after a reset, got %+v", stats.Latency)
+			break
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// tcpConnIdleTimeout closes client TCP connections that stay idle this long
+const tcpConnIdleTimeout = 30 * time.Second
+
+// tcpListenerNeeded reports whether the proxy answers DNS over TCP: zone transfers
+// need it, and so do clients retrying a UDP answer truncated by WithMaxResponseSize
+// or by response rate limiting
+func (p *DNSProxy) tcpListenerNeeded() bool {
+	return p.axfrEnabled || p.maxResponseSize > 0 || p.rrlEnabled
+}
+
+// runTCPListener accepts DNS over TCP connections on the netstack
+func (p *DNSProxy) runTCPListener() {
+	defer p.wg.Done()
+
+	ipBytes := p.proxyIP.As4()
+	laddr := tcpip.FullAddress{
+		NIC:  1,
+		Addr: tcpip.AddrFrom4(ipBytes),
+		Port: p.listenPort,
+	}
+
+	listener, err := gonet.ListenTCP(p.stack, laddr, ipv4.ProtocolNumber)
+	if err != nil {
+		logger.Error("Failed to create DNS TCP listener: %v", err)
+		return
+	}
+
+	// Closing the listener unblocks Accept on shutdown
+	go func() {
+		<-p.ctx.Done()
+		listener.Close()
+	}()
+
+	logger.Debug("DNS proxy listening for TCP on netstack")
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+			logger.Error("DNS TCP accept error: %v", err)
+			continue
+		}
+		go p.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn answers queries on a TCP connection until the client closes it. Zone
+// transfers go to handleAXFR, every other query is answered as over UDP but without
+// the response size limit. Messages are framed with the two byte length prefix used
+// by DNS over TCP.
+func (p *DNSProxy) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	var clientAddr netip.Addr
+	if addr, err := netip.ParseAddrPort(conn.RemoteAddr().String()); err == nil {
+		clientAddr = addr.Addr()
+	}
+
+	dnsConn := &dns.Conn{Conn: conn}
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpConnIdleTimeout))
+		queryData, err := dnsConn.ReadMsgHeader(nil)
+		if err != nil {
+			return
+		}
+
+		query := new(dns.Msg)
+		if err := query.Unpack(queryData); err != nil {
+			logger.Debug("Failed to parse DNS query over TCP: %v", err)
+			return
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(tcpConnIdleTimeout))
+		if len(query.Question) == 1 && query.Question[0].Qtype == dns.TypeAXFR {
+			for _, msg := range p.handleAXFR(query, clientAddr) {
+				if err := dnsConn.WriteMsg(msg); err != nil {
+					logger.Error("Failed to send AXFR response: %v", err)
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(tcpConnIdleTimeout))
+			}
+			continue
+		}
+
+		responseData := p.answerQuery(queryData, conn.RemoteAddr(), false)
+		if responseData == nil {
+			continue
+		}
+		if _, err := dnsConn.Write(responseData); err != nil {
+			logger.Error("Failed to send DNS response over TCP: %v", err)
+			return
+		}
+	}
+}
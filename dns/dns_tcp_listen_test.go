@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startTCPServer serves DNS over TCP for p on a local port and returns its address
+func startTCPServer(t *testing.T, p *DNSProxy) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serveTCPConn(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// exchangeTCP sends query to the DNS over TCP server at addr
+func exchangeTCP(t *testing.T, addr string, query *dns.Msg) *dns.Msg {
+	t.Helper()
+
+	client := &dns.Client{Net: "tcp"}
+	response, _, err := client.Exchange(query, addr)
+	if err != nil {
+		t.Fatalf("TCP exchange failed: %v", err)
+	}
+	return response
+}
+
+func TestTCPListenerNeeded(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DNSProxyOption
+		want bool
+	}{
+		{name: "default", want: false},
+		{name: "axfr", opts: []DNSProxyOption{WithAXFREnabled(true)}, want: true},
+		{name: "max response size", opts: []DNSProxyOption{WithMaxResponseSize(1232)}, want: true},
+		{name: "rrl", opts: []DNSProxyOption{WithRRLEnabled(true)}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newUpdateTestProxy(tt.opts...).tcpListenerNeeded(); got != tt.want {
+				t.Errorf("Expected tcpListenerNeeded %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTCPAnswersTruncatedQuery(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	WithMaxResponseSize(1024)(proxy)
+	for i := 0; i < 200; i++ {
+		proxy.recordStore.AddRecord("big.example.com.", net.IPv4(10, 0, byte(i/256), byte(i%256)))
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("big.example.com.", dns.TypeA)
+	udpResponse := new(dns.Msg)
+	if err := udpResponse.Unpack(exchangeUDP(t, proxy, query)); err != nil {
+		t.Fatalf("Failed to unpack response: %v", err)
+	}
+	if !udpResponse.Truncated {
+		t.Fatal("Expected the UDP response to be truncated")
+	}
+
+	// The client retries over TCP and gets the whole answer
+	response := exchangeTCP(t, startTCPServer(t, proxy), query)
+	if response.Truncated || len(response.Answer) != 200 {
+		t.Errorf("Expected all 200 records over TCP, got TC=%v with %d records", response.Truncated, len(response.Answer))
+	}
+}
+
+func TestTCPNotRateLimited(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore(), ctx: context.Background()}
+	WithRRLEnabled(true)(proxy)
+	WithRRLRequestsPerSecond(1)(proxy)
+	WithRRLSlipRate(0)(proxy)
+	proxy.recordStore.AddRecord("app.example.com.", net.ParseIP("10.0.0.1"))
+	addr := startTCPServer(t, proxy)
+
+	query := new(dns.Msg)
+	query.SetQuestion("app.example.com.", dns.TypeA)
+	var truncated bool
+	for i := 0; i < 5; i++ {
+		response := new(dns.Msg)
+		if err := response.Unpack(exchangeUDP(t, proxy, query)); err != nil {
+			t.Fatalf("Failed to unpack response: %v", err)
+		}
+		truncated = truncated || response.Truncated
+	}
+	if !truncated {
+		t.Fatal("Expected UDP responses to be rate limited")
+	}
+
+	// The same client is not limited when it retries over TCP
+	for i := 0; i < 5; i++ {
+		if response := exchangeTCP(t, addr, query); response.Truncated || len(response.Answer) != 1 {
+			t.Fatalf("Expected a full answer over TCP, got TC=%v with %d records", response.Truncated, len(response.Answer))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultTCPPoolSize is how many idle TCP connections are kept per upstream server
+	defaultTCPPoolSize = 4
+	// defaultTCPIdleTimeout is how long an idle upstream TCP connection is kept
+	defaultTCPIdleTimeout = 30 * time.Second
+	// tcpUpstreamPrefix marks an upstream server queried over TCP, e.g. "tcp://1.1.1.1:53"
+	tcpUpstreamPrefix = "tcp://"
+	// tcpProbeTimeout is how long a pooled connection is read from to see if it was closed
+	tcpProbeTimeout = time.Millisecond
+)
+
+// WithTCPPoolSize sets how many idle TCP connections are kept per upstream server for
+// reuse, 4 by default. Upstream queries go over TCP when a UDP response is truncated
+// or the server is given as tcp://host:port. 0 opens a new connection for every query.
+func WithTCPPoolSize(n int) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.tcpPoolSize = max(n, 0)
+	}
+}
+
+// WithTCPIdleTimeout sets how long an idle upstream TCP connection is kept for reuse,
+// 30 seconds by default
+func WithTCPIdleTimeout(d time.Duration) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.tcpIdleTimeout = d
+	}
+}
+
+// TCPConnectionPool keeps idle TCP connections to upstream servers so queries do not
+// pay for a handshake each. A nil pool keeps no connections.
+type TCPConnectionPool struct {
+	size        int
+	idleTimeout time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]pooledConn // server address -> idle connections, most recent last
+}
+
+// pooledConn is an idle connection and when it was returned to the pool
+type pooledConn struct {
+	conn      *dns.Conn
+	idleSince time.Time
+}
+
+// NewTCPConnectionPool creates a pool keeping up to size idle connections per server
+// for at most idleTimeout
+func NewTCPConnectionPool(size int, idleTimeout time.Duration) *TCPConnectionPool {
+	return &TCPConnectionPool{
+		size:        size,
+		idleTimeout: idleTimeout,
+		idle:        make(map[string][]pooledConn),
+	}
+}
+
+// Get returns an idle connection to server that is still open, or nil if there is none.
+// Connections idle too long or closed by the server are closed and skipped.
+func (p *TCPConnectionPool) Get(server string) *dns.Conn {
+	if p == nil {
+		return nil
+	}
+
+	for {
+		p.mu.Lock()
+		conns := p.idle[server]
+		if len(conns) == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		pc := conns[len(conns)-1]
+		p.idle[server] = conns[:len(conns)-1]
+		p.mu.Unlock()
+
+		if time.Since(pc.idleSince) <= p.idleTimeout && connAlive(pc.conn) {
+			return pc.conn
+		}
+		pc.conn.Close()
+	}
+}
+
+// Put returns conn to the pool after a successful exchange with server, closing it if
+// the pool for server is full
+func (p *TCPConnectionPool) Put(server string, conn *dns.Conn) {
+	if p == nil || p.size == 0 {
+		conn.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idle == nil || len(p.idle[server]) >= p.size {
+		conn.Close()
+		return
+	}
+	p.idle[server] = append(p.idle[server], pooledConn{conn: conn, idleSince: time.Now()})
+}
+
+// Close closes every idle connection, later Puts close their connection
+func (p *TCPConnectionPool) Close() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, conns := range p.idle {
+		for _, pc := range conns {
+			pc.conn.Close()
+		}
+	}
+	p.idle = nil
+}
+
+// connAlive reports whether the server has not closed conn. An idle DNS connection has
+// nothing to read, so a short read that times out means it is still open, while EOF or
+// unexpected data means it cannot be reused.
+func connAlive(conn *dns.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(tcpProbeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := conn.Conn.Read(b[:])
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// tcpUpstream returns the address of server and whether it is to be queried over TCP
+func tcpUpstream(server string) (string, bool) {
+	return strings.CutPrefix(server, tcpUpstreamPrefix)
+}
+
+// queryUpstreamTCP sends a DNS query to server over TCP, reusing a pooled connection if
+// there is one
+func (p *DNSProxy) queryUpstreamTCP(ctx context.Context, server string, query *dns.Msg) (*dns.Msg, error) {
+	if conn := p.tcpPool.Get(server); conn != nil {
+		response, err := p.exchangeTCP(ctx, server, query, conn)
+		if err == nil || ctx.Err() != nil {
+			return response, err
+		}
+		// The server may have closed the connection since it was checked
+		logger.Debug("Pooled TCP connection to %s failed, dialing a new one: %v", server, err)
+	}
+
+	client := &dns.Client{Net: "tcp"}
+	conn, err := client.DialContext(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	return p.exchangeTCP(ctx, server, query, conn)
+}
+
+// exchangeTCP sends query over conn, returning conn to the pool after a response
+func (p *DNSProxy) exchangeTCP(ctx context.Context, server string, query *dns.Msg, conn *dns.Conn) (*dns.Msg, error) {
+	// End the read when ctx is cancelled, as for UDP
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+
+	client := &dns.Client{Net: "tcp"}
+	response, _, err := client.ExchangeWithConnContext(ctx, query, conn)
+	if !stop() {
+		// ctx was cancelled and cut the deadline short, so conn cannot be reused
+		conn.Close()
+		return response, err
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	p.tcpPool.Put(server, conn)
+	return response, nil
+}
@@ -0,0 +1,125 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// countingListener counts the connections it accepts
+type countingListener struct {
+	net.Listener
+	accepts atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepts.Add(1)
+	}
+	return conn, err
+}
+
+// startTCPUpstream runs a DNS server answering A queries over TCP, and over UDP with a
+// truncated empty response, on the same port. serverIdle is how long the server keeps an
+// idle connection open.
+func startTCPUpstream(t *testing.T, serverIdle time.Duration) (string, *countingListener) {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+			m.Truncated = true
+		} else {
+			hdr := dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("192.0.2.1")})
+		}
+		w.WriteMsg(m)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	listener := &countingListener{Listener: ln}
+	conn, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+
+	idle := func() time.Duration { return serverIdle }
+	tcpServer := &dns.Server{Listener: listener, Handler: handler, IdleTimeout: idle}
+	udpServer := &dns.Server{PacketConn: conn, Handler: handler}
+	go tcpServer.ActivateAndServe()
+	go udpServer.ActivateAndServe()
+	t.Cleanup(func() {
+		tcpServer.Shutdown()
+		udpServer.Shutdown()
+	})
+
+	return ln.Addr().String(), listener
+}
+
+// queryA resolves name through server with queryUpstream
+func queryA(t *testing.T, proxy *DNSProxy, server, name string) {
+	t.Helper()
+
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeA)
+	response, err := proxy.queryUpstream(context.Background(), server, query, 2*time.Second)
+	if err != nil {
+		t.Fatalf("queryUpstream failed: %v", err)
+	}
+	if response.Truncated || len(response.Answer) != 1 {
+		t.Fatalf("Expected the full TCP answer, got %v", response)
+	}
+}
+
+func TestTCPConnectionPoolReuse(t *testing.T) {
+	addr, listener := startTCPUpstream(t, time.Minute)
+	proxy := &DNSProxy{ctx: context.Background(), tcpPool: NewTCPConnectionPool(2, time.Minute)}
+	defer proxy.tcpPool.Close()
+
+	// Explicit TCP upstreams and truncated UDP responses share the pool
+	for _, name := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+		queryA(t, proxy, tcpUpstreamPrefix+addr, name)
+	}
+	queryA(t, proxy, addr, "d.example.com.")
+
+	if n := listener.accepts.Load(); n != 1 {
+		t.Errorf("Expected 1 TCP connection to be reused, got %d", n)
+	}
+}
+
+func TestTCPConnectionPoolStaleConnections(t *testing.T) {
+	tests := []struct {
+		name        string
+		serverIdle  time.Duration
+		idleTimeout time.Duration
+		size        int
+	}{
+		{name: "closed by server", serverIdle: 20 * time.Millisecond, idleTimeout: time.Minute, size: 2},
+		{name: "idle timeout", serverIdle: time.Minute, idleTimeout: 20 * time.Millisecond, size: 2},
+		{name: "pooling disabled", serverIdle: time.Minute, idleTimeout: time.Minute, size: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, listener := startTCPUpstream(t, tt.serverIdle)
+			proxy := &DNSProxy{ctx: context.Background(), tcpPool: NewTCPConnectionPool(tt.size, tt.idleTimeout)}
+			defer proxy.tcpPool.Close()
+
+			queryA(t, proxy, tcpUpstreamPrefix+addr, "a.example.com.")
+			time.Sleep(100 * time.Millisecond)
+			queryA(t, proxy, tcpUpstreamPrefix+addr, "b.example.com.")
+
+			if n := listener.accepts.Load(); n != 2 {
+				t.Errorf("Expected a new connection for the second query, got %d connections", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+)
+
+// tenantKey is the context key of the tenant a query belongs to
+type tenantKey struct{}
+
+// WithTenantResolver maps each client to a tenant so tenants sharing the proxy see their
+// own local records. Queries from a client resolved to a non-empty tenant are answered
+// from that tenant's store, see TenantStore. Clients resolved to an empty tenant use the
+// default record store. Upstream forwarding and the negative cache are shared.
+func WithTenantResolver(fn func(clientIP netip.Addr) string) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.tenantResolver = fn
+	}
+}
+
+// TenantStore returns the record store of tenant, creating an empty one if it has none
+func (p *DNSProxy) TenantStore(tenant string) *DNSRecordStore {
+	if store, ok := p.tenantStores.Load(tenant); ok {
+		return store.(*DNSRecordStore)
+	}
+	store, _ := p.tenantStores.LoadOrStore(tenant, NewDNSRecordStore())
+	return store.(*DNSRecordStore)
+}
+
+// RemoveTenant drops the record store of tenant, stopping its health checks
+// Its clients are answered from an empty store until records are added again.
+func (p *DNSProxy) RemoveTenant(tenant string) {
+	if store, ok := p.tenantStores.LoadAndDelete(tenant); ok {
+		store.(*DNSRecordStore).Clear()
+	}
+}
+
+// tenantFor returns the tenant of the client at clientAddr, or an empty string without
+// a tenant resolver
+func (p *DNSProxy) tenantFor(clientAddr net.Addr) string {
+	if p.tenantResolver == nil {
+		return ""
+	}
+	addrPort, err := netip.ParseAddrPort(clientAddr.String())
+	if err != nil {
+		return ""
+	}
+	return p.tenantResolver(addrPort.Addr().Unmap())
+}
+
+// withTenant returns ctx carrying tenant, or ctx itself for the default tenant
+func withTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// localStore returns the record store for the tenant of the query ctx belongs to
+func (p *DNSProxy) localStore(ctx context.Context) RecordStore {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return p.TenantStore(tenant)
+	}
+	return p.recordStore
+}
@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestTenantStores(t *testing.T) {
+	proxy := &DNSProxy{recordStore: NewDNSRecordStore()}
+	WithTenantResolver(func(clientIP netip.Addr) string {
+		if clientIP == netip.MustParseAddr("10.0.0.2") {
+			return "acme"
+		}
+		return ""
+	})(proxy)
+
+	proxy.recordStore.AddRecord("app.internal.", net.ParseIP("192.168.0.1"))
+	proxy.TenantStore("acme").AddRecord("app.internal.", net.ParseIP("172.16.0.1"))
+	if proxy.TenantStore("acme") != proxy.TenantStore("acme") {
+		t.Fatal("Expected the same store for the same tenant")
+	}
+
+	resolve := func(client string) *dns.Msg {
+		t.Helper()
+		ctx := withTenant(context.Background(), proxy.tenantFor(&net.UDPAddr{IP: net.ParseIP(client), Port: 5353}))
+		query := new(dns.Msg)
+		query.SetQuestion("app.internal.", dns.TypeA)
+		return proxy.checkLocalRecords(ctx, query, query.Question[0])
+	}
+
+	tests := []struct {
+		client string
+		want   string
+	}{
+		{"10.0.0.1", "192.168.0.1"},
+		{"10.0.0.2", "172.16.0.1"},
+	}
+	for _, tt := range tests {
+		response := resolve(tt.client)
+		if response == nil || len(response.Answer) != 1 {
+			t.Fatalf("Expected one answer for %s, got %v", tt.client, response)
+		}
+		if a := response.Answer[0].(*dns.A); a.A.String() != tt.want {
+			t.Errorf("Expected %s for %s, got %s", tt.want, tt.client, a.A)
+		}
+	}
+
+	proxy.RemoveTenant("acme")
+	if response := resolve("10.0.0.2"); response != nil {
+		t.Errorf("Expected no local records after removing the tenant, got %v", response)
+	}
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"container/list"
+	"errors"
+	"maps"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or Rollback
+var ErrTxDone = errors.New("DNS transaction has already been committed or rolled back")
+
+// txOp is a single pending change in a DNSTransaction
+type txOp struct {
+	remove bool
+	domain string
+	ip     net.IP
+}
+
+// DNSTransaction collects record changes and applies them to a DNSRecordStore
+// all at once. Readers of the store never see a partially applied transaction.
+type DNSTransaction struct {
+	store *DNSRecordStore
+	delta []txOp
+	done  bool
+}
+
+// BeginTx starts a transaction on the store
+// Only one transaction may be open at a time, so BeginTx blocks until the
+// previous transaction is committed or rolled back
+func (s *DNSRecordStore) BeginTx() *DNSTransaction {
+	s.txMu.Lock()
+	return &DNSTransaction{store: s}
+}
+
+// AddRecord queues adding a DNS record mapping (A or AAAA)
+func (tx *DNSTransaction) AddRecord(domain string, ip net.IP) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if ip.To16() == nil {
+		return &net.ParseError{Type: "IP address", Text: ip.String()}
+	}
+
+	tx.delta = append(tx.delta, txOp{domain: domain, ip: ip})
+	return nil
+}
+
+// RemoveRecord queues removing a DNS record mapping
+// If ip is nil, all records for the domain are removed
+func (tx *DNSTransaction) RemoveRecord(domain string, ip net.IP) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.delta = append(tx.delta, txOp{remove: true, domain: domain, ip: ip})
+	return nil
+}
+
+// Commit applies the queued changes atomically
+// If any change fails, for example because a store limit is reached or a wildcard
+// pattern is invalid, none are applied. Subscribers are told about the committed
+// changes once the transaction is done.
+func (tx *DNSTransaction) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	events, err := tx.apply()
+	tx.finish()
+	if err != nil {
+		return err
+	}
+
+	tx.store.publish(events...)
+	return nil
+}
+
+// apply makes the queued changes under the store lock, undoing them all if one fails,
+// and returns the subscriber events for them
+func (tx *DNSTransaction) apply() ([]RecordEvent, error) {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := s.snapshotLocked()
+	notify := s.hasSubscribers()
+
+	var events []RecordEvent
+	for _, op := range tx.delta {
+		if op.remove {
+			var before []RecordEvent
+			if notify {
+				before = s.recordEventsLocked(op.domain, RecordRemoved)
+			}
+			s.removeRecordLocked(op.domain, op.ip)
+			if notify {
+				events = append(events, removedEvents(before, s.recordEventsLocked(op.domain, RecordRemoved))...)
+			}
+			continue
+		}
+		added, err := s.addRecordLocked(op.domain, op.ip)
+		if err != nil {
+			s.restoreLocked(snap)
+			return nil, err
+		}
+		if added && notify {
+			addr, _ := ipToAddr(op.ip)
+			events = append(events, addedEvent(op.domain, addr))
+		}
+	}
+
+	return events, nil
+}
+
+// Rollback discards the queued changes
+func (tx *DNSTransaction) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.finish()
+}
+
+func (tx *DNSTransaction) finish() {
+	tx.done = true
+	tx.delta = nil
+	tx.store.txMu.Unlock()
+}
+
+// recordSnapshot holds the A and AAAA state a transaction may change
+type recordSnapshot struct {
+	aRecords      map[string][]netip.Addr
+	aaaaRecords   map[string][]netip.Addr
+	aWildcards    *dnsTrie
+	aaaaWildcards *dnsTrie
+	ptrRecords    map[netip.Addr][]string
+	expiries      map[string]map[string]time.Time
+	weights       map[string]map[string]uint
+	lru           []string
+}
+
+// snapshotLocked copies the A, AAAA and PTR state of the store
+// The caller must hold s.mu
+func (s *DNSRecordStore) snapshotLocked() *recordSnapshot {
+	snap := &recordSnapshot{
+		aRecords:      cloneAddrMap(s.aRecords),
+		aaaaRecords:   cloneAddrMap(s.aaaaRecords),
+		aWildcards:    s.aWildcards.clone(),
+		aaaaWildcards: s.aaaaWildcards.clone(),
+		ptrRecords:    make(map[netip.Addr][]string, len(s.ptrRecords)),
+		expiries:      make(map[string]map[string]time.Time, len(s.expiries)),
+		weights:       make(map[string]map[string]uint, len(s.weights)),
+	}
+	for ip, domains := range s.ptrRecords {
+		snap.ptrRecords[ip] = append([]string(nil), domains...)
+	}
+	for domain, expiries := range s.expiries {
+		snap.expiries[domain] = maps.Clone(expiries)
+	}
+	for domain, weights := range s.weights {
+		snap.weights[domain] = maps.Clone(weights)
+	}
+
+	if s.lruEnabled() {
+		s.lruMu.Lock()
+		for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+			snap.lru = append(snap.lru, elem.Value.(string))
+		}
+		s.lruMu.Unlock()
+	}
+
+	return snap
+}
+
+// restoreLocked puts back the state captured by snapshotLocked
+// The caller must hold s.mu for writing
+func (s *DNSRecordStore) restoreLocked(snap *recordSnapshot) {
+	s.aRecords = snap.aRecords
+	s.aaaaRecords = snap.aaaaRecords
+	s.aWildcards = snap.aWildcards
+	s.aaaaWildcards = snap.aaaaWildcards
+	s.ptrRecords = snap.ptrRecords
+	s.expiries = snap.expiries
+	s.weights = snap.weights
+
+	if s.lruEnabled() {
+		s.lruMu.Lock()
+		s.lru = list.New()
+		s.lruIndex = make(map[string]*list.Element, len(snap.lru))
+		for _, domain := range snap.lru {
+			s.lruIndex[domain] = s.lru.PushBack(domain)
+		}
+		s.lruMu.Unlock()
+	}
+}
+
+func cloneAddrMap(m map[string][]netip.Addr) map[string][]netip.Addr {
+	clone := make(map[string][]netip.Addr, len(m))
+	for domain, addrs := range m {
+		clone[domain] = append([]netip.Addr(nil), addrs...)
+	}
+	return clone
+}
@@ -0,0 +1,212 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("old.example.com.", net.ParseIP("10.0.0.1"))
+
+	tx := store.BeginTx()
+	tx.AddRecord("a.example.com.", net.ParseIP("10.0.0.2"))
+	tx.AddRecord("*.wild.example.com.", net.ParseIP("10.0.0.3"))
+	tx.RemoveRecord("old.example.com.", nil)
+
+	// Nothing is visible before commit
+	if store.HasRecord("a.example.com.", RecordTypeA) {
+		t.Error("Expected queued record to be invisible before commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if !store.HasRecord("a.example.com.", RecordTypeA) {
+		t.Error("Expected committed record")
+	}
+	if !store.HasRecord("x.wild.example.com.", RecordTypeA) {
+		t.Error("Expected committed wildcard record")
+	}
+	if store.HasRecord("old.example.com.", RecordTypeA) || store.HasPTRRecordForIP(net.ParseIP("10.0.0.1")) {
+		t.Error("Expected removed record and its PTR to be gone")
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Expected ErrTxDone on second commit, got %v", err)
+	}
+	if err := tx.AddRecord("b.example.com.", net.ParseIP("10.0.0.4")); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Expected ErrTxDone after commit, got %v", err)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("keep.example.com.", net.ParseIP("10.0.0.1"))
+
+	tx := store.BeginTx()
+	tx.AddRecord("new.example.com.", net.ParseIP("10.0.0.2"))
+	tx.RemoveRecord("keep.example.com.", nil)
+	tx.Rollback()
+	tx.Rollback()
+
+	if store.HasRecord("new.example.com.", RecordTypeA) {
+		t.Error("Expected rolled back record to be absent")
+	}
+	if ips := store.GetRecords("keep.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected existing record to be unchanged, got %v", ips)
+	}
+
+	// A failing commit leaves the store unchanged
+	limited := NewDNSRecordStore(WithMaxExactEntries(2))
+	limited.AddRecord("keep.example.com.", net.ParseIP("10.0.0.1"))
+
+	tx = limited.BeginTx()
+	tx.RemoveRecord("keep.example.com.", nil)
+	tx.AddRecord("a.example.com.", net.ParseIP("10.0.0.2"))
+	tx.AddRecord("b.example.com.", net.ParseIP("10.0.0.3"))
+	tx.AddRecord("c.example.com.", net.ParseIP("10.0.0.4"))
+	if err := tx.Commit(); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("Expected ErrStoreFull, got %v", err)
+	}
+
+	if ips := limited.GetRecords("keep.example.com.", RecordTypeA); len(ips) != 1 {
+		t.Errorf("Expected existing record to survive failed commit, got %v", ips)
+	}
+	if !limited.HasPTRRecordForIP(net.ParseIP("10.0.0.1")) {
+		t.Error("Expected existing PTR record to survive failed commit")
+	}
+	for _, domain := range []string{"a.example.com.", "b.example.com."} {
+		if limited.HasRecord(domain, RecordTypeA) {
+			t.Errorf("Expected %s not to be added by failed commit", domain)
+		}
+	}
+}
+
+func TestTransactionSingleOpen(t *testing.T) {
+	store := NewDNSRecordStore()
+	tx := store.BeginTx()
+
+	started := make(chan struct{})
+	go func() {
+		second := store.BeginTx()
+		close(started)
+		second.Rollback()
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("Expected second BeginTx to block while a transaction is open")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tx.Rollback()
+	<-started
+}
+
+func TestTransactionConsistentSnapshot(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	const ips = 50
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	inconsistent := make(chan int, 1)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			// A reader sees all of the transaction's addresses or none of them
+			if n := len(store.GetRecords("host.example.com.", RecordTypeA)); n != 0 && n != ips {
+				select {
+				case inconsistent <- n:
+				default:
+				}
+			}
+		}
+	}()
+
+	for round := 0; round < 20; round++ {
+		tx := store.BeginTx()
+		for i := 0; i < ips; i++ {
+			ip := net.IPv4(10, 0, 0, byte(i))
+			if round%2 == 0 {
+				tx.AddRecord("host.example.com.", ip)
+			} else {
+				tx.RemoveRecord("host.example.com.", ip)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	select {
+	case n := <-inconsistent:
+		t.Errorf("Expected 0 or %d records, reader saw %d", ips, n)
+	default:
+	}
+}
+
+func TestTransactionInvalidWildcardUnlimited(t *testing.T) {
+	store := NewDNSRecordStore()
+
+	tx := store.BeginTx()
+	tx.AddRecord("a.example.com.", net.ParseIP("10.0.0.1"))
+	tx.AddRecord("*.exa mple..com.", net.ParseIP("10.0.0.2"))
+	if err := tx.Commit(); !errors.Is(err, ErrInvalidDomain) {
+		t.Fatalf("Expected ErrInvalidDomain, got %v", err)
+	}
+
+	if ips := store.GetRecords("a.example.com.", RecordTypeA); len(ips) != 0 {
+		t.Errorf("Expected the valid add to be rolled back, got %v", ips)
+	}
+}
+
+func TestTransactionPublishesEvents(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("old.example.com.", net.ParseIP("10.0.0.1"))
+
+	var events []RecordEvent
+	store.Subscribe("test", func(event RecordEvent) { events = append(events, event) })
+
+	tx := store.BeginTx()
+	tx.AddRecord("a.example.com.", net.ParseIP("10.0.0.2"))
+	tx.RemoveRecord("old.example.com.", nil)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %v", events)
+	}
+	if events[0].Type != RecordAdded || events[0].Domain != "a.example.com." || !events[0].IP.Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Expected the add event first, got %+v", events[0])
+	}
+	if events[1].Type != RecordRemoved || events[1].Domain != "old.example.com." || !events[1].IP.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected the remove event second, got %+v", events[1])
+	}
+
+	// A failed commit publishes nothing
+	events = nil
+	tx = store.BeginTx()
+	tx.AddRecord("b.example.com.", net.ParseIP("10.0.0.3"))
+	tx.AddRecord("*.exa mple..com.", net.ParseIP("10.0.0.4"))
+	tx.Commit()
+	if len(events) != 0 {
+		t.Errorf("Expected no events from a failed commit, got %v", events)
+	}
+}
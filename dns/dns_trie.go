@@ -0,0 +1,211 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// dnsTrie stores wildcard patterns keyed by their literal labels in reverse order,
+// so a lookup only visits the nodes along the queried name instead of every pattern.
+// The labels left of and including the rightmost label containing * or ? are kept
+// as a residual pattern on the node reached by the literal suffix.
+type dnsTrie struct {
+	root  *dnsTrieNode
+	count int
+}
+
+type dnsTrieNode struct {
+	children  map[string]*dnsTrieNode // literal label -> child node
+	wildcards map[string][]net.IP     // residual wildcard pattern -> IPs
+}
+
+func newDNSTrie() *dnsTrie {
+	return &dnsTrie{root: &dnsTrieNode{}}
+}
+
+// splitPattern splits a lowercase FQDN wildcard pattern into its literal labels,
+// right to left, and the residual wildcard pattern
+func splitPattern(pattern string) ([]string, string) {
+	labels := strings.Split(strings.TrimSuffix(pattern, "."), ".")
+
+	i := len(labels) - 1
+	for i >= 0 && !strings.ContainsAny(labels[i], "*?") {
+		i--
+	}
+
+	literal := make([]string, 0, len(labels)-i-1)
+	for j := len(labels) - 1; j > i; j-- {
+		literal = append(literal, labels[j])
+	}
+	return literal, strings.Join(labels[:i+1], ".")
+}
+
+// len returns the number of patterns in the trie
+func (t *dnsTrie) len() int {
+	return t.count
+}
+
+// get returns the IPs stored for pattern
+func (t *dnsTrie) get(pattern string) ([]net.IP, bool) {
+	literal, residual := splitPattern(pattern)
+
+	node := t.root
+	for _, label := range literal {
+		node = node.children[label]
+		if node == nil {
+			return nil, false
+		}
+	}
+
+	ips, ok := node.wildcards[residual]
+	return ips, ok
+}
+
+// set stores ips for pattern, replacing any existing IPs
+func (t *dnsTrie) set(pattern string, ips []net.IP) {
+	literal, residual := splitPattern(pattern)
+
+	node := t.root
+	for _, label := range literal {
+		child := node.children[label]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*dnsTrieNode)
+			}
+			child = &dnsTrieNode{}
+			node.children[label] = child
+		}
+		node = child
+	}
+
+	if node.wildcards == nil {
+		node.wildcards = make(map[string][]net.IP)
+	}
+	if _, exists := node.wildcards[residual]; !exists {
+		t.count++
+	}
+	node.wildcards[residual] = ips
+}
+
+// delete removes pattern and prunes nodes left empty
+func (t *dnsTrie) delete(pattern string) {
+	literal, residual := splitPattern(pattern)
+
+	path := make([]*dnsTrieNode, 0, len(literal)+1)
+	node := t.root
+	path = append(path, node)
+	for _, label := range literal {
+		node = node.children[label]
+		if node == nil {
+			return
+		}
+		path = append(path, node)
+	}
+
+	if _, exists := node.wildcards[residual]; !exists {
+		return
+	}
+	delete(node.wildcards, residual)
+	t.count--
+
+	for i := len(path) - 1; i > 0; i-- {
+		if len(path[i].children) > 0 || len(path[i].wildcards) > 0 {
+			break
+		}
+		delete(path[i-1].children, literal[i-1])
+	}
+}
+
+// checkLimit returns ErrStoreFull if adding pattern would exceed limit
+func (t *dnsTrie) checkLimit(pattern string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	if _, exists := t.get(pattern); exists {
+		return nil
+	}
+	if t.count >= limit {
+		return fmt.Errorf("%w: cannot add %s, limit of %d reached", ErrStoreFull, pattern, limit)
+	}
+	return nil
+}
+
+// walk calls visit with the IPs of every pattern matching domain until visit returns
+// false, matching residuals with their compiled form when compiled has one
+func (t *dnsTrie) walk(domain string, compiled map[string]*CompiledPattern, visit func(ips []net.IP) bool) {
+	name := strings.TrimSuffix(domain, ".")
+
+	node := t.root
+	end := len(name)
+	for node != nil && end > 0 {
+		prefix := name[:end]
+		for residual, ips := range node.wildcards {
+			if matchResidual(compiled, residual, prefix) && !visit(ips) {
+				return
+			}
+		}
+
+		start := strings.LastIndexByte(prefix, '.') + 1
+		node = node.children[prefix[start:]]
+		end = start - 1
+	}
+}
+
+// match returns the IPs of all patterns matching domain
+func (t *dnsTrie) match(domain string, compiled map[string]*CompiledPattern) []net.IP {
+	var records []net.IP
+	t.walk(domain, compiled, func(ips []net.IP) bool {
+		records = append(records, ips...)
+		return true
+	})
+	return records
+}
+
+// matches reports whether any pattern matches domain
+func (t *dnsTrie) matches(domain string, compiled map[string]*CompiledPattern) bool {
+	found := false
+	t.walk(domain, compiled, func([]net.IP) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// patterns returns every pattern in the trie with its IPs
+func (t *dnsTrie) patterns() map[string][]net.IP {
+	patterns := make(map[string][]net.IP, t.count)
+	var visit func(node *dnsTrieNode, suffix string)
+	visit = func(node *dnsTrieNode, suffix string) {
+		for residual, ips := range node.wildcards {
+			patterns[residual+"."+suffix] = ips
+		}
+		for label, child := range node.children {
+			visit(child, label+"."+suffix)
+		}
+	}
+	visit(t.root, "")
+	return patterns
+}
+
+// clone returns a deep copy of the trie
+func (t *dnsTrie) clone() *dnsTrie {
+	return &dnsTrie{root: t.root.clone(), count: t.count}
+}
+
+func (n *dnsTrieNode) clone() *dnsTrieNode {
+	c := &dnsTrieNode{}
+	if n.children != nil {
+		c.children = make(map[string]*dnsTrieNode, len(n.children))
+		for label, child := range n.children {
+			c.children[label] = child.clone()
+		}
+	}
+	if n.wildcards != nil {
+		c.wildcards = make(map[string][]net.IP, len(n.wildcards))
+		for residual, ips := range n.wildcards {
+			c.wildcards[residual] = append([]net.IP(nil), ips...)
+		}
+	}
+	return c
+}
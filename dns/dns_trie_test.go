@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestDNSTrieMatchesLinearScan(t *testing.T) {
+	patterns := []string{
+		"*.",
+		"*.autoco.internal.",
+		"*.sub.autoco.internal.",
+		"host-*.autoco.internal.",
+		"?.autoco.internal.",
+		"web?.autoco.internal.",
+		"*.web.*.internal.",
+		"a*c.example.com.",
+		"example.*.",
+	}
+	domains := []string{
+		"autoco.internal.",
+		"host.autoco.internal.",
+		"a.b.autoco.internal.",
+		"x.sub.autoco.internal.",
+		"host-1.autoco.internal.",
+		"a.autoco.internal.",
+		"web1.autoco.internal.",
+		"api.web.prod.internal.",
+		"ab.xc.example.com.",
+		"abc.example.com.",
+		"example.org.",
+		"unrelated.test.",
+		".",
+	}
+
+	trie := newDNSTrie()
+	linear := make(map[string][]net.IP)
+	for i, pattern := range patterns {
+		ip := []net.IP{net.IPv4(10, 0, 0, byte(i+1))}
+		trie.set(pattern, ip)
+		linear[pattern] = ip
+	}
+	if trie.len() != len(patterns) {
+		t.Fatalf("Expected %d patterns, got %d", len(patterns), trie.len())
+	}
+
+	for _, domain := range domains {
+		expected := 0
+		for pattern := range linear {
+			if matchWildcard(pattern, domain) {
+				expected++
+			}
+		}
+
+		if got := len(trie.match(domain, nil)); got != expected {
+			t.Errorf("%s: expected %d matches, got %d", domain, expected, got)
+		}
+		if trie.matches(domain, nil) != (expected > 0) {
+			t.Errorf("%s: expected matches to be %v", domain, expected > 0)
+		}
+	}
+}
+
+func TestDNSTrieDelete(t *testing.T) {
+	trie := newDNSTrie()
+	trie.set("*.a.example.com.", []net.IP{net.ParseIP("10.0.0.1")})
+	trie.set("*.example.com.", []net.IP{net.ParseIP("10.0.0.2")})
+
+	trie.delete("*.a.example.com.")
+	trie.delete("*.missing.example.com.")
+
+	if trie.len() != 1 {
+		t.Errorf("Expected 1 pattern, got %d", trie.len())
+	}
+	if _, ok := trie.get("*.a.example.com."); ok {
+		t.Error("Expected deleted pattern to be gone")
+	}
+	if ips := trie.match("host.a.example.com.", nil); len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Expected only the remaining pattern to match, got %v", ips)
+	}
+
+	trie.delete("*.example.com.")
+	if len(trie.root.children) != 0 {
+		t.Errorf("Expected empty nodes to be pruned, got %v", trie.root.children)
+	}
+}
+
+func wildcardBenchmarkPatterns(n int) map[string][]net.IP {
+	patterns := make(map[string][]net.IP, n)
+	for i := 0; i < n; i++ {
+		patterns[fmt.Sprintf("*.svc%d.example.com.", i)] = []net.IP{net.IPv4(10, byte(i>>16), byte(i>>8), byte(i))}
+	}
+	return patterns
+}
+
+// BenchmarkWildcardLookupLinear measures the previous approach of scanning every pattern
+func BenchmarkWildcardLookupLinear(b *testing.B) {
+	patterns := wildcardBenchmarkPatterns(10000)
+	domain := "host.svc9999.example.com."
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var records []net.IP
+		for pattern, ips := range patterns {
+			if matchWildcard(pattern, domain) {
+				records = append(records, ips...)
+			}
+		}
+		if len(records) != 1 {
+			b.Fatalf("Expected 1 match, got %d", len(records))
+		}
+	}
+}
+
+func BenchmarkWildcardLookupTrie(b *testing.B) {
+	store := NewDNSRecordStore()
+	for pattern, ips := range wildcardBenchmarkPatterns(10000) {
+		store.AddRecord(pattern, ips[0])
+	}
+	domain := "host.svc9999.example.com."
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if records := store.GetRecords(domain, RecordTypeA); len(records) != 1 {
+			b.Fatalf("Expected 1 match, got %d", len(records))
+		}
+	}
+}
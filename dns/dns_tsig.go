@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the allowed clock skew in seconds for signed responses
+const tsigFudge = 300
+
+// tsigKey is a shared secret used to authenticate DNS UPDATE messages
+type tsigKey struct {
+	algorithm string
+	secret    string // base64 encoded
+}
+
+// WithTSIGRequired refuses every DNS UPDATE that is not signed with a known TSIG key
+func WithTSIGRequired(required bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.tsigRequired = required
+	}
+}
+
+// AddTSIGKey adds or replaces a TSIG key used to verify DNS UPDATE messages
+// algorithm is a TSIG algorithm name such as "hmac-sha256" and secret is base64 encoded.
+// Once any key is configured, unsigned updates are refused.
+func (p *DNSProxy) AddTSIGKey(keyName, algorithm, secret string) error {
+	algorithm = strings.ToLower(dns.Fqdn(algorithm))
+	switch algorithm {
+	case dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512:
+	default:
+		return fmt.Errorf("unsupported TSIG algorithm %s", algorithm)
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		return fmt.Errorf("TSIG secret for %s is not valid base64: %w", keyName, err)
+	}
+
+	p.tsigLock.Lock()
+	defer p.tsigLock.Unlock()
+
+	if p.tsigKeys == nil {
+		p.tsigKeys = make(map[string]tsigKey)
+	}
+	p.tsigKeys[strings.ToLower(dns.Fqdn(keyName))] = tsigKey{algorithm: algorithm, secret: secret}
+	return nil
+}
+
+// RemoveTSIGKey removes a TSIG key so updates signed with it are refused
+func (p *DNSProxy) RemoveTSIGKey(keyName string) {
+	p.tsigLock.Lock()
+	defer p.tsigLock.Unlock()
+
+	delete(p.tsigKeys, strings.ToLower(dns.Fqdn(keyName)))
+}
+
+// lookupTSIGKey returns the key with the given name
+func (p *DNSProxy) lookupTSIGKey(keyName string) (tsigKey, bool) {
+	p.tsigLock.RLock()
+	defer p.tsigLock.RUnlock()
+
+	key, ok := p.tsigKeys[strings.ToLower(keyName)]
+	return key, ok
+}
+
+// authenticateUpdate verifies the TSIG signature of an update against raw, the message as received
+// Unsigned updates are accepted only when no key is configured and TSIG is not required
+func (p *DNSProxy) authenticateUpdate(msg *dns.Msg, raw []byte) error {
+	sig := msg.IsTsig()
+	if sig == nil {
+		p.tsigLock.RLock()
+		haveKeys := len(p.tsigKeys) > 0
+		p.tsigLock.RUnlock()
+
+		if p.tsigRequired || haveKeys {
+			return fmt.Errorf("unsigned DNS update refused")
+		}
+		return nil
+	}
+
+	key, ok := p.lookupTSIGKey(sig.Hdr.Name)
+	if !ok {
+		return fmt.Errorf("unknown TSIG key %s", sig.Hdr.Name)
+	}
+	if !strings.EqualFold(sig.Algorithm, key.algorithm) {
+		return fmt.Errorf("TSIG key %s uses %s, not %s", sig.Hdr.Name, key.algorithm, sig.Algorithm)
+	}
+	if err := dns.TsigVerify(raw, key.secret, "", false); err != nil {
+		return fmt.Errorf("verify TSIG key %s: %w", sig.Hdr.Name, err)
+	}
+
+	return nil
+}
+
+// packUpdateResponse packs the response to an update, signing it when the request was signed
+func (p *DNSProxy) packUpdateResponse(request, response *dns.Msg) ([]byte, error) {
+	sig := response.IsTsig()
+	if sig == nil {
+		return response.Pack()
+	}
+
+	key, ok := p.lookupTSIGKey(sig.Hdr.Name)
+	if !ok {
+		return nil, fmt.Errorf("TSIG key %s was removed", sig.Hdr.Name)
+	}
+
+	data, _, err := dns.TsigGenerate(response, key.secret, request.IsTsig().MAC, false)
+	return data, err
+}
+
+// signUpdateResponse marks the response to be signed with the request's TSIG key
+func signUpdateResponse(request, response *dns.Msg) {
+	if sig := request.IsTsig(); sig != nil {
+		response.SetTsig(sig.Hdr.Name, sig.Algorithm, tsigFudge, time.Now().Unix())
+	}
+}
@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testTSIGKey    = "dhcp-key."
+	testTSIGSecret = "c2VjcmV0LWtleS1mb3ItdGVzdHM="
+	otherSecret    = "YW5vdGhlci1zZWNyZXQta2V5"
+)
+
+// signedUpdate builds an update adding host.lan.example. and returns it signed with secret
+func signedUpdate(t *testing.T, keyName, secret string) (*dns.Msg, []byte) {
+	t.Helper()
+
+	msg := new(dns.Msg)
+	msg.SetUpdate("lan.example.")
+	msg.Insert([]dns.RR{mustRR(t, "host.lan.example. 300 IN A 192.168.1.50")})
+	msg.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+
+	raw, _, err := dns.TsigGenerate(msg, secret, "", false)
+	if err != nil {
+		t.Fatalf("Failed to sign update: %v", err)
+	}
+
+	received := new(dns.Msg)
+	if err := received.Unpack(raw); err != nil {
+		t.Fatalf("Failed to unpack signed update: %v", err)
+	}
+	return received, raw
+}
+
+func TestDNSUpdateTSIG(t *testing.T) {
+	proxy := newUpdateTestProxy(WithDNSUpdateEnabled(true))
+	if err := proxy.AddTSIGKey(testTSIGKey, "hmac-sha256", testTSIGSecret); err != nil {
+		t.Fatalf("AddTSIGKey failed: %v", err)
+	}
+
+	msg, raw := signedUpdate(t, testTSIGKey, testTSIGSecret)
+	response, err := proxy.handleDNSUpdate(msg, raw)
+	if err != nil || response.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected signed update to succeed, got %v %v", response, err)
+	}
+	if !proxy.recordStore.HasRecord("host.lan.example.", RecordTypeA) {
+		t.Error("Expected signed update to be applied")
+	}
+
+	// The response is signed with the same key
+	data, err := proxy.packUpdateResponse(msg, response)
+	if err != nil {
+		t.Fatalf("Failed to pack response: %v", err)
+	}
+	if err := dns.TsigVerify(data, testTSIGSecret, msg.IsTsig().MAC, false); err != nil {
+		t.Errorf("Expected response signature to verify: %v", err)
+	}
+
+	// HandleDNSUpdate verifies a parsed message as well
+	msg, _ = signedUpdate(t, testTSIGKey, testTSIGSecret)
+	if response, err := proxy.HandleDNSUpdate(msg); err != nil || response.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected HandleDNSUpdate to verify a signed update, got %v %v", response, err)
+	}
+}
+
+func TestDNSUpdateTSIGRefused(t *testing.T) {
+	proxy := newUpdateTestProxy(WithDNSUpdateEnabled(true))
+	proxy.AddTSIGKey(testTSIGKey, dns.HmacSHA256, testTSIGSecret)
+
+	msg, raw := signedUpdate(t, testTSIGKey, otherSecret)
+	if response, _ := proxy.handleDNSUpdate(msg, raw); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for a bad signature, got %s", dns.RcodeToString[response.Rcode])
+	}
+
+	msg, raw = signedUpdate(t, "unknown-key.", testTSIGSecret)
+	if response, _ := proxy.handleDNSUpdate(msg, raw); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an unknown key, got %s", dns.RcodeToString[response.Rcode])
+	}
+
+	unsigned := new(dns.Msg)
+	unsigned.SetUpdate("lan.example.")
+	unsigned.Insert([]dns.RR{mustRR(t, "host.lan.example. 300 IN A 192.168.1.50")})
+	if response, _ := proxy.HandleDNSUpdate(unsigned); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an unsigned update when keys are configured, got %s", dns.RcodeToString[response.Rcode])
+	}
+	if proxy.recordStore.HasRecord("host.lan.example.", RecordTypeA) {
+		t.Error("Expected refused updates not to be applied")
+	}
+
+	required := newUpdateTestProxy(WithDNSUpdateEnabled(true), WithTSIGRequired(true))
+	if response, _ := required.HandleDNSUpdate(unsigned); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an unsigned update when TSIG is required, got %s", dns.RcodeToString[response.Rcode])
+	}
+
+	if err := proxy.AddTSIGKey("bad-alg.", "hmac-md4", testTSIGSecret); err == nil {
+		t.Error("Expected error for unsupported algorithm")
+	}
+	if err := proxy.AddTSIGKey("bad-secret.", dns.HmacSHA256, "not base64!"); err == nil {
+		t.Error("Expected error for invalid secret")
+	}
+}
+
+func TestDNSUpdateTSIGKeyRotation(t *testing.T) {
+	proxy := newUpdateTestProxy(WithDNSUpdateEnabled(true))
+	proxy.AddTSIGKey(testTSIGKey, dns.HmacSHA256, testTSIGSecret)
+
+	proxy.RemoveTSIGKey(testTSIGKey)
+	proxy.AddTSIGKey(testTSIGKey, dns.HmacSHA256, otherSecret)
+
+	msg, raw := signedUpdate(t, testTSIGKey, testTSIGSecret)
+	if response, _ := proxy.handleDNSUpdate(msg, raw); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for the rotated out secret, got %s", dns.RcodeToString[response.Rcode])
+	}
+
+	msg, raw = signedUpdate(t, testTSIGKey, otherSecret)
+	if response, _ := proxy.handleDNSUpdate(msg, raw); response.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected the new secret to be accepted, got %s", dns.RcodeToString[response.Rcode])
+	}
+}
@@ -0,0 +1,236 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNotUpdate is returned by HandleDNSUpdate for messages that are not DNS UPDATEs
+var ErrNotUpdate = errors.New("not a DNS UPDATE message")
+
+// WithDNSUpdateEnabled allows clients such as DHCP servers to register records with
+// DNS UPDATE (RFC 2136). Updates are refused unless enabled.
+func WithDNSUpdateEnabled(enabled bool) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dnsUpdateEnabled = enabled
+	}
+}
+
+// WithDNSUpdateZone restricts DNS UPDATE to the given zone and the names below it
+// Without a zone, updates for any zone are accepted
+func WithDNSUpdateZone(zone string) DNSProxyOption {
+	return func(p *DNSProxy) {
+		p.dnsUpdateZone = strings.ToLower(dns.Fqdn(zone))
+	}
+}
+
+// HandleDNSUpdate applies a DNS UPDATE message to the record store
+// Only A and AAAA records are supported. The prerequisite section is checked
+// and every update validated before any record is changed.
+// Signed updates are verified against the keys added with AddTSIGKey.
+func (p *DNSProxy) HandleDNSUpdate(msg *dns.Msg) (*dns.Msg, error) {
+	if msg.Opcode != dns.OpcodeUpdate {
+		return nil, ErrNotUpdate
+	}
+
+	raw, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("pack DNS update: %w", err)
+	}
+	return p.handleDNSUpdate(msg, raw)
+}
+
+// handleDNSUpdate applies a DNS UPDATE message, raw is the message as received for TSIG verification
+func (p *DNSProxy) handleDNSUpdate(msg *dns.Msg, raw []byte) (*dns.Msg, error) {
+	if msg.Opcode != dns.OpcodeUpdate {
+		return nil, ErrNotUpdate
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(msg)
+
+	if !p.dnsUpdateEnabled {
+		response.Rcode = dns.RcodeRefused
+		return response, nil
+	}
+
+	if err := p.authenticateUpdate(msg, raw); err != nil {
+		response.Rcode = dns.RcodeRefused
+		return response, err
+	}
+	signUpdateResponse(msg, response)
+
+	// The zone section must name exactly one zone of class IN
+	if len(msg.Question) != 1 || msg.Question[0].Qtype != dns.TypeSOA || msg.Question[0].Qclass != dns.ClassINET {
+		response.Rcode = dns.RcodeFormatError
+		return response, fmt.Errorf("DNS update must have a single SOA zone")
+	}
+	zone := strings.ToLower(msg.Question[0].Name)
+	if p.dnsUpdateZone != "" && zone != p.dnsUpdateZone {
+		response.Rcode = dns.RcodeRefused
+		return response, fmt.Errorf("DNS update for zone %s refused, only %s is allowed", zone, p.dnsUpdateZone)
+	}
+
+	if rcode := p.checkUpdatePrerequisites(zone, msg.Answer); rcode != dns.RcodeSuccess {
+		response.Rcode = rcode
+		return response, nil
+	}
+
+	if rcode, err := checkUpdateRecords(zone, msg.Ns); rcode != dns.RcodeSuccess {
+		response.Rcode = rcode
+		return response, err
+	}
+
+	for _, rr := range msg.Ns {
+		if err := p.applyUpdate(rr); err != nil {
+			response.Rcode = dns.RcodeServerFailure
+			return response, err
+		}
+	}
+
+	return response, nil
+}
+
+// checkUpdatePrerequisites evaluates the prerequisite section of an update (RFC 2136 section 3.2)
+func (p *DNSProxy) checkUpdatePrerequisites(zone string, prereqs []dns.RR) int {
+	// Value dependent prerequisites are compared as whole RRsets
+	expected := make(map[string][]net.IP)
+	expectedType := make(map[string]RecordType)
+
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		name := strings.ToLower(hdr.Name)
+		if !dns.IsSubDomain(zone, name) {
+			return dns.RcodeNotZone
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rrtype == dns.TypeANY {
+				if !p.nameInUse(name) {
+					return dns.RcodeNameError
+				}
+			} else if !p.recordStore.HasRecord(name, RecordType(hdr.Rrtype)) {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if hdr.Rrtype == dns.TypeANY {
+				if p.nameInUse(name) {
+					return dns.RcodeYXDomain
+				}
+			} else if p.recordStore.HasRecord(name, RecordType(hdr.Rrtype)) {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			ip, ok := updateRecordIP(rr)
+			if !ok {
+				return dns.RcodeFormatError
+			}
+			key := name + "/" + dns.TypeToString[hdr.Rrtype]
+			expected[key] = append(expected[key], ip)
+			expectedType[key] = RecordType(hdr.Rrtype)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for key, ips := range expected {
+		name, _, _ := strings.Cut(key, "/")
+		if !sameIPSet(ips, p.recordStore.GetRecords(name, expectedType[key])) {
+			return dns.RcodeNXRrset
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// checkUpdateRecords validates the update section before anything is applied (RFC 2136 section 3.4.1)
+func checkUpdateRecords(zone string, updates []dns.RR) (int, error) {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(zone, strings.ToLower(hdr.Name)) {
+			return dns.RcodeNotZone, fmt.Errorf("%s is outside zone %s", hdr.Name, zone)
+		}
+
+		switch hdr.Class {
+		case dns.ClassINET, dns.ClassNONE:
+			if hdr.Class == dns.ClassNONE && hdr.Rrtype == dns.TypeANY {
+				continue
+			}
+			if _, ok := updateRecordIP(rr); !ok {
+				return dns.RcodeRefused, fmt.Errorf("unsupported record type %s for %s", dns.TypeToString[hdr.Rrtype], hdr.Name)
+			}
+		case dns.ClassANY:
+			if hdr.Rrtype != dns.TypeANY && hdr.Rrtype != dns.TypeA && hdr.Rrtype != dns.TypeAAAA {
+				return dns.RcodeRefused, fmt.Errorf("unsupported record type %s for %s", dns.TypeToString[hdr.Rrtype], hdr.Name)
+			}
+		default:
+			return dns.RcodeFormatError, fmt.Errorf("invalid class %d for %s", hdr.Class, hdr.Name)
+		}
+	}
+
+	return dns.RcodeSuccess, nil
+}
+
+// applyUpdate applies a single validated record from the update section
+func (p *DNSProxy) applyUpdate(rr dns.RR) error {
+	hdr := rr.Header()
+
+	switch {
+	case hdr.Rrtype == dns.TypeANY:
+		// Delete all records for the name
+		p.recordStore.RemoveRecord(hdr.Name, nil)
+	case hdr.Class == dns.ClassANY:
+		// Delete the A or AAAA RRset
+		for _, ip := range p.recordStore.GetRecords(hdr.Name, RecordType(hdr.Rrtype)) {
+			p.recordStore.RemoveRecord(hdr.Name, ip)
+		}
+	case hdr.Class == dns.ClassNONE:
+		// Delete a single record
+		ip, _ := updateRecordIP(rr)
+		p.recordStore.RemoveRecord(hdr.Name, ip)
+	default:
+		ip, _ := updateRecordIP(rr)
+		if _, err := p.recordStore.AddRecord(hdr.Name, ip); err != nil {
+			return fmt.Errorf("add record for %s: %w", hdr.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// nameInUse reports whether the store has an A or AAAA record for name
+func (p *DNSProxy) nameInUse(name string) bool {
+	return p.recordStore.HasRecord(name, RecordTypeA) || p.recordStore.HasRecord(name, RecordTypeAAAA)
+}
+
+// updateRecordIP returns the address of an A or AAAA record
+func updateRecordIP(rr dns.RR) (net.IP, bool) {
+	switch r := rr.(type) {
+	case *dns.A:
+		return r.A, r.A != nil
+	case *dns.AAAA:
+		return r.AAAA, r.AAAA != nil
+	}
+	return nil, false
+}
+
+// sameIPSet reports whether a and b hold the same addresses, ignoring order and duplicates
+func sameIPSet(a, b []net.IP) bool {
+	for _, ip := range a {
+		if !slices.ContainsFunc(b, ip.Equal) {
+			return false
+		}
+	}
+	for _, ip := range b {
+		if !slices.ContainsFunc(a, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newUpdateTestProxy(opts ...DNSProxyOption) *DNSProxy {
+	p := &DNSProxy{recordStore: NewDNSRecordStore()}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", s, err)
+	}
+	return rr
+}
+
+func TestHandleDNSUpdate(t *testing.T) {
+	proxy := newUpdateTestProxy(WithDNSUpdateEnabled(true), WithDNSUpdateZone("lan.example"))
+
+	msg := new(dns.Msg)
+	msg.SetUpdate("lan.example.")
+	msg.Insert([]dns.RR{
+		mustRR(t, "laptop.lan.example. 300 IN A 192.168.1.20"),
+		mustRR(t, "laptop.lan.example. 300 IN AAAA fd00::20"),
+	})
+
+	response, err := proxy.HandleDNSUpdate(msg)
+	if err != nil || response.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %v %v", response, err)
+	}
+	if ips := proxy.recordStore.GetRecords("laptop.lan.example.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.168.1.20")) {
+		t.Errorf("Expected A record to be added, got %v", ips)
+	}
+	if !proxy.recordStore.HasRecord("laptop.lan.example.", RecordTypeAAAA) {
+		t.Error("Expected AAAA record to be added")
+	}
+
+	// Delete a single record
+	msg = new(dns.Msg)
+	msg.SetUpdate("lan.example.")
+	msg.Remove([]dns.RR{mustRR(t, "laptop.lan.example. 0 IN AAAA fd00::20")})
+	if response, _ := proxy.HandleDNSUpdate(msg); response.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[response.Rcode])
+	}
+	if proxy.recordStore.HasRecord("laptop.lan.example.", RecordTypeAAAA) {
+		t.Error("Expected AAAA record to be removed")
+	}
+
+	// Delete every record for the name with class NONE type ANY
+	msg = new(dns.Msg)
+	msg.SetUpdate("lan.example.")
+	msg.Ns = []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "laptop.lan.example.", Rrtype: dns.TypeANY, Class: dns.ClassNONE}}}
+	if response, _ := proxy.HandleDNSUpdate(msg); response.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[response.Rcode])
+	}
+	if proxy.recordStore.HasRecord("laptop.lan.example.", RecordTypeA) {
+		t.Error("Expected all records for the name to be removed")
+	}
+}
+
+func TestHandleDNSUpdateRefused(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.SetUpdate("lan.example.")
+	msg.Insert([]dns.RR{mustRR(t, "host.lan.example. 300 IN A 192.168.1.30")})
+
+	disabled := newUpdateTestProxy()
+	if response, _ := disabled.HandleDNSUpdate(msg); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED when updates are disabled, got %s", dns.RcodeToString[response.Rcode])
+	}
+
+	otherZone := newUpdateTestProxy(WithDNSUpdateEnabled(true), WithDNSUpdateZone("corp.example."))
+	if response, _ := otherZone.HandleDNSUpdate(msg); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for another zone, got %s", dns.RcodeToString[response.Rcode])
+	}
+
+	proxy := newUpdateTestProxy(WithDNSUpdateEnabled(true))
+	unsupported := new(dns.Msg)
+	unsupported.SetUpdate("lan.example.")
+	unsupported.Insert([]dns.RR{
+		mustRR(t, "host.lan.example. 300 IN A 192.168.1.30"),
+		mustRR(t, "host.lan.example. 300 IN TXT \"hello\""),
+	})
+	if response, _ := proxy.HandleDNSUpdate(unsupported); response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for unsupported type, got %s", dns.RcodeToString[response.Rcode])
+	}
+	if proxy.recordStore.HasRecord("host.lan.example.", RecordTypeA) {
+		t.Error("Expected no records to be applied from a refused update")
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("host.lan.example.", dns.TypeA)
+	if _, err := proxy.HandleDNSUpdate(query); !errors.Is(err, ErrNotUpdate) {
+		t.Errorf("Expected ErrNotUpdate for a query, got %v", err)
+	}
+}
+
+func TestHandleDNSUpdatePrerequisites(t *testing.T) {
+	proxy := newUpdateTestProxy(WithDNSUpdateEnabled(true))
+	proxy.recordStore.AddRecord("taken.lan.example.", net.ParseIP("192.168.1.10"))
+
+	tests := []struct {
+		name    string
+		prereq  func(m *dns.Msg)
+		rcode   int
+		applied bool
+	}{
+		{
+			name:    "name not in use fails",
+			prereq:  func(m *dns.Msg) { m.NameNotUsed([]dns.RR{mustRR(t, "taken.lan.example. 0 IN A 0.0.0.0")}) },
+			rcode:   dns.RcodeYXDomain,
+			applied: false,
+		},
+		{
+			name:    "name in use succeeds",
+			prereq:  func(m *dns.Msg) { m.NameUsed([]dns.RR{mustRR(t, "taken.lan.example. 0 IN A 0.0.0.0")}) },
+			rcode:   dns.RcodeSuccess,
+			applied: true,
+		},
+		{
+			name:    "RRset exists fails",
+			prereq:  func(m *dns.Msg) { m.RRsetUsed([]dns.RR{mustRR(t, "free.lan.example. 0 IN A 0.0.0.0")}) },
+			rcode:   dns.RcodeNXRrset,
+			applied: false,
+		},
+		{
+			name:    "value dependent RRset matches",
+			prereq:  func(m *dns.Msg) { m.Used([]dns.RR{mustRR(t, "taken.lan.example. 0 IN A 192.168.1.10")}) },
+			rcode:   dns.RcodeSuccess,
+			applied: true,
+		},
+		{
+			name:    "value dependent RRset differs",
+			prereq:  func(m *dns.Msg) { m.Used([]dns.RR{mustRR(t, "taken.lan.example. 0 IN A 192.168.1.99")}) },
+			rcode:   dns.RcodeNXRrset,
+			applied: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy.recordStore.RemoveRecord("new.lan.example.", nil)
+
+			msg := new(dns.Msg)
+			msg.SetUpdate("lan.example.")
+			tt.prereq(msg)
+			msg.Insert([]dns.RR{mustRR(t, "new.lan.example. 300 IN A 192.168.1.40")})
+
+			response, _ := proxy.HandleDNSUpdate(msg)
+			if response.Rcode != tt.rcode {
+				t.Errorf("Expected %s, got %s", dns.RcodeToString[tt.rcode], dns.RcodeToString[response.Rcode])
+			}
+			if got := proxy.recordStore.HasRecord("new.lan.example.", RecordTypeA); got != tt.applied {
+				t.Errorf("Expected update applied = %v, got %v", tt.applied, got)
+			}
+		})
+	}
+}
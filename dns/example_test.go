@@ -0,0 +1,41 @@
+//go:build dnstest
+
+package dns_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	olmdns "github.com/fosrl/olm/dns"
+	"github.com/miekg/dns"
+)
+
+// TestNewTestDNSProxyQuery shows how a package importing dns can test against a running
+// proxy: add records through the proxy, then send real queries to the returned address.
+func TestNewTestDNSProxyQuery(t *testing.T) {
+	proxy, addr := olmdns.NewTestDNSProxy(t)
+
+	if _, err := proxy.AddDNSRecord("peer.example.internal.", net.ParseIP("100.90.0.7")); err != nil {
+		t.Fatalf("Failed to add record: %v", err)
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("peer.example.internal.", dns.TypeA)
+	client := &dns.Client{Timeout: 2 * time.Second}
+	response, _, err := client.Exchange(query, addr)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if len(response.Answer) != 1 {
+		t.Fatalf("Expected 1 answer, got %d", len(response.Answer))
+	}
+	a, ok := response.Answer[0].(*dns.A)
+	if !ok || !a.A.Equal(net.ParseIP("100.90.0.7")) {
+		t.Errorf("Expected A 100.90.0.7, got %s", response.Answer[0])
+	}
+	if !response.Authoritative {
+		t.Error("Expected an authoritative answer for a local record")
+	}
+}
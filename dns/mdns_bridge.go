@@ -0,0 +1,351 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/miekg/dns"
+)
+
+const (
+	// mdnsCacheFlush is the cache-flush bit mDNS sets in the record class (RFC 6762 section 10.2)
+	mdnsCacheFlush = 1 << 15
+
+	// mdnsExpiryInterval is how often the bridge removes records that were not refreshed
+	mdnsExpiryInterval = 10 * time.Second
+
+	// mdnsDomain is the domain mDNS names live under (RFC 6762 section 3)
+	mdnsDomain = "local."
+)
+
+// mdnsIPv4Addr is the IPv4 mDNS multicast group and port
+var mdnsIPv4Addr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsKey identifies a record learned from mDNS
+type mdnsKey struct {
+	rrtype uint16
+	name   string
+	value  string
+}
+
+// mdnsEntry is a learned record and when it expires
+type mdnsEntry struct {
+	rr      dns.RR
+	expires time.Time
+}
+
+// MDNSBridge listens for mDNS announcements on the local network and mirrors the
+// announced A, AAAA, PTR and SRV records into a DNSRecordStore, so clients that do
+// not speak mDNS can resolve them through the proxy. Only names under .local are
+// mirrored, and reverse PTR records only when they point under .local, so hosts on the
+// network cannot answer for other names. Records are removed on goodbye packets or when
+// they are not refreshed within twice their announced TTL. Records that were in the
+// store before the bridge announced them are left alone.
+type MDNSBridge struct {
+	store *DNSRecordStore
+	iface *net.Interface
+
+	mu      sync.Mutex
+	records map[mdnsKey]mdnsEntry
+	conn    *net.UDPConn
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	now func() time.Time
+}
+
+// NewMDNSBridge creates a bridge that mirrors mDNS records seen on iface into store
+// iface may be nil to use the system default multicast interface
+func NewMDNSBridge(store *DNSRecordStore, iface *net.Interface) (*MDNSBridge, error) {
+	if store == nil {
+		return nil, fmt.Errorf("mDNS bridge needs a record store")
+	}
+
+	return &MDNSBridge{
+		store:   store,
+		iface:   iface,
+		records: make(map[mdnsKey]mdnsEntry),
+		now:     time.Now,
+	}, nil
+}
+
+// Start joins the mDNS multicast group and processes announcements until ctx is
+// cancelled or Stop is called
+func (b *MDNSBridge) Start(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn != nil {
+		return fmt.Errorf("mDNS bridge already started")
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", b.iface, mdnsIPv4Addr)
+	if err != nil {
+		return fmt.Errorf("join mDNS multicast group: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	b.conn = conn
+	b.cancel = cancel
+
+	b.wg.Add(2)
+	go b.readLoop(ctx, conn)
+	go b.expiryLoop(ctx)
+
+	logger.Info("mDNS bridge listening on %s", mdnsIPv4Addr)
+	return nil
+}
+
+// Stop leaves the multicast group and removes every record the bridge added
+func (b *MDNSBridge) Stop() error {
+	b.mu.Lock()
+	conn, cancel := b.conn, b.cancel
+	b.conn, b.cancel = nil, nil
+	b.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	cancel()
+	err := conn.Close()
+	b.wg.Wait()
+
+	b.mu.Lock()
+	for key, entry := range b.records {
+		b.removeRecord(entry.rr)
+		delete(b.records, key)
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("close mDNS listener: %w", err)
+	}
+	return nil
+}
+
+func (b *MDNSBridge) readLoop(ctx context.Context, conn *net.UDPConn) {
+	defer b.wg.Done()
+
+	buf := make([]byte, 9000) // mDNS messages may be as large as a jumbo frame
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Debug("mDNS read error: %v", err)
+			continue
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(buf[:n]); err != nil {
+			logger.Debug("Failed to parse mDNS message: %v", err)
+			continue
+		}
+		b.handleMessage(msg)
+	}
+}
+
+func (b *MDNSBridge) expiryLoop(ctx context.Context) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(mdnsExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.expireRecords()
+		}
+	}
+}
+
+// handleMessage applies the records of an mDNS response to the store
+func (b *MDNSBridge) handleMessage(msg *dns.Msg) {
+	if !msg.Response {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			b.handleRecord(rr)
+		}
+	}
+}
+
+// handleRecord adds, refreshes or removes a single announced record
+// The caller must hold b.mu
+func (b *MDNSBridge) handleRecord(rr dns.RR) {
+	hdr := rr.Header()
+	if hdr.Class&^mdnsCacheFlush != dns.ClassINET {
+		return
+	}
+
+	key, ok := mdnsRecordKey(rr)
+	if !ok {
+		return
+	}
+	if !mdnsNameAllowed(rr) {
+		logger.Debug("Ignoring mDNS record outside %s: %s", mdnsDomain, rr)
+		return
+	}
+
+	// A TTL of zero is a goodbye packet
+	if hdr.Ttl == 0 {
+		if entry, exists := b.records[key]; exists {
+			b.removeRecord(entry.rr)
+			delete(b.records, key)
+			logger.Debug("mDNS goodbye for %s %s", dns.TypeToString[key.rrtype], key.name)
+		}
+		return
+	}
+
+	if _, exists := b.records[key]; !exists {
+		added, err := b.addRecord(rr)
+		if err != nil {
+			logger.Debug("Failed to add mDNS record %s: %v", rr, err)
+			return
+		}
+		if !added {
+			// The record was already in the store, so it is not the bridge's to remove
+			return
+		}
+	}
+	b.records[key] = mdnsEntry{
+		rr:      dns.Copy(rr),
+		expires: b.now().Add(2 * time.Duration(hdr.Ttl) * time.Second),
+	}
+}
+
+// expireRecords removes records that were not refreshed in time
+func (b *MDNSBridge) expireRecords() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	for key, entry := range b.records {
+		if now.After(entry.expires) {
+			b.removeRecord(entry.rr)
+			delete(b.records, key)
+			logger.Debug("mDNS record %s %s expired", dns.TypeToString[key.rrtype], key.name)
+		}
+	}
+}
+
+// addRecord adds rr to the store, returning false if it was already there
+func (b *MDNSBridge) addRecord(rr dns.RR) (bool, error) {
+	name := rr.Header().Name
+
+	switch r := rr.(type) {
+	case *dns.A:
+		return b.store.AddRecord(name, r.A)
+	case *dns.AAAA:
+		return b.store.AddRecord(name, r.AAAA)
+	}
+
+	s := b.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r := rr.(type) {
+	case *dns.PTR:
+		if strings.Trim(r.Ptr, ".") == "" {
+			return false, fmt.Errorf("PTR record for %s has an empty target", name)
+		}
+		target := strings.ToLower(dns.Fqdn(r.Ptr))
+		if IsReverseDNSDomain(name) {
+			ip, err := ReverseDNSToIP(name)
+			if err != nil {
+				return false, err
+			}
+			addr, _ := ipToAddr(ip)
+			if slices.Contains(s.ptrRecords[addr], target) {
+				return false, nil
+			}
+			s.addPTRLocked(addr, target)
+			return true, nil
+		}
+		domain := strings.ToLower(dns.Fqdn(name))
+		if slices.Contains(s.servicePTRRecords[domain], dns.Fqdn(r.Ptr)) {
+			return false, nil
+		}
+		s.addServicePTRLocked(domain, r.Ptr)
+		return true, nil
+	case *dns.SRV:
+		if strings.Trim(r.Target, ".") == "" {
+			return false, fmt.Errorf("SRV record for %s has an empty target", name)
+		}
+		domain := strings.ToLower(dns.Fqdn(name))
+		rec := SRVRecord{Priority: r.Priority, Weight: r.Weight, Port: r.Port, Target: strings.ToLower(dns.Fqdn(r.Target))}
+		if slices.Contains(s.srvRecords[domain], rec) {
+			return false, nil
+		}
+		s.addSRVLocked(domain, rec)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *MDNSBridge) removeRecord(rr dns.RR) {
+	name := rr.Header().Name
+
+	switch r := rr.(type) {
+	case *dns.A:
+		b.store.RemoveRecord(name, r.A)
+	case *dns.AAAA:
+		b.store.RemoveRecord(name, r.AAAA)
+	case *dns.PTR:
+		if IsReverseDNSDomain(name) {
+			if ip, err := ReverseDNSToIP(name); err == nil {
+				b.store.RemovePTRRecordTarget(ip, r.Ptr)
+			}
+			return
+		}
+		b.store.RemoveServicePTRRecord(name, r.Ptr)
+	case *dns.SRV:
+		b.store.RemoveSRVRecord(name, &SRVRecord{Priority: r.Priority, Weight: r.Weight, Port: r.Port, Target: r.Target})
+	}
+}
+
+// mdnsNameAllowed reports whether rr is for a name the bridge may answer for: a name
+// under .local, or a reverse DNS name pointing to one
+func mdnsNameAllowed(rr dns.RR) bool {
+	name := rr.Header().Name
+	if ptr, ok := rr.(*dns.PTR); ok && IsReverseDNSDomain(name) {
+		return dns.IsSubDomain(mdnsDomain, dns.CanonicalName(ptr.Ptr))
+	}
+	return dns.IsSubDomain(mdnsDomain, dns.CanonicalName(name))
+}
+
+// mdnsRecordKey returns the tracking key of a supported record
+func mdnsRecordKey(rr dns.RR) (mdnsKey, bool) {
+	hdr := rr.Header()
+	key := mdnsKey{rrtype: hdr.Rrtype, name: dns.CanonicalName(hdr.Name)}
+
+	switch r := rr.(type) {
+	case *dns.A:
+		key.value = r.A.String()
+	case *dns.AAAA:
+		key.value = r.AAAA.String()
+	case *dns.PTR:
+		key.value = dns.CanonicalName(r.Ptr)
+	case *dns.SRV:
+		key.value = fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, dns.CanonicalName(r.Target))
+	default:
+		return mdnsKey{}, false
+	}
+	return key, true
+}
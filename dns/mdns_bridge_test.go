@@ -0,0 +1,207 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func mdnsAnnouncement(t *testing.T, records ...string) *dns.Msg {
+	t.Helper()
+
+	msg := new(dns.Msg)
+	msg.Response = true
+	msg.Authoritative = true
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", s, err)
+		}
+		msg.Answer = append(msg.Answer, rr)
+	}
+	return msg
+}
+
+func TestMDNSBridgeAnnouncements(t *testing.T) {
+	store := NewDNSRecordStore()
+	bridge, err := NewMDNSBridge(store, nil)
+	if err != nil {
+		t.Fatalf("NewMDNSBridge failed: %v", err)
+	}
+
+	bridge.handleMessage(mdnsAnnouncement(t,
+		"_http._tcp.local. 4500 IN PTR myservice._http._tcp.local.",
+		"myservice._http._tcp.local. 120 IN SRV 0 0 8080 host.local.",
+		"host.local. 120 IN A 192.168.1.20",
+		"host.local. 120 IN AAAA fe80::20",
+	))
+
+	if targets := store.GetServicePTRRecords("_http._tcp.local."); len(targets) != 1 || targets[0] != "myservice._http._tcp.local." {
+		t.Errorf("Expected service PTR record, got %v", targets)
+	}
+	if records := store.GetSRVRecords("myservice._http._tcp.local."); len(records) != 1 || records[0].Port != 8080 {
+		t.Errorf("Expected SRV record, got %v", records)
+	}
+	if ips := store.GetRecords("host.local.", RecordTypeA); len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.168.1.20")) {
+		t.Errorf("Expected A record, got %v", ips)
+	}
+	if !store.HasRecord("host.local.", RecordTypeAAAA) {
+		t.Error("Expected AAAA record")
+	}
+
+	// Queries are ignored
+	query := new(dns.Msg)
+	query.SetQuestion("other.local.", dns.TypeA)
+	query.Answer = mdnsAnnouncement(t, "other.local. 120 IN A 192.168.1.30").Answer
+	bridge.handleMessage(query)
+	if store.HasRecord("other.local.", RecordTypeA) {
+		t.Error("Expected records in queries to be ignored")
+	}
+
+	// Goodbye packets remove records
+	bridge.handleMessage(mdnsAnnouncement(t,
+		"host.local. 0 IN A 192.168.1.20",
+		"myservice._http._tcp.local. 0 IN SRV 0 0 8080 host.local.",
+	))
+	if store.HasRecord("host.local.", RecordTypeA) {
+		t.Error("Expected goodbye to remove A record")
+	}
+	if store.HasSRVRecord("myservice._http._tcp.local.") {
+		t.Error("Expected goodbye to remove SRV record")
+	}
+	if !store.HasRecord("host.local.", RecordTypeAAAA) {
+		t.Error("Expected AAAA record without goodbye to remain")
+	}
+}
+
+func TestMDNSBridgeCacheFlushClass(t *testing.T) {
+	store := NewDNSRecordStore()
+	bridge, _ := NewMDNSBridge(store, nil)
+
+	msg := mdnsAnnouncement(t, "host.local. 120 IN A 192.168.1.20")
+	msg.Answer[0].Header().Class |= mdnsCacheFlush
+	bridge.handleMessage(msg)
+
+	if !store.HasRecord("host.local.", RecordTypeA) {
+		t.Error("Expected record with cache-flush bit to be added")
+	}
+}
+
+func TestMDNSBridgeExpiry(t *testing.T) {
+	store := NewDNSRecordStore()
+	bridge, _ := NewMDNSBridge(store, nil)
+
+	now := time.Now()
+	bridge.now = func() time.Time { return now }
+
+	bridge.handleMessage(mdnsAnnouncement(t,
+		"short.local. 60 IN A 192.168.1.40",
+		"long.local. 600 IN A 192.168.1.41",
+	))
+
+	// Refreshing a record pushes back its expiry
+	now = now.Add(100 * time.Second)
+	bridge.handleMessage(mdnsAnnouncement(t, "short.local. 60 IN A 192.168.1.40"))
+
+	now = now.Add(100 * time.Second)
+	bridge.expireRecords()
+	if !store.HasRecord("short.local.", RecordTypeA) {
+		t.Error("Expected refreshed record to remain within 2x TTL")
+	}
+
+	now = now.Add(30 * time.Second)
+	bridge.expireRecords()
+	if store.HasRecord("short.local.", RecordTypeA) {
+		t.Error("Expected record to expire after 2x TTL without refresh")
+	}
+	if !store.HasRecord("long.local.", RecordTypeA) {
+		t.Error("Expected record with longer TTL to remain")
+	}
+}
+
+func TestMDNSBridgeStartStop(t *testing.T) {
+	store := NewDNSRecordStore()
+	bridge, _ := NewMDNSBridge(store, nil)
+
+	if err := bridge.Start(context.Background()); err != nil {
+		t.Skipf("Multicast is not available: %v", err)
+	}
+	if err := bridge.Start(context.Background()); err == nil {
+		t.Error("Expected error when starting twice")
+	}
+
+	bridge.mu.Lock()
+	bridge.handleRecord(mdnsAnnouncement(t, "host.local. 120 IN A 192.168.1.20").Answer[0])
+	bridge.mu.Unlock()
+
+	if err := bridge.Stop(); err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+	if store.HasRecord("host.local.", RecordTypeA) {
+		t.Error("Expected Stop to remove learned records")
+	}
+	if err := bridge.Stop(); err != nil {
+		t.Errorf("Expected second Stop to be a no-op, got %v", err)
+	}
+
+	if _, err := NewMDNSBridge(nil, nil); err == nil {
+		t.Error("Expected error for nil store")
+	}
+}
+
+func TestMDNSBridgeIgnoresNamesOutsideLocal(t *testing.T) {
+	store := NewDNSRecordStore()
+	bridge, err := NewMDNSBridge(store, nil)
+	if err != nil {
+		t.Fatalf("NewMDNSBridge failed: %v", err)
+	}
+
+	bridge.handleMessage(mdnsAnnouncement(t,
+		"bank.com. 120 IN A 192.168.1.66",
+		"_http._tcp.example.com. 120 IN PTR evil._http._tcp.example.com.",
+		"66.1.168.192.in-addr.arpa. 120 IN PTR bank.com.",
+		"20.1.168.192.in-addr.arpa. 120 IN PTR host.local.",
+	))
+
+	if store.HasRecord("bank.com.", RecordTypeA) {
+		t.Error("Expected an A record outside .local to be ignored")
+	}
+	if targets := store.GetServicePTRRecords("_http._tcp.example.com."); len(targets) != 0 {
+		t.Errorf("Expected a service PTR outside .local to be ignored, got %v", targets)
+	}
+	if domain, ok := store.GetPTRRecordByIP(net.ParseIP("192.168.1.66")); ok {
+		t.Errorf("Expected a reverse PTR to a name outside .local to be ignored, got %s", domain)
+	}
+	if domain, ok := store.GetPTRRecordByIP(net.ParseIP("192.168.1.20")); !ok || domain != "host.local." {
+		t.Errorf("Expected a reverse PTR to a .local name, got %q", domain)
+	}
+}
+
+func TestMDNSBridgeKeepsExistingRecords(t *testing.T) {
+	store := NewDNSRecordStore()
+	store.AddRecord("printer.local.", net.ParseIP("192.168.1.50"))
+	store.AddSRVRecord("printer._ipp._tcp.local.", SRVRecord{Port: 631, Target: "printer.local."})
+	bridge, err := NewMDNSBridge(store, nil)
+	if err != nil {
+		t.Fatalf("NewMDNSBridge failed: %v", err)
+	}
+
+	bridge.handleMessage(mdnsAnnouncement(t,
+		"printer.local. 120 IN A 192.168.1.50",
+		"printer._ipp._tcp.local. 120 IN SRV 0 0 631 printer.local.",
+	))
+	bridge.handleMessage(mdnsAnnouncement(t,
+		"printer.local. 0 IN A 192.168.1.50",
+		"printer._ipp._tcp.local. 0 IN SRV 0 0 631 printer.local.",
+	))
+
+	if !store.HasRecord("printer.local.", RecordTypeA) {
+		t.Error("Expected a goodbye not to remove an A record the bridge did not add")
+	}
+	if !store.HasSRVRecord("printer._ipp._tcp.local.") {
+		t.Error("Expected a goodbye not to remove an SRV record the bridge did not add")
+	}
+}
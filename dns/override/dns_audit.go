@@ -0,0 +1,96 @@
+package olm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+)
+
+// auditLogPath is the audit log used by CleanupStaleState and by overrides without
+// WithAuditLog, empty for none. Guarded by overrideMu.
+var auditLogPath string
+
+// AuditEntry is one JSON line in the DNS override audit log
+type AuditEntry struct {
+	Timestamp       time.Time    `json:"timestamp"`
+	Operation       string       `json:"operation"`
+	Interface       string       `json:"interface,omitempty"`
+	PreviousServers []netip.Addr `json:"previousServers,omitempty"`
+	NewServers      []netip.Addr `json:"newServers,omitempty"`
+	Manager         string       `json:"manager,omitempty"`
+	Path            string       `json:"path,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	PID             int          `json:"pid"`
+}
+
+// SetAuditLog sets the file every DNS change is appended to as a JSON line,
+// including the changes made by CleanupStaleState. An empty path turns the audit log off.
+func SetAuditLog(path string) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	auditLogPath = path
+}
+
+// WithAuditLog appends the changes made by this override and its restore to path,
+// instead of the file set by SetAuditLog
+func WithAuditLog(path string) OverrideOption {
+	return func(o *overrideOptions) {
+		o.auditLog = path
+	}
+}
+
+// appendAuditEntry appends entry to the audit log at path, doing nothing if path is empty
+// Failures are logged rather than returned so auditing never blocks a DNS change.
+func appendAuditEntry(path string, entry AuditEntry) {
+	if path == "" {
+		return
+	}
+
+	entry.Timestamp = time.Now().UTC()
+	entry.PID = os.Getpid()
+	if err := writeAuditEntry(path, entry); err != nil {
+		logger.Error("Failed to write DNS audit log %s: %v", path, err)
+	}
+}
+
+func writeAuditEntry(path string, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode entry: %w", err)
+	}
+
+	// O_SYNC so an entry is on disk before the change it describes is reported done
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND|os.O_SYNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// overrideAudit is where an override records its changes
+type overrideAudit struct {
+	path          string
+	interfaceName string
+}
+
+func (a overrideAudit) record(entry AuditEntry) {
+	entry.Interface = a.interfaceName
+	appendAuditEntry(a.path, entry)
+}
+
+// errorString returns err's message, or an empty string for a nil error
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,97 @@
+package olm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	platformtesting "github.com/fosrl/olm/dns/platform/testing"
+)
+
+// readAuditLog decodes every line of the audit log at path
+func readAuditLog(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dns-audit.log")
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	options := newOverrideOptions([]OverrideOption{WithOverrideVerificationTimeout(0), WithAuditLog(path)})
+	options.interfaceName = "olm"
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	if err := restoreDNS(conf); err != nil {
+		t.Fatalf("restoreDNS failed: %v", err)
+	}
+
+	// A failed set is recorded together with its rollback
+	conf.SetDNSError(errors.New("permission denied"))
+	setDNS(proxyIp, conf, options)
+
+	entries := readAuditLog(t, path)
+	var operations []string
+	for _, entry := range entries {
+		operations = append(operations, entry.Operation)
+		if entry.Interface != "olm" || entry.PID != os.Getpid() || entry.Timestamp.IsZero() {
+			t.Errorf("Expected interface, PID and timestamp on every entry, got %+v", entry)
+		}
+	}
+	if !slices.Equal(operations, []string{"set", "restore", "set", "rollback"}) {
+		t.Fatalf("Expected set, restore, set and rollback entries, got %v", operations)
+	}
+
+	set, restore := entries[0], entries[1]
+	if !slices.Equal(set.PreviousServers, original) || !slices.Equal(set.NewServers, []netip.Addr{proxyIp}) || set.Error != "" {
+		t.Errorf("Unexpected set entry %+v", set)
+	}
+	if !slices.Equal(restore.PreviousServers, []netip.Addr{proxyIp}) || !slices.Equal(restore.NewServers, original) {
+		t.Errorf("Unexpected restore entry %+v", restore)
+	}
+	if entries[2].Error == "" {
+		t.Error("Expected the failed set to record its error")
+	}
+}
+
+func TestAuditLogDefaultPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dns-audit.log")
+	SetAuditLog(path)
+	t.Cleanup(func() { SetAuditLog("") })
+
+	options := newOverrideOptions([]OverrideOption{WithOverrideVerificationTimeout(0)})
+	conf := platformtesting.NewMockDNSConfigurator()
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	if err := restoreDNS(conf); err != nil {
+		t.Fatalf("restoreDNS failed: %v", err)
+	}
+	if entries := readAuditLog(t, path); len(entries) != 2 {
+		t.Errorf("Expected the set and restore in the SetAuditLog file, got %+v", entries)
+	}
+}
@@ -0,0 +1,130 @@
+package olm
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Shell hook events accepted by WithShellHook
+const (
+	HookPreSet      = "pre-set"
+	HookPostSet     = "post-set"
+	HookPreRestore  = "pre-restore"
+	HookPostRestore = "post-restore"
+)
+
+// changeHooks run around DNS changes. Pre hooks abort the change by returning
+// an error, post hook errors are only logged since DNS has already changed.
+type changeHooks struct {
+	preSet      []func() error
+	postSet     []func(newServers []netip.Addr) error
+	preRestore  []func() error
+	postRestore []func(restoredServers []netip.Addr) error
+}
+
+// WithPreSetHook runs fn before DNS is changed. An error aborts SetupDNSOverride.
+func WithPreSetHook(fn func() error) OverrideOption {
+	return func(o *overrideOptions) {
+		o.changeHooks.preSet = append(o.changeHooks.preSet, fn)
+	}
+}
+
+// WithPostSetHook runs fn once DNS points at the proxy. An error is logged but
+// the change is kept.
+func WithPostSetHook(fn func(newServers []netip.Addr) error) OverrideOption {
+	return func(o *overrideOptions) {
+		o.changeHooks.postSet = append(o.changeHooks.postSet, fn)
+	}
+}
+
+// WithPreRestoreHook runs fn before the override is restored. An error aborts
+// RestoreDNSOverride and leaves the override in place.
+func WithPreRestoreHook(fn func() error) OverrideOption {
+	return func(o *overrideOptions) {
+		o.changeHooks.preRestore = append(o.changeHooks.preRestore, fn)
+	}
+}
+
+// WithPostRestoreHook runs fn once the original DNS servers are back. An error
+// is logged but the restore is kept.
+func WithPostRestoreHook(fn func(restoredServers []netip.Addr) error) OverrideOption {
+	return func(o *overrideOptions) {
+		o.changeHooks.postRestore = append(o.changeHooks.postRestore, fn)
+	}
+}
+
+// WithShellHook runs command through the system shell for event, one of HookPreSet,
+// HookPostSet, HookPreRestore or HookPostRestore. Post hooks get the servers in the
+// OLM_DNS_SERVERS environment variable, separated by spaces. A non-zero exit status
+// is handled like an error from the matching Go hook.
+func WithShellHook(event, command string) OverrideOption {
+	return func(o *overrideOptions) {
+		switch event {
+		case HookPreSet:
+			o.changeHooks.preSet = append(o.changeHooks.preSet, func() error {
+				return runShellHook(command, nil)
+			})
+		case HookPostSet:
+			o.changeHooks.postSet = append(o.changeHooks.postSet, func(servers []netip.Addr) error {
+				return runShellHook(command, servers)
+			})
+		case HookPreRestore:
+			o.changeHooks.preRestore = append(o.changeHooks.preRestore, func() error {
+				return runShellHook(command, nil)
+			})
+		case HookPostRestore:
+			o.changeHooks.postRestore = append(o.changeHooks.postRestore, func(servers []netip.Addr) error {
+				return runShellHook(command, servers)
+			})
+		default:
+			o.optionErr = fmt.Errorf("unknown shell hook event %q", event)
+		}
+	}
+}
+
+// runShellHook runs command with sh, or cmd on Windows
+func runShellHook(command string, servers []netip.Addr) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	addrs := make([]string, len(servers))
+	for i, server := range servers {
+		addrs[i] = server.String()
+	}
+	cmd.Env = append(os.Environ(), "OLM_DNS_SERVERS="+strings.Join(addrs, " "))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("hook %q: %w, output: %s", command, err, out)
+	}
+	return nil
+}
+
+// runPre runs each hook in order and stops at the first error
+func runPre(hooks []func() error) error {
+	for _, hook := range hooks {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPost runs every hook, returning the errors as one
+func runPost(hooks []func([]netip.Addr) error, servers []netip.Addr) error {
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(servers); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
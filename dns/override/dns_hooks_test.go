@@ -0,0 +1,119 @@
+package olm
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	platformtesting "github.com/fosrl/olm/dns/platform/testing"
+)
+
+func TestChangeHooks(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+
+	var calls []string
+	options := newOverrideOptions([]OverrideOption{
+		WithOverrideVerificationTimeout(0),
+		WithPreSetHook(func() error {
+			calls = append(calls, "pre-set")
+			return nil
+		}),
+		WithPostSetHook(func(servers []netip.Addr) error {
+			calls = append(calls, "post-set")
+			if !slices.Equal(servers, []netip.Addr{proxyIp}) {
+				t.Errorf("Expected post-set to get the proxy, got %v", servers)
+			}
+			return errors.New("monitoring unreachable")
+		}),
+		WithPreRestoreHook(func() error {
+			calls = append(calls, "pre-restore")
+			return nil
+		}),
+		WithPostRestoreHook(func(servers []netip.Addr) error {
+			calls = append(calls, "post-restore")
+			if !slices.Equal(servers, original) {
+				t.Errorf("Expected post-restore to get the original servers, got %v", servers)
+			}
+			return nil
+		}),
+	})
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		t.Fatalf("Expected a post-set error to keep the override, got %v", err)
+	}
+	if !conf.Overridden() {
+		t.Error("Expected DNS to stay overridden after a failing post-set hook")
+	}
+	if err := restoreDNS(conf); err != nil {
+		t.Fatalf("restoreDNS failed: %v", err)
+	}
+	if !slices.Equal(calls, []string{"pre-set", "post-set", "pre-restore", "post-restore"}) {
+		t.Errorf("Expected the hooks to run in order, got %v", calls)
+	}
+}
+
+func TestChangeHooksAbort(t *testing.T) {
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+	conf := platformtesting.NewMockDNSConfigurator()
+
+	options := newOverrideOptions([]OverrideOption{WithPreSetHook(func() error { return errors.New("not now") })})
+	if err := setDNS(proxyIp, conf, options); err == nil {
+		t.Fatal("Expected a failing pre-set hook to abort the override")
+	}
+	if len(conf.SetDNSCalls()) != 0 {
+		t.Error("Expected DNS to be left alone")
+	}
+
+	options = newOverrideOptions([]OverrideOption{
+		WithOverrideVerificationTimeout(0),
+		WithPreRestoreHook(func() error { return errors.New("not now") }),
+	})
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	t.Cleanup(func() { overrideChangeHooks = changeHooks{} })
+	if err := restoreDNS(conf); err == nil {
+		t.Fatal("Expected a failing pre-restore hook to abort the restore")
+	}
+	if !conf.Overridden() {
+		t.Error("Expected the override to stay in place")
+	}
+}
+
+func TestShellHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell hook test uses sh")
+	}
+
+	out := filepath.Join(t.TempDir(), "servers")
+	options := newOverrideOptions([]OverrideOption{
+		WithOverrideVerificationTimeout(0),
+		WithShellHook(HookPostSet, `echo "$OLM_DNS_SERVERS" > `+out),
+		WithShellHook(HookPreRestore, "exit 3"),
+	})
+	conf := platformtesting.NewMockDNSConfigurator()
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	t.Cleanup(func() { overrideChangeHooks = changeHooks{} })
+
+	if got, _ := os.ReadFile(out); strings.TrimSpace(string(got)) != "100.96.128.1" {
+		t.Errorf("Expected the post-set hook to see the proxy in OLM_DNS_SERVERS, got %q", got)
+	}
+	if err := restoreDNS(conf); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("Expected the failing pre-restore command to abort the restore, got %v", err)
+	}
+
+	options = newOverrideOptions([]OverrideOption{WithShellHook("on-set", "true")})
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), platformtesting.NewMockDNSConfigurator(), options); err == nil {
+		t.Error("Expected an unknown hook event to be rejected")
+	}
+}
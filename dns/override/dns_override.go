@@ -0,0 +1,466 @@
+package olm
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	platform "github.com/fosrl/olm/dns/platform"
+	"github.com/miekg/dns"
+)
+
+var (
+	// overrideMu guards the platform-specific configurator variable, which is
+	// non-nil while an override is active
+	overrideMu sync.Mutex
+
+	// The override* variables belong to the active override, set by setDNS and
+	// used by restoreDNS. All are guarded by overrideMu.
+	overrideHooks       DNSOverrideHooks
+	overrideOriginal    []netip.Addr
+	overrideServers     []netip.Addr
+	overridePersistence PersistenceMode
+	overrideAuditLog    overrideAudit
+	overrideChangeHooks changeHooks
+
+	// overrideGeneration counts the overrides applied so far, so the auto-restore
+	// timer of one override never restores a later one. Guarded by overrideMu.
+	overrideGeneration uint64
+
+	// restoreTimer is the pending auto-restore armed by SetupDNSOverrideWithTimeout
+	restoreTimer   *time.Timer
+	restoreTimerMu sync.Mutex
+)
+
+var (
+	// ErrOverrideAlreadyActive is returned by SetupDNSOverride when an override is
+	// already in place. Overriding again would replace the backup of the original
+	// DNS settings with the proxy's, so restoring would keep DNS on the proxy.
+	ErrOverrideAlreadyActive = errors.New("DNS override already active")
+
+	// ErrOverrideNotActive is returned by RestoreDNSOverride when there is no override to restore
+	ErrOverrideNotActive = errors.New("DNS override not active")
+)
+
+// StaleEntry describes DNS configuration that CleanupStaleState would remove
+type StaleEntry = platform.StaleEntry
+
+// SetupMode controls whether the proxy replaces or is added ahead of the
+// original system nameservers
+type SetupMode int
+
+const (
+	// OverrideModeReplace makes the proxy the only nameserver
+	OverrideModeReplace SetupMode = iota
+	// OverrideModePrepend adds the proxy as the first nameserver and keeps
+	// the original servers as a fallback at the OS level
+	OverrideModePrepend
+)
+
+// String returns the setup mode name
+func (m SetupMode) String() string {
+	switch m {
+	case OverrideModeReplace:
+		return "replace"
+	case OverrideModePrepend:
+		return "prepend"
+	default:
+		return "unknown"
+	}
+}
+
+// OverrideOption configures the behaviour of SetupDNSOverride
+type OverrideOption func(*overrideOptions)
+
+type overrideOptions struct {
+	verificationTimeout time.Duration
+	proxyPort           uint16
+	searchDomains       []string
+	mode                SetupMode
+	hooks               DNSOverrideHooks
+	persistence         PersistenceMode
+	persistenceCommand  []string
+	auditLog            string
+	changeHooks         changeHooks
+	// optionErr is set by an option given an invalid value
+	optionErr error
+	// interfaceName is the interface passed to SetupDNSOverride, recorded in the audit log
+	interfaceName string
+}
+
+// DNSOverrideHooks are called as the DNS override changes state
+// Any of the functions may be nil.
+type DNSOverrideHooks struct {
+	// OnSet is called once the system DNS points at the proxy, with the servers
+	// that were replaced and the servers now configured
+	OnSet func(original, new []netip.Addr)
+
+	// OnRestore is called once RestoreDNSOverride has put back the original servers
+	OnRestore func(restored []netip.Addr)
+
+	// OnError is called when a phase of the override fails: "validate", "set",
+	// "verify", "persist" or "restore"
+	OnError func(phase string, err error)
+}
+
+func (h DNSOverrideHooks) set(original, new []netip.Addr) {
+	if h.OnSet != nil {
+		h.OnSet(original, new)
+	}
+}
+
+func (h DNSOverrideHooks) restore(restored []netip.Addr) {
+	if h.OnRestore != nil {
+		h.OnRestore(restored)
+	}
+}
+
+func (h DNSOverrideHooks) fail(phase string, err error) {
+	if h.OnError != nil {
+		h.OnError(phase, err)
+	}
+}
+
+// WithOverrideEventHooks sets functions called when the override is set, restored
+// or fails, so a larger daemon can react without polling. The hooks stay in use
+// until RestoreDNSOverride has restored the override.
+func WithOverrideEventHooks(hooks DNSOverrideHooks) OverrideOption {
+	return func(o *overrideOptions) {
+		o.hooks = hooks
+	}
+}
+
+// WithOverrideVerificationTimeout makes SetupDNSOverride send the DNS proxy a test
+// query once the system DNS points at it, and roll the override back if no answer
+// comes within d. The check is off by default, and a zero or negative d turns it off.
+// overrideMu is held while waiting, so other override calls wait up to d too.
+func WithOverrideVerificationTimeout(d time.Duration) OverrideOption {
+	return func(o *overrideOptions) {
+		o.verificationTimeout = d
+	}
+}
+
+// WithOverrideProxyPort sets the port the DNS proxy answers on, 53 by default, which
+// the verification query is sent to. Use it for a proxy started with a listen port
+// other than 53.
+func WithOverrideProxyPort(port uint16) OverrideOption {
+	return func(o *overrideOptions) {
+		o.proxyPort = port
+	}
+}
+
+// WithSearchDomains sets the search domains configured alongside the proxy
+// nameserver, e.g. when the tunnel provides its own domain
+func WithSearchDomains(domains []string) OverrideOption {
+	return func(o *overrideOptions) {
+		o.searchDomains = domains
+	}
+}
+
+// WithOverrideMode sets whether the proxy replaces the original nameservers
+// (the default) or is prepended to them
+func WithOverrideMode(mode SetupMode) OverrideOption {
+	return func(o *overrideOptions) {
+		o.mode = mode
+	}
+}
+
+// newOverrideOptions applies opts on top of the defaults
+// The caller must hold overrideMu.
+func newOverrideOptions(opts []OverrideOption) overrideOptions {
+	options := overrideOptions{
+		proxyPort: 53,
+		auditLog:  auditLogPath,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// dnsSnapshot holds the DNS configuration captured before an override is applied
+type dnsSnapshot struct {
+	servers []netip.Addr
+}
+
+// setDNS points the system DNS at the proxy as a single transaction: the current
+// configuration is snapshotted, the change is applied, the proxy is verified to be
+// reachable and the snapshot is restored if any step fails.
+// The caller must hold overrideMu.
+func setDNS(proxyIp netip.Addr, conf platform.DNSConfigurator, options overrideOptions) error {
+	if options.optionErr != nil {
+		options.hooks.fail("validate", options.optionErr)
+		return options.optionErr
+	}
+
+	// Fail with a clear reason before touching anything if the change cannot be made
+	if err := conf.ValidateConfig(); err != nil {
+		err = fmt.Errorf("%s DNS configurator cannot change DNS settings: %w", conf.Name(), err)
+		options.hooks.fail("validate", err)
+		return err
+	}
+	if !persistenceSupported(options.persistence) {
+		err := fmt.Errorf("%w: %s", ErrPersistenceUnsupported, options.persistence)
+		options.hooks.fail("validate", err)
+		return err
+	}
+	if options.persistence != PersistenceNone && len(options.persistenceCommand) == 0 {
+		options.hooks.fail("validate", ErrPersistenceCommandRequired)
+		return ErrPersistenceCommandRequired
+	}
+
+	// Take a snapshot of the current DNS configuration before changing anything
+	var snapshot dnsSnapshot
+	currentDNS, err := conf.GetCurrentDNS()
+	if err != nil {
+		logger.Warn("Could not get current DNS: %v", err)
+	} else {
+		snapshot.servers = currentDNS
+		logger.Info("Current DNS servers: %v", currentDNS)
+	}
+
+	// Set new DNS servers to point to our proxy
+	newDNS := []netip.Addr{
+		proxyIp,
+	}
+
+	if options.mode == OverrideModePrepend {
+		if pc, ok := conf.(platform.PrependConfigurator); ok {
+			// The DNS manager keeps the original servers itself
+			pc.SetPrepend(true)
+		} else {
+			for _, server := range snapshot.servers {
+				if !slices.Contains(newDNS, server) {
+					newDNS = append(newDNS, server)
+				}
+			}
+		}
+	}
+
+	if err := runPre(options.changeHooks.preSet); err != nil {
+		err = fmt.Errorf("pre-set hook aborted DNS override: %w", err)
+		options.hooks.fail("set", err)
+		return err
+	}
+
+	audit := overrideAudit{path: options.auditLog, interfaceName: options.interfaceName}
+
+	// rollback undoes a failed phase and reports it
+	rollback := func(phase string, cause error) error {
+		err := rollbackDNS(conf, snapshot, cause)
+		audit.record(AuditEntry{Operation: "rollback", PreviousServers: newDNS, NewServers: snapshot.servers, Error: errorString(err)})
+		options.hooks.fail(phase, err)
+		return err
+	}
+
+	if len(options.searchDomains) > 0 {
+		logger.Info("Setting DNS search domains to: %v", options.searchDomains)
+		if err := conf.SetSearchDomains(options.searchDomains); err != nil {
+			return rollback("set", fmt.Errorf("failed to set search domains: %w", err))
+		}
+	}
+
+	logger.Info("Setting DNS servers to: %v", newDNS)
+	originalDNS, err := conf.SetDNS(newDNS)
+	audit.record(AuditEntry{Operation: "set", PreviousServers: snapshot.servers, NewServers: newDNS, Error: errorString(err)})
+	if err != nil {
+		return rollback("set", fmt.Errorf("failed to set DNS: %w", err))
+	}
+
+	logger.Info("Original DNS servers backed up: %v", originalDNS)
+
+	if options.verificationTimeout > 0 {
+		if err := verifyDNSProxy(netip.AddrPortFrom(proxyIp, options.proxyPort), options.verificationTimeout); err != nil {
+			return rollback("verify", fmt.Errorf("failed to verify DNS proxy: %w", err))
+		}
+		logger.Debug("DNS proxy %s answered verification query", proxyIp)
+	}
+
+	if options.persistence != PersistenceNone {
+		if err := enablePersistence(options.persistence, options.persistenceCommand); err != nil {
+			return rollback("persist", fmt.Errorf("failed to persist DNS override: %w", err))
+		}
+		logger.Info("DNS override will be reapplied on boot (%s)", options.persistence)
+	}
+
+	overrideHooks = options.hooks
+	overrideOriginal = originalDNS
+	overrideServers = newDNS
+	overridePersistence = options.persistence
+	overrideAuditLog = audit
+	overrideChangeHooks = options.changeHooks
+	overrideGeneration++
+	options.hooks.set(originalDNS, newDNS)
+
+	if err := runPost(options.changeHooks.postSet, newDNS); err != nil {
+		logger.Warn("Post-set hook failed, keeping the DNS override: %v", err)
+	}
+	return nil
+}
+
+// restoreDNS undoes the override made through conf and reports it to the override hooks
+// The caller must hold overrideMu.
+func restoreDNS(conf platform.DNSConfigurator) error {
+	if err := runPre(overrideChangeHooks.preRestore); err != nil {
+		err = fmt.Errorf("pre-restore hook aborted DNS restore: %w", err)
+		overrideHooks.fail("restore", err)
+		return err
+	}
+
+	logger.Info("Restoring original DNS configuration")
+	err := conf.RestoreDNS()
+	overrideAuditLog.record(AuditEntry{Operation: "restore", PreviousServers: overrideServers, NewServers: overrideOriginal, Error: errorString(err)})
+	if err != nil {
+		err = fmt.Errorf("failed to restore DNS: %w", err)
+		overrideHooks.fail("restore", err)
+		return err
+	}
+
+	// DNS is already back to normal, so a leftover boot entry is reported but not fatal
+	if overridePersistence != PersistenceNone {
+		if err := disablePersistence(overridePersistence); err != nil {
+			err = fmt.Errorf("failed to remove DNS override persistence: %w", err)
+			logger.Error("%v", err)
+			overrideHooks.fail("persist", err)
+		}
+	}
+
+	hooks, change, restored := overrideHooks, overrideChangeHooks, overrideOriginal
+	overrideHooks, overrideOriginal, overrideServers = DNSOverrideHooks{}, nil, nil
+	overridePersistence, overrideAuditLog, overrideChangeHooks = PersistenceNone, overrideAudit{}, changeHooks{}
+	hooks.restore(restored)
+
+	if err := runPost(change.postRestore, restored); err != nil {
+		logger.Warn("Post-restore hook failed: %v", err)
+	}
+
+	logger.Info("DNS configuration restored successfully")
+	return nil
+}
+
+// rollbackDNS restores the snapshot after a failed override. The configurator's
+// RestoreDNS is tried first. If it fails or leaves servers other than the snapshot's,
+// for example because SetDNS failed before writing its backup, the snapshot servers are
+// set again with SetDNS and the backup that SetDNS wrote is discarded, so nothing is
+// left to restore later. The returned error always wraps cause, and also wraps the
+// rollback failures if the snapshot could not be restored.
+func rollbackDNS(conf platform.DNSConfigurator, snapshot dnsSnapshot, cause error) error {
+	logger.Warn("DNS override failed, rolling back to %v: %v", snapshot.servers, cause)
+
+	restoreErr := conf.RestoreDNS()
+	if restoreErr == nil {
+		current, err := conf.GetCurrentDNS()
+		if len(snapshot.servers) == 0 || (err == nil && slices.Equal(current, snapshot.servers)) {
+			logger.Info("DNS configuration rolled back successfully")
+			return cause
+		}
+	} else if len(snapshot.servers) == 0 {
+		return fmt.Errorf("%w (rollback failed: %w)", cause, restoreErr)
+	} else {
+		logger.Warn("Failed to restore DNS, setting the snapshot servers again: %v", restoreErr)
+	}
+
+	if _, err := conf.SetDNS(snapshot.servers); err != nil {
+		if restoreErr != nil {
+			return fmt.Errorf("%w (rollback failed: %w, setting snapshot servers failed: %w)", cause, restoreErr, err)
+		}
+		return fmt.Errorf("%w (rollback failed: %w)", cause, err)
+	}
+
+	if bd, ok := conf.(platform.BackupDiscarder); ok {
+		if err := bd.DiscardBackup(); err != nil {
+			logger.Warn("Failed to discard the DNS backup written while rolling back: %v", err)
+		}
+	}
+
+	logger.Info("DNS configuration rolled back to the snapshot servers")
+	return cause
+}
+
+// verifyDNSProxy sends a test query to the proxy at server and waits for any response
+func verifyDNSProxy(server netip.AddrPort, timeout time.Duration) error {
+	client := &dns.Client{
+		Timeout: timeout,
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion(".", dns.TypeNS)
+
+	if _, _, err := client.Exchange(query, server.String()); err != nil {
+		return fmt.Errorf("query %s: %w", server, err)
+	}
+
+	return nil
+}
+
+// SetupDNSOverrideWithTimeout behaves like SetupDNSOverride but automatically
+// restores the original DNS configuration if RestoreDNSOverride has not been
+// called within timeout. This is a safety net for operators testing configurations.
+func SetupDNSOverrideWithTimeout(interfaceName string, proxyIp netip.Addr, timeout time.Duration, opts ...OverrideOption) error {
+	if timeout <= 0 {
+		return fmt.Errorf("auto-restore timeout must be positive, got %s", timeout)
+	}
+
+	overrideMu.Lock()
+	err := setupDNSOverrideLocked(interfaceName, proxyIp, opts)
+	generation := overrideGeneration
+	overrideMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	restoreTimerMu.Lock()
+	defer restoreTimerMu.Unlock()
+
+	if restoreTimer != nil {
+		restoreTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		restoreTimerMu.Lock()
+		if restoreTimer != timer {
+			// Cancelled or replaced while we were waiting for the lock
+			restoreTimerMu.Unlock()
+			return
+		}
+		restoreTimer = nil
+		restoreTimerMu.Unlock()
+
+		overrideMu.Lock()
+		defer overrideMu.Unlock()
+
+		// The override may have been restored and a new one applied in the meantime
+		if overrideGeneration != generation {
+			return
+		}
+
+		logger.Warn("DNS override was not restored within %s, reverting automatically", timeout)
+		if err := restoreDNSOverrideLocked(); err != nil && !errors.Is(err, ErrOverrideNotActive) {
+			logger.Error("Failed to auto-restore DNS: %v", err)
+		}
+	})
+	restoreTimer = timer
+
+	logger.Info("DNS override will be automatically restored in %s", timeout)
+	return nil
+}
+
+// CancelDNSOverrideTimeout stops a pending auto-restore armed by
+// SetupDNSOverrideWithTimeout, leaving the current DNS override in place
+func CancelDNSOverrideTimeout() {
+	restoreTimerMu.Lock()
+	defer restoreTimerMu.Unlock()
+
+	if restoreTimer == nil {
+		return
+	}
+
+	restoreTimer.Stop()
+	restoreTimer = nil
+	logger.Debug("DNS override auto-restore cancelled")
+}
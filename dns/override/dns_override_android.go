@@ -6,11 +6,36 @@ import "net/netip"
 
 // SetupDNSOverride is a no-op on Android
 // Android handles DNS through the VpnService API at the Java/Kotlin layer
-func SetupDNSOverride(interfaceName string, proxyIp netip.Addr) error {
+func SetupDNSOverride(interfaceName string, proxyIp netip.Addr, opts ...OverrideOption) error {
+	return nil
+}
+
+// setupDNSOverrideLocked is SetupDNSOverride, a no-op
+func setupDNSOverrideLocked(interfaceName string, proxyIp netip.Addr, opts []OverrideOption) error {
+	return nil
+}
+
+// restoreDNSOverrideLocked is RestoreDNSOverride, a no-op
+func restoreDNSOverrideLocked() error {
 	return nil
 }
 
 // RestoreDNSOverride is a no-op on Android
 func RestoreDNSOverride() error {
 	return nil
-}
\ No newline at end of file
+}
+
+// CleanupStaleState is a no-op on Android
+func CleanupStaleState(interfaceNames ...string) error {
+	return nil
+}
+
+// CleanupStaleStateDryRun always reports nothing, see CleanupStaleState
+func CleanupStaleStateDryRun(interfaceNames ...string) ([]StaleEntry, error) {
+	return nil, nil
+}
+
+// PreviewDNSOverride reports that nothing is written on Android, see SetupDNSOverride
+func PreviewDNSOverride(interfaceName string, proxyIps []netip.Addr, searchDomains []string, opts ...OverrideOption) (string, error) {
+	return "# DNS is configured by the Android VPN service, no system changes are made\n", nil
+}
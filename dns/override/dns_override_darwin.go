@@ -14,50 +14,83 @@ var configurator platform.DNSConfigurator
 
 // SetupDNSOverride configures the system DNS to use the DNS proxy on macOS
 // Uses scutil for DNS configuration
-func SetupDNSOverride(interfaceName string, proxyIp netip.Addr) error {
-	var err error
-	configurator, err = platform.NewDarwinDNSConfigurator()
+func SetupDNSOverride(interfaceName string, proxyIp netip.Addr, opts ...OverrideOption) error {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	return setupDNSOverrideLocked(interfaceName, proxyIp, opts)
+}
+
+// setupDNSOverrideLocked is SetupDNSOverride, the caller must hold overrideMu
+func setupDNSOverrideLocked(interfaceName string, proxyIp netip.Addr, opts []OverrideOption) error {
+	if configurator != nil {
+		return ErrOverrideAlreadyActive
+	}
+
+	options := newOverrideOptions(opts)
+	options.interfaceName = interfaceName
+	conf, err := platform.NewDarwinDNSConfigurator()
 	if err != nil {
 		return fmt.Errorf("failed to create Darwin DNS configurator: %w", err)
 	}
 
 	logger.Info("Using Darwin scutil DNS configurator")
 
-	// Get current DNS servers before changing
-	currentDNS, err := configurator.GetCurrentDNS()
-	if err != nil {
-		logger.Warn("Could not get current DNS: %v", err)
-	} else {
-		logger.Info("Current DNS servers: %v", currentDNS)
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		return err
 	}
+	configurator = conf
+	return nil
+}
+
+// RestoreDNSOverride restores the original DNS configuration
+// Any pending auto-restore timer is cancelled
+func RestoreDNSOverride() error {
+	CancelDNSOverrideTimeout()
+
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
 
-	// Set new DNS servers to point to our proxy
-	newDNS := []netip.Addr{
-		proxyIp,
+	return restoreDNSOverrideLocked()
+}
+
+// restoreDNSOverrideLocked is RestoreDNSOverride without cancelling the timer
+// The caller must hold overrideMu.
+func restoreDNSOverrideLocked() error {
+	if configurator == nil {
+		return ErrOverrideNotActive
 	}
 
-	logger.Info("Setting DNS servers to: %v", newDNS)
-	originalDNS, err := configurator.SetDNS(newDNS)
-	if err != nil {
-		return fmt.Errorf("failed to set DNS: %w", err)
+	if err := restoreDNS(configurator); err != nil {
+		return err
 	}
 
-	logger.Info("Original DNS servers backed up: %v", originalDNS)
+	configurator = nil
 	return nil
 }
 
-// RestoreDNSOverride restores the original DNS configuration
-func RestoreDNSOverride() error {
-	if configurator == nil {
-		logger.Debug("No DNS configurator to restore")
-		return nil
-	}
+// CleanupStaleState removes DNS configuration left behind by a previous session
+// that did not shut down cleanly. On macOS this removes leftover scutil keys.
+func CleanupStaleState(interfaceNames ...string) error {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
 
-	logger.Info("Restoring original DNS configuration")
-	if err := configurator.RestoreDNS(); err != nil {
-		return fmt.Errorf("failed to restore DNS: %w", err)
+	// The Darwin configurator cleans up persisted state when it is created
+	if _, err := platform.NewDarwinDNSConfigurator(); err != nil {
+		return fmt.Errorf("failed to clean up stale DNS state: %w", err)
 	}
 
-	logger.Info("DNS configuration restored successfully")
 	return nil
 }
+
+// CleanupStaleStateDryRun reports what CleanupStaleState would remove
+// without modifying any scutil state
+func CleanupStaleStateDryRun(interfaceNames ...string) ([]StaleEntry, error) {
+	return platform.DetectStaleDarwinDNS()
+}
+
+// PreviewDNSOverride returns the scutil commands SetupDNSOverride would run
+// without applying them
+func PreviewDNSOverride(interfaceName string, proxyIps []netip.Addr, searchDomains []string, opts ...OverrideOption) (string, error) {
+	return platform.PreviewDarwinDNS(proxyIps, searchDomains)
+}
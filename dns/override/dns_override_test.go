@@ -0,0 +1,338 @@
+package olm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	platform "github.com/fosrl/olm/dns/platform"
+	platformtesting "github.com/fosrl/olm/dns/platform/testing"
+	"github.com/miekg/dns"
+)
+
+// fakeConfigurator records the servers passed to SetDNS
+type fakeConfigurator struct {
+	current []netip.Addr
+	set     []netip.Addr
+	prepend bool
+}
+
+func (f *fakeConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error) {
+	f.set = servers
+	return f.current, nil
+}
+
+func (f *fakeConfigurator) SetSearchDomains(domains []string) error { return nil }
+func (f *fakeConfigurator) GetSearchDomains() ([]string, error)     { return nil, nil }
+func (f *fakeConfigurator) RestoreDNS() error                       { return nil }
+func (f *fakeConfigurator) ValidateConfig() error                   { return nil }
+func (f *fakeConfigurator) GetCurrentDNS() ([]netip.Addr, error)    { return f.current, nil }
+func (f *fakeConfigurator) Name() string                            { return "fake" }
+func (f *fakeConfigurator) CleanupUncleanShutdown() error           { return nil }
+
+// fakePrependConfigurator handles prepend natively
+type fakePrependConfigurator struct {
+	fakeConfigurator
+}
+
+func (f *fakePrependConfigurator) SetPrepend(prepend bool) { f.prepend = prepend }
+
+func TestSetDNSOverrideMode(t *testing.T) {
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1"), netip.MustParseAddr("1.1.1.1")}
+
+	tests := []struct {
+		name     string
+		mode     SetupMode
+		expected []netip.Addr
+	}{
+		{name: "replace", mode: OverrideModeReplace, expected: []netip.Addr{proxyIp}},
+		{name: "prepend", mode: OverrideModePrepend, expected: append([]netip.Addr{proxyIp}, original...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &fakeConfigurator{current: original}
+			options := newOverrideOptions([]OverrideOption{WithOverrideMode(tt.mode), WithOverrideVerificationTimeout(0)})
+
+			if err := setDNS(proxyIp, conf, options); err != nil {
+				t.Fatalf("setDNS failed: %v", err)
+			}
+
+			if len(conf.set) != len(tt.expected) {
+				t.Fatalf("Expected servers %v, got %v", tt.expected, conf.set)
+			}
+			for i := range conf.set {
+				if conf.set[i] != tt.expected[i] {
+					t.Errorf("Expected servers %v, got %v", tt.expected, conf.set)
+				}
+			}
+		})
+	}
+}
+
+func TestSetDNSPrependNative(t *testing.T) {
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+	conf := &fakePrependConfigurator{fakeConfigurator{current: []netip.Addr{netip.MustParseAddr("192.168.1.1")}}}
+	options := newOverrideOptions([]OverrideOption{WithOverrideMode(OverrideModePrepend), WithOverrideVerificationTimeout(0)})
+
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+
+	if !conf.prepend {
+		t.Errorf("Expected SetPrepend(true) to be called")
+	}
+	if len(conf.set) != 1 || conf.set[0] != proxyIp {
+		t.Errorf("Expected only the proxy IP to be passed to SetDNS, got %v", conf.set)
+	}
+}
+
+func TestSetDNSRollbackOnFailure(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	injected := errors.New("permission denied")
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	conf.SetDNSError(injected)
+	options := newOverrideOptions([]OverrideOption{WithOverrideVerificationTimeout(0)})
+
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); !errors.Is(err, injected) {
+		t.Fatalf("Expected setDNS to fail with the injected error, got %v", err)
+	}
+	if current, _ := conf.GetCurrentDNS(); !slices.Equal(current, original) || conf.Overridden() {
+		t.Errorf("Expected the original servers %v to stay in place, got %v", original, current)
+	}
+}
+
+func TestSetDNSValidatesConfig(t *testing.T) {
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetValidateConfigError(fmt.Errorf("%w: not root", platform.ErrInsufficientPrivileges))
+	options := newOverrideOptions([]OverrideOption{WithOverrideVerificationTimeout(0)})
+
+	err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options)
+	if !errors.Is(err, platform.ErrInsufficientPrivileges) {
+		t.Fatalf("Expected an insufficient privileges error, got %v", err)
+	}
+	if calls := conf.SetDNSCalls(); len(calls) != 0 {
+		t.Errorf("Expected SetDNS not to be called, got %v", calls)
+	}
+}
+
+func TestOverrideEventHooks(t *testing.T) {
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+
+	var setOriginal, setNew, restored []netip.Addr
+	var phases []string
+	hooks := DNSOverrideHooks{
+		OnSet:     func(o, n []netip.Addr) { setOriginal, setNew = o, n },
+		OnRestore: func(r []netip.Addr) { restored = r },
+		OnError:   func(phase string, err error) { phases = append(phases, phase) },
+	}
+	options := newOverrideOptions([]OverrideOption{WithOverrideEventHooks(hooks), WithOverrideVerificationTimeout(0)})
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	if !slices.Equal(setOriginal, original) || !slices.Equal(setNew, []netip.Addr{proxyIp}) {
+		t.Errorf("Expected OnSet(%v, [%s]), got OnSet(%v, %v)", original, proxyIp, setOriginal, setNew)
+	}
+
+	if err := restoreDNS(conf); err != nil {
+		t.Fatalf("restoreDNS failed: %v", err)
+	}
+	if !slices.Equal(restored, original) {
+		t.Errorf("Expected OnRestore(%v), got OnRestore(%v)", original, restored)
+	}
+
+	failing := platformtesting.NewMockDNSConfigurator()
+	failing.SetValidateConfigError(platform.ErrDNSManagerNotReachable)
+	setDNS(proxyIp, failing, options)
+	failing.SetValidateConfigError(nil)
+	failing.SetDNSError(errors.New("permission denied"))
+	setDNS(proxyIp, failing, options)
+	if !slices.Equal(phases, []string{"validate", "set"}) {
+		t.Errorf("Expected OnError for the validate and set phases, got %v", phases)
+	}
+}
+
+func TestOverrideEventHooksOptional(t *testing.T) {
+	options := newOverrideOptions([]OverrideOption{WithOverrideEventHooks(DNSOverrideHooks{}), WithOverrideVerificationTimeout(0)})
+	conf := platformtesting.NewMockDNSConfigurator()
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	if err := restoreDNS(conf); err != nil {
+		t.Fatalf("restoreDNS failed: %v", err)
+	}
+}
+
+// scriptedConfigurator is a mock whose SetDNS calls fail with errs in turn, nil errors
+// letting the call through. With partial, a failing call still changes the servers,
+// as a SetDNS failing after writing but before saving its backup would.
+type scriptedConfigurator struct {
+	*platformtesting.MockDNSConfigurator
+	errs    []error
+	partial bool
+}
+
+func (s *scriptedConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error) {
+	var err error
+	if len(s.errs) > 0 {
+		err, s.errs = s.errs[0], s.errs[1:]
+	}
+	if err == nil {
+		return s.MockDNSConfigurator.SetDNS(servers)
+	}
+	if s.partial {
+		s.SetCurrentDNS(servers)
+	}
+	return nil, err
+}
+
+// silentDNSPort returns the port of a UDP socket that never answers
+func silentDNSPort(t *testing.T) uint16 {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestSetDNSVerifiesProxyPort(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	port := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+	options := newOverrideOptions([]OverrideOption{WithOverrideProxyPort(port), WithOverrideVerificationTimeout(time.Second)})
+	if err := setDNS(netip.MustParseAddr("127.0.0.1"), conf, options); err != nil {
+		t.Fatalf("Expected the proxy on port %d to be verified, got %v", port, err)
+	}
+}
+
+func TestSetDNSVerificationFailureRollsBack(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	options := newOverrideOptions([]OverrideOption{
+		WithOverrideProxyPort(silentDNSPort(t)),
+		WithOverrideVerificationTimeout(100 * time.Millisecond),
+	})
+
+	err := setDNS(netip.MustParseAddr("127.0.0.1"), conf, options)
+	if err == nil || !strings.Contains(err.Error(), "failed to verify DNS proxy") {
+		t.Fatalf("Expected a verification error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "rollback failed") {
+		t.Errorf("Expected the rollback to succeed, got %v", err)
+	}
+	if current, _ := conf.GetCurrentDNS(); !slices.Equal(current, original) || conf.Overridden() {
+		t.Errorf("Expected the original servers %v to be restored, got %v", original, current)
+	}
+}
+
+func TestSetDNSRollbackReappliesSnapshot(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	injected := errors.New("write interrupted")
+	conf := &scriptedConfigurator{MockDNSConfigurator: platformtesting.NewMockDNSConfigurator(), errs: []error{injected}, partial: true}
+	conf.SetCurrentDNS(original)
+	options := newOverrideOptions([]OverrideOption{WithOverrideVerificationTimeout(0)})
+
+	// SetDNS changed the servers without a backup, so RestoreDNS has nothing to restore
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); !errors.Is(err, injected) {
+		t.Fatalf("Expected setDNS to fail with the injected error, got %v", err)
+	}
+	if current, _ := conf.GetCurrentDNS(); !slices.Equal(current, original) {
+		t.Errorf("Expected the snapshot servers %v to be set again, got %v", original, current)
+	}
+	if calls := conf.SetDNSCalls(); len(calls) != 1 || !slices.Equal(calls[0], original) {
+		t.Errorf("Expected SetDNS(%v) from the rollback, got %v", original, calls)
+	}
+	// The backup written by the rollback's SetDNS would undo nothing but still be restored later
+	if conf.Overridden() {
+		t.Error("Expected the backup written by the rollback to be discarded")
+	}
+}
+
+func TestSetDNSSearchDomainsFailureRollsBack(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	injected := errors.New("search domains rejected")
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	conf.SetSearchDomainsError(injected)
+
+	var phase string
+	options := newOverrideOptions([]OverrideOption{
+		WithSearchDomains([]string{"corp.internal"}),
+		WithAuditLog(filepath.Join(t.TempDir(), "audit.log")),
+		WithOverrideEventHooks(DNSOverrideHooks{OnError: func(p string, err error) { phase = p }}),
+	})
+
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); !errors.Is(err, injected) {
+		t.Fatalf("Expected setDNS to fail with the injected error, got %v", err)
+	}
+	if phase != "set" {
+		t.Errorf("Expected OnError for the set phase, got %q", phase)
+	}
+	if current, _ := conf.GetCurrentDNS(); !slices.Equal(current, original) || conf.Overridden() {
+		t.Errorf("Expected the original servers %v to be kept, got %v", original, current)
+	}
+
+	if entries := readAuditLog(t, options.auditLog); len(entries) != 1 || entries[0].Operation != "rollback" {
+		t.Errorf("Expected the failure to be audited as a rollback, got %+v", entries)
+	}
+}
+
+func TestVerificationOptIn(t *testing.T) {
+	if timeout := newOverrideOptions(nil).verificationTimeout; timeout != 0 {
+		t.Errorf("Expected proxy verification to be off by default, got a %v timeout", timeout)
+	}
+}
+
+func TestSetDNSRollbackFailureWrapsErrors(t *testing.T) {
+	restoreErr := errors.New("restore failed")
+	reapplyErr := errors.New("set failed")
+	conf := &scriptedConfigurator{MockDNSConfigurator: platformtesting.NewMockDNSConfigurator(), errs: []error{nil, reapplyErr}}
+	conf.SetCurrentDNS([]netip.Addr{netip.MustParseAddr("192.168.1.1")})
+	conf.SetRestoreDNSError(restoreErr)
+
+	var hookErr error
+	options := newOverrideOptions([]OverrideOption{
+		WithOverrideProxyPort(silentDNSPort(t)),
+		WithOverrideVerificationTimeout(100 * time.Millisecond),
+		WithOverrideEventHooks(DNSOverrideHooks{OnError: func(phase string, err error) { hookErr = err }}),
+	})
+
+	err := setDNS(netip.MustParseAddr("127.0.0.1"), conf, options)
+	if err == nil || !strings.Contains(err.Error(), "failed to verify DNS proxy") {
+		t.Fatalf("Expected the verification error, got %v", err)
+	}
+	if !errors.Is(err, restoreErr) || !errors.Is(err, reapplyErr) {
+		t.Errorf("Expected both rollback failures to be wrapped, got %v", err)
+	}
+	if hookErr != err {
+		t.Errorf("Expected OnError to get the combined error, got %v", hookErr)
+	}
+}
@@ -3,98 +3,310 @@
 package olm
 
 import (
+	"errors"
 	"fmt"
 	"net/netip"
+	"slices"
 
 	"github.com/fosrl/newt/logger"
 	platform "github.com/fosrl/olm/dns/platform"
 )
 
-var configurator platform.DNSConfigurator
+var (
+	configurator platform.DNSConfigurator
+
+	// createConfigurator picks the configurator for SetupDNSOverride, replaced in tests
+	createConfigurator = newConfigurator
+)
 
 // SetupDNSOverride configures the system DNS to use the DNS proxy on Linux/FreeBSD
-// Detects the DNS manager by reading /etc/resolv.conf and verifying runtime availability
-func SetupDNSOverride(interfaceName string, proxyIp netip.Addr) error {
-	var err error
+// Detects the DNS manager by reading /etc/resolv.conf and verifying runtime availability.
+// State left by a previous session that did not shut down cleanly is cleaned up first.
+func SetupDNSOverride(interfaceName string, proxyIp netip.Addr, opts ...OverrideOption) error {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	return setupDNSOverrideLocked(interfaceName, proxyIp, opts)
+}
+
+// setupDNSOverrideLocked is SetupDNSOverride, the caller must hold overrideMu
+func setupDNSOverrideLocked(interfaceName string, proxyIp netip.Addr, opts []OverrideOption) error {
+	if configurator != nil {
+		return ErrOverrideAlreadyActive
+	}
+
+	// Otherwise the previous session's changes would be backed up as the original DNS
+	if err := cleanupStaleStateLocked([]string{interfaceName}); err != nil {
+		logger.Warn("Failed to clean up stale DNS state: %v", err)
+	}
+
+	options := newOverrideOptions(opts)
+	options.interfaceName = interfaceName
+	conf, err := createConfigurator(interfaceName)
+	if err != nil {
+		return err
+	}
+
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		return err
+	}
+	configurator = conf
+	return nil
+}
+
+// newConfigurator creates the configurator for the DNS manager in use, falling
+// back to writing resolv.conf directly
+func newConfigurator(interfaceName string) (platform.DNSConfigurator, error) {
+	// Windows regenerates resolv.conf under WSL2, so none of the managers below apply
+	if platform.IsWSL2() {
+		conf, err := platform.NewWSLDNSConfigurator()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create WSL DNS configurator: %w", err)
+		}
+		logger.Info("Using WSL DNS configurator, restart WSL for the wsl.conf change to take effect")
+		return conf, nil
+	}
 
 	// Detect which DNS manager is in use by checking /etc/resolv.conf and runtime availability
-	managerType := platform.DetectDNSManager(interfaceName)
-	logger.Info("Detected DNS manager: %s", managerType.String())
+	managerType, confidence := platform.DetectDNSManager(interfaceName)
+	logger.Info("Detected DNS manager: %s (confidence: %s)", managerType.String(), confidence.String())
+
+	// Only trust a manager that was seen running, anything less goes straight to the file
+	if confidence < platform.ConfidenceProcessConfirmed {
+		managerType = platform.FileManager
+	}
 
 	// Create configurator based on detected manager
 	switch managerType {
 	case platform.SystemdResolvedManager:
-		configurator, err = platform.NewSystemdResolvedDNSConfigurator(interfaceName)
+		conf, err := platform.NewSystemdResolvedDNSConfigurator(interfaceName)
 		if err == nil {
 			logger.Info("Using systemd-resolved DNS configurator")
-			return setDNS(proxyIp, configurator)
+			return conf, nil
 		}
 		logger.Warn("Failed to create systemd-resolved configurator: %v, falling back", err)
 
 	case platform.NetworkManagerManager:
-		configurator, err = platform.NewNetworkManagerDNSConfigurator(interfaceName)
+		conf, err := platform.NewNetworkManagerDNSConfigurator(interfaceName)
 		if err == nil {
 			logger.Info("Using NetworkManager DNS configurator")
-			return setDNS(proxyIp, configurator)
+			return conf, nil
 		}
 		logger.Warn("Failed to create NetworkManager configurator: %v, falling back", err)
 
 	case platform.ResolvconfManager:
-		configurator, err = platform.NewResolvconfDNSConfigurator(interfaceName)
+		conf, err := platform.NewResolvconfDNSConfigurator(interfaceName)
 		if err == nil {
 			logger.Info("Using resolvconf DNS configurator")
-			return setDNS(proxyIp, configurator)
+			return conf, nil
 		}
 		logger.Warn("Failed to create resolvconf configurator: %v, falling back", err)
+
+	case platform.UCIManager:
+		conf, err := platform.NewUCIDNSConfigurator(interfaceName)
+		if err == nil {
+			logger.Info("Using uci DNS configurator")
+			return conf, nil
+		}
+		logger.Warn("Failed to create uci configurator: %v, falling back", err)
 	}
 
 	// Fall back to direct file manipulation
-	configurator, err = platform.NewFileDNSConfigurator()
+	conf, err := platform.NewFileDNSConfigurator()
 	if err != nil {
-		return fmt.Errorf("failed to create file DNS configurator: %w", err)
+		return nil, fmt.Errorf("failed to create file DNS configurator: %w", err)
 	}
 
 	logger.Info("Using file-based DNS configurator")
-	return setDNS(proxyIp, configurator)
+	return conf, nil
 }
 
-// setDNS is a helper function to set DNS and log the results
-func setDNS(proxyIp netip.Addr, conf platform.DNSConfigurator) error {
-	// Get current DNS servers before changing
-	currentDNS, err := conf.GetCurrentDNS()
-	if err != nil {
-		logger.Warn("Could not get current DNS: %v", err)
-	} else {
-		logger.Info("Current DNS servers: %v", currentDNS)
-	}
+// RestoreDNSOverride restores the original DNS configuration
+// Any pending auto-restore timer is cancelled
+func RestoreDNSOverride() error {
+	CancelDNSOverrideTimeout()
+
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	return restoreDNSOverrideLocked()
+}
 
-	// Set new DNS servers to point to our proxy
-	newDNS := []netip.Addr{
-		proxyIp,
+// restoreDNSOverrideLocked is RestoreDNSOverride without cancelling the timer
+// The caller must hold overrideMu.
+func restoreDNSOverrideLocked() error {
+	if configurator == nil {
+		return ErrOverrideNotActive
 	}
 
-	logger.Info("Setting DNS servers to: %v", newDNS)
-	originalDNS, err := conf.SetDNS(newDNS)
-	if err != nil {
-		return fmt.Errorf("failed to set DNS: %w", err)
+	if err := restoreDNS(configurator); err != nil {
+		return err
 	}
 
-	logger.Info("Original DNS servers backed up: %v", originalDNS)
+	configurator = nil
 	return nil
 }
 
-// RestoreDNSOverride restores the original DNS configuration
-func RestoreDNSOverride() error {
+// staleCheck detects and cleans up one kind of state a previous session may have left
+type staleCheck struct {
+	manager       string // the StaleEntry manager
+	interfaceName string // empty for system wide state
+	detect        func() []StaleEntry
+	cleanup       func() error
+}
+
+// newStaleChecks returns the checks of CleanupStaleState for the given interface
+// names, replaced in tests
+var newStaleChecks = func(interfaceNames []string) []staleCheck {
+	checks := []staleCheck{
+		{manager: "file", detect: func() []StaleEntry { return platform.DetectStaleFileDNS() }, cleanup: func() error { return platform.CleanupStaleFileDNS() }},
+		{manager: "NetworkManager", detect: platform.DetectStaleNetworkManagerDNS, cleanup: platform.CleanupStaleNetworkManagerDNS},
+		{manager: "wsl", detect: platform.DetectStaleWSLDNS, cleanup: platform.CleanupStaleWSLDNS},
+	}
+
+	for _, interfaceName := range interfaceNames {
+		checks = append(checks,
+			staleCheck{
+				manager:       "resolvconf",
+				interfaceName: interfaceName,
+				detect:        func() []StaleEntry { return platform.DetectStaleResolvconfDNS(interfaceName) },
+				cleanup:       func() error { return platform.CleanupStaleResolvconfDNS(interfaceName) },
+			},
+			staleCheck{
+				manager:       "systemd-resolved",
+				interfaceName: interfaceName,
+				detect:        func() []StaleEntry { return platform.DetectStaleSystemdResolvedDNS(interfaceName) },
+				cleanup:       func() error { return platform.CleanupStaleSystemdResolvedDNS(interfaceName) },
+			},
+		)
+	}
+	return checks
+}
+
+// String names the check in errors
+func (c staleCheck) String() string {
+	if c.interfaceName == "" {
+		return c.manager
+	}
+	return c.manager + " " + c.interfaceName
+}
+
+// ownedByOverrideLocked reports whether the state c looks at belongs to the active
+// override, which looks the same as state left by a previous session
+// The caller must hold overrideMu.
+func (c staleCheck) ownedByOverrideLocked() bool {
 	if configurator == nil {
-		logger.Debug("No DNS configurator to restore")
-		return nil
+		return false
+	}
+	if c.interfaceName != "" && c.interfaceName != overrideAuditLog.interfaceName {
+		return false
+	}
+
+	switch configurator.(type) {
+	case *platform.WSLDNSConfigurator:
+		return c.manager == "file" || c.manager == "wsl"
+	case *platform.FileDNSConfigurator:
+		return c.manager == "file"
+	case *platform.NetworkManagerDNSConfigurator:
+		return c.manager == "NetworkManager"
+	case *platform.ResolvconfDNSConfigurator:
+		return c.manager == "resolvconf"
+	case *platform.SystemdResolvedDNSConfigurator:
+		return c.manager == "systemd-resolved"
+	default:
+		return false
+	}
+}
+
+// staleChecksLocked returns the checks for interfaceNames that do not look at the
+// active override's own state. The caller must hold overrideMu.
+func staleChecksLocked(interfaceNames []string) []staleCheck {
+	return slices.DeleteFunc(newStaleChecks(interfaceNames), staleCheck.ownedByOverrideLocked)
+}
+
+// CleanupStaleState removes DNS configuration left behind by a previous session
+// that did not shut down cleanly. File, NetworkManager and WSL state is checked,
+// plus resolvconf and systemd-resolved state for each of the given interface names.
+// State belonging to an active override is left alone.
+func CleanupStaleState(interfaceNames ...string) error {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	return cleanupStaleStateLocked(interfaceNames)
+}
+
+// cleanupStaleStateLocked is CleanupStaleState, the caller must hold overrideMu
+func cleanupStaleStateLocked(interfaceNames []string) error {
+	checks := staleChecksLocked(interfaceNames)
+
+	// Look up what is stale first so the audit log can say what was removed
+	var stale []StaleEntry
+	if auditLogPath != "" {
+		for _, check := range checks {
+			stale = append(stale, check.detect()...)
+		}
+	}
+
+	var errs []error
+	for _, check := range checks {
+		if err := check.cleanup(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check, err))
+		}
 	}
 
-	logger.Info("Restoring original DNS configuration")
-	if err := configurator.RestoreDNS(); err != nil {
-		return fmt.Errorf("failed to restore DNS: %w", err)
+	var err error
+	if len(errs) > 0 {
+		err = fmt.Errorf("failed to clean up stale DNS state: %w", errors.Join(errs...))
+	}
+	for _, entry := range stale {
+		appendAuditEntry(auditLogPath, AuditEntry{Operation: "cleanup", Manager: entry.Manager, Path: entry.Path, Error: errorString(err)})
+	}
+	if err != nil {
+		return err
 	}
 
-	logger.Info("DNS configuration restored successfully")
+	logger.Debug("Stale DNS state cleanup complete")
 	return nil
 }
+
+// CleanupStaleStateDryRun reports what CleanupStaleState would remove for the
+// given interface names without modifying any files or D-Bus state
+func CleanupStaleStateDryRun(interfaceNames ...string) ([]StaleEntry, error) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	var entries []StaleEntry
+	for _, check := range staleChecksLocked(interfaceNames) {
+		entries = append(entries, check.detect()...)
+	}
+	return entries, nil
+}
+
+// PreviewDNSOverride returns what SetupDNSOverride would write for the detected
+// DNS manager without applying it: the resolv.conf content for the file and
+// resolvconf configurators, or a summary of the config file or D-Bus calls otherwise.
+// opts are the options SetupDNSOverride would be called with.
+func PreviewDNSOverride(interfaceName string, proxyIps []netip.Addr, searchDomains []string, opts ...OverrideOption) (string, error) {
+	var options overrideOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	managerType, confidence := platform.DetectDNSManager(interfaceName)
+	if confidence < platform.ConfidenceProcessConfirmed {
+		managerType = platform.FileManager
+	}
+
+	switch managerType {
+	case platform.SystemdResolvedManager:
+		return platform.PreviewSystemdResolvedDNS(interfaceName, proxyIps, searchDomains, options.mode == OverrideModePrepend)
+	case platform.NetworkManagerManager:
+		return platform.PreviewNetworkManagerDNS(proxyIps, searchDomains)
+	case platform.ResolvconfManager:
+		return platform.PreviewResolvconfDNS(interfaceName, proxyIps, searchDomains)
+	case platform.UCIManager:
+		return platform.PreviewUCIDNS(interfaceName, proxyIps, searchDomains)
+	default:
+		return platform.PreviewFileDNS(proxyIps, searchDomains)
+	}
+}
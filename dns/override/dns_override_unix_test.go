@@ -0,0 +1,311 @@
+//go:build (linux && !android) || freebsd
+
+package olm
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	platform "github.com/fosrl/olm/dns/platform"
+	platformtesting "github.com/fosrl/olm/dns/platform/testing"
+)
+
+func TestOverrideActiveState(t *testing.T) {
+	if err := RestoreDNSOverride(); !errors.Is(err, ErrOverrideNotActive) {
+		t.Fatalf("Expected ErrOverrideNotActive with no override, got %v", err)
+	}
+
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	options := newOverrideOptions([]OverrideOption{WithOverrideVerificationTimeout(0)})
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+	overrideMu.Lock()
+	configurator = conf
+	overrideMu.Unlock()
+	t.Cleanup(func() {
+		overrideMu.Lock()
+		configurator = nil
+		overrideMu.Unlock()
+	})
+
+	// A second override must not run, it would back up the proxy as the original DNS
+	if err := SetupDNSOverride("olm", netip.MustParseAddr("100.96.128.2")); !errors.Is(err, ErrOverrideAlreadyActive) {
+		t.Fatalf("Expected ErrOverrideAlreadyActive, got %v", err)
+	}
+	if calls := conf.SetDNSCalls(); len(calls) != 1 {
+		t.Errorf("Expected the active override to be left alone, got SetDNS calls %v", calls)
+	}
+
+	if err := RestoreDNSOverride(); err != nil {
+		t.Fatalf("RestoreDNSOverride failed: %v", err)
+	}
+	if conf.Overridden() {
+		t.Error("Expected the original DNS to be restored")
+	}
+	if err := RestoreDNSOverride(); !errors.Is(err, ErrOverrideNotActive) {
+		t.Errorf("Expected ErrOverrideNotActive after restoring, got %v", err)
+	}
+}
+
+// useMockConfigurator makes SetupDNSOverride use a mock configurator starting with
+// original and find no stale state, and restores any override left when the test ends
+func useMockConfigurator(t *testing.T, original []netip.Addr) *platformtesting.MockDNSConfigurator {
+	t.Helper()
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	conf.SetCurrentDNS(original)
+	prev, prevChecks := createConfigurator, newStaleChecks
+	createConfigurator = func(string) (platform.DNSConfigurator, error) { return conf, nil }
+	newStaleChecks = func([]string) []staleCheck { return nil }
+	t.Cleanup(func() {
+		CancelDNSOverrideTimeout()
+		RestoreDNSOverride()
+		createConfigurator, newStaleChecks = prev, prevChecks
+	})
+	return conf
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+func TestSetupDNSOverrideWithTimeout(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	proxyIp := netip.MustParseAddr("100.96.128.1")
+	noVerify := WithOverrideVerificationTimeout(0)
+
+	t.Run("timer restores", func(t *testing.T) {
+		conf := useMockConfigurator(t, original)
+		if err := SetupDNSOverrideWithTimeout("olm", proxyIp, 50*time.Millisecond, noVerify); err != nil {
+			t.Fatalf("SetupDNSOverrideWithTimeout failed: %v", err)
+		}
+		if !conf.Overridden() {
+			t.Fatal("Expected DNS to be overridden")
+		}
+
+		if !waitFor(func() bool { return !conf.Overridden() }) {
+			t.Fatal("Expected the timer to restore DNS")
+		}
+		if current, _ := conf.GetCurrentDNS(); !slices.Equal(current, original) {
+			t.Errorf("Expected the original servers %v, got %v", original, current)
+		}
+		if err := RestoreDNSOverride(); !errors.Is(err, ErrOverrideNotActive) {
+			t.Errorf("Expected the override to be inactive after the timer, got %v", err)
+		}
+	})
+
+	t.Run("cancel stops the timer", func(t *testing.T) {
+		conf := useMockConfigurator(t, original)
+		if err := SetupDNSOverrideWithTimeout("olm", proxyIp, 50*time.Millisecond, noVerify); err != nil {
+			t.Fatalf("SetupDNSOverrideWithTimeout failed: %v", err)
+		}
+		CancelDNSOverrideTimeout()
+
+		time.Sleep(150 * time.Millisecond)
+		if !conf.Overridden() {
+			t.Fatal("Expected the override to stay after cancelling the timer")
+		}
+		if err := RestoreDNSOverride(); err != nil {
+			t.Errorf("RestoreDNSOverride failed: %v", err)
+		}
+	})
+
+	t.Run("manual restore before expiry", func(t *testing.T) {
+		conf := useMockConfigurator(t, original)
+		if err := SetupDNSOverrideWithTimeout("olm", proxyIp, 100*time.Millisecond, noVerify); err != nil {
+			t.Fatalf("SetupDNSOverrideWithTimeout failed: %v", err)
+		}
+		if err := RestoreDNSOverride(); err != nil {
+			t.Fatalf("RestoreDNSOverride failed: %v", err)
+		}
+
+		restoreTimerMu.Lock()
+		pending := restoreTimer
+		restoreTimerMu.Unlock()
+		if pending != nil {
+			t.Error("Expected RestoreDNSOverride to cancel the timer")
+		}
+
+		// A later override without a timeout is not undone by the old timer
+		if err := SetupDNSOverride("olm", proxyIp, noVerify); err != nil {
+			t.Fatalf("SetupDNSOverride failed: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if !conf.Overridden() {
+			t.Error("Expected the old timer not to restore the new override")
+		}
+	})
+
+	t.Run("timer firing during a new override", func(t *testing.T) {
+		conf := useMockConfigurator(t, original)
+		if err := SetupDNSOverrideWithTimeout("olm", proxyIp, 50*time.Millisecond, noVerify); err != nil {
+			t.Fatalf("SetupDNSOverrideWithTimeout failed: %v", err)
+		}
+
+		// Hold the timer after it fired until the override has been replaced
+		overrideMu.Lock()
+		fired := waitFor(func() bool {
+			restoreTimerMu.Lock()
+			defer restoreTimerMu.Unlock()
+			return restoreTimer == nil
+		})
+		restoreErr := restoreDNSOverrideLocked()
+		setupErr := setupDNSOverrideLocked("olm", proxyIp, []OverrideOption{noVerify})
+		overrideMu.Unlock()
+		if !fired || restoreErr != nil || setupErr != nil {
+			t.Fatalf("Failed to replace the override: fired=%v, %v, %v", fired, restoreErr, setupErr)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		if !conf.Overridden() {
+			t.Error("Expected the timer of the first override to leave the new one alone")
+		}
+	})
+}
+
+// useStaleChecks replaces the stale state checks with one reporting an entry for each
+// manager, recording the cleanups that run
+func useStaleChecks(t *testing.T) *[]string {
+	t.Helper()
+
+	var cleaned []string
+	prev := newStaleChecks
+	newStaleChecks = func(interfaceNames []string) []staleCheck {
+		check := func(manager, interfaceName string) staleCheck {
+			c := staleCheck{manager: manager, interfaceName: interfaceName}
+			c.detect = func() []StaleEntry { return []StaleEntry{{Manager: manager, Path: c.String()}} }
+			c.cleanup = func() error {
+				cleaned = append(cleaned, c.String())
+				return nil
+			}
+			return c
+		}
+
+		checks := []staleCheck{check("file", ""), check("NetworkManager", "")}
+		for _, interfaceName := range interfaceNames {
+			checks = append(checks, check("systemd-resolved", interfaceName))
+		}
+		return checks
+	}
+	t.Cleanup(func() { newStaleChecks = prev })
+	return &cleaned
+}
+
+func TestCleanupStaleStateSkipsActiveOverride(t *testing.T) {
+	cleaned := useStaleChecks(t)
+
+	dir := t.TempDir()
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	if err := os.WriteFile(resolvConf, []byte("nameserver 192.168.1.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write resolv.conf: %v", err)
+	}
+	conf, err := platform.NewFileDNSConfigurator(platform.WithResolvConfPath(resolvConf), platform.WithBackupPath(filepath.Join(dir, "resolv.conf.olm.bak")))
+	if err != nil {
+		t.Fatalf("NewFileDNSConfigurator failed: %v", err)
+	}
+	prev := createConfigurator
+	createConfigurator = func(string) (platform.DNSConfigurator, error) { return conf, nil }
+	t.Cleanup(func() {
+		RestoreDNSOverride()
+		createConfigurator = prev
+	})
+
+	if err := SetupDNSOverride("olm", netip.MustParseAddr("100.96.128.1")); err != nil {
+		t.Fatalf("SetupDNSOverride failed: %v", err)
+	}
+
+	// The file backup belongs to the live override, the other state is stale
+	entries, err := CleanupStaleStateDryRun("olm")
+	if err != nil {
+		t.Fatalf("CleanupStaleStateDryRun failed: %v", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	if want := []string{"NetworkManager", "systemd-resolved olm"}; !slices.Equal(paths, want) {
+		t.Errorf("Expected stale entries %v, got %v", want, paths)
+	}
+
+	*cleaned = nil
+	if err := CleanupStaleState("olm"); err != nil {
+		t.Fatalf("CleanupStaleState failed: %v", err)
+	}
+	if want := []string{"NetworkManager", "systemd-resolved olm"}; !slices.Equal(*cleaned, want) {
+		t.Errorf("Expected cleanups %v, got %v", want, *cleaned)
+	}
+	if current, _ := conf.GetCurrentDNS(); !slices.Equal(current, []netip.Addr{netip.MustParseAddr("100.96.128.1")}) {
+		t.Errorf("Expected the override to stay in place, got %v", current)
+	}
+
+	// Once restored, nothing is left that an override owns
+	if err := RestoreDNSOverride(); err != nil {
+		t.Fatalf("RestoreDNSOverride failed: %v", err)
+	}
+	if entries, _ := CleanupStaleStateDryRun("olm"); len(entries) != 3 {
+		t.Errorf("Expected every check to run without an override, got %v", entries)
+	}
+}
+
+func TestSetupDNSOverrideCleansUpStaleState(t *testing.T) {
+	// A previous session crashed with resolv.conf pointing at its proxy
+	dir := t.TempDir()
+	fileOpts := []platform.FileOption{
+		platform.WithResolvConfPath(filepath.Join(dir, "resolv.conf")),
+		platform.WithBackupPath(filepath.Join(dir, "resolv.conf.olm.bak")),
+	}
+	original := "nameserver 192.168.1.1\n"
+	if err := os.WriteFile(filepath.Join(dir, "resolv.conf"), []byte("nameserver 100.96.128.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write resolv.conf: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "resolv.conf.olm.bak"), []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+
+	conf := useMockConfigurator(t, nil)
+	newStaleChecks = func([]string) []staleCheck {
+		return []staleCheck{{
+			manager: "file",
+			detect:  func() []StaleEntry { return platform.DetectStaleFileDNS(fileOpts...) },
+			cleanup: func() error { return platform.CleanupStaleFileDNS(fileOpts...) },
+		}}
+	}
+
+	prevCreate := createConfigurator
+	var restored string
+	createConfigurator = func(interfaceName string) (platform.DNSConfigurator, error) {
+		// The override backs up whatever is in place when its configurator is created
+		data, _ := os.ReadFile(filepath.Join(dir, "resolv.conf"))
+		restored = string(data)
+		return prevCreate(interfaceName)
+	}
+
+	if err := SetupDNSOverride("olm", netip.MustParseAddr("100.96.128.2")); err != nil {
+		t.Fatalf("SetupDNSOverride failed: %v", err)
+	}
+	if restored != original {
+		t.Errorf("Expected resolv.conf to be restored before the override, got %q", restored)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "resolv.conf.olm.bak")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the stale backup to be removed, got %v", err)
+	}
+	if !conf.Overridden() {
+		t.Error("Expected the override to be applied after the cleanup")
+	}
+}
@@ -14,50 +14,74 @@ var configurator platform.DNSConfigurator
 
 // SetupDNSOverride configures the system DNS to use the DNS proxy on Windows
 // Uses registry-based configuration (automatically extracts interface GUID)
-func SetupDNSOverride(interfaceName string, proxyIp netip.Addr) error {
-	var err error
-	configurator, err = platform.NewWindowsDNSConfigurator(interfaceName)
-	if err != nil {
-		return fmt.Errorf("failed to create Windows DNS configurator: %w", err)
-	}
+func SetupDNSOverride(interfaceName string, proxyIp netip.Addr, opts ...OverrideOption) error {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
 
-	logger.Info("Using Windows registry DNS configurator for interface: %s", interfaceName)
-
-	// Get current DNS servers before changing
-	currentDNS, err := configurator.GetCurrentDNS()
-	if err != nil {
-		logger.Warn("Could not get current DNS: %v", err)
-	} else {
-		logger.Info("Current DNS servers: %v", currentDNS)
-	}
+	return setupDNSOverrideLocked(interfaceName, proxyIp, opts)
+}
 
-	// Set new DNS servers to point to our proxy
-	newDNS := []netip.Addr{
-		proxyIp,
+// setupDNSOverrideLocked is SetupDNSOverride, the caller must hold overrideMu
+func setupDNSOverrideLocked(interfaceName string, proxyIp netip.Addr, opts []OverrideOption) error {
+	if configurator != nil {
+		return ErrOverrideAlreadyActive
 	}
 
-	logger.Info("Setting DNS servers to: %v", newDNS)
-	originalDNS, err := configurator.SetDNS(newDNS)
+	options := newOverrideOptions(opts)
+	options.interfaceName = interfaceName
+	conf, err := platform.NewWindowsDNSConfigurator(interfaceName)
 	if err != nil {
-		return fmt.Errorf("failed to set DNS: %w", err)
+		return fmt.Errorf("failed to create Windows DNS configurator: %w", err)
 	}
 
-	logger.Info("Original DNS servers backed up: %v", originalDNS)
+	logger.Info("Using Windows registry DNS configurator for interface: %s", interfaceName)
+
+	if err := setDNS(proxyIp, conf, options); err != nil {
+		return err
+	}
+	configurator = conf
 	return nil
 }
 
 // RestoreDNSOverride restores the original DNS configuration
+// Any pending auto-restore timer is cancelled
 func RestoreDNSOverride() error {
+	CancelDNSOverrideTimeout()
+
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	return restoreDNSOverrideLocked()
+}
+
+// restoreDNSOverrideLocked is RestoreDNSOverride without cancelling the timer
+// The caller must hold overrideMu.
+func restoreDNSOverrideLocked() error {
 	if configurator == nil {
-		logger.Debug("No DNS configurator to restore")
-		return nil
+		return ErrOverrideNotActive
 	}
 
-	logger.Info("Restoring original DNS configuration")
-	if err := configurator.RestoreDNS(); err != nil {
-		return fmt.Errorf("failed to restore DNS: %w", err)
+	if err := restoreDNS(configurator); err != nil {
+		return err
 	}
 
-	logger.Info("DNS configuration restored successfully")
+	configurator = nil
 	return nil
 }
+
+// CleanupStaleState is a no-op on Windows since registry DNS settings are tied
+// to the interface GUID, which changes when the interface is recreated
+func CleanupStaleState(interfaceNames ...string) error {
+	return nil
+}
+
+// CleanupStaleStateDryRun always reports nothing on Windows, see CleanupStaleState
+func CleanupStaleStateDryRun(interfaceNames ...string) ([]StaleEntry, error) {
+	return nil, nil
+}
+
+// PreviewDNSOverride returns the registry values SetupDNSOverride would write
+// without applying them
+func PreviewDNSOverride(interfaceName string, proxyIps []netip.Addr, searchDomains []string, opts ...OverrideOption) (string, error) {
+	return platform.PreviewWindowsDNS(interfaceName, proxyIps, searchDomains)
+}
@@ -0,0 +1,65 @@
+package olm
+
+import (
+	"errors"
+)
+
+// PersistenceMode controls whether the DNS override is reapplied after a reboot
+type PersistenceMode int
+
+const (
+	// PersistenceNone leaves the override in place only until restore or reboot
+	PersistenceNone PersistenceMode = iota
+	// PersistenceSystemdUnit installs a systemd unit that runs the persistence
+	// command on boot (Linux)
+	PersistenceSystemdUnit
+	// PersistenceRunOnce registers the persistence command under the RunOnce
+	// registry key, which Windows runs at the next logon (Windows)
+	PersistenceRunOnce
+)
+
+// String returns the persistence mode name
+func (m PersistenceMode) String() string {
+	switch m {
+	case PersistenceNone:
+		return "none"
+	case PersistenceSystemdUnit:
+		return "systemd-unit"
+	case PersistenceRunOnce:
+		return "runonce"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrPersistenceUnsupported is returned by SetupDNSOverride when the persistence
+// mode is not available on this platform
+var ErrPersistenceUnsupported = errors.New("DNS override persistence mode not supported on this platform")
+
+// ErrPersistenceCommandRequired is returned by SetupDNSOverride when WithPersistence
+// is given without WithPersistenceCommand
+var ErrPersistenceCommandRequired = errors.New("DNS override persistence requires a command")
+
+// WithPersistence makes the override survive reboots by running the command set with
+// WithPersistenceCommand on boot, which is required. The persistence entry is written
+// once DNS is set and removed by RestoreDNSOverride.
+//
+// PersistenceSystemdUnit writes /etc/systemd/system/olm-dns.service as a oneshot unit
+// and enables it, which requires root. PersistenceRunOnce writes to HKLM, which
+// requires an elevated (Administrator) process.
+func WithPersistence(mode PersistenceMode) OverrideOption {
+	return func(o *overrideOptions) {
+		o.persistence = mode
+	}
+}
+
+// WithPersistenceCommand sets the command run on boot by WithPersistence. It should
+// reapply the DNS setup and exit, the systemd unit is a oneshot. There is no default:
+// the Olm command line can carry credentials such as --secret, which would end up in
+// the unit file or registry, and a second Olm would clash with one already installed
+// as a service. Pass credentials through a config file or the environment instead.
+func WithPersistenceCommand(args ...string) OverrideOption {
+	return func(o *overrideOptions) {
+		o.persistenceCommand = args
+	}
+}
@@ -0,0 +1,107 @@
+//go:build linux && !android
+
+package olm
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const persistenceUnitName = "olm-dns.service"
+
+var (
+	// persistenceUnitPath is where PersistenceSystemdUnit writes its unit file
+	persistenceUnitPath = "/etc/systemd/system/" + persistenceUnitName
+
+	// systemctl runs systemctl with args, replaced in tests
+	systemctl = func(args ...string) error {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s: %w, output: %s", strings.Join(args, " "), err, out)
+		}
+		return nil
+	}
+)
+
+// persistenceUnit is the systemd unit written by PersistenceSystemdUnit. It runs the
+// persistence command once on boot and stays active so the override shows as applied.
+const persistenceUnit = `# Generated by Olm, removed when the DNS override is restored
+[Unit]
+Description=Olm DNS override
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func persistenceSupported(mode PersistenceMode) bool {
+	return mode == PersistenceNone || mode == PersistenceSystemdUnit
+}
+
+// enablePersistence writes and enables the systemd unit that reapplies the override
+func enablePersistence(mode PersistenceMode, command []string) error {
+	// The command may still hold credentials, so only root can read the unit
+	unit := fmt.Sprintf(persistenceUnit, systemdExecLine(command))
+	if err := writeUnitFile(persistenceUnitPath, []byte(unit)); err != nil {
+		return fmt.Errorf("write %s: %w", persistenceUnitPath, err)
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		os.Remove(persistenceUnitPath)
+		return err
+	}
+	if err := systemctl("enable", persistenceUnitName); err != nil {
+		os.Remove(persistenceUnitPath)
+		return err
+	}
+	return nil
+}
+
+// writeUnitFile writes data to path with mode 0600, also when path already exists
+func writeUnitFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// disablePersistence disables and removes the systemd unit written by enablePersistence
+func disablePersistence(mode PersistenceMode) error {
+	if err := systemctl("disable", persistenceUnitName); err != nil {
+		return err
+	}
+	if err := os.Remove(persistenceUnitPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", persistenceUnitPath, err)
+	}
+	return systemctl("daemon-reload")
+}
+
+// systemdExecLine quotes args for an ExecStart line
+func systemdExecLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		// systemd expands % specifiers and $ variables, double them to keep them literal
+		arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\;") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,108 @@
+//go:build linux && !android
+
+package olm
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	platformtesting "github.com/fosrl/olm/dns/platform/testing"
+)
+
+// fakeSystemctl records systemctl calls instead of running them
+func fakeSystemctl(t *testing.T) *[]string {
+	t.Helper()
+	var calls []string
+	prevPath, prevSystemctl := persistenceUnitPath, systemctl
+	persistenceUnitPath = filepath.Join(t.TempDir(), persistenceUnitName)
+	systemctl = func(args ...string) error {
+		calls = append(calls, strings.Join(args, " "))
+		return nil
+	}
+	t.Cleanup(func() { persistenceUnitPath, systemctl = prevPath, prevSystemctl })
+	return &calls
+}
+
+func TestPersistenceSystemdUnit(t *testing.T) {
+	calls := fakeSystemctl(t)
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	options := newOverrideOptions([]OverrideOption{
+		WithOverrideVerificationTimeout(0),
+		WithPersistence(PersistenceSystemdUnit),
+		WithPersistenceCommand("/usr/local/bin/olm", "--id", "my client"),
+	})
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); err != nil {
+		t.Fatalf("setDNS failed: %v", err)
+	}
+
+	unit, err := os.ReadFile(persistenceUnitPath)
+	if err != nil {
+		t.Fatalf("Expected the unit file to be written: %v", err)
+	}
+	if !strings.Contains(string(unit), "ExecStart=/usr/local/bin/olm --id \"my client\"\n") {
+		t.Errorf("Expected the persistence command in the unit, got:\n%s", unit)
+	}
+	if !strings.Contains(string(unit), "Type=oneshot\n") {
+		t.Errorf("Expected a oneshot unit, got:\n%s", unit)
+	}
+	if info, err := os.Stat(persistenceUnitPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the unit file to be readable only by root, got %v %v", info.Mode(), err)
+	}
+	if !slices.Equal(*calls, []string{"daemon-reload", "enable olm-dns.service"}) {
+		t.Errorf("Expected the unit to be enabled, got systemctl calls %v", *calls)
+	}
+
+	*calls = nil
+	if err := restoreDNS(conf); err != nil {
+		t.Fatalf("restoreDNS failed: %v", err)
+	}
+	if _, err := os.Stat(persistenceUnitPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the unit file to be removed, got %v", err)
+	}
+	if !slices.Equal(*calls, []string{"disable olm-dns.service", "daemon-reload"}) {
+		t.Errorf("Expected the unit to be disabled, got systemctl calls %v", *calls)
+	}
+}
+
+func TestPersistenceUnsupportedMode(t *testing.T) {
+	fakeSystemctl(t)
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	options := newOverrideOptions([]OverrideOption{WithPersistence(PersistenceRunOnce)})
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); !errors.Is(err, ErrPersistenceUnsupported) {
+		t.Fatalf("Expected ErrPersistenceUnsupported, got %v", err)
+	}
+	if len(conf.SetDNSCalls()) != 0 {
+		t.Error("Expected DNS to be left alone when the persistence mode is unsupported")
+	}
+}
+
+func TestPersistenceCommandRequired(t *testing.T) {
+	calls := fakeSystemctl(t)
+
+	conf := platformtesting.NewMockDNSConfigurator()
+	options := newOverrideOptions([]OverrideOption{WithPersistence(PersistenceSystemdUnit)})
+	if err := setDNS(netip.MustParseAddr("100.96.128.1"), conf, options); !errors.Is(err, ErrPersistenceCommandRequired) {
+		t.Fatalf("Expected ErrPersistenceCommandRequired, got %v", err)
+	}
+	if len(conf.SetDNSCalls()) != 0 || len(*calls) != 0 {
+		t.Error("Expected DNS and systemd to be left alone without a persistence command")
+	}
+	if _, err := os.Stat(persistenceUnitPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no unit file, got %v", err)
+	}
+}
+
+func TestSystemdExecLine(t *testing.T) {
+	got := systemdExecLine([]string{"/opt/olm", "--secret", `a"b\c`, "100%", "$HOME"})
+	want := `/opt/olm --secret "a\"b\\c" 100%% $$HOME`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
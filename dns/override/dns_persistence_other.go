@@ -0,0 +1,15 @@
+//go:build !windows && !(linux && !android)
+
+package olm
+
+func persistenceSupported(mode PersistenceMode) bool {
+	return mode == PersistenceNone
+}
+
+func enablePersistence(mode PersistenceMode, command []string) error {
+	return ErrPersistenceUnsupported
+}
+
+func disablePersistence(mode PersistenceMode) error {
+	return nil
+}
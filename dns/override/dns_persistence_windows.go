@@ -0,0 +1,57 @@
+//go:build windows
+
+package olm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	runOnceKeyPath   = `SOFTWARE\Microsoft\Windows\CurrentVersion\RunOnce`
+	runOnceValueName = "OlmDNS"
+)
+
+func persistenceSupported(mode PersistenceMode) bool {
+	return mode == PersistenceNone || mode == PersistenceRunOnce
+}
+
+// enablePersistence registers the command that reapplies the override under RunOnce
+func enablePersistence(mode PersistenceMode, command []string) error {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = windows.EscapeArg(arg)
+	}
+
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, runOnceKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open RunOnce key: %w", err)
+	}
+	defer key.Close()
+
+	if err := key.SetStringValue(runOnceValueName, strings.Join(quoted, " ")); err != nil {
+		return fmt.Errorf("set RunOnce value: %w", err)
+	}
+	return nil
+}
+
+// disablePersistence removes the RunOnce value written by enablePersistence
+func disablePersistence(mode PersistenceMode) error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, runOnceKeyPath, registry.SET_VALUE)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("open RunOnce key: %w", err)
+	}
+	defer key.Close()
+
+	if err := key.DeleteValue(runOnceValueName); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("delete RunOnce value: %w", err)
+	}
+	return nil
+}
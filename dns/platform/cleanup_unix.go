@@ -0,0 +1,177 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	resolvectlCommand         = "resolvectl"
+	resolvconfInterfaceDir    = "/run/resolvconf/interface"
+	networkManagerDNSConfPath = networkManagerConfDir + "/" + networkManagerDNSConfFile
+)
+
+// CleanupStaleSystemdResolvedDNS reverts per-link DNS settings left on an interface
+// by a previous session. It is a no-op if the interface no longer exists, since
+// systemd-resolved drops per-link state together with the link.
+func CleanupStaleSystemdResolvedDNS(interfaceName string) error {
+	if _, err := net.InterfaceByName(interfaceName); err != nil {
+		// Interface is gone, so there is nothing registered to revert
+		return nil
+	}
+
+	if _, err := exec.LookPath(resolvectlCommand); err != nil {
+		// resolvectl not installed means systemd-resolved is not in use
+		return nil
+	}
+
+	if out, err := exec.Command(resolvectlCommand, "revert", interfaceName).CombinedOutput(); err != nil {
+		return fmt.Errorf("resolvectl revert %s: %w, output: %s", interfaceName, err, out)
+	}
+
+	return nil
+}
+
+// CleanupStaleNetworkManagerDNS removes the global DNS config file written by a
+// previous session and reloads NetworkManager if it was present
+func CleanupStaleNetworkManagerDNS() error {
+	n := &NetworkManagerDNSConfigurator{
+		confPath: networkManagerDNSConfPath,
+	}
+	return n.CleanupUncleanShutdown()
+}
+
+// CleanupStaleResolvconfDNS removes any resolvconf entry registered for the interface
+func CleanupStaleResolvconfDNS(interfaceName string) error {
+	if !IsResolvconfAvailable() {
+		return nil
+	}
+
+	implType, err := detectResolvconfType()
+	if err != nil {
+		return err
+	}
+
+	r := &ResolvconfDNSConfigurator{
+		ifaceName: interfaceName,
+		implType:  implType,
+	}
+	return r.CleanupUncleanShutdown()
+}
+
+// CleanupStaleFileDNS restores resolv.conf from a backup left by a previous session
+// Pass the same WithBackupPath and WithResolvConfPath options the session used.
+// With the default backup path, a backup at the path used by older versions is restored too.
+func CleanupStaleFileDNS(opts ...FileOption) error {
+	f := newFileDNSConfigurator(opts)
+	if err := f.CleanupUncleanShutdown(); err != nil {
+		return err
+	}
+	if f.backupPath != resolvConfBackupPath {
+		return nil
+	}
+
+	f.backupPath = legacyResolvConfBackupPath
+	return f.CleanupUncleanShutdown()
+}
+
+// DetectStaleFileDNS reports a resolv.conf backup left by a previous session
+func DetectStaleFileDNS(opts ...FileOption) []StaleEntry {
+	f := newFileDNSConfigurator(opts)
+	entries := detectStaleFileDNS(f.backupPath)
+	if f.backupPath == resolvConfBackupPath {
+		entries = append(entries, detectStaleFileDNS(legacyResolvConfBackupPath)...)
+	}
+	return entries
+}
+
+func detectStaleFileDNS(backupPath string) []StaleEntry {
+	f := newFileDNSConfigurator([]FileOption{WithBackupPath(backupPath)})
+	if !f.isBackupExists() {
+		return nil
+	}
+
+	return []StaleEntry{{
+		Manager:     "file",
+		Description: "resolv.conf backup from a previous session would be restored",
+		Path:        backupPath,
+	}}
+}
+
+// DetectStaleNetworkManagerDNS reports a global DNS config file left by a previous session
+func DetectStaleNetworkManagerDNS() []StaleEntry {
+	return detectStaleNetworkManagerDNS(networkManagerDNSConfPath)
+}
+
+func detectStaleNetworkManagerDNS(confPath string) []StaleEntry {
+	if _, err := os.Stat(confPath); err != nil {
+		return nil
+	}
+
+	return []StaleEntry{{
+		Manager:     "NetworkManager",
+		Description: "global DNS config file would be removed and NetworkManager reloaded",
+		Path:        confPath,
+	}}
+}
+
+// DetectStaleResolvconfDNS reports a resolvconf entry registered for the interface
+func DetectStaleResolvconfDNS(interfaceName string) []StaleEntry {
+	// Debian resolvconf keeps one file per interface
+	path := filepath.Join(resolvconfInterfaceDir, interfaceName)
+	if _, err := os.Stat(path); err == nil {
+		return []StaleEntry{{
+			Manager:     "resolvconf",
+			Description: fmt.Sprintf("resolvconf entry for %s would be deleted", interfaceName),
+			Path:        path,
+		}}
+	}
+
+	// openresolv can list the entry for a single interface
+	if !IsResolvconfAvailable() {
+		return nil
+	}
+	out, err := exec.Command(resolvconfCommand, "-l", interfaceName).Output()
+	if err != nil || len(parseResolvconfOutput(string(out))) == 0 {
+		return nil
+	}
+
+	return []StaleEntry{{
+		Manager:     "resolvconf",
+		Description: fmt.Sprintf("resolvconf entry for %s would be deleted", interfaceName),
+		Path:        interfaceName,
+	}}
+}
+
+// DetectStaleSystemdResolvedDNS reports per-link DNS servers still set on the interface
+func DetectStaleSystemdResolvedDNS(interfaceName string) []StaleEntry {
+	if _, err := net.InterfaceByName(interfaceName); err != nil {
+		return nil
+	}
+
+	if _, err := exec.LookPath(resolvectlCommand); err != nil {
+		return nil
+	}
+
+	// Output looks like "Link 5 (olm): 100.96.128.1"
+	out, err := exec.Command(resolvectlCommand, "dns", interfaceName).Output()
+	if err != nil {
+		return nil
+	}
+	_, servers, found := strings.Cut(string(out), ":")
+	if !found || strings.TrimSpace(servers) == "" {
+		return nil
+	}
+
+	return []StaleEntry{{
+		Manager:     "systemd-resolved",
+		Description: fmt.Sprintf("per-link DNS (%s) on %s would be reverted", strings.TrimSpace(servers), interfaceName),
+		Path:        interfaceName,
+	}}
+}
@@ -0,0 +1,66 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectStaleStateDryRun(t *testing.T) {
+	dir := t.TempDir()
+	backupPath := filepath.Join(dir, "resolv.conf.olm.bak")
+	confPath := filepath.Join(dir, "olm-dns.conf")
+	wslBackupPath := filepath.Join(dir, filepath.Base(wslConfBackupPath))
+
+	// Nothing stale yet
+	if entries := detectStaleFileDNS(backupPath); len(entries) != 0 {
+		t.Errorf("Expected no stale file entries, got %v", entries)
+	}
+	if entries := detectStaleNetworkManagerDNS(confPath); len(entries) != 0 {
+		t.Errorf("Expected no stale NetworkManager entries, got %v", entries)
+	}
+	if entries := detectStaleWSLDNS(wslBackupPath); len(entries) != 0 {
+		t.Errorf("Expected no stale WSL entries, got %v", entries)
+	}
+
+	// Create synthetic stale state from a crashed session
+	for _, path := range []string{backupPath, confPath, wslBackupPath} {
+		if err := os.WriteFile(path, []byte("nameserver 192.168.1.1\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	entries := detectStaleFileDNS(backupPath)
+	if len(entries) != 1 || entries[0].Manager != "file" || entries[0].Path != backupPath {
+		t.Errorf("Expected stale file entry for %s, got %v", backupPath, entries)
+	}
+
+	entries = detectStaleNetworkManagerDNS(confPath)
+	if len(entries) != 1 || entries[0].Manager != "NetworkManager" || entries[0].Path != confPath {
+		t.Errorf("Expected stale NetworkManager entry for %s, got %v", confPath, entries)
+	}
+
+	// The WSL backup uses the same .olm.bak suffix as the resolv.conf backup
+	entries = detectStaleWSLDNS(wslBackupPath)
+	if len(entries) != 1 || entries[0].Manager != "wsl" || entries[0].Path != filepath.Join(dir, "wsl.conf.olm.bak") {
+		t.Errorf("Expected stale WSL entry for %s, got %v", wslBackupPath, entries)
+	}
+
+	// Dry run must not touch the files
+	for _, path := range []string{backupPath, confPath, wslBackupPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to still exist after dry run: %v", path, err)
+		}
+	}
+}
+
+func TestDetectStaleSystemdResolvedMissingInterface(t *testing.T) {
+	if entries := DetectStaleSystemdResolvedDNS("olm-does-not-exist"); len(entries) != 0 {
+		t.Errorf("Expected no entries for missing interface, got %v", entries)
+	}
+	if err := CleanupStaleSystemdResolvedDNS("olm-does-not-exist"); err != nil {
+		t.Errorf("Expected nil error for missing interface, got %v", err)
+	}
+}
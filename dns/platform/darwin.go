@@ -30,6 +30,7 @@ const (
 	keySupplementalMatchDomainsNoSearch = "SupplementalMatchDomainsNoSearch"
 	keyServerAddresses                  = "ServerAddresses"
 	keyServerPort                       = "ServerPort"
+	keySearchDomains                    = "SearchDomains"
 	arraySymbol                         = "* "
 	digitSymbol                         = "# "
 
@@ -47,6 +48,7 @@ type DarwinDNSConfigurator struct {
 	createdKeys   map[string]struct{}
 	originalState *DNSState
 	stateFilePath string
+	searchDomains []string
 }
 
 // NewDarwinDNSConfigurator creates a new macOS DNS configurator
@@ -104,7 +106,14 @@ func (d *DarwinDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, erro
 	return originalServers, nil
 }
 
+// SetSearchDomains sets the search domains added to the override key by SetDNS
+func (d *DarwinDNSConfigurator) SetSearchDomains(domains []string) error {
+	d.searchDomains = domains
+	return nil
+}
+
 // RestoreDNS restores the original DNS configuration
+// Removing our keys also removes the search domains we added
 func (d *DarwinDNSConfigurator) RestoreDNS() error {
 	// Remove all created keys
 	for key := range d.createdKeys {
@@ -145,6 +154,37 @@ func (d *DarwinDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
 	return servers, nil
 }
 
+// ValidateConfig checks that scutil exists and the process runs as root
+func (d *DarwinDNSConfigurator) ValidateConfig() error {
+	if _, err := os.Stat(scutilPath); err != nil {
+		return fmt.Errorf("%w: %w", ErrDNSManagerNotReachable, err)
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("%w: scutil must be run as root to change DNS settings", ErrInsufficientPrivileges)
+	}
+
+	return nil
+}
+
+// GetSearchDomains returns the search domains of the primary network service
+func (d *DarwinDNSConfigurator) GetSearchDomains() ([]string, error) {
+	primaryServiceKey, err := d.getPrimaryServiceKey()
+	if err != nil || primaryServiceKey == "" {
+		return nil, fmt.Errorf("get primary service: %w", err)
+	}
+
+	dnsKey := fmt.Sprintf(primaryServiceFormat, primaryServiceKey)
+	cmd := fmt.Sprintf("show %s\n", dnsKey)
+
+	output, err := d.runScutil(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("run scutil: %w", err)
+	}
+
+	return parseScutilArray(output, keySearchDomains), nil
+}
+
 // CleanupUncleanShutdown removes any DNS keys left over from a previous crash
 func (d *DarwinDNSConfigurator) CleanupUncleanShutdown() error {
 	state, err := d.loadState()
@@ -214,20 +254,42 @@ func (d *DarwinDNSConfigurator) addDNSState(state, domains string, dnsServer net
 	}
 
 	// Build the scutil command following NetBird's approach
+	commands := d.buildDNSStateCommands(state, domains, dnsServer, port, noSearch)
+
+	if _, err := d.runScutil(commands); err != nil {
+		return fmt.Errorf("applying state for domains %s, error: %w", domains, err)
+	}
+
+	logger.Info("Added DNS override with server %s:%d for domains: %s", dnsServer.String(), port, domains)
+	return nil
+}
+
+// buildDNSStateCommands builds the scutil commands that set a DNS state entry
+func (d *DarwinDNSConfigurator) buildDNSStateCommands(state, domains string, dnsServer netip.Addr, port int, noSearch string) string {
 	var commands strings.Builder
 	commands.WriteString("d.init\n")
 	commands.WriteString(fmt.Sprintf("d.add %s %s%s\n", keySupplementalMatchDomains, arraySymbol, domains))
 	commands.WriteString(fmt.Sprintf("d.add %s %s%s\n", keySupplementalMatchDomainsNoSearch, digitSymbol, noSearch))
 	commands.WriteString(fmt.Sprintf("d.add %s %s%s\n", keyServerAddresses, arraySymbol, dnsServer.String()))
 	commands.WriteString(fmt.Sprintf("d.add %s %s%s\n", keyServerPort, digitSymbol, strconv.Itoa(port)))
+	if len(d.searchDomains) > 0 {
+		commands.WriteString(fmt.Sprintf("d.add %s %s%s\n", keySearchDomains, arraySymbol, strings.Join(d.searchDomains, " ")))
+	}
 	commands.WriteString(fmt.Sprintf("set %s\n", state))
 
-	if _, err := d.runScutil(commands.String()); err != nil {
-		return fmt.Errorf("applying state for domains %s, error: %w", domains, err)
+	return commands.String()
+}
+
+// PreviewDarwinDNS returns the scutil commands SetDNS would run, without running them
+func PreviewDarwinDNS(servers []netip.Addr, searchDomains []string) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
 	}
 
-	logger.Info("Added DNS override with server %s:%d for domains: %s", dnsServer.String(), port, domains)
-	return nil
+	d := &DarwinDNSConfigurator{searchDomains: searchDomains}
+	key := fmt.Sprintf(dnsStateKeyFormat, "Override")
+
+	return "# scutil <<EOF\n" + d.buildDNSStateCommands(key, "\"\"", servers[0], 53, "0") + "EOF\n", nil
 }
 
 // removeKey removes a DNS configuration key and updates internal state
@@ -312,6 +374,36 @@ func (d *DarwinDNSConfigurator) parseServerAddresses(output []byte) []netip.Addr
 	return servers
 }
 
+// parseScutilArray returns the values of the array named key in scutil output
+func parseScutilArray(output []byte, key string) []string {
+	var values []string
+	inArray := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, key+" : <array> {") {
+			inArray = true
+			continue
+		}
+
+		if line == "}" {
+			inArray = false
+			continue
+		}
+
+		if inArray {
+			// Line format: "0 : corp.internal"
+			if _, value, ok := strings.Cut(line, " : "); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values
+}
+
 // flushDNSCache flushes the system DNS cache
 func (d *DarwinDNSConfigurator) flushDNSCache() error {
 	logger.Debug("Flushing dscacheutil cache")
@@ -417,3 +509,29 @@ func (d *DarwinDNSConfigurator) clearState() error {
 	logger.Debug("Cleared DNS state file")
 	return nil
 }
+
+// DetectStaleDarwinDNS reports scutil keys left by a previous session without removing them
+func DetectStaleDarwinDNS() ([]StaleEntry, error) {
+	d := &DarwinDNSConfigurator{
+		stateFilePath: getDNSStateFilePath(),
+	}
+
+	state, err := d.loadState()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
+	var entries []StaleEntry
+	for _, key := range state.CreatedKeys {
+		entries = append(entries, StaleEntry{
+			Manager:     "scutil",
+			Description: "DNS key from a previous session would be removed",
+			Path:        key,
+		})
+	}
+
+	return entries, nil
+}
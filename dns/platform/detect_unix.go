@@ -27,12 +27,65 @@ const (
 	ResolvconfManager
 	// FileManager indicates direct file management (no DNS manager)
 	FileManager
+	// UCIManager indicates OpenWRT style uci configuration feeding dnsmasq
+	UCIManager
 )
 
+// DetectionConfidence is how certain DetectDNSManager is of the manager it returns
+type DetectionConfidence int
+
+const (
+	// ConfidenceGuessed means nothing pointed at the manager, it is the default choice
+	ConfidenceGuessed DetectionConfidence = iota
+	// ConfidenceFileEvidence means /etc/resolv.conf points at the manager
+	ConfidenceFileEvidence
+	// ConfidenceProcessConfirmed means the manager's tooling is installed and runs
+	ConfidenceProcessConfirmed
+	// ConfidenceRuntimeVerified means the manager answered over D-Bus
+	ConfidenceRuntimeVerified
+)
+
+// String returns a human-readable name for the detection confidence
+func (c DetectionConfidence) String() string {
+	switch c {
+	case ConfidenceFileEvidence:
+		return "file-evidence"
+	case ConfidenceProcessConfirmed:
+		return "process-confirmed"
+	case ConfidenceRuntimeVerified:
+		return "runtime-verified"
+	default:
+		return "guessed"
+	}
+}
+
+// dnsManagerProbes check whether each DNS manager is running, replaced in tests
+type dnsManagerProbes struct {
+	systemdResolved          func() bool
+	networkManager           func() bool
+	networkManagerDNSSupport func() bool
+	resolvconf               func() bool
+	uci                      func() bool
+}
+
+// systemProbes checks the DNS managers of the running system
+var systemProbes = dnsManagerProbes{
+	systemdResolved:          IsSystemdResolvedAvailable,
+	networkManager:           IsNetworkManagerAvailable,
+	networkManagerDNSSupport: IsNetworkManagerDNSModeSupported,
+	resolvconf:               IsResolvconfAvailable,
+	uci:                      IsUCIAvailable,
+}
+
 // DetectDNSManagerFromFile reads /etc/resolv.conf to determine which DNS manager is in use
 // This provides a hint based on comments in the file, similar to Netbird's approach
 func DetectDNSManagerFromFile() DNSManagerType {
-	file, err := os.Open(defaultResolvConfPath)
+	return detectDNSManagerFromFile(defaultResolvConfPath)
+}
+
+// detectDNSManagerFromFile reads the resolv.conf at path for a DNS manager hint
+func detectDNSManagerFromFile(path string) DNSManagerType {
+	file, err := os.Open(path)
 	if err != nil {
 		return UnknownManager
 	}
@@ -83,76 +136,79 @@ func (d DNSManagerType) String() string {
 		return "resolvconf"
 	case FileManager:
 		return "file"
+	case UCIManager:
+		return "uci"
 	default:
 		return "unknown"
 	}
 }
 
 // DetectDNSManager combines file detection with runtime availability checks
-// to determine the best DNS configurator to use
-func DetectDNSManager(interfaceName string) DNSManagerType {
+// to determine the best DNS configurator to use, and how certain that choice is
+func DetectDNSManager(interfaceName string) (DNSManagerType, DetectionConfidence) {
+	return detectDNSManager(interfaceName, defaultResolvConfPath, systemProbes)
+}
+
+// detectDNSManager detects the DNS manager from the resolv.conf at path and the given probes
+func detectDNSManager(interfaceName, path string, probes dnsManagerProbes) (DNSManagerType, DetectionConfidence) {
+	// OpenWRT points resolv.conf at dnsmasq, whose upstream servers come from uci
+	if probes.uci() {
+		return UCIManager, ConfidenceProcessConfirmed
+	}
+
 	// First check what the file suggests
-	fileHint := DetectDNSManagerFromFile()
+	fileHint := detectDNSManagerFromFile(path)
 
 	// Verify the hint with runtime checks
 	switch fileHint {
 	case SystemdResolvedManager:
 		// Verify systemd-resolved is actually running
-		if IsSystemdResolvedAvailable() {
-			return SystemdResolvedManager
+		if probes.systemdResolved() {
+			return SystemdResolvedManager, ConfidenceRuntimeVerified
 		}
 		logger.Warn("dns platform: Found systemd-resolved but it is not running. Falling back to file...")
-		os.Exit(0)
-		return FileManager
+		return FileManager, ConfidenceFileEvidence
 
 	case NetworkManagerManager:
 		// Verify NetworkManager is actually running
-		if IsNetworkManagerAvailable() {
+		if probes.networkManager() {
 			// Check if NetworkManager is delegating to systemd-resolved
-			if !IsNetworkManagerDNSModeSupported() {
+			if !probes.networkManagerDNSSupport() {
 				logger.Info("NetworkManager is delegating DNS to systemd-resolved, using systemd-resolved configurator")
-				if IsSystemdResolvedAvailable() {
-					return SystemdResolvedManager
+				if probes.systemdResolved() {
+					return SystemdResolvedManager, ConfidenceRuntimeVerified
 				}
 			}
-			return NetworkManagerManager
+			return NetworkManagerManager, ConfidenceRuntimeVerified
 		}
 		logger.Warn("dns platform: Found network manager but it is not running. Falling back to file...")
-		return FileManager
+		return FileManager, ConfidenceFileEvidence
 
 	case ResolvconfManager:
 		// Verify resolvconf is available
-		if IsResolvconfAvailable() {
-			return ResolvconfManager
+		if probes.resolvconf() {
+			return ResolvconfManager, ConfidenceProcessConfirmed
 		}
 		// If resolvconf is mentioned but not available, fall back to file
-		return FileManager
+		return FileManager, ConfidenceFileEvidence
+	}
 
-	case FileManager:
-		// File suggests direct file management
-		// But we should still check if a manager is available that wasn't mentioned
-		if IsSystemdResolvedAvailable() && interfaceName != "" {
-			return SystemdResolvedManager
+	// The file names no manager, so check if one is available that wasn't mentioned
+	if interfaceName != "" {
+		if probes.systemdResolved() {
+			return SystemdResolvedManager, ConfidenceRuntimeVerified
 		}
-		if IsNetworkManagerAvailable() && interfaceName != "" {
-			return NetworkManagerManager
+		if probes.networkManager() {
+			return NetworkManagerManager, ConfidenceRuntimeVerified
 		}
-		if IsResolvconfAvailable() && interfaceName != "" {
-			return ResolvconfManager
+		if probes.resolvconf() {
+			return ResolvconfManager, ConfidenceProcessConfirmed
 		}
-		return FileManager
+	}
 
-	default:
-		// Unknown - do runtime detection
-		if IsSystemdResolvedAvailable() && interfaceName != "" {
-			return SystemdResolvedManager
-		}
-		if IsNetworkManagerAvailable() && interfaceName != "" {
-			return NetworkManagerManager
-		}
-		if IsResolvconfAvailable() && interfaceName != "" {
-			return ResolvconfManager
-		}
-		return FileManager
+	// A plain resolv.conf is evidence of direct file management, a missing one is not
+	if fileHint == FileManager {
+		return FileManager, ConfidenceFileEvidence
 	}
+	return FileManager, ConfidenceGuessed
 }
@@ -0,0 +1,116 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeProbes reports the given managers as running
+func fakeProbes(systemdResolved, networkManager, networkManagerDNSSupport, resolvconf bool) dnsManagerProbes {
+	return dnsManagerProbes{
+		systemdResolved:          func() bool { return systemdResolved },
+		networkManager:           func() bool { return networkManager },
+		networkManagerDNSSupport: func() bool { return networkManagerDNSSupport },
+		resolvconf:               func() bool { return resolvconf },
+		uci:                      func() bool { return false },
+	}
+}
+
+func TestDetectDNSManagerConfidence(t *testing.T) {
+	tests := []struct {
+		name           string
+		resolvConf     string // empty for a missing resolv.conf
+		interfaceName  string
+		probes         dnsManagerProbes
+		wantManager    DNSManagerType
+		wantConfidence DetectionConfidence
+	}{
+		{
+			name:           "systemd-resolved verified over D-Bus",
+			resolvConf:     "# This is /run/systemd/resolve/stub-resolv.conf managed by man:systemd-resolved(8).\nnameserver 127.0.0.53\n",
+			probes:         fakeProbes(true, false, false, false),
+			wantManager:    SystemdResolvedManager,
+			wantConfidence: ConfidenceRuntimeVerified,
+		},
+		{
+			name:           "systemd-resolved named but not running",
+			resolvConf:     "# managed by man:systemd-resolved(8)\nnameserver 127.0.0.53\n",
+			probes:         fakeProbes(false, false, false, false),
+			wantManager:    FileManager,
+			wantConfidence: ConfidenceFileEvidence,
+		},
+		{
+			name:           "NetworkManager delegating to systemd-resolved",
+			resolvConf:     "# Generated by NetworkManager\nnameserver 192.168.1.1\n",
+			probes:         fakeProbes(true, true, false, false),
+			wantManager:    SystemdResolvedManager,
+			wantConfidence: ConfidenceRuntimeVerified,
+		},
+		{
+			name:           "NetworkManager verified over D-Bus",
+			resolvConf:     "# Generated by NetworkManager\nnameserver 192.168.1.1\n",
+			probes:         fakeProbes(false, true, true, false),
+			wantManager:    NetworkManagerManager,
+			wantConfidence: ConfidenceRuntimeVerified,
+		},
+		{
+			name:           "resolvconf command runs",
+			resolvConf:     "# Dynamic resolv.conf(5) file generated by resolvconf(8)\nnameserver 192.168.1.1\n",
+			probes:         fakeProbes(false, false, false, true),
+			wantManager:    ResolvconfManager,
+			wantConfidence: ConfidenceProcessConfirmed,
+		},
+		{
+			name:           "plain resolv.conf",
+			resolvConf:     "nameserver 192.168.1.1\n",
+			interfaceName:  "olm",
+			probes:         fakeProbes(false, false, false, false),
+			wantManager:    FileManager,
+			wantConfidence: ConfidenceFileEvidence,
+		},
+		{
+			name:           "plain resolv.conf with systemd-resolved running",
+			resolvConf:     "nameserver 192.168.1.1\n",
+			interfaceName:  "olm",
+			probes:         fakeProbes(true, false, false, false),
+			wantManager:    SystemdResolvedManager,
+			wantConfidence: ConfidenceRuntimeVerified,
+		},
+		{
+			name:       "uci installed",
+			resolvConf: "search lan\nnameserver 127.0.0.1\n",
+			probes: func() dnsManagerProbes {
+				probes := fakeProbes(false, false, false, false)
+				probes.uci = func() bool { return true }
+				return probes
+			}(),
+			wantManager:    UCIManager,
+			wantConfidence: ConfidenceProcessConfirmed,
+		},
+		{
+			name:           "missing resolv.conf",
+			probes:         fakeProbes(false, false, false, false),
+			wantManager:    FileManager,
+			wantConfidence: ConfidenceGuessed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "resolv.conf")
+			if tt.resolvConf != "" {
+				if err := os.WriteFile(path, []byte(tt.resolvConf), 0644); err != nil {
+					t.Fatalf("Failed to write resolv.conf: %v", err)
+				}
+			}
+
+			manager, confidence := detectDNSManager(tt.interfaceName, path, tt.probes)
+			if manager != tt.wantManager || confidence != tt.wantConfidence {
+				t.Errorf("Expected %s (%s), got %s (%s)", tt.wantManager, tt.wantConfidence, manager, confidence)
+			}
+		})
+	}
+}
@@ -3,26 +3,103 @@
 package dns
 
 import (
+	"errors"
 	"fmt"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
+
+	"github.com/fosrl/newt/logger"
 )
 
 const (
 	resolvConfPath       = "/etc/resolv.conf"
-	resolvConfBackupPath = "/etc/resolv.conf.olm.backup"
-	resolvConfHeader     = "# Generated by Olm DNS Manager\n# Original file backed up to " + resolvConfBackupPath + "\n\n"
+	resolvConfBackupPath = "/etc/resolv.conf.olm.bak"
+	// legacyResolvConfBackupPath is where older versions backed up resolv.conf
+	legacyResolvConfBackupPath = "/etc/resolv.conf.olm.backup"
+	resolvConfHeader           = "# Generated by Olm DNS Manager\n# Original file backed up to %s\n\n"
 )
 
+// ErrFileImmutable is returned when resolv.conf cannot be written because the
+// immutable attribute is set on it
+var ErrFileImmutable = errors.New("resolv.conf is immutable")
+
+// SymlinkMode controls how the file configurator writes a symlinked resolv.conf
+type SymlinkMode int
+
+const (
+	// FollowSymlink writes the new configuration to the symlink target
+	FollowSymlink SymlinkMode = iota
+	// ReplaceSymlink replaces the symlink with a plain file and recreates
+	// the symlink on restore
+	ReplaceSymlink
+)
+
+// String returns the symlink mode name
+func (m SymlinkMode) String() string {
+	switch m {
+	case FollowSymlink:
+		return "follow"
+	case ReplaceSymlink:
+		return "replace"
+	default:
+		return "unknown"
+	}
+}
+
 // FileDNSConfigurator manages DNS settings by directly modifying /etc/resolv.conf
 type FileDNSConfigurator struct {
-	originalState *DNSState
+	originalState  *DNSState
+	searchDomains  []string
+	resolvConfPath string
+	backupPath     string
+	symlinkMode    SymlinkMode
+}
+
+// FileOption configures a FileDNSConfigurator
+type FileOption func(*FileDNSConfigurator)
+
+// WithSymlinkHandling sets how a symlinked resolv.conf is written, e.g. when
+// it points at systemd-resolved's stub-resolv.conf. The default is FollowSymlink.
+func WithSymlinkHandling(mode SymlinkMode) FileOption {
+	return func(f *FileDNSConfigurator) {
+		f.symlinkMode = mode
+	}
+}
+
+// WithBackupPath sets where the original resolv.conf is backed up while DNS is
+// overridden. The default is /etc/resolv.conf.olm.bak.
+func WithBackupPath(path string) FileOption {
+	return func(f *FileDNSConfigurator) {
+		f.backupPath = path
+	}
+}
+
+// WithResolvConfPath sets the resolv.conf to manage, for systems where it is not
+// at /etc/resolv.conf, e.g. inside an overlay filesystem
+func WithResolvConfPath(path string) FileOption {
+	return func(f *FileDNSConfigurator) {
+		f.resolvConfPath = path
+	}
+}
+
+// newFileDNSConfigurator applies opts over the default paths without touching the filesystem
+func newFileDNSConfigurator(opts []FileOption) *FileDNSConfigurator {
+	f := &FileDNSConfigurator{
+		resolvConfPath: resolvConfPath,
+		backupPath:     resolvConfBackupPath,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 // NewFileDNSConfigurator creates a new file-based DNS configurator
-func NewFileDNSConfigurator() (*FileDNSConfigurator, error) {
-	f := &FileDNSConfigurator{}
+func NewFileDNSConfigurator(opts ...FileOption) (*FileDNSConfigurator, error) {
+	f := newFileDNSConfigurator(opts)
 	if err := f.CleanupUncleanShutdown(); err != nil {
 		return nil, fmt.Errorf("cleanup unclean shutdown: %w", err)
 	}
@@ -37,10 +114,11 @@ func (f *FileDNSConfigurator) Name() string {
 // SetDNS sets the DNS servers and returns the original servers
 func (f *FileDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error) {
 	// Get current DNS settings before overriding
-	originalServers, err := f.GetCurrentDNS()
+	content, err := os.ReadFile(f.resolvConfPath)
 	if err != nil {
-		return nil, fmt.Errorf("get current DNS: %w", err)
+		return nil, fmt.Errorf("get current DNS: read resolv.conf: %w", err)
 	}
+	originalServers := f.parseNameservers(string(content))
 
 	// Backup original resolv.conf if not already backed up
 	if !f.isBackupExists() {
@@ -51,37 +129,58 @@ func (f *FileDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error)
 
 	// Store original state
 	f.originalState = &DNSState{
-		OriginalServers:  originalServers,
-		ConfiguratorName: f.Name(),
+		OriginalServers:       originalServers,
+		OriginalSearchDomains: parseSearchDomains(string(content)),
+		ConfiguratorName:      f.Name(),
 	}
 
 	// Write new resolv.conf
 	if err := f.writeResolvConf(servers); err != nil {
+		if immutable, _ := isFileImmutable(f.resolvConfPath); immutable {
+			return nil, fmt.Errorf("%w: run 'chattr -i %s' to allow Olm to manage DNS (%w)", ErrFileImmutable, f.resolvConfPath, err)
+		}
 		return nil, fmt.Errorf("write resolv.conf: %w", err)
 	}
 
 	return originalServers, nil
 }
 
+// SetSearchDomains sets the search domains written to resolv.conf by SetDNS
+func (f *FileDNSConfigurator) SetSearchDomains(domains []string) error {
+	f.searchDomains = domains
+	return nil
+}
+
 // RestoreDNS restores the original DNS configuration
+// The backup holds the complete original file, so search domains are restored too
 func (f *FileDNSConfigurator) RestoreDNS() error {
 	if !f.isBackupExists() {
 		return fmt.Errorf("no backup file exists")
 	}
 
-	// Copy backup back to original location
-	if err := copyFile(resolvConfBackupPath, resolvConfPath); err != nil {
+	if err := f.restoreFromBackup(); err != nil {
 		return fmt.Errorf("restore from backup: %w", err)
 	}
 
 	// Remove backup file
-	if err := os.Remove(resolvConfBackupPath); err != nil {
+	if err := os.Remove(f.backupPath); err != nil {
 		return fmt.Errorf("remove backup file: %w", err)
 	}
 
 	return nil
 }
 
+// DiscardBackup removes the backup of the original resolv.conf and keeps the current
+// one, see BackupDiscarder
+func (f *FileDNSConfigurator) DiscardBackup() error {
+	for _, path := range []string{f.backupPath, f.symlinkTargetPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
 // CleanupUncleanShutdown removes any DNS configuration left over from a previous crash
 // For the file-based configurator, we check if a backup file exists (indicating a crash
 // happened while DNS was configured) and restore from it if so.
@@ -94,21 +193,53 @@ func (f *FileDNSConfigurator) CleanupUncleanShutdown() error {
 
 	// A backup exists, which means we crashed while DNS was configured
 	// Restore the original resolv.conf
-	if err := copyFile(resolvConfBackupPath, resolvConfPath); err != nil {
+	if err := f.restoreFromBackup(); err != nil {
 		return fmt.Errorf("restore from backup during cleanup: %w", err)
 	}
 
 	// Remove backup file
-	if err := os.Remove(resolvConfBackupPath); err != nil {
+	if err := os.Remove(f.backupPath); err != nil {
 		return fmt.Errorf("remove backup file during cleanup: %w", err)
 	}
 
 	return nil
 }
 
+// restoreFromBackup puts back the original resolv.conf, recreating the symlink if
+// ReplaceSymlink broke it and copying the backup over it otherwise
+func (f *FileDNSConfigurator) restoreFromBackup() error {
+	content, err := os.ReadFile(f.symlinkTargetPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return copyFile(f.backupPath, f.resolvConfPath)
+	}
+	if err != nil {
+		return fmt.Errorf("read resolv.conf symlink target: %w", err)
+	}
+
+	linkTarget := string(content)
+	if err := os.Remove(f.resolvConfPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove resolv.conf: %w", err)
+	}
+	if err := os.Symlink(linkTarget, f.resolvConfPath); err != nil {
+		return fmt.Errorf("recreate resolv.conf symlink: %w", err)
+	}
+	logger.Info("Restored %s as a symlink to %s", f.resolvConfPath, linkTarget)
+
+	if err := os.Remove(f.symlinkTargetPath()); err != nil {
+		return fmt.Errorf("remove resolv.conf symlink target: %w", err)
+	}
+	return nil
+}
+
+// symlinkTargetPath is where ReplaceSymlink saves the original link target, next to
+// the backup so it survives a crash
+func (f *FileDNSConfigurator) symlinkTargetPath() string {
+	return filepath.Join(filepath.Dir(f.backupPath), filepath.Base(f.resolvConfPath)+".olm.symlink")
+}
+
 // GetCurrentDNS returns the currently configured DNS servers
 func (f *FileDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
-	content, err := os.ReadFile(resolvConfPath)
+	content, err := os.ReadFile(f.resolvConfPath)
 	if err != nil {
 		return nil, fmt.Errorf("read resolv.conf: %w", err)
 	}
@@ -116,20 +247,46 @@ func (f *FileDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
 	return f.parseNameservers(string(content)), nil
 }
 
+// ValidateConfig checks that resolv.conf can be written and backed up
+// With ReplaceSymlink a symlinked resolv.conf is replaced, so only its directory must be writable.
+func (f *FileDNSConfigurator) ValidateConfig() error {
+	linfo, err := os.Lstat(f.resolvConfPath)
+	if err != nil {
+		return fmt.Errorf("stat resolv.conf: %w", err)
+	}
+	if linfo.Mode()&os.ModeSymlink == 0 || f.symlinkMode != ReplaceSymlink {
+		if err := checkFileWritable(f.resolvConfPath); err != nil {
+			return err
+		}
+	}
+
+	return checkDirWritable(filepath.Dir(f.backupPath))
+}
+
+// GetSearchDomains returns the search domains in resolv.conf
+func (f *FileDNSConfigurator) GetSearchDomains() ([]string, error) {
+	content, err := os.ReadFile(f.resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("read resolv.conf: %w", err)
+	}
+
+	return parseSearchDomains(string(content)), nil
+}
+
 // backupResolvConf creates a backup of the current resolv.conf
 func (f *FileDNSConfigurator) backupResolvConf() error {
 	// Get file info for permissions
-	info, err := os.Stat(resolvConfPath)
+	info, err := os.Stat(f.resolvConfPath)
 	if err != nil {
 		return fmt.Errorf("stat resolv.conf: %w", err)
 	}
 
-	if err := copyFile(resolvConfPath, resolvConfBackupPath); err != nil {
+	if err := copyFile(f.resolvConfPath, f.backupPath); err != nil {
 		return fmt.Errorf("copy file: %w", err)
 	}
 
 	// Preserve permissions
-	if err := os.Chmod(resolvConfBackupPath, info.Mode()); err != nil {
+	if err := os.Chmod(f.backupPath, info.Mode()); err != nil {
 		return fmt.Errorf("chmod backup: %w", err)
 	}
 
@@ -142,14 +299,76 @@ func (f *FileDNSConfigurator) writeResolvConf(servers []netip.Addr) error {
 		return fmt.Errorf("no DNS servers provided")
 	}
 
-	// Get file info for permissions
-	info, err := os.Stat(resolvConfPath)
+	// Get file info for permissions, following any symlink
+	info, err := os.Stat(f.resolvConfPath)
 	if err != nil {
 		return fmt.Errorf("stat resolv.conf: %w", err)
 	}
 
+	path, err := f.prepareWritePath()
+	if err != nil {
+		return err
+	}
+
+	// Replace the file whole so a crash cannot leave it half written
+	if err := writeFileAtomic(path, []byte(f.renderResolvConf(servers)), info.Mode()); err != nil {
+		return fmt.Errorf("write resolv.conf: %w", err)
+	}
+
+	return nil
+}
+
+// prepareWritePath returns the path writeResolvConf should write to. If
+// resolv.conf is a symlink it is either resolved to its target or removed,
+// depending on the configured SymlinkMode.
+func (f *FileDNSConfigurator) prepareWritePath() (string, error) {
+	linfo, err := os.Lstat(f.resolvConfPath)
+	if err != nil {
+		return "", fmt.Errorf("lstat resolv.conf: %w", err)
+	}
+	if linfo.Mode()&os.ModeSymlink == 0 {
+		return f.resolvConfPath, nil
+	}
+
+	linkTarget, err := os.Readlink(f.resolvConfPath)
+	if err != nil {
+		return "", fmt.Errorf("read resolv.conf symlink: %w", err)
+	}
+
+	switch f.symlinkMode {
+	case ReplaceSymlink:
+		logger.Info("%s is a symlink to %s, replacing it with a plain file (restored on exit)", f.resolvConfPath, linkTarget)
+		// Save the target before breaking the link so it can be recreated after a crash
+		if err := writeFileAtomic(f.symlinkTargetPath(), []byte(linkTarget), 0644); err != nil {
+			return "", fmt.Errorf("save resolv.conf symlink target: %w", err)
+		}
+		if err := os.Remove(f.resolvConfPath); err != nil {
+			os.Remove(f.symlinkTargetPath())
+			return "", fmt.Errorf("remove resolv.conf symlink: %w", err)
+		}
+		return f.resolvConfPath, nil
+
+	default:
+		target, err := filepath.EvalSymlinks(f.resolvConfPath)
+		if err != nil {
+			return "", fmt.Errorf("resolve resolv.conf symlink: %w", err)
+		}
+		logger.Info("%s is a symlink, writing DNS configuration to its target %s", f.resolvConfPath, target)
+		return target, nil
+	}
+}
+
+// renderResolvConf builds the resolv.conf content for the specified DNS servers
+func (f *FileDNSConfigurator) renderResolvConf(servers []netip.Addr) string {
 	var content strings.Builder
-	content.WriteString(resolvConfHeader)
+	content.WriteString(fmt.Sprintf(resolvConfHeader, f.backupPath))
+
+	// Write search domains
+	if len(f.searchDomains) > 0 {
+		content.WriteString("search ")
+		content.WriteString(strings.Join(f.searchDomains, " "))
+		content.WriteString("\n")
+	}
 
 	// Write nameservers
 	for _, server := range servers {
@@ -158,17 +377,24 @@ func (f *FileDNSConfigurator) writeResolvConf(servers []netip.Addr) error {
 		content.WriteString("\n")
 	}
 
-	// Write the file
-	if err := os.WriteFile(resolvConfPath, []byte(content.String()), info.Mode()); err != nil {
-		return fmt.Errorf("write resolv.conf: %w", err)
+	return content.String()
+}
+
+// PreviewFileDNS returns the resolv.conf content SetDNS would write, without writing it
+func PreviewFileDNS(servers []netip.Addr, searchDomains []string) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
 	}
 
-	return nil
+	f := newFileDNSConfigurator(nil)
+	f.searchDomains = searchDomains
+
+	return fmt.Sprintf("# %s\n%s", f.resolvConfPath, f.renderResolvConf(servers)), nil
 }
 
 // isBackupExists checks if a backup file exists
 func (f *FileDNSConfigurator) isBackupExists() bool {
-	_, err := os.Stat(resolvConfBackupPath)
+	_, err := os.Stat(f.backupPath)
 	return err == nil
 }
 
@@ -199,6 +425,34 @@ func (f *FileDNSConfigurator) parseNameservers(content string) []netip.Addr {
 	return servers
 }
 
+// parseSearchDomains extracts search domains from resolv.conf content
+// The last search or domain directive wins, matching the resolver's behaviour
+func parseSearchDomains(content string) []string {
+	var domains []string
+
+	lines := strings.Split(content, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		// Skip comments and empty lines
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "search", "domain":
+			domains = fields[1:]
+		}
+	}
+
+	return domains
+}
+
 // copyFile copies a file from src to dst
 func copyFile(src, dst string) error {
 	content, err := os.ReadFile(src)
@@ -212,9 +466,82 @@ func copyFile(src, dst string) error {
 		return fmt.Errorf("stat source: %w", err)
 	}
 
-	if err := os.WriteFile(dst, content, info.Mode()); err != nil {
+	if err := writeFileAtomic(dst, content, info.Mode()); err != nil {
 		return fmt.Errorf("write destination: %w", err)
 	}
 
 	return nil
 }
+
+// writeFileAtomic replaces path with data by writing a temporary file in the same
+// directory and renaming it over path, so readers see the old or the new content and
+// never a partial write. When the rename cannot replace path, as for a resolv.conf
+// bind mounted into a container, or no temporary file can be created next to it, path
+// is truncated and written in place and synced instead. A symlink at path is followed,
+// as os.WriteFile would, rather than replaced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".olm-*")
+	if err != nil {
+		logger.Debug("Cannot create a temporary file next to %s, writing in place: %v", path, err)
+		return writeFileInPlace(path, data, perm)
+	}
+	tmpPath := tmp.Name()
+
+	if err := writeTempFile(tmp, data, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		if errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EBUSY) {
+			logger.Debug("Cannot rename over %s, writing in place: %v", path, err)
+			return writeFileInPlace(path, data, perm)
+		}
+		return fmt.Errorf("rename temporary file: %w", err)
+	}
+
+	return nil
+}
+
+// writeTempFile writes data to tmp with mode perm, syncs and closes it
+func writeTempFile(tmp *os.File, data []byte, perm os.FileMode) error {
+	// CreateTemp makes the file 0600
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod temporary file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+	return nil
+}
+
+// writeFileInPlace truncates path, writes data to it and syncs it
+func writeFileInPlace(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,437 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestFileDNSConfigurator creates a file configurator operating on a temporary resolv.conf
+func newTestFileDNSConfigurator(t *testing.T, content string) *FileDNSConfigurator {
+	t.Helper()
+
+	dir := t.TempDir()
+	f := &FileDNSConfigurator{
+		resolvConfPath: filepath.Join(dir, "resolv.conf"),
+		backupPath:     filepath.Join(dir, "resolv.conf.olm.bak"),
+	}
+
+	if err := os.WriteFile(f.resolvConfPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write resolv.conf: %v", err)
+	}
+
+	return f
+}
+
+func TestFileDNSConfiguratorGetSearchDomains(t *testing.T) {
+	f := newTestFileDNSConfigurator(t, "search corp.example\nnameserver 192.168.1.1\n")
+	f.SetSearchDomains([]string{"tunnel.internal", "lab.internal"})
+
+	check := func(want ...string) {
+		t.Helper()
+		got, err := f.GetSearchDomains()
+		if err != nil {
+			t.Fatalf("GetSearchDomains failed: %v", err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Expected search domains %v, got %v", want, got)
+		}
+	}
+
+	check("corp.example")
+	if _, err := f.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+	check("tunnel.internal", "lab.internal")
+	if err := f.RestoreDNS(); err != nil {
+		t.Fatalf("RestoreDNS failed: %v", err)
+	}
+	check("corp.example")
+}
+
+func TestFileDNSConfiguratorSearchDomains(t *testing.T) {
+	original := "search corp.example lab.example\nnameserver 192.168.1.1\n"
+	f := newTestFileDNSConfigurator(t, original)
+
+	if err := f.SetSearchDomains([]string{"tunnel.internal"}); err != nil {
+		t.Fatalf("SetSearchDomains failed: %v", err)
+	}
+
+	if _, err := f.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+
+	// The saved state and backup should hold the pre-override search domains
+	got := f.originalState.OriginalSearchDomains
+	if len(got) != 2 || got[0] != "corp.example" || got[1] != "lab.example" {
+		t.Errorf("Expected original search domains [corp.example lab.example], got %v", got)
+	}
+
+	backup, err := os.ReadFile(f.backupPath)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	if string(backup) != original {
+		t.Errorf("Expected backup to match original, got %q", backup)
+	}
+
+	// The new file should use the tunnel search domain
+	current, err := os.ReadFile(f.resolvConfPath)
+	if err != nil {
+		t.Fatalf("Failed to read resolv.conf: %v", err)
+	}
+	if !strings.Contains(string(current), "search tunnel.internal\n") {
+		t.Errorf("Expected resolv.conf to contain tunnel search domain, got %q", current)
+	}
+	if !strings.Contains(string(current), "nameserver 100.96.128.1\n") {
+		t.Errorf("Expected resolv.conf to contain proxy nameserver, got %q", current)
+	}
+
+	// Restoring should bring back the original search domains
+	if err := f.RestoreDNS(); err != nil {
+		t.Fatalf("RestoreDNS failed: %v", err)
+	}
+
+	restored, err := os.ReadFile(f.resolvConfPath)
+	if err != nil {
+		t.Fatalf("Failed to read resolv.conf: %v", err)
+	}
+	if string(restored) != original {
+		t.Errorf("Expected restored resolv.conf to match original, got %q", restored)
+	}
+	if domains := parseSearchDomains(string(restored)); len(domains) != 2 || domains[0] != "corp.example" {
+		t.Errorf("Expected restored search domains [corp.example lab.example], got %v", domains)
+	}
+}
+
+func TestParseSearchDomains(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "search directive",
+			content:  "search a.example b.example\nnameserver 1.1.1.1\n",
+			expected: []string{"a.example", "b.example"},
+		},
+		{
+			name:     "domain directive",
+			content:  "domain a.example\nnameserver 1.1.1.1\n",
+			expected: []string{"a.example"},
+		},
+		{
+			name:     "last directive wins",
+			content:  "domain a.example\nsearch b.example\n",
+			expected: []string{"b.example"},
+		},
+		{
+			name:     "comments ignored",
+			content:  "# search a.example\n; search b.example\nnameserver 1.1.1.1\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSearchDomains(tt.content)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewFileDNS(t *testing.T) {
+	preview, err := PreviewFileDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}, []string{"tunnel.internal"})
+	if err != nil {
+		t.Fatalf("PreviewFileDNS failed: %v", err)
+	}
+
+	if !strings.Contains(preview, "search tunnel.internal\n") {
+		t.Errorf("Expected preview to contain search domain, got %q", preview)
+	}
+	if !strings.Contains(preview, "nameserver 100.96.128.1\n") {
+		t.Errorf("Expected preview to contain proxy nameserver, got %q", preview)
+	}
+
+	if _, err := PreviewFileDNS(nil, nil); err == nil {
+		t.Error("Expected error for empty server list")
+	}
+}
+
+func TestFileDNSConfiguratorSymlink(t *testing.T) {
+	original := "nameserver 127.0.0.53\n"
+	servers := []netip.Addr{netip.MustParseAddr("100.96.128.1")}
+
+	tests := []struct {
+		name string
+		mode SymlinkMode
+	}{
+		{name: "follow", mode: FollowSymlink},
+		{name: "replace", mode: ReplaceSymlink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "stub-resolv.conf")
+			if err := os.WriteFile(target, []byte(original), 0644); err != nil {
+				t.Fatalf("Failed to write target: %v", err)
+			}
+
+			f := &FileDNSConfigurator{
+				resolvConfPath: filepath.Join(dir, "resolv.conf"),
+				backupPath:     filepath.Join(dir, "resolv.conf.olm.bak"),
+			}
+			WithSymlinkHandling(tt.mode)(f)
+			if err := os.Symlink(target, f.resolvConfPath); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+
+			if _, err := f.SetDNS(servers); err != nil {
+				t.Fatalf("SetDNS failed: %v", err)
+			}
+
+			info, err := os.Lstat(f.resolvConfPath)
+			if err != nil {
+				t.Fatalf("Failed to lstat resolv.conf: %v", err)
+			}
+			isLink := info.Mode()&os.ModeSymlink != 0
+			targetContent, _ := os.ReadFile(target)
+
+			switch tt.mode {
+			case FollowSymlink:
+				if !isLink {
+					t.Errorf("Expected resolv.conf to remain a symlink")
+				}
+				if !strings.Contains(string(targetContent), "nameserver 100.96.128.1\n") {
+					t.Errorf("Expected target to contain proxy nameserver, got %q", targetContent)
+				}
+			case ReplaceSymlink:
+				if isLink {
+					t.Errorf("Expected resolv.conf to be replaced with a plain file")
+				}
+				if string(targetContent) != original {
+					t.Errorf("Expected target to be untouched, got %q", targetContent)
+				}
+			}
+
+			if err := f.RestoreDNS(); err != nil {
+				t.Fatalf("RestoreDNS failed: %v", err)
+			}
+
+			if info, err := os.Lstat(f.resolvConfPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("Expected resolv.conf to be a symlink after restore")
+			}
+			if content, _ := os.ReadFile(f.resolvConfPath); string(content) != original {
+				t.Errorf("Expected restored content %q, got %q", original, content)
+			}
+		})
+	}
+}
+
+func TestFileDNSConfiguratorCleanupRecreatesSymlink(t *testing.T) {
+	original := "nameserver 127.0.0.53\n"
+	dir := t.TempDir()
+	target := filepath.Join(dir, "stub-resolv.conf")
+	if err := os.WriteFile(target, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+
+	opts := []FileOption{
+		WithResolvConfPath(filepath.Join(dir, "resolv.conf")),
+		WithBackupPath(filepath.Join(dir, "resolv.conf.olm.bak")),
+		WithSymlinkHandling(ReplaceSymlink),
+	}
+	f := newFileDNSConfigurator(opts)
+	if err := os.Symlink(target, f.resolvConfPath); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := f.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+
+	// A new configurator after a crash has only what was written to disk
+	if _, err := NewFileDNSConfigurator(opts...); err != nil {
+		t.Fatalf("NewFileDNSConfigurator failed: %v", err)
+	}
+
+	if link, err := os.Readlink(f.resolvConfPath); err != nil || link != target {
+		t.Errorf("Expected resolv.conf to be a symlink to %s again, got %q %v", target, link, err)
+	}
+	for _, path := range []string{f.backupPath, f.symlinkTargetPath()} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s to be removed, got %v", path, err)
+		}
+	}
+}
+
+func TestFileDNSConfiguratorDiscardBackup(t *testing.T) {
+	f := newTestFileDNSConfigurator(t, "nameserver 192.168.1.1\n")
+	servers := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	if _, err := f.SetDNS(servers); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+
+	if err := f.DiscardBackup(); err != nil {
+		t.Fatalf("DiscardBackup failed: %v", err)
+	}
+	if _, err := os.Stat(f.backupPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the backup to be removed, got %v", err)
+	}
+	if current, _ := f.GetCurrentDNS(); !slices.Equal(current, servers) {
+		t.Errorf("Expected the servers %v to be kept, got %v", servers, current)
+	}
+
+	// Nothing is left to restore
+	if err := f.CleanupUncleanShutdown(); err != nil {
+		t.Fatalf("CleanupUncleanShutdown failed: %v", err)
+	}
+	if current, _ := f.GetCurrentDNS(); !slices.Equal(current, servers) {
+		t.Errorf("Expected the servers %v after cleanup, got %v", servers, current)
+	}
+}
+
+func TestIsFileImmutable(t *testing.T) {
+	f := newTestFileDNSConfigurator(t, "nameserver 192.168.1.1\n")
+
+	immutable, err := isFileImmutable(f.resolvConfPath)
+	if err != nil {
+		t.Fatalf("isFileImmutable failed: %v", err)
+	}
+	if immutable {
+		t.Errorf("Expected a freshly written file not to be immutable")
+	}
+
+	if _, err := isFileImmutable(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestFileDNSConfiguratorValidateConfig(t *testing.T) {
+	f := newTestFileDNSConfigurator(t, "nameserver 192.168.1.1\n")
+	if err := f.ValidateConfig(); err != nil {
+		t.Fatalf("Expected a writable resolv.conf to validate, got %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("File permissions do not apply to root")
+	}
+	if err := os.Chmod(f.resolvConfPath, 0444); err != nil {
+		t.Fatalf("Failed to chmod resolv.conf: %v", err)
+	}
+	if err := f.ValidateConfig(); !errors.Is(err, ErrInsufficientPrivileges) {
+		t.Errorf("Expected ErrInsufficientPrivileges for a read-only resolv.conf, got %v", err)
+	}
+}
+
+func TestFileDNSConfiguratorCustomPaths(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "overlay", "resolv.conf")
+	backupPath := filepath.Join(dir, "resolv.conf.custom.bak")
+	original := "nameserver 192.168.1.1\n"
+	if err := os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		t.Fatalf("Failed to create overlay dir: %v", err)
+	}
+	if err := os.WriteFile(confPath, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write resolv.conf: %v", err)
+	}
+
+	opts := []FileOption{WithResolvConfPath(confPath), WithBackupPath(backupPath)}
+	f, err := NewFileDNSConfigurator(opts...)
+	if err != nil {
+		t.Fatalf("NewFileDNSConfigurator failed: %v", err)
+	}
+	if _, err := f.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+	if backup, err := os.ReadFile(backupPath); err != nil || string(backup) != original {
+		t.Fatalf("Expected the backup at %s to hold the original, got %q (%v)", backupPath, backup, err)
+	}
+
+	// Simulate a crash: the cleanup must find the same backup and restore from it
+	if entries := DetectStaleFileDNS(opts...); len(entries) != 1 || entries[0].Path != backupPath {
+		t.Errorf("Expected a stale entry for %s, got %v", backupPath, entries)
+	}
+	if err := CleanupStaleFileDNS(opts...); err != nil {
+		t.Fatalf("CleanupStaleFileDNS failed: %v", err)
+	}
+	if restored, _ := os.ReadFile(confPath); string(restored) != original {
+		t.Errorf("Expected resolv.conf to be restored, got %q", restored)
+	}
+	if _, err := os.Stat(backupPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the backup to be removed, got %v", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	f := newTestFileDNSConfigurator(t, "nameserver 192.168.1.1\n")
+	if err := os.Chmod(f.resolvConfPath, 0640); err != nil {
+		t.Fatalf("Failed to chmod resolv.conf: %v", err)
+	}
+	before, err := os.Stat(f.resolvConfPath)
+	if err != nil {
+		t.Fatalf("Failed to stat resolv.conf: %v", err)
+	}
+
+	if _, err := f.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+
+	after, err := os.Stat(f.resolvConfPath)
+	if err != nil {
+		t.Fatalf("Failed to stat resolv.conf: %v", err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("Expected resolv.conf to be replaced by a new file")
+	}
+	if after.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640 to be kept, got %v", after.Mode().Perm())
+	}
+	if servers, err := f.GetCurrentDNS(); err != nil || !slices.Equal(servers, []netip.Addr{netip.MustParseAddr("100.96.128.1")}) {
+		t.Errorf("GetCurrentDNS() = %v, %v", servers, err)
+	}
+
+	// No temporary files are left next to resolv.conf
+	entries, err := os.ReadDir(filepath.Dir(f.resolvConfPath))
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".olm-") {
+			t.Errorf("Unexpected temporary file %s", entry.Name())
+		}
+	}
+}
+
+func TestWriteFileInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(path, []byte("nameserver 192.168.1.1\nnameserver 192.168.1.2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write resolv.conf: %v", err)
+	}
+	before, _ := os.Stat(path)
+
+	if err := writeFileInPlace(path, []byte("nameserver 100.96.128.1\n"), 0644); err != nil {
+		t.Fatalf("writeFileInPlace failed: %v", err)
+	}
+
+	after, _ := os.Stat(path)
+	if !os.SameFile(before, after) {
+		t.Error("Expected the file to be written in place")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "nameserver 100.96.128.1\n" {
+		t.Errorf("Expected the old content to be truncated, got %q", content)
+	}
+}
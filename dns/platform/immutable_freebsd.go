@@ -0,0 +1,9 @@
+//go:build freebsd
+
+package dns
+
+// isFileImmutable always reports false on FreeBSD, where immutability is
+// managed through chflags rather than the Linux inode flags ioctl
+func isFileImmutable(path string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,34 @@
+//go:build linux && !android
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsImmutableFl is FS_IMMUTABLE_FL from linux/fs.h, set by chattr +i
+const fsImmutableFl = 0x00000010
+
+// isFileImmutable reports whether the immutable attribute is set on path.
+// Filesystems that do not support inode flags report false.
+func isFileImmutable(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	flags, err := unix.IoctlGetUint32(int(file.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		if errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.EOPNOTSUPP) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get inode flags of %s: %w", path, err)
+	}
+
+	return flags&fsImmutableFl != 0, nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -35,6 +36,7 @@ const (
 type NetworkManagerDNSConfigurator struct {
 	ifaceName     string
 	originalState *DNSState
+	searchDomains []string
 	confPath      string
 	dispatchPath  string
 }
@@ -80,8 +82,9 @@ func (n *NetworkManagerDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Ad
 
 	// Store original state
 	n.originalState = &DNSState{
-		OriginalServers:  originalServers,
-		ConfiguratorName: n.Name(),
+		OriginalServers:       originalServers,
+		OriginalSearchDomains: readResolvConfSearchDomains(),
+		ConfiguratorName:      n.Name(),
 	}
 
 	// Apply new DNS servers
@@ -92,7 +95,14 @@ func (n *NetworkManagerDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Ad
 	return originalServers, nil
 }
 
+// SetSearchDomains sets the global search domains written by SetDNS
+func (n *NetworkManagerDNSConfigurator) SetSearchDomains(domains []string) error {
+	n.searchDomains = domains
+	return nil
+}
+
 // RestoreDNS restores the original DNS configuration
+// Removing our global DNS config also drops the search domains we set
 func (n *NetworkManagerDNSConfigurator) RestoreDNS() error {
 	// Remove our configuration file
 	if err := os.Remove(n.confPath); err != nil && !os.IsNotExist(err) {
@@ -155,12 +165,48 @@ func (n *NetworkManagerDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
 	return servers, nil
 }
 
+// ValidateConfig checks that NetworkManager is running and its conf.d directory is writable
+func (n *NetworkManagerDNSConfigurator) ValidateConfig() error {
+	if !IsNetworkManagerAvailable() {
+		return fmt.Errorf("%w: NetworkManager is not running", ErrDNSManagerNotReachable)
+	}
+
+	return checkDirWritable(filepath.Dir(n.confPath))
+}
+
+// GetSearchDomains returns the search domains by reading /etc/resolv.conf
+func (n *NetworkManagerDNSConfigurator) GetSearchDomains() ([]string, error) {
+	content, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("read resolv.conf: %w", err)
+	}
+
+	return parseSearchDomains(string(content)), nil
+}
+
 // applyDNSServers applies DNS server configuration via NetworkManager config file
 func (n *NetworkManagerDNSConfigurator) applyDNSServers(servers []netip.Addr) error {
 	if len(servers) == 0 {
 		return fmt.Errorf("no DNS servers provided")
 	}
 
+	// Write the configuration file
+	if err := os.WriteFile(n.confPath, []byte(n.renderConfig(servers)), 0644); err != nil {
+		return fmt.Errorf("write DNS config file: %w", err)
+	}
+
+	// Reload NetworkManager to apply the new configuration
+	if err := n.reloadNetworkManager(); err != nil {
+		// Try to clean up
+		os.Remove(n.confPath)
+		return fmt.Errorf("reload NetworkManager: %w", err)
+	}
+
+	return nil
+}
+
+// renderConfig builds the NetworkManager configuration file that sets global DNS
+func (n *NetworkManagerDNSConfigurator) renderConfig(servers []netip.Addr) string {
 	// Build DNS server list
 	var dnsServers []string
 	for _, server := range servers {
@@ -176,19 +222,29 @@ func (n *NetworkManagerDNSConfigurator) applyDNSServers(servers []netip.Addr) er
 servers=%s
 `, strings.Join(dnsServers, ","))
 
-	// Write the configuration file
-	if err := os.WriteFile(n.confPath, []byte(configContent), 0644); err != nil {
-		return fmt.Errorf("write DNS config file: %w", err)
+	// Search domains live in the [global-dns] section
+	if len(n.searchDomains) > 0 {
+		configContent += fmt.Sprintf(`
+[global-dns]
+searches=%s
+`, strings.Join(n.searchDomains, ","))
 	}
 
-	// Reload NetworkManager to apply the new configuration
-	if err := n.reloadNetworkManager(); err != nil {
-		// Try to clean up
-		os.Remove(n.confPath)
-		return fmt.Errorf("reload NetworkManager: %w", err)
+	return configContent
+}
+
+// PreviewNetworkManagerDNS returns the config file SetDNS would write, without writing it
+func PreviewNetworkManagerDNS(servers []netip.Addr, searchDomains []string) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
 	}
 
-	return nil
+	n := &NetworkManagerDNSConfigurator{
+		confPath:      networkManagerConfDir + "/" + networkManagerDNSConfFile,
+		searchDomains: searchDomains,
+	}
+
+	return fmt.Sprintf("# %s\n%s# then reload NetworkManager via D-Bus %s.Reload\n", n.confPath, n.renderConfig(servers), networkManagerDest), nil
 }
 
 // reloadNetworkManager tells NetworkManager to reload its configuration
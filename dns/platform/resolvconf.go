@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"fmt"
 	"net/netip"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -17,6 +18,8 @@ type ResolvconfDNSConfigurator struct {
 	ifaceName     string
 	implType      string
 	originalState *DNSState
+	searchDomains []string
+	prepend       bool
 }
 
 // NewResolvconfDNSConfigurator creates a new resolvconf DNS configurator
@@ -60,8 +63,9 @@ func (r *ResolvconfDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr,
 
 	// Store original state
 	r.originalState = &DNSState{
-		OriginalServers:  originalServers,
-		ConfiguratorName: r.Name(),
+		OriginalServers:       originalServers,
+		OriginalSearchDomains: readResolvConfSearchDomains(),
+		ConfiguratorName:      r.Name(),
 	}
 
 	// Apply new DNS servers
@@ -72,7 +76,20 @@ func (r *ResolvconfDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr,
 	return originalServers, nil
 }
 
+// SetSearchDomains sets the search domains registered for the interface by SetDNS
+func (r *ResolvconfDNSConfigurator) SetSearchDomains(domains []string) error {
+	r.searchDomains = domains
+	return nil
+}
+
+// SetPrepend registers the interface non-exclusively in SetDNS, so resolvconf
+// merges our servers with those of the other interfaces
+func (r *ResolvconfDNSConfigurator) SetPrepend(prepend bool) {
+	r.prepend = prepend
+}
+
 // RestoreDNS restores the original DNS configuration
+// Deleting our interface entry also removes the search domains we registered
 func (r *ResolvconfDNSConfigurator) RestoreDNS() error {
 	var cmd *exec.Cmd
 
@@ -127,38 +144,94 @@ func (r *ResolvconfDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
 	return parseResolvconfOutput(string(content)), nil
 }
 
+// ValidateConfig checks that the resolvconf command exists and the process runs as root
+func (r *ResolvconfDNSConfigurator) ValidateConfig() error {
+	if _, err := exec.LookPath(resolvconfCommand); err != nil {
+		return fmt.Errorf("%w: %w", ErrDNSManagerNotReachable, err)
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("%w: resolvconf must be run as root", ErrInsufficientPrivileges)
+	}
+
+	return nil
+}
+
+// GetSearchDomains returns the search domains in the merged /etc/resolv.conf
+func (r *ResolvconfDNSConfigurator) GetSearchDomains() ([]string, error) {
+	content, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("read resolv.conf: %w", err)
+	}
+
+	return parseSearchDomains(string(content)), nil
+}
+
 // applyDNSServers applies DNS server configuration via resolvconf
 func (r *ResolvconfDNSConfigurator) applyDNSServers(servers []netip.Addr) error {
 	if len(servers) == 0 {
 		return fmt.Errorf("no DNS servers provided")
 	}
 
-	// Build resolv.conf content
-	var content bytes.Buffer
+	// Apply via resolvconf
+	cmd := exec.Command(resolvconfCommand, r.applyArgs()...)
+	cmd.Stdin = bytes.NewBufferString(r.renderConfig(servers))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("apply resolvconf config: %w, output: %s", err, out)
+	}
+
+	return nil
+}
+
+// renderConfig builds the resolv.conf content passed to resolvconf
+func (r *ResolvconfDNSConfigurator) renderConfig(servers []netip.Addr) string {
+	var content strings.Builder
 	content.WriteString("# Generated by Olm DNS Manager\n\n")
 
+	if len(r.searchDomains) > 0 {
+		content.WriteString("search ")
+		content.WriteString(strings.Join(r.searchDomains, " "))
+		content.WriteString("\n")
+	}
+
 	for _, server := range servers {
 		content.WriteString("nameserver ")
 		content.WriteString(server.String())
 		content.WriteString("\n")
 	}
 
-	// Apply via resolvconf
-	var cmd *exec.Cmd
-	switch r.implType {
-	case "openresolv":
+	return content.String()
+}
+
+// applyArgs returns the resolvconf arguments used to add our interface entry
+func (r *ResolvconfDNSConfigurator) applyArgs() []string {
+	switch {
+	case r.implType == "openresolv" && !r.prepend:
 		// OpenResolv supports exclusive mode with -x
-		cmd = exec.Command(resolvconfCommand, "-x", "-a", r.ifaceName)
+		return []string{"-x", "-a", r.ifaceName}
 	default:
-		cmd = exec.Command(resolvconfCommand, "-a", r.ifaceName)
+		return []string{"-a", r.ifaceName}
 	}
+}
 
-	cmd.Stdin = &content
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("apply resolvconf config: %w, output: %s", err, out)
+// PreviewResolvconfDNS returns the resolvconf command and input SetDNS would use, without running it
+func PreviewResolvconfDNS(ifaceName string, servers []netip.Addr, searchDomains []string) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
 	}
 
-	return nil
+	implType, err := detectResolvconfType()
+	if err != nil {
+		implType = "resolvconf"
+	}
+
+	r := &ResolvconfDNSConfigurator{
+		ifaceName:     ifaceName,
+		implType:      implType,
+		searchDomains: searchDomains,
+	}
+
+	return fmt.Sprintf("# %s %s <<EOF\n%sEOF\n", resolvconfCommand, strings.Join(r.applyArgs(), " "), r.renderConfig(servers)), nil
 }
 
 // detectResolvconfType detects which resolvconf implementation is being used
@@ -214,6 +287,16 @@ func readResolvConfServers() ([]netip.Addr, error) {
 	return parseResolvconfOutput(string(out)), nil
 }
 
+// readResolvConfSearchDomains reads search domains from /etc/resolv.conf
+func readResolvConfSearchDomains() []string {
+	content, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return nil
+	}
+
+	return parseSearchDomains(string(content))
+}
+
 // IsResolvconfAvailable checks if resolvconf is available
 func IsResolvconfAvailable() bool {
 	cmd := exec.Command(resolvconfCommand, "--version")
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
+	"strings"
 	"time"
 
 	dbus "github.com/godbus/dbus/v5"
@@ -26,6 +27,7 @@ const (
 	systemdDbusSetDNSSECMethod       = systemdDbusLinkInterface + ".SetDNSSEC"
 	systemdDbusSetDNSOverTLSMethod   = systemdDbusLinkInterface + ".SetDNSOverTLS"
 	systemdDbusRevertMethod          = systemdDbusLinkInterface + ".Revert"
+	systemdDbusDomainsProperty       = systemdDbusLinkInterface + ".Domains"
 
 	// RootZone is the root DNS zone that matches all queries
 	RootZone = "."
@@ -48,6 +50,8 @@ type SystemdResolvedDNSConfigurator struct {
 	ifaceName      string
 	dbusLinkObject dbus.ObjectPath
 	originalState  *DNSState
+	searchDomains  []string
+	prepend        bool
 }
 
 // NewSystemdResolvedDNSConfigurator creates a new systemd-resolved DNS configurator
@@ -114,7 +118,20 @@ func (s *SystemdResolvedDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.A
 	return originalServers, nil
 }
 
+// SetPrepend stops SetDNS from claiming the root routing domain, so the link
+// is used alongside the other links instead of capturing all queries
+func (s *SystemdResolvedDNSConfigurator) SetPrepend(prepend bool) {
+	s.prepend = prepend
+}
+
+// SetSearchDomains sets the per-link search domains applied by SetDNS
+func (s *SystemdResolvedDNSConfigurator) SetSearchDomains(domains []string) error {
+	s.searchDomains = domains
+	return nil
+}
+
 // RestoreDNS restores the original DNS configuration
+// Revert clears both the per-link DNS servers and domains
 func (s *SystemdResolvedDNSConfigurator) RestoreDNS() error {
 	// Call Revert method to restore systemd-resolved defaults
 	conn, err := dbus.SystemBus()
@@ -161,6 +178,56 @@ func (s *SystemdResolvedDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
 	return []netip.Addr{}, nil
 }
 
+// ValidateConfig checks that systemd-resolved answers on D-Bus and still knows the link
+func (s *SystemdResolvedDNSConfigurator) ValidateConfig() error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("%w: connect to system bus: %w", ErrDNSManagerNotReachable, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := conn.Object(systemdResolvedDest, systemdDbusObjectNode).CallWithContext(ctx, "org.freedesktop.DBus.Peer.Ping", 0).Store(); err != nil {
+		return fmt.Errorf("%w: systemd-resolved is not running: %w", ErrDNSManagerNotReachable, err)
+	}
+
+	if _, err := conn.Object(systemdResolvedDest, s.dbusLinkObject).GetProperty(systemdDbusDomainsProperty); err != nil {
+		return fmt.Errorf("%w: systemd-resolved does not manage %s: %w", ErrDNSManagerNotReachable, s.ifaceName, err)
+	}
+
+	return nil
+}
+
+// GetSearchDomains returns the search domains configured on the link
+// Routing-only domains such as the root zone are not search domains and are left out.
+func (s *SystemdResolvedDNSConfigurator) GetSearchDomains() ([]string, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect to system bus: %w", err)
+	}
+	defer conn.Close()
+
+	prop, err := conn.Object(systemdResolvedDest, s.dbusLinkObject).GetProperty(systemdDbusDomainsProperty)
+	if err != nil {
+		return nil, fmt.Errorf("get link domains: %w", err)
+	}
+
+	var domains []systemdDbusDomainsInput
+	if err := prop.Store(&domains); err != nil {
+		return nil, fmt.Errorf("parse link domains: %w", err)
+	}
+
+	var searchDomains []string
+	for _, domain := range domains {
+		if !domain.MatchOnly {
+			searchDomains = append(searchDomains, domain.Domain)
+		}
+	}
+	return searchDomains, nil
+}
+
 // applyDNSServers applies DNS server configuration via systemd-resolved
 func (s *SystemdResolvedDNSConfigurator) applyDNSServers(servers []netip.Addr) error {
 	if len(servers) == 0 {
@@ -204,15 +271,7 @@ func (s *SystemdResolvedDNSConfigurator) applyDNSServers(servers []netip.Addr) e
 		return fmt.Errorf("set default route: %w", err)
 	}
 
-	// Set the root zone "." as a match-only domain
-	// This captures ALL DNS queries and routes them through this interface
-	domainsInput := []systemdDbusDomainsInput{
-		{
-			Domain:    RootZone,
-			MatchOnly: true,
-		},
-	}
-	if err := s.callLinkMethod(systemdDbusSetDomainsMethod, domainsInput); err != nil {
+	if err := s.callLinkMethod(systemdDbusSetDomainsMethod, s.linkDomains()); err != nil {
 		return fmt.Errorf("set domains: %w", err)
 	}
 
@@ -236,6 +295,57 @@ func (s *SystemdResolvedDNSConfigurator) applyDNSServers(servers []netip.Addr) e
 	return nil
 }
 
+// linkDomains returns the domains SetDNS sets on the link
+func (s *SystemdResolvedDNSConfigurator) linkDomains() []systemdDbusDomainsInput {
+	// Set the root zone "." as a match-only domain
+	// This captures ALL DNS queries and routes them through this interface
+	var domainsInput []systemdDbusDomainsInput
+	if !s.prepend {
+		domainsInput = append(domainsInput, systemdDbusDomainsInput{
+			Domain:    RootZone,
+			MatchOnly: true,
+		})
+	}
+
+	// Add search domains as regular (non match-only) domains
+	for _, domain := range s.searchDomains {
+		domainsInput = append(domainsInput, systemdDbusDomainsInput{
+			Domain:    domain,
+			MatchOnly: false,
+		})
+	}
+	return domainsInput
+}
+
+// PreviewSystemdResolvedDNS returns the D-Bus calls SetDNS would make on the link, without
+// making them. prepend previews a configurator set up with SetPrepend(true).
+func PreviewSystemdResolvedDNS(ifaceName string, servers []netip.Addr, searchDomains []string, prepend bool) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
+	}
+
+	s := &SystemdResolvedDNSConfigurator{searchDomains: searchDomains, prepend: prepend}
+	var domains []string
+	for _, domain := range s.linkDomains() {
+		if domain.MatchOnly {
+			domains = append(domains, "~"+domain.Domain)
+		} else {
+			domains = append(domains, domain.Domain)
+		}
+	}
+
+	var preview strings.Builder
+	preview.WriteString(fmt.Sprintf("# systemd-resolved link %s via D-Bus %s\n", ifaceName, systemdResolvedDest))
+	preview.WriteString(fmt.Sprintf("%s %v\n", systemdDbusSetDNSMethod, servers))
+	preview.WriteString(fmt.Sprintf("%s true\n", systemdDbusSetDefaultRouteMethod))
+	preview.WriteString(fmt.Sprintf("%s %s\n", systemdDbusSetDomainsMethod, strings.Join(domains, " ")))
+	preview.WriteString(fmt.Sprintf("%s no\n", systemdDbusSetDNSSECMethod))
+	preview.WriteString(fmt.Sprintf("%s no\n", systemdDbusSetDNSOverTLSMethod))
+	preview.WriteString(fmt.Sprintf("%s\n", systemdDbusFlushCachesMethod))
+
+	return preview.String(), nil
+}
+
 // callLinkMethod is a helper to call methods on the link object
 func (s *SystemdResolvedDNSConfigurator) callLinkMethod(method string, value any) error {
 	conn, err := dbus.SystemBus()
@@ -0,0 +1,42 @@
+//go:build linux && !android
+
+package dns
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestPreviewSystemdResolvedDNS(t *testing.T) {
+	servers := []netip.Addr{netip.MustParseAddr("100.96.128.1")}
+	setDomains := func(preview string) string {
+		for _, line := range strings.Split(preview, "\n") {
+			if strings.HasPrefix(line, systemdDbusSetDomainsMethod+" ") {
+				return strings.TrimPrefix(line, systemdDbusSetDomainsMethod+" ")
+			}
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name    string
+		prepend bool
+		want    string
+	}{
+		{name: "replace", prepend: false, want: "~. corp.internal"},
+		{name: "prepend", prepend: true, want: "corp.internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, err := PreviewSystemdResolvedDNS("olm", servers, []string{"corp.internal"}, tt.prepend)
+			if err != nil {
+				t.Fatalf("PreviewSystemdResolvedDNS failed: %v", err)
+			}
+			if got := setDomains(preview); got != tt.want {
+				t.Errorf("Expected domains %q, got %q in:\n%s", tt.want, got, preview)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package testing provides an in-memory DNSConfigurator for testing DNS override logic
+// without root access or a real DNS manager
+package testing
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+
+	platform "github.com/fosrl/olm/dns/platform"
+)
+
+var (
+	_ platform.DNSConfigurator = (*MockDNSConfigurator)(nil)
+	_ platform.BackupDiscarder = (*MockDNSConfigurator)(nil)
+)
+
+// MockDNSConfigurator keeps the DNS servers and search domains in memory
+type MockDNSConfigurator struct {
+	mu            sync.Mutex
+	servers       []netip.Addr
+	searchDomains []string
+	pendingSearch []string           // applied by the next SetDNS
+	backup        *platform.DNSState // state before the first SetDNS, nil when not overridden
+	setDNSErr     error
+	searchErr     error
+	restoreErr    error
+	validateErr   error
+	setDNSCalls   [][]netip.Addr
+}
+
+// NewMockDNSConfigurator creates a mock configurator with no DNS servers configured
+func NewMockDNSConfigurator() *MockDNSConfigurator {
+	return &MockDNSConfigurator{}
+}
+
+// Name returns the configurator name
+func (m *MockDNSConfigurator) Name() string {
+	return "mock"
+}
+
+// SetDNS records the call and replaces the servers, backing up the original state on the
+// first override. It returns the servers it replaced, or the error set by SetDNSError.
+func (m *MockDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setDNSCalls = append(m.setDNSCalls, slices.Clone(servers))
+	if m.setDNSErr != nil {
+		return nil, m.setDNSErr
+	}
+
+	if m.backup == nil {
+		m.backup = &platform.DNSState{
+			OriginalServers:       slices.Clone(m.servers),
+			OriginalSearchDomains: slices.Clone(m.searchDomains),
+			ConfiguratorName:      m.Name(),
+		}
+	}
+
+	previous := m.servers
+	m.servers = slices.Clone(servers)
+	if m.pendingSearch != nil {
+		m.searchDomains = m.pendingSearch
+	}
+	return previous, nil
+}
+
+// SetSearchDomains sets the search domains applied by the next SetDNS, or fails with
+// the error set by SetSearchDomainsError
+func (m *MockDNSConfigurator) SetSearchDomains(domains []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.searchErr != nil {
+		return m.searchErr
+	}
+	m.pendingSearch = slices.Clone(domains)
+	return nil
+}
+
+// GetSearchDomains returns the current search domains
+func (m *MockDNSConfigurator) GetSearchDomains() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.searchDomains), nil
+}
+
+// RestoreDNS puts back the servers and search domains backed up by SetDNS
+// It does nothing when DNS is not overridden, and fails with the error set by
+// SetRestoreDNSError.
+func (m *MockDNSConfigurator) RestoreDNS() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.restoreErr != nil {
+		return m.restoreErr
+	}
+
+	if m.backup == nil {
+		return nil
+	}
+	m.servers = m.backup.OriginalServers
+	m.searchDomains = m.backup.OriginalSearchDomains
+	m.backup = nil
+	return nil
+}
+
+// ValidateConfig returns the error set by SetValidateConfigError
+func (m *MockDNSConfigurator) ValidateConfig() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.validateErr
+}
+
+// GetCurrentDNS returns the current servers
+func (m *MockDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.servers), nil
+}
+
+// DiscardBackup drops the state backed up by SetDNS and keeps the current servers
+func (m *MockDNSConfigurator) DiscardBackup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.backup = nil
+	return nil
+}
+
+// CleanupUncleanShutdown restores the backup left by an override that was never restored
+func (m *MockDNSConfigurator) CleanupUncleanShutdown() error {
+	return m.RestoreDNS()
+}
+
+// SetDNSError makes SetDNS fail with err, or succeed again when err is nil
+func (m *MockDNSConfigurator) SetDNSError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setDNSErr = err
+}
+
+// SetSearchDomainsError makes SetSearchDomains fail with err, or succeed again when err is nil
+func (m *MockDNSConfigurator) SetSearchDomainsError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.searchErr = err
+}
+
+// SetRestoreDNSError makes RestoreDNS fail with err, or succeed again when err is nil
+func (m *MockDNSConfigurator) SetRestoreDNSError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.restoreErr = err
+}
+
+// SetValidateConfigError makes ValidateConfig fail with err, or succeed again when err is nil
+func (m *MockDNSConfigurator) SetValidateConfigError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.validateErr = err
+}
+
+// SetCurrentDNS sets the servers the system starts with, as if configured before Olm ran
+func (m *MockDNSConfigurator) SetCurrentDNS(servers []netip.Addr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.servers = slices.Clone(servers)
+}
+
+// SetDNSCalls returns the servers passed to each SetDNS call, in order
+func (m *MockDNSConfigurator) SetDNSCalls() [][]netip.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.setDNSCalls)
+}
+
+// Overridden reports whether SetDNS has replaced the servers without a RestoreDNS since
+func (m *MockDNSConfigurator) Overridden() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.backup != nil
+}
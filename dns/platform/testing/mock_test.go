@@ -0,0 +1,73 @@
+package testing
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestMockDNSConfigurator(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	proxy := []netip.Addr{netip.MustParseAddr("100.96.128.1")}
+
+	m := NewMockDNSConfigurator()
+	m.SetCurrentDNS(original)
+	m.SetSearchDomains([]string{"tunnel.internal"})
+
+	previous, err := m.SetDNS(proxy)
+	if err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+	if !slices.Equal(previous, original) {
+		t.Errorf("Expected SetDNS to return %v, got %v", original, previous)
+	}
+	if current, _ := m.GetCurrentDNS(); !slices.Equal(current, proxy) {
+		t.Errorf("Expected current servers %v, got %v", proxy, current)
+	}
+	if domains, _ := m.GetSearchDomains(); !slices.Equal(domains, []string{"tunnel.internal"}) {
+		t.Errorf("Expected search domains [tunnel.internal], got %v", domains)
+	}
+
+	// A second override keeps the first backup
+	if _, err := m.SetDNS(append(proxy, netip.MustParseAddr("1.1.1.1"))); err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+	if calls := m.SetDNSCalls(); len(calls) != 2 || !slices.Equal(calls[0], proxy) {
+		t.Errorf("Expected both SetDNS calls to be recorded, got %v", calls)
+	}
+
+	if err := m.RestoreDNS(); err != nil {
+		t.Fatalf("RestoreDNS failed: %v", err)
+	}
+	if current, _ := m.GetCurrentDNS(); !slices.Equal(current, original) {
+		t.Errorf("Expected restored servers %v, got %v", original, current)
+	}
+	if domains, _ := m.GetSearchDomains(); len(domains) != 0 {
+		t.Errorf("Expected the search domains to be restored, got %v", domains)
+	}
+	if m.Overridden() {
+		t.Error("Expected no override after RestoreDNS")
+	}
+}
+
+func TestMockDNSConfiguratorSetDNSError(t *testing.T) {
+	original := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	injected := errors.New("permission denied")
+
+	m := NewMockDNSConfigurator()
+	m.SetCurrentDNS(original)
+	m.SetDNSError(injected)
+
+	if _, err := m.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); !errors.Is(err, injected) {
+		t.Fatalf("Expected the injected error, got %v", err)
+	}
+	if current, _ := m.GetCurrentDNS(); !slices.Equal(current, original) || m.Overridden() {
+		t.Errorf("Expected a failed SetDNS to leave %v in place, got %v", original, current)
+	}
+
+	m.SetDNSError(nil)
+	if _, err := m.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")}); err != nil {
+		t.Errorf("Expected SetDNS to succeed once the error is cleared, got %v", err)
+	}
+}
@@ -1,6 +1,19 @@
 package dns
 
-import "net/netip"
+import (
+	"errors"
+	"net/netip"
+)
+
+var (
+	// ErrInsufficientPrivileges is returned by ValidateConfig when the process
+	// may not change the DNS settings, usually because it is not running as root
+	ErrInsufficientPrivileges = errors.New("insufficient privileges to change DNS settings")
+
+	// ErrDNSManagerNotReachable is returned by ValidateConfig when the DNS
+	// manager is not running or does not manage the interface
+	ErrDNSManagerNotReachable = errors.New("DNS manager not reachable")
+)
 
 // DNSConfigurator provides an interface for managing system DNS settings
 // across different platforms and implementations
@@ -9,9 +22,21 @@ type DNSConfigurator interface {
 	// Returns the original DNS servers that were replaced
 	SetDNS(servers []netip.Addr) ([]netip.Addr, error)
 
-	// RestoreDNS restores the original DNS servers
+	// SetSearchDomains sets the search domains to configure alongside the
+	// DNS servers. They are applied by the next call to SetDNS.
+	SetSearchDomains(domains []string) error
+
+	// GetSearchDomains returns the currently configured search domains
+	GetSearchDomains() ([]string, error)
+
+	// RestoreDNS restores the original DNS servers and search domains
 	RestoreDNS() error
 
+	// ValidateConfig checks that the DNS manager is reachable and the process
+	// may change its settings, without changing anything. It returns an error
+	// wrapping ErrInsufficientPrivileges or ErrDNSManagerNotReachable.
+	ValidateConfig() error
+
 	// GetCurrentDNS returns the currently configured DNS servers
 	GetCurrentDNS() ([]netip.Addr, error)
 
@@ -23,6 +48,21 @@ type DNSConfigurator interface {
 	CleanupUncleanShutdown() error
 }
 
+// PrependConfigurator is implemented by configurators that can add the DNS
+// servers ahead of the existing system servers natively, instead of having
+// the caller pass the original servers back in to SetDNS
+type PrependConfigurator interface {
+	// SetPrepend makes the next call to SetDNS keep the existing servers
+	SetPrepend(prepend bool)
+}
+
+// BackupDiscarder is implemented by configurators that back up the original
+// configuration on disk in SetDNS. DiscardBackup removes that backup and keeps the
+// servers now set, so a later RestoreDNS or CleanupUncleanShutdown does not undo them.
+type BackupDiscarder interface {
+	DiscardBackup() error
+}
+
 // DNSConfig contains the configuration for DNS override
 type DNSConfig struct {
 	// Servers is the list of DNS servers to use
@@ -43,3 +83,15 @@ type DNSState struct {
 	// ConfiguratorName is the name of the configurator that saved this state
 	ConfiguratorName string
 }
+
+// StaleEntry describes DNS configuration left behind by a previous session
+type StaleEntry struct {
+	// Manager is the DNS manager that owns the stale state
+	Manager string `json:"manager"`
+
+	// Description is a human-readable explanation of the stale state
+	Description string `json:"description"`
+
+	// Path is the file, D-Bus object or key holding the stale state
+	Path string `json:"path"`
+}
@@ -0,0 +1,253 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+const (
+	uciCommand            = "/sbin/uci"
+	uciNetworkRestartPath = "/etc/init.d/network"
+)
+
+// UCIDNSConfigurator manages DNS settings on OpenWRT and other embedded Linux systems
+// configured through uci, where netifd hands the dns option of a network interface
+// section to dnsmasq. The interface name is the uci section, such as "lan" or "wan",
+// not the kernel interface name. Changes are committed, so a crash leaves them in
+// place until RestoreDNS runs.
+type UCIDNSConfigurator struct {
+	ifaceName     string
+	uciPath       string
+	restartPath   string
+	originalState *DNSState
+	searchDomains []string
+}
+
+// NewUCIDNSConfigurator creates a DNS configurator for the uci network section ifaceName
+func NewUCIDNSConfigurator(interfaceName string) (*UCIDNSConfigurator, error) {
+	return newUCIDNSConfigurator(interfaceName, uciCommand, uciNetworkRestartPath)
+}
+
+// newUCIDNSConfigurator creates a uci configurator running the given uci and network
+// restart commands
+func newUCIDNSConfigurator(interfaceName, uciPath, restartPath string) (*UCIDNSConfigurator, error) {
+	if interfaceName == "" {
+		return nil, fmt.Errorf("interface name is required")
+	}
+
+	u := &UCIDNSConfigurator{
+		ifaceName:   interfaceName,
+		uciPath:     uciPath,
+		restartPath: restartPath,
+	}
+
+	// uci set fails on a missing section, so catch it before SetDNS
+	if _, err := u.get(""); err != nil {
+		return nil, fmt.Errorf("uci network section %s: %w", interfaceName, err)
+	}
+
+	return u, nil
+}
+
+// Name returns the configurator name
+func (u *UCIDNSConfigurator) Name() string {
+	return "uci"
+}
+
+// SetDNS sets the dns option of the interface section, commits it and restarts the
+// network, returning the servers it replaced
+func (u *UCIDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers provided")
+	}
+
+	originalServers, err := u.GetCurrentDNS()
+	if err != nil {
+		return nil, fmt.Errorf("get current DNS: %w", err)
+	}
+	originalSearchDomains, err := u.GetSearchDomains()
+	if err != nil {
+		return nil, fmt.Errorf("get current search domains: %w", err)
+	}
+
+	// Keep the first backup if SetDNS is called again before RestoreDNS
+	if u.originalState == nil {
+		u.originalState = &DNSState{
+			OriginalServers:       originalServers,
+			OriginalSearchDomains: originalSearchDomains,
+			ConfiguratorName:      u.Name(),
+		}
+	}
+
+	if err := u.apply(servers, u.searchDomains); err != nil {
+		return nil, err
+	}
+
+	return originalServers, nil
+}
+
+// SetSearchDomains sets the domains SetDNS writes to the dns_search option
+func (u *UCIDNSConfigurator) SetSearchDomains(domains []string) error {
+	u.searchDomains = domains
+	return nil
+}
+
+// GetSearchDomains returns the dns_search option of the interface section
+func (u *UCIDNSConfigurator) GetSearchDomains() ([]string, error) {
+	value, err := u.get("dns_search")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(value), nil
+}
+
+// RestoreDNS puts back the dns and dns_search options saved by SetDNS
+func (u *UCIDNSConfigurator) RestoreDNS() error {
+	if u.originalState == nil {
+		return nil
+	}
+
+	if err := u.apply(u.originalState.OriginalServers, u.originalState.OriginalSearchDomains); err != nil {
+		return err
+	}
+
+	u.originalState = nil
+	return nil
+}
+
+// ValidateConfig checks that uci is installed and the process runs as root
+func (u *UCIDNSConfigurator) ValidateConfig() error {
+	if _, err := exec.LookPath(u.uciPath); err != nil {
+		return fmt.Errorf("%w: %w", ErrDNSManagerNotReachable, err)
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("%w: uci must be run as root", ErrInsufficientPrivileges)
+	}
+
+	return nil
+}
+
+// GetCurrentDNS returns the servers in the dns option of the interface section
+func (u *UCIDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
+	value, err := u.get("dns")
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []netip.Addr
+	for _, field := range strings.Fields(value) {
+		if addr, err := netip.ParseAddr(field); err == nil {
+			servers = append(servers, addr)
+		}
+	}
+	return servers, nil
+}
+
+// CleanupUncleanShutdown does nothing: the original options are only kept in memory,
+// so settings left by a crash cannot be told apart from ones made by the user
+func (u *UCIDNSConfigurator) CleanupUncleanShutdown() error {
+	return nil
+}
+
+// apply writes the dns and dns_search options, deleting the ones left empty, commits
+// them and restarts the network so dnsmasq picks them up
+func (u *UCIDNSConfigurator) apply(servers []netip.Addr, searchDomains []string) error {
+	values := make([]string, len(servers))
+	for i, server := range servers {
+		values[i] = server.String()
+	}
+
+	for _, cmd := range uciCommands(u.ifaceName, values, searchDomains) {
+		path := u.uciPath
+		if cmd[0] == "restart" {
+			path = u.restartPath
+		}
+		out, err := exec.Command(path, cmd...).CombinedOutput()
+		if err != nil && slices.Contains(cmd, "delete") {
+			// The option was not set
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w, output: %s", path, strings.Join(cmd, " "), err, out)
+		}
+	}
+
+	return nil
+}
+
+// get returns the value of option in the interface section, or the section type when
+// option is empty. A missing option is returned as an empty value.
+func (u *UCIDNSConfigurator) get(option string) (string, error) {
+	key := "network." + u.ifaceName
+	if option != "" {
+		key += "." + option
+	}
+
+	out, err := exec.Command(u.uciPath, "-q", "get", key).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// uci exits with 1 for a missing entry
+		if option != "" && errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("uci get %s: %w", key, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// uciCommands returns the uci commands, and the final network restart, that set the
+// dns and dns_search options of section ifaceName
+func uciCommands(ifaceName string, servers, searchDomains []string) [][]string {
+	option := func(name string, values []string) []string {
+		key := "network." + ifaceName + "." + name
+		if len(values) == 0 {
+			// Deleting a missing option fails, which apply ignores
+			return []string{"-q", "delete", key}
+		}
+		return []string{"set", key + "=" + strings.Join(values, " ")}
+	}
+
+	return [][]string{
+		option("dns", servers),
+		option("dns_search", searchDomains),
+		{"commit", "network"},
+		{"restart"},
+	}
+}
+
+// PreviewUCIDNS returns the commands SetDNS would run for the uci network section
+// ifaceName, without running them
+func PreviewUCIDNS(ifaceName string, servers []netip.Addr, searchDomains []string) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
+	}
+
+	values := make([]string, len(servers))
+	for i, server := range servers {
+		values[i] = server.String()
+	}
+
+	var preview strings.Builder
+	for _, cmd := range uciCommands(ifaceName, values, searchDomains) {
+		if cmd[0] == "restart" {
+			fmt.Fprintf(&preview, "# %s restart\n", uciNetworkRestartPath)
+			continue
+		}
+		fmt.Fprintf(&preview, "# uci %s\n", strings.Join(cmd, " "))
+	}
+	return preview.String(), nil
+}
+
+// IsUCIAvailable reports whether uci is installed at /sbin/uci, as on OpenWRT
+func IsUCIAvailable() bool {
+	_, err := os.Stat(uciCommand)
+	return err == nil
+}
@@ -0,0 +1,141 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeUCI is a uci stand-in keeping one option per file in its state directory, enough
+// for get, set, delete and commit on the network config
+const fakeUCI = `#!/bin/sh
+state="$(dirname "$0")/state"
+[ "$1" = "-q" ] && shift
+case "$1" in
+get)
+	[ -f "$state/$2" ] || exit 1
+	cat "$state/$2"
+	;;
+set)
+	key="${2%%=*}"
+	[ -f "$state/${key%.*}" ] || exit 1
+	printf '%s\n' "${2#*=}" > "$state/$key"
+	;;
+delete)
+	[ -f "$state/$2" ] || exit 1
+	rm "$state/$2"
+	;;
+commit)
+	echo commit >> "$state/log"
+	;;
+esac
+`
+
+// newFakeUCI writes a fake uci with the given options and a network restart script
+// that logs its runs, returning their paths and the state directory
+func newFakeUCI(t *testing.T, options map[string]string) (uciPath, restartPath, state string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	state = filepath.Join(dir, "state")
+	if err := os.Mkdir(state, 0755); err != nil {
+		t.Fatalf("Failed to create state dir: %v", err)
+	}
+	for key, value := range options {
+		if err := os.WriteFile(filepath.Join(state, key), []byte(value+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", key, err)
+		}
+	}
+
+	uciPath = filepath.Join(dir, "uci")
+	restartPath = filepath.Join(dir, "network")
+	restart := "#!/bin/sh\necho \"restart $1\" >> \"" + filepath.Join(state, "log") + "\"\n"
+	for path, script := range map[string]string{uciPath: fakeUCI, restartPath: restart} {
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return uciPath, restartPath, state
+}
+
+// readUCIOption returns the value of key in the fake uci state, or "" if it is not set
+func readUCIOption(t *testing.T, state, key string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(state, key))
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", key, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestUCIDNSConfigurator(t *testing.T) {
+	uciPath, restartPath, state := newFakeUCI(t, map[string]string{
+		"network.lan":     "interface",
+		"network.lan.dns": "192.168.1.1 1.1.1.1",
+	})
+
+	if _, err := newUCIDNSConfigurator("olm0", uciPath, restartPath); err == nil {
+		t.Error("Expected an error for a missing uci section")
+	}
+
+	u, err := newUCIDNSConfigurator("lan", uciPath, restartPath)
+	if err != nil {
+		t.Fatalf("newUCIDNSConfigurator failed: %v", err)
+	}
+	u.SetSearchDomains([]string{"corp.internal"})
+
+	original, err := u.SetDNS([]netip.Addr{netip.MustParseAddr("100.96.128.1")})
+	if err != nil {
+		t.Fatalf("SetDNS failed: %v", err)
+	}
+	want := []netip.Addr{netip.MustParseAddr("192.168.1.1"), netip.MustParseAddr("1.1.1.1")}
+	if !slices.Equal(original, want) {
+		t.Errorf("SetDNS returned %v, expected %v", original, want)
+	}
+	if got := readUCIOption(t, state, "network.lan.dns"); got != "100.96.128.1" {
+		t.Errorf("Expected dns option 100.96.128.1, got %q", got)
+	}
+	if got := readUCIOption(t, state, "network.lan.dns_search"); got != "corp.internal" {
+		t.Errorf("Expected dns_search option corp.internal, got %q", got)
+	}
+	if servers, err := u.GetCurrentDNS(); err != nil || !slices.Equal(servers, []netip.Addr{netip.MustParseAddr("100.96.128.1")}) {
+		t.Errorf("GetCurrentDNS() = %v, %v", servers, err)
+	}
+
+	if err := u.RestoreDNS(); err != nil {
+		t.Fatalf("RestoreDNS failed: %v", err)
+	}
+	if got := readUCIOption(t, state, "network.lan.dns"); got != "192.168.1.1 1.1.1.1" {
+		t.Errorf("Expected the original dns option, got %q", got)
+	}
+	if got := readUCIOption(t, state, "network.lan.dns_search"); got != "" {
+		t.Errorf("Expected dns_search to be deleted, got %q", got)
+	}
+
+	// Each change is committed and followed by a network restart
+	if log := readUCIOption(t, state, "log"); log != "commit\nrestart restart\ncommit\nrestart restart" {
+		t.Errorf("Unexpected command log:\n%s", log)
+	}
+}
+
+func TestPreviewUCIDNS(t *testing.T) {
+	preview, err := PreviewUCIDNS("lan", []netip.Addr{netip.MustParseAddr("100.96.128.1")}, nil)
+	if err != nil {
+		t.Fatalf("PreviewUCIDNS failed: %v", err)
+	}
+	want := "# uci set network.lan.dns=100.96.128.1\n" +
+		"# uci -q delete network.lan.dns_search\n" +
+		"# uci commit network\n" +
+		"# /etc/init.d/network restart\n"
+	if preview != want {
+		t.Errorf("PreviewUCIDNS() =\n%s\nexpected\n%s", preview, want)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkFileWritable checks that path can be opened for writing without changing it
+func checkFileWritable(path string) error {
+	if immutable, _ := isFileImmutable(path); immutable {
+		return fmt.Errorf("%w: %w: run 'chattr -i %s' to allow Olm to manage DNS", ErrInsufficientPrivileges, ErrFileImmutable, path)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w: cannot write %s", ErrInsufficientPrivileges, path)
+		}
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// checkDirWritable checks that files can be created in dir
+func checkDirWritable(dir string) error {
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w: cannot create files in %s", ErrInsufficientPrivileges, dir)
+		}
+		return fmt.Errorf("access %s: %w", dir, err)
+	}
+	return nil
+}
@@ -8,9 +8,12 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"os/exec"
+	"strings"
 	"syscall"
 	"unsafe"
 
+	"github.com/fosrl/newt/logger"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 )
@@ -18,23 +21,42 @@ import (
 var (
 	dnsapi                  = syscall.NewLazyDLL("dnsapi.dll")
 	dnsFlushResolverCacheFn = dnsapi.NewProc("DnsFlushResolverCache")
+
+	// execCommand is replaced in tests
+	execCommand = exec.Command
 )
 
 const (
 	interfaceConfigPath           = `SYSTEM\CurrentControlSet\Services\Tcpip\Parameters\Interfaces`
 	interfaceConfigNameServer     = "NameServer"
 	interfaceConfigDhcpNameServer = "DhcpNameServer"
+	tcpipParametersPath           = `SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`
+	tcpipSearchList               = "SearchList"
 )
 
 // WindowsDNSConfigurator manages DNS settings on Windows using the registry
 type WindowsDNSConfigurator struct {
 	guid          string
 	originalState *DNSState
+	searchDomains []string
+	searchListSet bool
+	noFlush       bool
+}
+
+// WindowsOption configures a WindowsDNSConfigurator
+type WindowsOption func(*WindowsDNSConfigurator)
+
+// WithNoFlush stops SetDNS from flushing the DNS client cache after the
+// registry has been updated
+func WithNoFlush() WindowsOption {
+	return func(w *WindowsDNSConfigurator) {
+		w.noFlush = true
+	}
 }
 
 // NewWindowsDNSConfigurator creates a new Windows DNS configurator
 // Accepts an interface name and extracts the GUID internally
-func NewWindowsDNSConfigurator(interfaceName string) (*WindowsDNSConfigurator, error) {
+func NewWindowsDNSConfigurator(interfaceName string, opts ...WindowsOption) (*WindowsDNSConfigurator, error) {
 	if interfaceName == "" {
 		return nil, fmt.Errorf("interface name is required")
 	}
@@ -44,9 +66,13 @@ func NewWindowsDNSConfigurator(interfaceName string) (*WindowsDNSConfigurator, e
 		return nil, fmt.Errorf("failed to get interface GUID: %w", err)
 	}
 
-	return &WindowsDNSConfigurator{
+	w := &WindowsDNSConfigurator{
 		guid: guid,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w, nil
 }
 
 // newWindowsDNSConfiguratorFromGUID creates a configurator from a GUID string
@@ -85,15 +111,51 @@ func (w *WindowsDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, err
 		return nil, fmt.Errorf("set DNS servers: %w", err)
 	}
 
-	// Flush DNS cache
-	if err := w.flushDNSCache(); err != nil {
-		// Non-fatal, just log
-		fmt.Printf("warning: failed to flush DNS cache: %v\n", err)
+	// Set search domains, remembering the original list so it can be restored
+	if len(w.searchDomains) > 0 {
+		originalSearch, err := getSearchList()
+		if err != nil {
+			return nil, fmt.Errorf("get search list: %w", err)
+		}
+		w.originalState.OriginalSearchDomains = originalSearch
+
+		if err := setSearchList(w.searchDomains); err != nil {
+			return nil, fmt.Errorf("set search list: %w", err)
+		}
+		w.searchListSet = true
 	}
 
+	w.flushAfterSet()
+
 	return originalServers, nil
 }
 
+// flushAfterSet flushes the DNS client cache so the new servers are used
+// immediately. Failures are logged rather than returned.
+func (w *WindowsDNSConfigurator) flushAfterSet() {
+	if w.noFlush {
+		return
+	}
+
+	if err := FlushWindowsDNSCache(); err != nil {
+		logger.Warn("Failed to flush DNS cache: %v", err)
+	}
+}
+
+// FlushWindowsDNSCache clears the DNS client cache by running ipconfig /flushdns
+func FlushWindowsDNSCache() error {
+	if out, err := execCommand("ipconfig", "/flushdns").CombinedOutput(); err != nil {
+		return fmt.Errorf("ipconfig /flushdns: %w, output: %s", err, out)
+	}
+	return nil
+}
+
+// SetSearchDomains sets the global search list written by SetDNS
+func (w *WindowsDNSConfigurator) SetSearchDomains(domains []string) error {
+	w.searchDomains = domains
+	return nil
+}
+
 // RestoreDNS restores the original DNS configuration
 func (w *WindowsDNSConfigurator) RestoreDNS() error {
 	if w.originalState == nil {
@@ -105,6 +167,14 @@ func (w *WindowsDNSConfigurator) RestoreDNS() error {
 		return fmt.Errorf("clear DNS servers: %w", err)
 	}
 
+	// Put back the original search list if we changed it
+	if w.searchListSet {
+		if err := setSearchList(w.originalState.OriginalSearchDomains); err != nil {
+			return fmt.Errorf("restore search list: %w", err)
+		}
+		w.searchListSet = false
+	}
+
 	// Flush DNS cache
 	if err := w.flushDNSCache(); err != nil {
 		fmt.Printf("warning: failed to flush DNS cache: %v\n", err)
@@ -148,6 +218,36 @@ func (w *WindowsDNSConfigurator) GetCurrentDNS() ([]netip.Addr, error) {
 	return []netip.Addr{}, nil
 }
 
+// ValidateConfig checks that the interface and search list registry keys can be written
+func (w *WindowsDNSConfigurator) ValidateConfig() error {
+	regKey, err := w.getInterfaceRegistryKey(registry.SET_VALUE)
+	if err != nil {
+		return registryAccessError(err)
+	}
+	closeKey(regKey)
+
+	regKey, err = registry.OpenKey(registry.LOCAL_MACHINE, tcpipParametersPath, registry.SET_VALUE)
+	if err != nil {
+		return registryAccessError(fmt.Errorf("open HKEY_LOCAL_MACHINE\\%s: %w", tcpipParametersPath, err))
+	}
+	closeKey(regKey)
+
+	return nil
+}
+
+// registryAccessError classifies a failure to open a registry key for ValidateConfig
+func registryAccessError(err error) error {
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return fmt.Errorf("%w: %w", ErrInsufficientPrivileges, err)
+	}
+	return fmt.Errorf("%w: %w", ErrDNSManagerNotReachable, err)
+}
+
+// GetSearchDomains returns the global search list
+func (w *WindowsDNSConfigurator) GetSearchDomains() ([]string, error) {
+	return getSearchList()
+}
+
 // setDNSServers sets the DNS servers in the registry
 func (w *WindowsDNSConfigurator) setDNSServers(servers []netip.Addr) error {
 	if len(servers) == 0 {
@@ -192,6 +292,78 @@ func (w *WindowsDNSConfigurator) clearDNSServers() error {
 	return nil
 }
 
+// getSearchList reads the global DNS suffix search list
+func getSearchList() ([]string, error) {
+	regKey, err := registry.OpenKey(registry.LOCAL_MACHINE, tcpipParametersPath, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("open HKEY_LOCAL_MACHINE\\%s: %w", tcpipParametersPath, err)
+	}
+	defer closeKey(regKey)
+
+	searchList, _, err := regKey.GetStringValue(tcpipSearchList)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get SearchList: %w", err)
+	}
+
+	return splitByDelimiters(searchList, []rune{',', ' '}), nil
+}
+
+// setSearchList writes the global DNS suffix search list
+func setSearchList(domains []string) error {
+	regKey, err := registry.OpenKey(registry.LOCAL_MACHINE, tcpipParametersPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open HKEY_LOCAL_MACHINE\\%s: %w", tcpipParametersPath, err)
+	}
+	defer closeKey(regKey)
+
+	if err := regKey.SetStringValue(tcpipSearchList, strings.Join(domains, ",")); err != nil {
+		return fmt.Errorf("set SearchList: %w", err)
+	}
+
+	return nil
+}
+
+// PreviewWindowsDNS returns the registry writes SetDNS would make, without making them
+// opts are the options SetDNS would run with, e.g. WithNoFlush.
+func PreviewWindowsDNS(interfaceName string, servers []netip.Addr, searchDomains []string, opts ...WindowsOption) (string, error) {
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no DNS servers provided")
+	}
+
+	guid, err := getInterfaceGUIDString(interfaceName)
+	if err != nil {
+		return "", fmt.Errorf("get interface GUID: %w", err)
+	}
+
+	w := &WindowsDNSConfigurator{guid: guid}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w.renderPreview(servers, searchDomains), nil
+}
+
+// renderPreview describes the registry writes and cache flush of SetDNS
+func (w *WindowsDNSConfigurator) renderPreview(servers []netip.Addr, searchDomains []string) string {
+	serverList := make([]string, 0, len(servers))
+	for _, server := range servers {
+		serverList = append(serverList, server.String())
+	}
+
+	var preview strings.Builder
+	preview.WriteString(fmt.Sprintf("HKEY_LOCAL_MACHINE\\%s\\%s\\%s = %s\n", interfaceConfigPath, w.guid, interfaceConfigNameServer, strings.Join(serverList, ",")))
+	if len(searchDomains) > 0 {
+		preview.WriteString(fmt.Sprintf("HKEY_LOCAL_MACHINE\\%s\\%s = %s\n", tcpipParametersPath, tcpipSearchList, strings.Join(searchDomains, ",")))
+	}
+	if !w.noFlush {
+		preview.WriteString("# then flush the DNS client cache with ipconfig /flushdns\n")
+	}
+
+	return preview.String()
+}
+
 // getInterfaceRegistryKey opens the registry key for the network interface
 func (w *WindowsDNSConfigurator) getInterfaceRegistryKey(access uint32) (registry.Key, error) {
 	regKeyPath := interfaceConfigPath + `\` + w.guid
@@ -0,0 +1,98 @@
+//go:build windows
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// fakeExecCommand records the command and runs TestHelperProcess instead
+func fakeExecCommand(t *testing.T, calls *[]string, exitCode int) func(string, ...string) *exec.Cmd {
+	t.Helper()
+
+	return func(name string, args ...string) *exec.Cmd {
+		*calls = append(*calls, fmt.Sprint(append([]string{name}, args...)))
+		cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+		cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", fmt.Sprintf("HELPER_EXIT_CODE=%d", exitCode))
+		return cmd
+	}
+}
+
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	if os.Getenv("HELPER_EXIT_CODE") != "0" {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestWindowsFlushAfterSet(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []WindowsOption
+		exitCode      int
+		expectedCalls int
+	}{
+		{name: "flush by default", expectedCalls: 1},
+		{name: "flush failure is not fatal", exitCode: 1, expectedCalls: 1},
+		{name: "no flush", opts: []WindowsOption{WithNoFlush()}, expectedCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			orig := execCommand
+			execCommand = fakeExecCommand(t, &calls, tt.exitCode)
+			defer func() { execCommand = orig }()
+
+			w := &WindowsDNSConfigurator{guid: "{test}"}
+			for _, opt := range tt.opts {
+				opt(w)
+			}
+			w.flushAfterSet()
+
+			if len(calls) != tt.expectedCalls {
+				t.Fatalf("Expected %d flush calls, got %d: %v", tt.expectedCalls, len(calls), calls)
+			}
+			if len(calls) == 1 && calls[0] != "[ipconfig /flushdns]" {
+				t.Errorf("Expected ipconfig /flushdns, got %s", calls[0])
+			}
+		})
+	}
+}
+
+func TestFlushWindowsDNSCacheError(t *testing.T) {
+	var calls []string
+	orig := execCommand
+	execCommand = fakeExecCommand(t, &calls, 1)
+	defer func() { execCommand = orig }()
+
+	if err := FlushWindowsDNSCache(); err == nil {
+		t.Errorf("Expected error when ipconfig fails")
+	}
+}
+
+func TestWindowsRenderPreview(t *testing.T) {
+	servers := []netip.Addr{netip.MustParseAddr("100.96.128.1")}
+
+	w := &WindowsDNSConfigurator{guid: "{test}"}
+	preview := w.renderPreview(servers, []string{"corp.example.com"})
+	if !strings.Contains(preview, `\{test}\NameServer = 100.96.128.1`) {
+		t.Errorf("Expected the NameServer write in the preview, got:\n%s", preview)
+	}
+	if !strings.Contains(preview, "ipconfig /flushdns") {
+		t.Errorf("Expected the preview to mention ipconfig /flushdns, got:\n%s", preview)
+	}
+
+	WithNoFlush()(w)
+	if preview := w.renderPreview(servers, nil); strings.Contains(preview, "flush") {
+		t.Errorf("Expected no flush in the preview with WithNoFlush, got:\n%s", preview)
+	}
+}
@@ -0,0 +1,247 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fosrl/newt/logger"
+)
+
+const (
+	procVersionPath   = "/proc/version"
+	wslConfPath       = "/etc/wsl.conf"
+	wslConfBackupPath = "/etc/wsl.conf.olm.bak"
+	// legacyWSLConfBackupPath is where older versions backed up wsl.conf
+	legacyWSLConfBackupPath = "/etc/wsl.conf.olm.backup"
+)
+
+// WSLDNSConfigurator manages DNS settings under WSL2, where Windows regenerates
+// /etc/resolv.conf on every session start. It disables the generation in
+// /etc/wsl.conf and then writes resolv.conf like the file configurator.
+// WSL must be restarted (wsl --shutdown) before the wsl.conf change takes effect.
+type WSLDNSConfigurator struct {
+	*FileDNSConfigurator
+	wslConfPath       string
+	wslConfBackupPath string
+}
+
+// NewWSLDNSConfigurator creates a new WSL2 DNS configurator
+func NewWSLDNSConfigurator(opts ...FileOption) (*WSLDNSConfigurator, error) {
+	// resolv.conf is usually a symlink into /mnt/wsl, which Windows owns
+	opts = append([]FileOption{WithSymlinkHandling(ReplaceSymlink)}, opts...)
+
+	file, err := NewFileDNSConfigurator(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WSLDNSConfigurator{
+		FileDNSConfigurator: file,
+		wslConfPath:         wslConfPath,
+		wslConfBackupPath:   wslConfBackupPath,
+	}
+	if err := w.restoreWSLConf(); err != nil {
+		return nil, fmt.Errorf("cleanup unclean shutdown: %w", err)
+	}
+	return w, nil
+}
+
+// Name returns the configurator name
+func (w *WSLDNSConfigurator) Name() string {
+	return "wsl-resolv.conf"
+}
+
+// SetDNS disables resolv.conf generation in wsl.conf and sets the DNS servers
+func (w *WSLDNSConfigurator) SetDNS(servers []netip.Addr) ([]netip.Addr, error) {
+	if err := w.disableGenerateResolvConf(); err != nil {
+		return nil, fmt.Errorf("update wsl.conf: %w", err)
+	}
+
+	return w.FileDNSConfigurator.SetDNS(servers)
+}
+
+// RestoreDNS restores the original resolv.conf and wsl.conf
+func (w *WSLDNSConfigurator) RestoreDNS() error {
+	if err := w.FileDNSConfigurator.RestoreDNS(); err != nil {
+		return err
+	}
+
+	return w.restoreWSLConf()
+}
+
+// DiscardBackup keeps the current resolv.conf and removes its backup, see
+// BackupDiscarder. wsl.conf is restored, since it holds no DNS servers.
+func (w *WSLDNSConfigurator) DiscardBackup() error {
+	if err := w.FileDNSConfigurator.DiscardBackup(); err != nil {
+		return err
+	}
+
+	return w.restoreWSLConf()
+}
+
+// ValidateConfig checks that resolv.conf and wsl.conf can be written
+func (w *WSLDNSConfigurator) ValidateConfig() error {
+	if err := w.FileDNSConfigurator.ValidateConfig(); err != nil {
+		return err
+	}
+
+	if err := checkFileWritable(w.wslConfPath); err != nil {
+		return err
+	}
+	return checkDirWritable(filepath.Dir(w.wslConfBackupPath))
+}
+
+// CleanupUncleanShutdown restores resolv.conf and wsl.conf left over from a previous crash
+func (w *WSLDNSConfigurator) CleanupUncleanShutdown() error {
+	if err := w.FileDNSConfigurator.CleanupUncleanShutdown(); err != nil {
+		return err
+	}
+
+	return w.restoreWSLConf()
+}
+
+// disableGenerateResolvConf backs up wsl.conf and sets generateResolvConf = false
+func (w *WSLDNSConfigurator) disableGenerateResolvConf() error {
+	content, err := os.ReadFile(w.wslConfPath)
+	if err != nil {
+		return fmt.Errorf("read wsl.conf: %w", err)
+	}
+
+	updated := setWSLGenerateResolvConf(string(content))
+	if updated == string(content) {
+		// Already disabled by the user, nothing to change or restore
+		return nil
+	}
+
+	if _, err := os.Stat(w.wslConfBackupPath); err != nil {
+		if err := copyFile(w.wslConfPath, w.wslConfBackupPath); err != nil {
+			return fmt.Errorf("backup wsl.conf: %w", err)
+		}
+	}
+
+	info, err := os.Stat(w.wslConfPath)
+	if err != nil {
+		return fmt.Errorf("stat wsl.conf: %w", err)
+	}
+	if err := os.WriteFile(w.wslConfPath, []byte(updated), info.Mode()); err != nil {
+		return fmt.Errorf("write wsl.conf: %w", err)
+	}
+
+	logger.Info("Disabled resolv.conf generation in %s, restart WSL (wsl --shutdown) for this to persist across sessions", w.wslConfPath)
+	return nil
+}
+
+// restoreWSLConf restores wsl.conf from the backup if we modified it
+func (w *WSLDNSConfigurator) restoreWSLConf() error {
+	if _, err := os.Stat(w.wslConfBackupPath); err != nil {
+		return nil
+	}
+
+	if err := copyFile(w.wslConfBackupPath, w.wslConfPath); err != nil {
+		return fmt.Errorf("restore wsl.conf: %w", err)
+	}
+	if err := os.Remove(w.wslConfBackupPath); err != nil {
+		return fmt.Errorf("remove wsl.conf backup: %w", err)
+	}
+
+	logger.Info("Restored %s, restart WSL (wsl --shutdown) for resolv.conf generation to resume", w.wslConfPath)
+	return nil
+}
+
+// setWSLGenerateResolvConf returns wsl.conf content with generateResolvConf = false
+// in the [network] section, adding the key or section if needed
+func setWSLGenerateResolvConf(content string) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	inNetwork := false
+	networkEnd := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inNetwork = strings.EqualFold(trimmed, "[network]")
+			if inNetwork {
+				networkEnd = i + 1
+			}
+			continue
+		}
+		if !inNetwork {
+			continue
+		}
+		networkEnd = i + 1
+
+		key, value, found := strings.Cut(trimmed, "=")
+		if found && strings.EqualFold(strings.TrimSpace(key), "generateResolvConf") {
+			if strings.EqualFold(strings.TrimSpace(value), "false") {
+				return content
+			}
+			lines[i] = "generateResolvConf = false"
+			return strings.Join(lines, "\n") + "\n"
+		}
+	}
+
+	if networkEnd == -1 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "[network]", "generateResolvConf = false")
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	lines = append(lines[:networkEnd], append([]string{"generateResolvConf = false"}, lines[networkEnd:]...)...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// IsWSL2 reports whether we are running under WSL2 with a wsl.conf to manage
+func IsWSL2() bool {
+	return isWSL2(procVersionPath, wslConfPath)
+}
+
+func isWSL2(versionPath, confPath string) bool {
+	version, err := os.ReadFile(versionPath)
+	if err != nil || !strings.Contains(strings.ToLower(string(version)), "microsoft") {
+		return false
+	}
+
+	_, err = os.Stat(confPath)
+	return err == nil
+}
+
+// CleanupStaleWSLDNS restores wsl.conf from a backup left by a previous session,
+// including one at the path used by older versions
+func CleanupStaleWSLDNS() error {
+	for _, backupPath := range []string{wslConfBackupPath, legacyWSLConfBackupPath} {
+		w := &WSLDNSConfigurator{
+			wslConfPath:       wslConfPath,
+			wslConfBackupPath: backupPath,
+		}
+		if err := w.restoreWSLConf(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DetectStaleWSLDNS reports a wsl.conf backup left by a previous session
+func DetectStaleWSLDNS() []StaleEntry {
+	return append(detectStaleWSLDNS(wslConfBackupPath), detectStaleWSLDNS(legacyWSLConfBackupPath)...)
+}
+
+func detectStaleWSLDNS(backupPath string) []StaleEntry {
+	if _, err := os.Stat(backupPath); err != nil {
+		return nil
+	}
+
+	return []StaleEntry{{
+		Manager:     "wsl",
+		Description: "wsl.conf backup from a previous session would be restored",
+		Path:        backupPath,
+	}}
+}
@@ -0,0 +1,108 @@
+//go:build (linux && !android) || freebsd
+
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetWSLGenerateResolvConf(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "empty file",
+			content:  "",
+			expected: "[network]\ngenerateResolvConf = false\n",
+		},
+		{
+			name:     "other section",
+			content:  "[boot]\nsystemd=true\n",
+			expected: "[boot]\nsystemd=true\n\n[network]\ngenerateResolvConf = false\n",
+		},
+		{
+			name:     "network section without key",
+			content:  "[network]\nhostname=dev\n[boot]\nsystemd=true\n",
+			expected: "[network]\nhostname=dev\ngenerateResolvConf = false\n[boot]\nsystemd=true\n",
+		},
+		{
+			name:     "key enabled",
+			content:  "[network]\ngenerateResolvConf=true\n",
+			expected: "[network]\ngenerateResolvConf = false\n",
+		},
+		{
+			name:     "already disabled",
+			content:  "[network]\ngenerateResolvConf = false\n",
+			expected: "[network]\ngenerateResolvConf = false\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setWSLGenerateResolvConf(tt.content); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsWSL2(t *testing.T) {
+	dir := t.TempDir()
+	versionPath := filepath.Join(dir, "version")
+	confPath := filepath.Join(dir, "wsl.conf")
+
+	if err := os.WriteFile(versionPath, []byte("Linux version 5.15.167.4-microsoft-standard-WSL2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write version: %v", err)
+	}
+	if isWSL2(versionPath, confPath) {
+		t.Errorf("Expected false without wsl.conf")
+	}
+
+	if err := os.WriteFile(confPath, []byte("[boot]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write wsl.conf: %v", err)
+	}
+	if !isWSL2(versionPath, confPath) {
+		t.Errorf("Expected true with microsoft kernel and wsl.conf")
+	}
+
+	if err := os.WriteFile(versionPath, []byte("Linux version 6.8.0-generic\n"), 0644); err != nil {
+		t.Fatalf("Failed to write version: %v", err)
+	}
+	if isWSL2(versionPath, confPath) {
+		t.Errorf("Expected false on a non-WSL kernel")
+	}
+}
+
+func TestWSLDNSConfiguratorRestoresWSLConf(t *testing.T) {
+	original := "[boot]\nsystemd=true\n"
+	dir := t.TempDir()
+	w := &WSLDNSConfigurator{
+		FileDNSConfigurator: newTestFileDNSConfigurator(t, "nameserver 172.20.0.1\n"),
+		wslConfPath:         filepath.Join(dir, "wsl.conf"),
+		wslConfBackupPath:   filepath.Join(dir, "wsl.conf.olm.bak"),
+	}
+	if err := os.WriteFile(w.wslConfPath, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write wsl.conf: %v", err)
+	}
+
+	if err := w.disableGenerateResolvConf(); err != nil {
+		t.Fatalf("disableGenerateResolvConf failed: %v", err)
+	}
+	if content, _ := os.ReadFile(w.wslConfPath); string(content) == original {
+		t.Errorf("Expected wsl.conf to be modified")
+	}
+
+	if err := w.restoreWSLConf(); err != nil {
+		t.Fatalf("restoreWSLConf failed: %v", err)
+	}
+	if content, _ := os.ReadFile(w.wslConfPath); string(content) != original {
+		t.Errorf("Expected wsl.conf to be restored to %q, got %q", original, content)
+	}
+	if _, err := os.Stat(w.wslConfBackupPath); !os.IsNotExist(err) {
+		t.Errorf("Expected wsl.conf backup to be removed")
+	}
+}
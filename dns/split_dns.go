@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// SplitDNSRule routes queries for a domain suffix to dedicated upstream servers
+type SplitDNSRule struct {
+	Suffix   string       `json:"suffix"`
+	Upstream []netip.Addr `json:"upstream"`
+}
+
+// SplitDNSConfig holds the split DNS rules, sorted by suffix length descending
+// so the most specific suffix is matched first
+type SplitDNSConfig struct {
+	Rules []SplitDNSRule `json:"rules"`
+}
+
+// normalize validates the rules, lowercases and fully qualifies each suffix
+// and sorts them by suffix length descending
+func (c SplitDNSConfig) normalize() (SplitDNSConfig, error) {
+	rules := make([]SplitDNSRule, 0, len(c.Rules))
+	for _, rule := range c.Rules {
+		suffix := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(rule.Suffix), "."))
+		if suffix == "" {
+			return SplitDNSConfig{}, fmt.Errorf("split DNS rule has an empty suffix")
+		}
+		if len(rule.Upstream) == 0 {
+			return SplitDNSConfig{}, fmt.Errorf("split DNS rule for %s has no upstream servers", suffix)
+		}
+
+		rules = append(rules, SplitDNSRule{
+			Suffix:   dns.Fqdn(suffix),
+			Upstream: append([]netip.Addr(nil), rule.Upstream...),
+		})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Suffix) > len(rules[j].Suffix)
+	})
+
+	return SplitDNSConfig{Rules: rules}, nil
+}
+
+// match returns the most specific rule whose suffix matches name
+func (c SplitDNSConfig) match(name string) (SplitDNSRule, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+	for _, rule := range c.Rules {
+		if name == rule.Suffix || strings.HasSuffix(name, "."+rule.Suffix) {
+			return rule, true
+		}
+	}
+	return SplitDNSRule{}, false
+}
+
+// Upstreams returns the unique upstream servers across all rules
+func (c SplitDNSConfig) Upstreams() []netip.Addr {
+	seen := make(map[netip.Addr]bool)
+	var upstreams []netip.Addr
+	for _, rule := range c.Rules {
+		for _, addr := range rule.Upstream {
+			if !seen[addr] {
+				seen[addr] = true
+				upstreams = append(upstreams, addr)
+			}
+		}
+	}
+	return upstreams
+}
+
+// SetSplitDNS replaces the split DNS rules used to pick upstream servers
+func (p *DNSProxy) SetSplitDNS(cfg SplitDNSConfig) error {
+	normalized, err := cfg.normalize()
+	if err != nil {
+		return err
+	}
+
+	p.splitDNSLock.Lock()
+	p.splitDNS = normalized
+	p.splitDNSLock.Unlock()
+
+	return nil
+}
+
+// GetSplitDNS returns a copy of the current split DNS rules
+func (p *DNSProxy) GetSplitDNS() SplitDNSConfig {
+	p.splitDNSLock.RLock()
+	defer p.splitDNSLock.RUnlock()
+
+	rules := make([]SplitDNSRule, len(p.splitDNS.Rules))
+	for i, rule := range p.splitDNS.Rules {
+		rules[i] = SplitDNSRule{
+			Suffix:   rule.Suffix,
+			Upstream: append([]netip.Addr(nil), rule.Upstream...),
+		}
+	}
+	return SplitDNSConfig{Rules: rules}
+}
+
+// upstreamsFor returns the upstream servers for name, using a matching split
+// DNS rule if there is one and the default upstream servers otherwise
+func (p *DNSProxy) upstreamsFor(name string) []string {
+	p.splitDNSLock.RLock()
+	rule, ok := p.splitDNS.match(name)
+	p.splitDNSLock.RUnlock()
+
+	if !ok {
+		return p.upstreamDNS
+	}
+
+	servers := make([]string, 0, len(rule.Upstream))
+	for _, addr := range rule.Upstream {
+		servers = append(servers, net.JoinHostPort(addr.String(), strconv.Itoa(DNSPort)))
+	}
+	return servers
+}
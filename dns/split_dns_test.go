@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestSplitDNSMatch(t *testing.T) {
+	corp := netip.MustParseAddr("10.0.0.53")
+	eng := netip.MustParseAddr("10.1.0.53")
+
+	proxy := &DNSProxy{upstreamDNS: []string{"8.8.8.8:53"}}
+	err := proxy.SetSplitDNS(SplitDNSConfig{Rules: []SplitDNSRule{
+		{Suffix: ".corp.internal", Upstream: []netip.Addr{corp}},
+		{Suffix: "eng.corp.internal.", Upstream: []netip.Addr{eng}},
+	}})
+	if err != nil {
+		t.Fatalf("SetSplitDNS failed: %v", err)
+	}
+
+	// Rules should be normalized and sorted by suffix length descending
+	rules := proxy.GetSplitDNS().Rules
+	if len(rules) != 2 || rules[0].Suffix != "eng.corp.internal." || rules[1].Suffix != "corp.internal." {
+		t.Fatalf("Expected rules sorted by suffix length, got %v", rules)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "suffix match", query: "host.corp.internal.", expected: "10.0.0.53:53"},
+		{name: "exact suffix", query: "corp.internal.", expected: "10.0.0.53:53"},
+		{name: "most specific wins", query: "build.eng.corp.internal.", expected: "10.1.0.53:53"},
+		{name: "case insensitive", query: "HOST.Corp.Internal.", expected: "10.0.0.53:53"},
+		{name: "label boundary", query: "notcorp.internal.", expected: "8.8.8.8:53"},
+		{name: "default upstream", query: "example.com.", expected: "8.8.8.8:53"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreams := proxy.upstreamsFor(tt.query)
+			if len(upstreams) != 1 || upstreams[0] != tt.expected {
+				t.Errorf("Expected [%s], got %v", tt.expected, upstreams)
+			}
+		})
+	}
+}
+
+func TestSplitDNSValidation(t *testing.T) {
+	proxy := &DNSProxy{}
+
+	if err := proxy.SetSplitDNS(SplitDNSConfig{Rules: []SplitDNSRule{{Suffix: "", Upstream: []netip.Addr{netip.MustParseAddr("10.0.0.53")}}}}); err == nil {
+		t.Errorf("Expected error for empty suffix")
+	}
+	if err := proxy.SetSplitDNS(SplitDNSConfig{Rules: []SplitDNSRule{{Suffix: "corp.internal"}}}); err == nil {
+		t.Errorf("Expected error for rule without upstream")
+	}
+}
+
+func TestSplitDNSUpstreams(t *testing.T) {
+	a := netip.MustParseAddr("10.0.0.53")
+	b := netip.MustParseAddr("10.1.0.53")
+
+	cfg := SplitDNSConfig{Rules: []SplitDNSRule{
+		{Suffix: "a.internal.", Upstream: []netip.Addr{a, b}},
+		{Suffix: "b.internal.", Upstream: []netip.Addr{b}},
+	}}
+
+	upstreams := cfg.Upstreams()
+	if len(upstreams) != 2 || upstreams[0] != a || upstreams[1] != b {
+		t.Errorf("Expected [%s %s], got %v", a, b, upstreams)
+	}
+}
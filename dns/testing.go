@@ -0,0 +1,55 @@
+//go:build dnstest
+
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// NewTestDNSProxy starts a DNSProxy answering on a UDP socket at 127.0.0.1 for tests in
+// other packages and returns it with its listen address, which ListenAddr also reports.
+// The proxy uses host networking instead of a netstack and is stopped when the test
+// ends. Names without local records are forwarded to an unreachable upstream and get
+// no answer.
+// It is only built with the dnstest build tag: go test -tags dnstest
+func NewTestDNSProxy(t testing.TB, opts ...DNSProxyOption) (*DNSProxy, string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for DNS queries: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &DNSProxy{
+		proxyIP:           netip.MustParseAddr("127.0.0.1"),
+		upstreamDNS:       []string{"127.0.0.1:1"},
+		recordStore:       NewDNSRecordStore(),
+		tunnelActivePorts: make(map[uint16]bool),
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.listenPort = uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+	p.listenAddr.Store(conn.LocalAddr().String())
+
+	// Closing the socket on stop unblocks the pending read
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.serveDNS(conn)
+	}()
+
+	t.Cleanup(p.Stop)
+	return p, conn.LocalAddr().String()
+}
@@ -198,6 +198,7 @@ func (o *Olm) handleConnect(msg websocket.WSMessage) {
 
 	if o.tunnelConfig.OverrideDNS {
 		// Set up DNS override to use our DNS proxy
+		// Split DNS upstreams stay behind the proxy, which routes queries to them by suffix
 		if err := dnsOverride.SetupDNSOverride(o.tunnelConfig.InterfaceName, o.dnsProxy.GetProxyIP()); err != nil {
 			logger.Error("Failed to setup DNS override: %v", err)
 			return
@@ -2,10 +2,12 @@ package olm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"net/netip"
 	"os"
 	"sync"
 	"time"
@@ -285,6 +287,68 @@ func (o *Olm) registerAPICallbacks() {
 			return o.SetPowerMode(req.Mode)
 		},
 	)
+
+	o.apiServer.SetDNSStaleHandler(func() (any, error) {
+		var interfaceNames []string
+		if o.tunnelConfig.InterfaceName != "" {
+			interfaceNames = append(interfaceNames, o.tunnelConfig.InterfaceName)
+		}
+
+		entries, err := dnsOverride.CleanupStaleStateDryRun(interfaceNames...)
+		if err != nil {
+			return nil, err
+		}
+		if entries == nil {
+			entries = []dnsOverride.StaleEntry{}
+		}
+		return entries, nil
+	})
+
+	o.apiServer.SetClientHistoryHandler(func(clientIP netip.Addr, n int) (any, error) {
+		if o.dnsProxy == nil {
+			return nil, fmt.Errorf("DNS proxy is not running")
+		}
+
+		entries := o.dnsProxy.GetClientHistory(clientIP, n)
+		if entries == nil {
+			entries = []dns.QueryLogEntry{}
+		}
+		return entries, nil
+	})
+
+	o.apiServer.SetStatsHandlers(
+		func() (any, error) {
+			if o.dnsProxy == nil {
+				return nil, fmt.Errorf("DNS proxy is not running")
+			}
+			return o.dnsProxy.Stats(), nil
+		},
+		func() error {
+			if o.dnsProxy == nil {
+				return fmt.Errorf("DNS proxy is not running")
+			}
+			o.dnsProxy.ResetStats()
+			return nil
+		},
+	)
+
+	o.apiServer.SetOverlapCheckHandler(func() (any, error) {
+		if o.dnsProxy == nil {
+			return nil, fmt.Errorf("DNS proxy is not running")
+		}
+		return map[string][]dns.WildcardOverlap{
+			"A":    o.dnsProxy.DetectWildcardOverlaps(dns.RecordTypeA),
+			"AAAA": o.dnsProxy.DetectWildcardOverlaps(dns.RecordTypeAAAA),
+		}, nil
+	})
+
+	o.apiServer.SetQueryStreamHandler(func(w http.ResponseWriter, r *http.Request) {
+		if o.dnsProxy == nil {
+			http.Error(w, "DNS proxy is not running", http.StatusInternalServerError)
+			return
+		}
+		o.dnsProxy.QueryStreamHandler().ServeHTTP(w, r)
+	})
 }
 
 func (o *Olm) StartTunnel(config TunnelConfig) {
@@ -527,7 +591,7 @@ func (o *Olm) Close() {
 
 	// Restore original DNS configuration
 	// we do this first to avoid any DNS issues if something else gets stuck
-	if err := dnsOverride.RestoreDNSOverride(); err != nil {
+	if err := dnsOverride.RestoreDNSOverride(); err != nil && !errors.Is(err, dnsOverride.ErrOverrideNotActive) {
 		logger.Error("Failed to restore DNS: %v", err)
 	}
 
@@ -144,7 +144,14 @@ func (pm *PeerManager) AddPeer(siteConfig SiteConfig) error {
 		if address == nil {
 			continue
 		}
-		pm.dnsProxy.AddDNSRecord(alias.Alias, address)
+		added, err := pm.dnsProxy.AddDNSRecord(alias.Alias, address)
+		if err != nil {
+			logger.Error("Failed to add DNS record for alias %s: %v", alias.Alias, err)
+			continue
+		}
+		if added {
+			logger.Info("New peer alias registered: %s -> %s (site %d)", alias.Alias, address, siteConfig.SiteId)
+		}
 	}
 
 	monitorAddress := strings.Split(siteConfig.ServerIP, "/")[0]